@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// AuditEventType is the kind of event recorded in the audit log
+type AuditEventType string
+
+const (
+	// AuditEventBid is a valid bid received from a relay by getHeader
+	AuditEventBid AuditEventType = "bid"
+	// AuditEventConstraintSubmitted is a signed constraints message accepted by a relay
+	AuditEventConstraintSubmitted AuditEventType = "constraint_submitted"
+	// AuditEventPayloadUnblinded is a payload returned by a relay for a signed blinded block
+	AuditEventPayloadUnblinded AuditEventType = "payload_unblinded"
+)
+
+// AuditEntry is a record of the audit log, see EmitAuditLog
+type AuditEntry struct {
+	EventType AuditEventType `json:"event_type"`
+	Slot      uint64         `json:"slot"`
+	RelayURL  string         `json:"relay_url"`
+	BlockHash string         `json:"block_hash,omitempty"`
+	BidValue  string         `json:"bid_value,omitempty"` // in wei
+	Timestamp time.Time      `json:"timestamp"`
+}
+
+// recordAuditEntry adds an entry to the audit log, timestamped with the service clock
+func (m *BoostService) recordAuditEntry(entry AuditEntry) {
+	entry.Timestamp = m.now().UTC()
+
+	m.auditLogLock.Lock()
+	defer m.auditLogLock.Unlock()
+	m.auditLog = append(m.auditLog, entry)
+}
+
+// EmitAuditLog writes the bids received, constraints submitted and payloads unblinded since the previous call,
+// as one JSON record per line in the order they happened. The written entries are removed from the log.
+func (m *BoostService) EmitAuditLog(w io.Writer) error {
+	m.auditLogLock.Lock()
+	defer m.auditLogLock.Unlock()
+
+	encoder := json.NewEncoder(w)
+	for i, entry := range m.auditLog {
+		if err := encoder.Encode(entry); err != nil {
+			// Keep the entries which were not written
+			m.auditLog = m.auditLog[i:]
+			return err
+		}
+	}
+	m.auditLog = nil
+	return nil
+}
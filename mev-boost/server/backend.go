@@ -9,6 +9,21 @@ const (
 	pathGetHeaderWithProofs = "/eth/v1/builder/header_with_proofs/{slot:[0-9]+}/{parent_hash:0x[a-fA-F0-9]+}/{pubkey:0x[a-fA-F0-9]+}"
 	pathGetPayload          = "/eth/v1/builder/blinded_blocks"
 
+	// BOLT: relay paths
+	pathConstraints      = "/relay/v1/builder/constraints"
+	pathDeleteConstraint = "/relay/v1/builder/constraints"
+	pathConstraintStatus = "/relay/v1/builder/constraints/status"
+	pathConstraintStream = "/ws/constraints"
+	pathCapabilities     = "/relay/v1/builder/capabilities"
+	pathConstraintTypes  = "/relay/v1/builder/constraint_types"
+
+	pathGetConstraintProof = "/relay/v1/builder/constraint_proof"
+	pathPayloadAttestation = "/relay/v1/builder/payload_attestation"
+	pathBoltOptIn          = "/relay/v1/builder/bolt/opt_in"
+
+	// Mock relay paths
+	pathRegisteredValidators = "/relay/v1/builder/validators"
+
 	// // Relay Monitor paths
 	// pathAuctionTranscript = "/monitor/v1/transcript"
 )
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"sync"
+	"time"
+)
+
+// CircuitState is the state of the circuit breaker of a relay
+type CircuitState int
+
+const (
+	// CircuitClosed means requests are sent to the relay
+	CircuitClosed CircuitState = iota
+	// CircuitOpen means the relay failed repeatedly, and requests to it are skipped
+	CircuitOpen
+	// CircuitHalfOpen means the open period is over, and a single trial request decides whether to close the circuit
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// relayCircuit is the circuit breaker state of a single relay
+type relayCircuit struct {
+	state         CircuitState
+	failures      int       // consecutive failures since firstFailure
+	firstFailure  time.Time // start of the current failure window
+	openedAt      time.Time
+	trialInFlight bool // a half-open trial request is in flight
+}
+
+// circuitBreaker stops sending requests to a relay after failureThreshold consecutive failures within window,
+// for openDuration. A single trial request is then let through: the circuit closes again if it succeeds,
+// and opens again if it fails.
+type circuitBreaker struct {
+	mu       sync.Mutex
+	circuits map[string]*relayCircuit
+
+	failureThreshold int
+	window           time.Duration
+	openDuration     time.Duration
+
+	now func() time.Time
+}
+
+func newCircuitBreaker(failureThreshold int, window, openDuration time.Duration) *circuitBreaker {
+	return &circuitBreaker{
+		circuits:         make(map[string]*relayCircuit),
+		failureThreshold: failureThreshold,
+		window:           window,
+		openDuration:     openDuration,
+		now:              time.Now,
+	}
+}
+
+// circuit returns the circuit of the relay, creating it if needed. b.mu must be held.
+func (b *circuitBreaker) circuit(relay RelayEntry) *relayCircuit {
+	key := relay.String()
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &relayCircuit{state: CircuitClosed}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+// resetRelays drops the circuits of the relays not in the list, and starts closed circuits for the new ones
+func (b *circuitBreaker) resetRelays(relays []RelayEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	circuits := make(map[string]*relayCircuit, len(relays))
+	for _, relay := range relays {
+		key := relay.String()
+		if c, ok := b.circuits[key]; ok {
+			circuits[key] = c
+		} else {
+			circuits[key] = &relayCircuit{state: CircuitClosed}
+		}
+	}
+	b.circuits = circuits
+}
+
+// allow returns whether a request may be sent to the relay. Every allowed request must be followed
+// by a call to recordSuccess or recordFailure.
+func (b *circuitBreaker) allow(relay RelayEntry) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(relay)
+	switch c.state {
+	case CircuitOpen:
+		if b.now().Sub(c.openedAt) < b.openDuration {
+			return false
+		}
+		c.state = CircuitHalfOpen
+		c.trialInFlight = true
+		return true
+	case CircuitHalfOpen:
+		// Only a single trial request at a time
+		if c.trialInFlight {
+			return false
+		}
+		c.trialInFlight = true
+		return true
+	case CircuitClosed:
+	}
+	return true
+}
+
+// recordSuccess closes the circuit of the relay
+func (b *circuitBreaker) recordSuccess(relay RelayEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(relay)
+	c.state = CircuitClosed
+	c.failures = 0
+	c.trialInFlight = false
+}
+
+// recordFailure counts a failed request to the relay, and opens its circuit if the threshold is reached
+// or if the failed request was the half-open trial
+func (b *circuitBreaker) recordFailure(relay RelayEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.now()
+	c := b.circuit(relay)
+	if c.state == CircuitHalfOpen {
+		c.state = CircuitOpen
+		c.openedAt = now
+		c.trialInFlight = false
+		return
+	}
+
+	// Restart counting if the previous failures are outside of the window
+	if c.failures == 0 || now.Sub(c.firstFailure) > b.window {
+		c.failures = 0
+		c.firstFailure = now
+	}
+	c.failures++
+
+	if c.failures >= b.failureThreshold {
+		c.state = CircuitOpen
+		c.openedAt = now
+		c.failures = 0
+	}
+}
+
+// state returns the state of the circuit of the relay. An open circuit whose open period is over is reported
+// as half-open, since the next request will be let through.
+func (b *circuitBreaker) state(relay RelayEntry) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(relay)
+	if c.state == CircuitOpen && b.now().Sub(c.openedAt) >= b.openDuration {
+		return CircuitHalfOpen
+	}
+	return c.state
+}
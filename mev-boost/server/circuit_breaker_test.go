@@ -0,0 +1,72 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircuitBreakerFailureWindow(t *testing.T) {
+	relay, err := NewRelayEntry("http://0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249@localhost:12345")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		failureDelays []time.Duration // delay before each failure
+		expectedState CircuitState
+	}{
+		{
+			name:          "Failures within the window open the circuit",
+			failureDelays: []time.Duration{0, time.Second, time.Second},
+			expectedState: CircuitOpen,
+		},
+		{
+			name:          "Too few failures keep the circuit closed",
+			failureDelays: []time.Duration{0, time.Second},
+			expectedState: CircuitClosed,
+		},
+		{
+			name:          "Failures spread over more than the window keep the circuit closed",
+			failureDelays: []time.Duration{0, 6 * time.Second, 6 * time.Second},
+			expectedState: CircuitClosed,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Unix(1700000000, 0)
+			breaker := newCircuitBreaker(3, 10*time.Second, time.Minute)
+			breaker.now = func() time.Time { return now }
+
+			for _, delay := range tt.failureDelays {
+				now = now.Add(delay)
+				require.True(t, breaker.allow(relay))
+				breaker.recordFailure(relay)
+			}
+			require.Equal(t, tt.expectedState, breaker.state(relay))
+		})
+	}
+
+	t.Run("Success resets the failure count", func(t *testing.T) {
+		breaker := newCircuitBreaker(2, time.Minute, time.Minute)
+		breaker.recordFailure(relay)
+		breaker.recordSuccess(relay)
+		breaker.recordFailure(relay)
+		require.Equal(t, CircuitClosed, breaker.state(relay))
+	})
+
+	t.Run("Only one trial request while half-open", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		breaker := newCircuitBreaker(1, time.Minute, time.Minute)
+		breaker.now = func() time.Time { return now }
+
+		breaker.recordFailure(relay)
+		require.False(t, breaker.allow(relay))
+
+		now = now.Add(time.Minute)
+		require.Equal(t, CircuitHalfOpen, breaker.state(relay))
+		require.True(t, breaker.allow(relay))
+		require.False(t, breaker.allow(relay))
+	})
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// ConnectionTestResult is the result of TestConnection, with the latency and error of each step of a request
+// to the relay. The steps after the first failed one are not run, and their latency and error are left zero.
+type ConnectionTestResult struct {
+	Relay RelayEntry
+
+	DNSLatency time.Duration
+	DNSError   error
+
+	TCPLatency time.Duration
+	TCPError   error
+
+	// The TLS handshake is skipped for relays using http
+	TLSLatency time.Duration
+	TLSError   error
+
+	// Latency of a GET request to the status endpoint, sent with the HTTP client used for the other requests
+	// to the relay. It may reuse a pooled connection, in which case it excludes the connection setup.
+	HTTPLatency time.Duration
+	HTTPError   error
+}
+
+// OK returns whether all the steps of the connection test succeeded
+func (r ConnectionTestResult) OK() bool {
+	return r.DNSError == nil && r.TCPError == nil && r.TLSError == nil && r.HTTPError == nil
+}
+
+// TestConnection checks the connectivity to the relay step by step, to tell where a failing relay breaks down:
+// DNS resolution of its host, TCP connection, TLS handshake for https relays, and status request.
+func (m *BoostService) TestConnection(ctx context.Context, relay RelayEntry) ConnectionTestResult {
+	result := ConnectionTestResult{Relay: relay}
+	log := m.log.WithField("url", relay.String())
+
+	host := relay.URL.Hostname()
+	port := relay.URL.Port()
+	if port == "" {
+		port = "80"
+		if relay.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	start := m.now()
+	addrs, err := net.DefaultResolver.LookupHost(ctx, host)
+	result.DNSLatency = m.now().Sub(start)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("%w: %s", errNoAddress, host)
+	}
+	if err != nil {
+		log.WithError(err).Warn("relay connection test failed: DNS resolution")
+		result.DNSError = err
+		return result
+	}
+
+	start = m.now()
+	dialer := net.Dialer{}
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(addrs[0], port))
+	result.TCPLatency = m.now().Sub(start)
+	if err != nil {
+		log.WithError(err).Warn("relay connection test failed: TCP connection")
+		result.TCPError = err
+		return result
+	}
+	defer conn.Close()
+
+	if relay.URL.Scheme == "https" {
+		start = m.now()
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12})
+		err = tlsConn.HandshakeContext(ctx)
+		result.TLSLatency = m.now().Sub(start)
+		if err != nil {
+			log.WithError(err).Warn("relay connection test failed: TLS handshake")
+			result.TLSError = err
+			return result
+		}
+	}
+
+	start = m.now()
+	code, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientGetHeader, relay), http.MethodGet, relay.GetURI(pathStatus), "", nil, nil, nil)
+	result.HTTPLatency = m.now().Sub(start)
+	if err == nil && code != http.StatusOK {
+		err = fmt.Errorf("%w: %d", errHTTPErrorResponse, code)
+	}
+	if err != nil {
+		log.WithError(err).Warn("relay connection test failed: status request")
+		result.HTTPError = err
+	}
+	return result
+}
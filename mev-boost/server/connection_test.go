@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestConnection(t *testing.T) {
+	testCases := []struct {
+		name string
+		// prepare returns the relay to test, after setting up the failure mode
+		prepare   func(t *testing.T, relay *mockRelay) RelayEntry
+		failedAt  func(result ConnectionTestResult) error
+		dnsOK     bool
+		tcpOK     bool
+		tlsTested bool
+	}{
+		{
+			name: "DNS resolution failure",
+			prepare: func(t *testing.T, _ *mockRelay) RelayEntry {
+				t.Helper()
+				relay, err := NewRelayEntry("http://0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249@relay.invalid:12345")
+				require.NoError(t, err)
+				return relay
+			},
+			failedAt: func(result ConnectionTestResult) error { return result.DNSError },
+		},
+		{
+			name: "TCP connection failure",
+			prepare: func(_ *testing.T, relay *mockRelay) RelayEntry {
+				relay.Server.Close()
+				return relay.RelayEntry
+			},
+			failedAt: func(result ConnectionTestResult) error { return result.TCPError },
+			dnsOK:    true,
+		},
+		{
+			name: "TLS handshake failure",
+			prepare: func(t *testing.T, relay *mockRelay) RelayEntry {
+				t.Helper()
+				// The relay only serves plain HTTP
+				httpsRelay, err := NewRelayEntry(strings.Replace(relay.RelayEntry.String(), "http://", "https://", 1))
+				require.NoError(t, err)
+				return httpsRelay
+			},
+			failedAt:  func(result ConnectionTestResult) error { return result.TLSError },
+			dnsOK:     true,
+			tcpOK:     true,
+			tlsTested: true,
+		},
+		{
+			name: "Status request failure",
+			prepare: func(_ *testing.T, relay *mockRelay) RelayEntry {
+				relay.RequiredHeader = "X-API-Key"
+				return relay.RelayEntry
+			},
+			failedAt: func(result ConnectionTestResult) error { return result.HTTPError },
+			dnsOK:    true,
+			tcpOK:    true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 1, time.Second)
+			relay := tt.prepare(t, backend.relays[0])
+
+			result := backend.boost.TestConnection(context.Background(), relay)
+			require.Equal(t, relay, result.Relay)
+			require.False(t, result.OK())
+			require.Error(t, tt.failedAt(result))
+
+			if tt.dnsOK {
+				require.NoError(t, result.DNSError)
+			}
+			if tt.tcpOK {
+				require.NoError(t, result.TCPError)
+				require.Positive(t, result.TCPLatency)
+			}
+			if !tt.tlsTested {
+				require.NoError(t, result.TLSError)
+				require.Zero(t, result.TLSLatency)
+			}
+		})
+	}
+
+	t.Run("Successful connection", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		relay := backend.relays[0].RelayEntry
+
+		result := backend.boost.TestConnection(context.Background(), relay)
+		require.True(t, result.OK(), "%+v", result)
+		require.Positive(t, result.TCPLatency)
+		require.Positive(t, result.HTTPLatency)
+		require.Zero(t, result.TLSLatency)
+		require.Equal(t, 1, backend.relays[0].GetRequestCount(pathStatus))
+	})
+
+	t.Run("Status request failure is an HTTP error", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		backend.relays[0].RequiredHeader = "X-API-Key"
+
+		result := backend.boost.TestConnection(context.Background(), backend.relays[0].RelayEntry)
+		require.ErrorIs(t, result.HTTPError, errHTTPErrorResponse)
+	})
+}
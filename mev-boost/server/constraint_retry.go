@@ -0,0 +1,174 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// constraintRetryQueue keeps the constraint submissions which failed transiently on a relay, while they are retried
+// in the background. The delay before each retry doubles from baseDelay up to maxDelay, and a submission is dropped
+// after maxAttempts retries. New submissions are dropped while maxDepth of them are waiting.
+//
+// The retries are stopped on shutdown, and the retries to a relay when it is removed from the relay list.
+type constraintRetryQueue struct {
+	mu          sync.Mutex
+	depth       int                           // submissions waiting to be retried
+	ctx         context.Context               // cancelled on shutdown
+	cancel      context.CancelFunc            // cancels ctx
+	relayCancel map[string]context.CancelFunc // cancels the retries to each relay, by relay URL
+	relayCtx    map[string]context.Context    // context of the retries to each relay, by relay URL
+
+	baseDelay   time.Duration
+	maxDelay    time.Duration
+	maxAttempts int
+	maxDepth    int
+}
+
+func newConstraintRetryQueue() *constraintRetryQueue {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &constraintRetryQueue{
+		ctx:         ctx,
+		cancel:      cancel,
+		relayCancel: make(map[string]context.CancelFunc),
+		relayCtx:    make(map[string]context.Context),
+		baseDelay:   100 * time.Millisecond,
+		maxDelay:    2 * time.Second,
+		maxAttempts: 5,
+		maxDepth:    64,
+	}
+}
+
+// add reserves a place in the queue for a submission to the relay, and returns the context of its retries. It
+// returns false if the queue is full or stopped.
+func (q *constraintRetryQueue) add(relay RelayEntry) (context.Context, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.depth >= q.maxDepth || q.ctx.Err() != nil {
+		return nil, false
+	}
+	key := relay.String()
+	ctx, ok := q.relayCtx[key]
+	if !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(q.ctx)
+		q.relayCtx[key] = ctx
+		q.relayCancel[key] = cancel
+	}
+	q.depth++
+	return ctx, true
+}
+
+// done frees the place of a submission in the queue
+func (q *constraintRetryQueue) done() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.depth--
+}
+
+// removeRelays stops the retries to the relays which aren't in the given list
+func (q *constraintRetryQueue) removeRelays(kept []RelayEntry) {
+	keep := make(map[string]bool, len(kept))
+	for _, relay := range kept {
+		keep[relay.String()] = true
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for key, cancel := range q.relayCancel {
+		if !keep[key] {
+			cancel()
+			delete(q.relayCancel, key)
+			delete(q.relayCtx, key)
+		}
+	}
+}
+
+// stop stops all the retries
+func (q *constraintRetryQueue) stop() {
+	q.cancel()
+}
+
+// isTransientFailure returns whether a failed request may succeed if sent again: network errors, which come without
+// a status code, rate limiting and server errors
+func isTransientFailure(code int) bool {
+	return code == 0 || code == http.StatusTooManyRequests || code >= http.StatusInternalServerError
+}
+
+// ConstraintRetryQueueDepth returns the number of constraint submissions waiting to be retried on a relay
+func (m *BoostService) ConstraintRetryQueueDepth() int {
+	q := m.constraintRetries
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.depth
+}
+
+// retryConstraintSubmission queues the submission of the constraints to the relay, to be retried in the background
+// with exponential backoff. It is dropped once the constraints are for a past slot, or on a non-transient failure.
+func (m *BoostService) retryConstraintSubmission(log *logrus.Entry, relay RelayEntry, ua UserAgent, payload BatchedSignedConstraints) {
+	q := m.constraintRetries
+	ctx, ok := q.add(relay)
+	if !ok {
+		log.Warn("[BOLT]: constraint retry queue is full or stopped, dropping the submission")
+		return
+	}
+
+	go func() {
+		defer q.done()
+
+		url := relay.GetURI(pathSubmitConstraint)
+		delay := q.baseDelay
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		for attempt := 1; attempt <= q.maxAttempts; attempt++ {
+			select {
+			case <-ctx.Done():
+				log.Info("[BOLT]: constraint submission retries stopped")
+				return
+			case <-timer.C:
+			}
+
+			for _, signedConstraints := range payload {
+				if err := m.validateConstraintSlot(signedConstraints.Message.Slot); err != nil {
+					log.WithError(err).Warn("[BOLT]: dropping constraint submission retry")
+					return
+				}
+			}
+
+			code, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientSubmitConstraint, relay), http.MethodPost, url, ua, nil, payload, nil)
+			if err == nil {
+				log.WithField("attempt", attempt).Info("[BOLT]: constraint submission retry succeeded")
+				m.recordConstraintsSubmitted(relay, payload)
+				return
+			}
+			if ctx.Err() != nil {
+				log.Info("[BOLT]: constraint submission retries stopped")
+				return
+			}
+			if !isTransientFailure(code) {
+				log.WithError(err).Warn("[BOLT]: constraint submission retry failed, giving up")
+				return
+			}
+			log.WithError(err).WithField("attempt", attempt).Warn("[BOLT]: constraint submission retry failed")
+
+			delay = min(2*delay, q.maxDelay)
+			timer.Reset(delay)
+		}
+		log.Warnf("[BOLT]: constraint submission failed after %d retries, giving up", q.maxAttempts)
+	}()
+}
+
+// recordConstraintsSubmitted adds an audit entry for each signed constraints message accepted by the relay
+func (m *BoostService) recordConstraintsSubmitted(relay RelayEntry, payload BatchedSignedConstraints) {
+	for _, signedConstraints := range payload {
+		m.recordAuditEntry(AuditEntry{
+			EventType: AuditEventConstraintSubmitted,
+			Slot:      signedConstraints.Message.Slot,
+			RelayURL:  relay.String(),
+		})
+	}
+}
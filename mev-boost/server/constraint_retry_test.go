@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsTransientFailure(t *testing.T) {
+	require.True(t, isTransientFailure(0))
+	require.True(t, isTransientFailure(http.StatusTooManyRequests))
+	require.True(t, isTransientFailure(http.StatusInternalServerError))
+	require.True(t, isTransientFailure(http.StatusServiceUnavailable))
+	require.False(t, isTransientFailure(http.StatusOK))
+	require.False(t, isTransientFailure(http.StatusBadRequest))
+	require.False(t, isTransientFailure(http.StatusUnauthorized))
+}
+
+func TestConstraintRetryQueue(t *testing.T) {
+	slot := uint64(8978583)
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+
+	setup := func(t *testing.T, failures int, statusCode int) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 1, time.Second)
+		backend.boost.constraintRetries.baseDelay = 10 * time.Millisecond
+		relay := backend.relays[0]
+		relay.handlerOverrideSubmitConstraint = func(w http.ResponseWriter, req *http.Request) {
+			if failures > 0 {
+				failures--
+				w.WriteHeader(statusCode)
+				return
+			}
+			relay.defaultHandleSubmitConstraint(w, req)
+		}
+		return backend
+	}
+
+	t.Run("Constraints are delivered after transient failures", func(t *testing.T) {
+		backend := setup(t, 3, http.StatusServiceUnavailable)
+
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+
+		require.NoError(t, backend.relays[0].WaitForConstraintSubmission(phase0.Slot(slot), 2*time.Second))
+		require.Equal(t, 4, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+		require.Eventually(t, func() bool { return backend.boost.ConstraintRetryQueueDepth() == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Queue depth counts the pending submissions", func(t *testing.T) {
+		backend := setup(t, 1, http.StatusServiceUnavailable)
+		backend.boost.constraintRetries.baseDelay = 200 * time.Millisecond
+
+		backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, 1, backend.boost.ConstraintRetryQueueDepth())
+
+		require.NoError(t, backend.relays[0].WaitForConstraintSubmission(phase0.Slot(slot), 2*time.Second))
+		require.Eventually(t, func() bool { return backend.boost.ConstraintRetryQueueDepth() == 0 }, time.Second, 10*time.Millisecond)
+	})
+
+	t.Run("Submission is dropped after the maximum number of retries", func(t *testing.T) {
+		backend := setup(t, 100, http.StatusServiceUnavailable)
+		backend.boost.constraintRetries.maxAttempts = 2
+
+		backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Eventually(t, func() bool { return backend.boost.ConstraintRetryQueueDepth() == 0 }, time.Second, 10*time.Millisecond)
+		require.Equal(t, 3, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+	})
+
+	t.Run("Submissions are dropped when the queue is full", func(t *testing.T) {
+		backend := setup(t, 100, http.StatusServiceUnavailable)
+		backend.boost.constraintRetries.baseDelay = time.Second
+		backend.boost.constraintRetries.maxDepth = 1
+
+		backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, 1, backend.boost.ConstraintRetryQueueDepth())
+		require.NoError(t, backend.boost.Shutdown(context.Background()))
+	})
+
+	t.Run("Retries are stopped on shutdown", func(t *testing.T) {
+		backend := setup(t, 100, http.StatusServiceUnavailable)
+		backend.boost.constraintRetries.baseDelay = time.Second
+
+		backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, 1, backend.boost.ConstraintRetryQueueDepth())
+		require.NoError(t, backend.boost.Shutdown(context.Background()))
+		require.Eventually(t, func() bool { return backend.boost.ConstraintRetryQueueDepth() == 0 }, 100*time.Millisecond, 10*time.Millisecond)
+		require.Equal(t, 1, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+	})
+
+	t.Run("Retries are stopped when the relay is removed", func(t *testing.T) {
+		backend := setup(t, 100, http.StatusServiceUnavailable)
+		backend.boost.constraintRetries.baseDelay = time.Second
+
+		backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, 1, backend.boost.ConstraintRetryQueueDepth())
+		other := newMockRelay(t)
+		require.NoError(t, backend.boost.ForceRelayRefresh([]RelayEntry{other.RelayEntry}))
+		require.Eventually(t, func() bool { return backend.boost.ConstraintRetryQueueDepth() == 0 }, 100*time.Millisecond, 10*time.Millisecond)
+		require.Equal(t, 1, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+	})
+
+	t.Run("Non-transient failures are not retried", func(t *testing.T) {
+		backend := setup(t, 1, http.StatusBadRequest)
+
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+		require.Equal(t, 0, backend.boost.ConstraintRetryQueueDepth())
+		time.Sleep(50 * time.Millisecond)
+		require.Equal(t, 1, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+	})
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+)
+
+var errInvalidStreamScheme = errors.New("invalid constraint stream URL scheme")
+
+// constraintStreamReconnectDelay is the delay between two failed attempts to connect to a constraint stream
+var constraintStreamReconnectDelay = time.Second
+
+// constraintStreamURL returns the WebSocket URL of the constraint stream of the relay
+func constraintStreamURL(relayURL string) (string, error) {
+	u, err := url.Parse(relayURL)
+	if err != nil {
+		return "", err
+	}
+
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("%w: %s", errInvalidStreamScheme, u.Scheme)
+	}
+	u.User = nil
+	u.Path = pathConstraintStream
+	return u.String(), nil
+}
+
+// StreamConstraints maintains a WebSocket connection to the constraint stream of the relay, and sends it the
+// batches of constraints received on the channel. The connection is reestablished if it drops, and a batch
+// which failed to be sent is sent again after reconnecting.
+//
+// It returns nil once the channel is closed, or the context error once it is done.
+func (m *BoostService) StreamConstraints(ctx context.Context, constraints <-chan BatchedSignedConstraints, relayURL string) error {
+	streamURL, err := constraintStreamURL(relayURL)
+	if err != nil {
+		return err
+	}
+	log := m.log.WithFields(logrus.Fields{
+		"method": "streamConstraints",
+		"url":    streamURL,
+	})
+
+	var pending BatchedSignedConstraints
+	for {
+		conn, _, err := websocket.DefaultDialer.DialContext(ctx, streamURL, m.extraHeaders)
+		if err != nil {
+			log.WithError(err).Warn("[BOLT]: could not connect to constraint stream, retrying")
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(constraintStreamReconnectDelay):
+				continue
+			}
+		}
+		log.Info("[BOLT]: connected to constraint stream")
+
+		pending, err = streamConstraintsToConn(ctx, conn, constraints, pending)
+		conn.Close()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		log.WithError(err).Warn("[BOLT]: constraint stream disconnected, reconnecting")
+	}
+}
+
+// streamConstraintsToConn sends the pending batch and the batches received on the channel to the connection,
+// until the channel is closed (nil error), the context is done, or the connection fails. In the latter case,
+// the batch which could not be sent is returned.
+func streamConstraintsToConn(ctx context.Context, conn *websocket.Conn, constraints <-chan BatchedSignedConstraints, pending BatchedSignedConstraints) (BatchedSignedConstraints, error) {
+	// The relay is not expected to send anything, reading only detects the connection being closed
+	closed := make(chan error, 1)
+	go func() {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				closed <- err
+				return
+			}
+		}
+	}()
+
+	closeMessage := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	for {
+		if len(pending) > 0 {
+			if err := conn.WriteJSON(pending); err != nil {
+				return pending, err
+			}
+			pending = nil
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = conn.WriteMessage(websocket.CloseMessage, closeMessage)
+			return nil, ctx.Err()
+		case err := <-closed:
+			return nil, err
+		case batch, ok := <-constraints:
+			if !ok {
+				_ = conn.WriteMessage(websocket.CloseMessage, closeMessage)
+				return nil, nil
+			}
+			pending = batch
+		}
+	}
+}
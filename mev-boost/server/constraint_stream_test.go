@@ -0,0 +1,107 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestConstraintStreamURL(t *testing.T) {
+	testCases := []struct {
+		name        string
+		relayURL    string
+		expectedURL string
+		expectedErr error
+	}{
+		{
+			name:        "HTTP relay",
+			relayURL:    "http://0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249@127.0.0.1:8080",
+			expectedURL: "ws://127.0.0.1:8080/ws/constraints",
+		},
+		{
+			name:        "HTTPS relay",
+			relayURL:    "https://relay.example.com",
+			expectedURL: "wss://relay.example.com/ws/constraints",
+		},
+		{
+			name:        "Unsupported scheme",
+			relayURL:    "ftp://relay.example.com",
+			expectedErr: errInvalidStreamScheme,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			streamURL, err := constraintStreamURL(tt.relayURL)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedURL, streamURL)
+		})
+	}
+}
+
+func TestStreamConstraints(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	makeBatch := func(slot uint64) BatchedSignedConstraints {
+		return BatchedSignedConstraints{&SignedConstraints{
+			Message: ConstraintsMessage{
+				ValidatorIndex: 12345,
+				Slot:           slot,
+				Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+			},
+		}}
+	}
+
+	t.Run("Delivers batches until the channel is closed", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		relay := backend.relays[0]
+
+		constraints := make(chan BatchedSignedConstraints)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- backend.boost.StreamConstraints(context.Background(), constraints, relay.Server.URL)
+		}()
+
+		constraints <- makeBatch(1)
+		constraints <- makeBatch(2)
+		require.NoError(t, relay.WaitForConstraintSubmission(1, time.Second))
+		require.NoError(t, relay.WaitForConstraintSubmission(2, time.Second))
+
+		close(constraints)
+		require.NoError(t, <-errCh)
+		require.Equal(t, 1, relay.ConstraintStreamsOpened())
+		require.Equal(t, 0, relay.GetRequestCount(pathSubmitConstraint))
+	})
+
+	t.Run("Reconnects after a disconnect", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		relay := backend.relays[0]
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		constraints := make(chan BatchedSignedConstraints)
+		errCh := make(chan error, 1)
+		go func() {
+			errCh <- backend.boost.StreamConstraints(ctx, constraints, relay.Server.URL)
+		}()
+
+		constraints <- makeBatch(1)
+		require.NoError(t, relay.WaitForConstraintSubmission(1, time.Second))
+
+		relay.DisconnectConstraintStreams()
+		require.Eventually(t, func() bool {
+			return relay.ConstraintStreamsOpened() == 2
+		}, 3*time.Second, 10*time.Millisecond)
+
+		constraints <- makeBatch(2)
+		require.NoError(t, relay.WaitForConstraintSubmission(2, time.Second))
+
+		cancel()
+		require.ErrorIs(t, <-errCh, context.Canceled)
+	})
+}
@@ -1,12 +1,27 @@
 package server
 
 import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	ssz "github.com/ferranbt/fastssz"
+	"github.com/flashbots/go-boost-utils/bls"
 	lru "github.com/hashicorp/golang-lru/v2"
 )
 
+const (
+	// MaxCancelledTransactions is the maximum number of transaction hashes in a CancelConstraintsMessage
+	MaxCancelledTransactions = 1024
+	// MaxAttestedTransactions is the maximum number of transaction hashes in a PayloadAttestation
+	MaxAttestedTransactions = 1024
+)
+
 type BatchedSignedConstraints = []*SignedConstraints
 
 type SignedConstraints struct {
@@ -18,6 +33,9 @@ type ConstraintsMessage struct {
 	ValidatorIndex uint64        `json:"validator_index"`
 	Slot           uint64        `json:"slot"`
 	Constraints    []*Constraint `json:"constraints"`
+	// Optional total gas limit of the constrained transactions, for the builder to check that the block can
+	// fit them. The sidecar and the relay don't know this field, so it is not part of the signed Digest.
+	GasLimit uint64 `json:"gas_limit,omitempty"`
 }
 
 type Constraint struct {
@@ -25,6 +43,166 @@ type Constraint struct {
 	Index *uint64     `json:"index"`
 }
 
+// ConstraintStatus maps constraint transaction hashes to the set of relay URLs which acknowledged them
+type ConstraintStatus map[phase0.Hash32]map[string]bool
+
+// ConstraintStatusResponse is the relay response listing the constraint transactions it acknowledged for a slot
+type ConstraintStatusResponse struct {
+	TransactionHashes []phase0.Hash32 `json:"transaction_hashes"`
+}
+
+// APIVersion is a version of the constraint and proof API
+type APIVersion uint64
+
+const (
+	ConstraintAPIVersionV1 APIVersion = 1
+)
+
+// supportedConstraintAPIVersions are the versions of the constraint and proof API implemented by the BoostService
+var supportedConstraintAPIVersions = []APIVersion{ConstraintAPIVersionV1}
+
+// CapabilitiesResponse is the relay response listing the versions of the constraint and proof API it supports
+type CapabilitiesResponse struct {
+	ConstraintAPIVersions []APIVersion `json:"constraint_api_versions"`
+}
+
+// Constraint types a relay may support, see GetSupportedConstraintTypes
+const (
+	ConstraintTypeTxInclusion = "tx_inclusion"
+	ConstraintTypeTxExclusion = "tx_exclusion"
+	ConstraintTypeBundle      = "bundle"
+)
+
+// ConstraintTypesResponse is the relay response listing the types of constraints it supports
+type ConstraintTypesResponse struct {
+	ConstraintTypes []string `json:"constraint_types"`
+}
+
+// TxHash parses the constrained transaction and returns its hash
+func (c *Constraint) TxHash() (phase0.Hash32, error) {
+	parsedTx := new(types.Transaction)
+	if err := parsedTx.UnmarshalBinary(c.Tx); err != nil {
+		return phase0.Hash32{}, err
+	}
+	return phase0.Hash32(parsedTx.Hash()), nil
+}
+
+// SignedCancelConstraints is the signed request to revoke constraints for a slot
+type SignedCancelConstraints struct {
+	Message   CancelConstraintsMessage `json:"message"`
+	Signature phase0.BLSSignature      `json:"signature"`
+}
+
+// CancelConstraintsMessage lists the hashes of the constrained transactions to revoke for a slot
+type CancelConstraintsMessage struct {
+	Slot              uint64          `json:"slot"`
+	TransactionHashes []phase0.Hash32 `json:"transaction_hashes"`
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the message, which is signed
+func (c *CancelConstraintsMessage) HashTreeRoot() ([32]byte, error) {
+	hh := ssz.NewHasher()
+	if err := c.HashTreeRootWith(hh); err != nil {
+		return [32]byte{}, err
+	}
+	return hh.HashRoot()
+}
+
+// HashTreeRootWith merkleizes the message as a container of a uint64 and a list of bytes32
+func (c *CancelConstraintsMessage) HashTreeRootWith(hh ssz.HashWalker) error {
+	numHashes := uint64(len(c.TransactionHashes))
+	if numHashes > MaxCancelledTransactions {
+		return ssz.ErrIncorrectListSize
+	}
+
+	indx := hh.Index()
+	hh.PutUint64(c.Slot)
+
+	subIndx := hh.Index()
+	for _, txHash := range c.TransactionHashes {
+		hh.Append(txHash[:])
+	}
+	hh.MerkleizeWithMixin(subIndx, numHashes, MaxCancelledTransactions)
+
+	hh.Merkleize(indx)
+	return nil
+}
+
+// SignedValidatorOptIn is the request of a validator to opt in to the BOLT constraint protocol for a range of slots
+type SignedValidatorOptIn struct {
+	Pubkey    phase0.BLSPubKey    `json:"pubkey"`
+	Signature phase0.BLSSignature `json:"signature"`
+	SlotRange SlotRange           `json:"slot_range"`
+}
+
+// SlotRange is the range of slots [Start, End]
+type SlotRange struct {
+	Start uint64 `json:"start"`
+	End   uint64 `json:"end"`
+}
+
+// SignedPayloadAttestation is the relay attestation that the payload it delivered for a slot includes
+// the constraints it received for it, see BoostService.GetAuditableProof
+type SignedPayloadAttestation struct {
+	Message   PayloadAttestation  `json:"message"`
+	Signature phase0.BLSSignature `json:"signature"`
+}
+
+// PayloadAttestation lists the constrained transactions included in the payload delivered for a slot
+type PayloadAttestation struct {
+	Slot              uint64          `json:"slot"`
+	BlockHash         phase0.Hash32   `json:"block_hash"`
+	TransactionHashes []phase0.Hash32 `json:"transaction_hashes"`
+}
+
+// HashTreeRoot returns the SSZ hash tree root of the attestation, which is signed by the relay
+func (a *PayloadAttestation) HashTreeRoot() ([32]byte, error) {
+	hh := ssz.NewHasher()
+	if err := a.HashTreeRootWith(hh); err != nil {
+		return [32]byte{}, err
+	}
+	return hh.HashRoot()
+}
+
+// HashTreeRootWith merkleizes the attestation as a container of a uint64, a bytes32 and a list of bytes32
+func (a *PayloadAttestation) HashTreeRootWith(hh ssz.HashWalker) error {
+	numHashes := uint64(len(a.TransactionHashes))
+	if numHashes > MaxAttestedTransactions {
+		return ssz.ErrIncorrectListSize
+	}
+
+	indx := hh.Index()
+	hh.PutUint64(a.Slot)
+	hh.PutBytes(a.BlockHash[:])
+
+	subIndx := hh.Index()
+	for _, txHash := range a.TransactionHashes {
+		hh.Append(txHash[:])
+	}
+	hh.MerkleizeWithMixin(subIndx, numHashes, MaxAttestedTransactions)
+
+	hh.Merkleize(indx)
+	return nil
+}
+
+// Digest returns the message signed by the proposer, computed as the bolt sidecar does: the keccak256 hash of
+// the validator index and the slot, followed by the 0x-prefixed hex encoding of each constrained transaction
+// and its index (0 if it is not set). Integers are little-endian, and no signing domain is applied.
+func (m *ConstraintsMessage) Digest() [32]byte {
+	data := make([]byte, 0, 16)
+	data = binary.LittleEndian.AppendUint64(data, m.ValidatorIndex)
+	data = binary.LittleEndian.AppendUint64(data, m.Slot)
+	for _, constraint := range m.Constraints {
+		index := uint64(0)
+		if constraint.Index != nil {
+			index = *constraint.Index
+		}
+		data = append(data, hexutil.Encode(constraint.Tx)...)
+		data = binary.LittleEndian.AppendUint64(data, index)
+	}
+	return crypto.Keccak256Hash(data)
+}
+
 func (s *SignedConstraints) String() string {
 	return JSONStringify(s)
 }
@@ -37,6 +215,93 @@ func (c *Constraint) String() string {
 	return JSONStringify(c)
 }
 
+// ConstraintSet is a collection of constrained transactions without duplicates, kept in insertion order
+type ConstraintSet struct {
+	txs    map[phase0.Hash32]Transaction
+	hashes []phase0.Hash32 // insertion order
+}
+
+// NewConstraintSet creates an empty constraint set
+func NewConstraintSet() *ConstraintSet {
+	return &ConstraintSet{
+		txs: make(map[phase0.Hash32]Transaction),
+	}
+}
+
+// Add adds the transaction with the given hash to the set. It returns false if the set already contains it.
+func (s *ConstraintSet) Add(tx Transaction, hash phase0.Hash32) bool {
+	if _, ok := s.txs[hash]; ok {
+		return false
+	}
+	s.txs[hash] = tx
+	s.hashes = append(s.hashes, hash)
+	return true
+}
+
+// Len returns the number of transactions in the set
+func (s *ConstraintSet) Len() int {
+	return len(s.hashes)
+}
+
+// ToSlice returns the transactions of the set in insertion order
+func (s *ConstraintSet) ToSlice() []Transaction {
+	txs := make([]Transaction, len(s.hashes))
+	for i, hash := range s.hashes {
+		txs[i] = s.txs[hash]
+	}
+	return txs
+}
+
+// deduplicateConstraints removes the signed constraints which only contain transactions already constrained
+// for the same slot earlier in the batch. Signed constraints with at least one new transaction are kept as is,
+// since their signature covers all their constraints.
+func deduplicateConstraints(batch BatchedSignedConstraints) BatchedSignedConstraints {
+	sets := make(map[uint64]*ConstraintSet)
+	deduplicated := make(BatchedSignedConstraints, 0, len(batch))
+	for _, signedConstraints := range batch {
+		set, ok := sets[signedConstraints.Message.Slot]
+		if !ok {
+			set = NewConstraintSet()
+			sets[signedConstraints.Message.Slot] = set
+		}
+
+		// Transactions which cannot be decoded are never considered duplicates
+		hasNewTx := len(signedConstraints.Message.Constraints) == 0
+		for _, constraint := range signedConstraints.Message.Constraints {
+			hash, err := constraint.TxHash()
+			if err != nil || set.Add(constraint.Tx, hash) {
+				hasNewTx = true
+			}
+		}
+		if hasNewTx {
+			deduplicated = append(deduplicated, signedConstraints)
+		}
+	}
+	return deduplicated
+}
+
+// VerifyBatchedSignatures verifies the signature of every signed constraints message of the batch against
+// the public key at the same position in pks, see ConstraintsMessage.Digest. It stops at the first invalid
+// signature, and returns an error wrapping errInvalidConstraintSignature with its position.
+func VerifyBatchedSignatures(batch BatchedSignedConstraints, pks []*bls.PublicKey) error {
+	if len(pks) != len(batch) {
+		return fmt.Errorf("%w: %d public keys for %d messages", errConstraintKeysMismatch, len(pks), len(batch))
+	}
+
+	for i, signedConstraints := range batch {
+		digest := signedConstraints.Message.Digest()
+		signature, err := bls.SignatureFromBytes(signedConstraints.Signature[:])
+		if err != nil {
+			return fmt.Errorf("%w: constraints %d for slot %d: %w", errInvalidConstraintSignature, i, signedConstraints.Message.Slot, err)
+		}
+		ok, err := bls.VerifySignature(signature, pks[i], digest[:])
+		if err != nil || !ok {
+			return fmt.Errorf("%w: constraints %d for slot %d", errInvalidConstraintSignature, i, signedConstraints.Message.Slot)
+		}
+	}
+	return nil
+}
+
 // ConstraintCache is a cache for constraints.
 type ConstraintCache struct {
 	// map of slots to all constraints for that slot
@@ -108,3 +373,40 @@ func (c *ConstraintCache) FindTransactionByHash(txHash common.Hash) (*Constraint
 	}
 	return nil, false
 }
+
+// MissingTransactions returns the constrained transactions of the given slot which are not part of txs.
+// The second return value is false if there are no constraints for the slot.
+func (c *ConstraintCache) MissingTransactions(slot uint64, txs []bellatrix.Transaction) ([]Transaction, bool) {
+	constraints, exists := c.constraints.Get(slot)
+	if !exists {
+		return nil, false
+	}
+
+	included := make(map[common.Hash]bool, len(txs))
+	for _, tx := range txs {
+		parsedTx := new(types.Transaction)
+		if err := parsedTx.UnmarshalBinary(tx); err != nil {
+			continue
+		}
+		included[parsedTx.Hash()] = true
+	}
+
+	missing := make([]Transaction, 0)
+	for hash, constraint := range constraints {
+		if !included[hash] {
+			missing = append(missing, constraint.Tx)
+		}
+	}
+	return missing, true
+}
+
+// RemoveConstraints removes the constraints of the given transactions at the given slot, if any
+func (c *ConstraintCache) RemoveConstraints(slot uint64, txHashes []phase0.Hash32) {
+	constraints, exists := c.constraints.Get(slot)
+	if !exists {
+		return
+	}
+	for _, txHash := range txHashes {
+		delete(constraints, common.Hash(txHash))
+	}
+}
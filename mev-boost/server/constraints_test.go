@@ -0,0 +1,270 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/flashbots/go-boost-utils/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func FuzzBatchedSignedConstraints(f *testing.F) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	index := uint64(2)
+	valid, err := json.Marshal(BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           8978583,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}, {Transaction(rawTx), &index}},
+		},
+	}})
+	require.NoError(f, err)
+
+	// Large transaction arrays
+	manyConstraints := make([]*Constraint, 1000)
+	for i := range manyConstraints {
+		manyConstraints[i] = &Constraint{Transaction(rawTx), nil}
+	}
+	large, err := json.Marshal(BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{ValidatorIndex: 1, Slot: 1, Constraints: manyConstraints},
+	}})
+	require.NoError(f, err)
+
+	f.Add(valid)
+	f.Add(large)
+	f.Add([]byte("not-json"))
+	f.Add([]byte("[]"))
+	f.Add([]byte("[null]"))
+	f.Add([]byte(`[{"message":{"slot":-1}}]`))
+	f.Add([]byte(`[{"message":{"constraints":[{"tx":"0xzz"}]}}]`))
+	f.Add([]byte(`[{"message":{"unknown_field":"é☃😀"}}]`))
+	f.Add([]byte(`[{"signature":"` + strings.Repeat("ff", 100) + `"}]`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		payload := BatchedSignedConstraints{}
+		if err := DecodeJSON(bytes.NewReader(data), &payload); err != nil {
+			require.NotEmpty(t, err.Error())
+			return
+		}
+
+		// Successfully decoded constraints can be encoded and decoded again without change
+		encoded, err := json.Marshal(payload)
+		require.NoError(t, err)
+		decoded := BatchedSignedConstraints{}
+		require.NoError(t, DecodeJSON(bytes.NewReader(encoded), &decoded))
+		reencoded, err := json.Marshal(decoded)
+		require.NoError(t, err)
+		require.JSONEq(t, string(encoded), string(reencoded))
+	})
+}
+
+func TestConstraintSet(t *testing.T) {
+	txA := Transaction(_HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f"))
+	txB := Transaction(_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"))
+
+	set := NewConstraintSet()
+	require.Empty(t, set.ToSlice())
+
+	require.True(t, set.Add(txB, phase0.Hash32{0x02}))
+	require.True(t, set.Add(txA, phase0.Hash32{0x01}))
+	require.False(t, set.Add(txB, phase0.Hash32{0x02}))
+	// Transactions are identified by their hash
+	require.False(t, set.Add(txA, phase0.Hash32{0x02}))
+
+	require.Equal(t, 2, set.Len())
+	require.Equal(t, []Transaction{txB, txA}, set.ToSlice())
+}
+
+func TestDeduplicateConstraints(t *testing.T) {
+	txA := Transaction(_HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f"))
+	txB := Transaction(_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"))
+	constraints := func(slot uint64, txs ...Transaction) *SignedConstraints {
+		signedConstraints := &SignedConstraints{Message: ConstraintsMessage{ValidatorIndex: 1, Slot: slot}}
+		for _, tx := range txs {
+			signedConstraints.Message.Constraints = append(signedConstraints.Message.Constraints, &Constraint{tx, nil})
+		}
+		return signedConstraints
+	}
+
+	testCases := []struct {
+		name     string
+		batch    BatchedSignedConstraints
+		expected []int // indexes of the signed constraints kept from the batch
+	}{
+		{
+			name:     "No duplicates",
+			batch:    BatchedSignedConstraints{constraints(1, txA), constraints(1, txB)},
+			expected: []int{0, 1},
+		},
+		{
+			name:     "Repeated signed constraints",
+			batch:    BatchedSignedConstraints{constraints(1, txA, txB), constraints(1, txA, txB)},
+			expected: []int{0},
+		},
+		{
+			name:     "Transactions already constrained in separate messages",
+			batch:    BatchedSignedConstraints{constraints(1, txA), constraints(1, txB), constraints(1, txB, txA)},
+			expected: []int{0, 1},
+		},
+		{
+			name:     "Partially duplicated signed constraints are kept",
+			batch:    BatchedSignedConstraints{constraints(1, txA), constraints(1, txA, txB)},
+			expected: []int{0, 1},
+		},
+		{
+			name:     "Same transaction for different slots",
+			batch:    BatchedSignedConstraints{constraints(1, txA), constraints(2, txA)},
+			expected: []int{0, 1},
+		},
+		{
+			name:     "Undecodable transactions are kept",
+			batch:    BatchedSignedConstraints{constraints(1, Transaction{0x01}), constraints(1, Transaction{0x01})},
+			expected: []int{0, 1},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			expected := make(BatchedSignedConstraints, len(tt.expected))
+			for i, index := range tt.expected {
+				expected[i] = tt.batch[index]
+			}
+			require.Equal(t, expected, deduplicateConstraints(tt.batch))
+		})
+	}
+}
+
+// signConstraintsMessage signs the digest of the message with secretKey, as the bolt sidecar does
+func signConstraintsMessage(message *ConstraintsMessage, secretKey *bls.SecretKey) phase0.BLSSignature {
+	digest := message.Digest()
+	var signature phase0.BLSSignature
+	copy(signature[:], bls.SignatureToBytes(bls.Sign(secretKey, digest[:])))
+	return signature
+}
+
+// makeSignedConstraintsBatch returns a batch of numMessages constraints messages signed with secretKey
+func makeSignedConstraintsBatch(t testing.TB, numMessages int, secretKey *bls.SecretKey) BatchedSignedConstraints {
+	t.Helper()
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	batch := make(BatchedSignedConstraints, numMessages)
+	for i := range batch {
+		message := ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           uint64(i),
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		}
+		batch[i] = &SignedConstraints{Message: message, Signature: signConstraintsMessage(&message, secretKey)}
+	}
+	return batch
+}
+
+func TestConstraintsMessageDigest(t *testing.T) {
+	index := uint64(3)
+	message := ConstraintsMessage{
+		ValidatorIndex: 1,
+		Slot:           2,
+		Constraints:    []*Constraint{{Transaction{0xab, 0xcd}, nil}, {Transaction{0x01}, &index}},
+	}
+
+	// Layout of the sidecar digest: the transactions are hashed as their 0x-prefixed hex strings,
+	// and a missing index is encoded as 0
+	data := []byte{1, 0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0}
+	data = append(data, "0xabcd"...)
+	data = append(data, 0, 0, 0, 0, 0, 0, 0, 0)
+	data = append(data, "0x01"...)
+	data = append(data, 3, 0, 0, 0, 0, 0, 0, 0)
+	require.Equal(t, crypto.Keccak256Hash(data), common.Hash(message.Digest()))
+
+	// The gas limit is not signed
+	message.GasLimit = 21_000
+	require.Equal(t, crypto.Keccak256Hash(data), common.Hash(message.Digest()))
+}
+
+func TestConstraintsMessageGasLimitOptional(t *testing.T) {
+	encoded, err := json.Marshal(ConstraintsMessage{ValidatorIndex: 1, Slot: 2})
+	require.NoError(t, err)
+	require.NotContains(t, string(encoded), "gas_limit")
+
+	// Messages of the sidecar have no gas limit
+	message := ConstraintsMessage{}
+	require.NoError(t, json.Unmarshal([]byte(`{"validator_index":1,"slot":2,"constraints":[]}`), &message))
+	require.Zero(t, message.GasLimit)
+}
+
+func TestVerifyBatchedSignatures(t *testing.T) {
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	otherSecretKey, otherPublicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+
+	batch := makeSignedConstraintsBatch(t, 3, secretKey)
+	// The second message is signed by another proposer
+	batch[1] = makeSignedConstraintsBatch(t, 2, otherSecretKey)[1]
+	pks := []*bls.PublicKey{publicKey, otherPublicKey, publicKey}
+
+	t.Run("Valid signatures", func(t *testing.T) {
+		require.NoError(t, VerifyBatchedSignatures(batch, pks))
+	})
+
+	t.Run("Wrong public key", func(t *testing.T) {
+		err := VerifyBatchedSignatures(batch, []*bls.PublicKey{publicKey, publicKey, publicKey})
+		require.ErrorIs(t, err, errInvalidConstraintSignature)
+		require.Contains(t, err.Error(), "constraints 1 for slot 1")
+	})
+
+	t.Run("Signed with a domain", func(t *testing.T) {
+		// The signing root of the digest in a domain, as for the other signed messages of the builder API
+		signingData := phase0.SigningData{ObjectRoot: batch[0].Message.Digest(), Domain: phase0.Domain{0x01}}
+		root, err := signingData.HashTreeRoot()
+		require.NoError(t, err)
+		signed := *batch[0]
+		copy(signed.Signature[:], bls.SignatureToBytes(bls.Sign(secretKey, root[:])))
+		err = VerifyBatchedSignatures(BatchedSignedConstraints{&signed}, pks[:1])
+		require.ErrorIs(t, err, errInvalidConstraintSignature)
+	})
+
+	t.Run("Tampered message", func(t *testing.T) {
+		tampered := *batch[2]
+		tampered.Message.ValidatorIndex++
+		err := VerifyBatchedSignatures(BatchedSignedConstraints{batch[0], batch[1], &tampered}, pks)
+		require.ErrorIs(t, err, errInvalidConstraintSignature)
+		require.Contains(t, err.Error(), "constraints 2 for slot 2")
+	})
+
+	t.Run("Public keys mismatch", func(t *testing.T) {
+		require.ErrorIs(t, VerifyBatchedSignatures(batch, pks[:2]), errConstraintKeysMismatch)
+	})
+}
+
+func BenchmarkVerifyBatchedSignatures(b *testing.B) {
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(b, err)
+	batch := makeSignedConstraintsBatch(b, 100, secretKey)
+	pks := make([]*bls.PublicKey, len(batch))
+	for i := range pks {
+		pks[i] = publicKey
+	}
+
+	b.Run("Batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			require.NoError(b, VerifyBatchedSignatures(batch, pks))
+		}
+	})
+
+	b.Run("Individual", func(b *testing.B) {
+		publicKeyBytes := bls.PublicKeyToBytes(publicKey)
+		for i := 0; i < b.N; i++ {
+			for _, signedConstraints := range batch {
+				digest := signedConstraints.Message.Digest()
+				ok, err := bls.VerifySignatureBytes(digest[:], signedConstraints.Signature[:], publicKeyBytes)
+				require.NoError(b, err)
+				require.True(b, ok)
+			}
+		}
+	})
+}
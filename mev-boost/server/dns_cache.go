@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+)
+
+// dnsCacheEntry holds the addresses of a host until expiresAt
+type dnsCacheEntry struct {
+	addrs     []string
+	expiresAt time.Time
+}
+
+// dnsCache is an http.RoundTripper resolving the relay hostnames itself, and keeping their addresses for ttl.
+// Go doesn't cache DNS resolutions, but the HTTP transport keeps reusing its open connections, so that a relay
+// whose IP changed is still reached at the old one. Once the addresses of a host expired, they are resolved
+// again before the next request, and the idle connections are closed if they changed.
+type dnsCache struct {
+	mu      sync.Mutex
+	entries map[string]dnsCacheEntry
+
+	ttl        time.Duration
+	transport  *http.Transport
+	dialer     *net.Dialer
+	lookupHost func(ctx context.Context, host string) ([]string, error)
+
+	now func() time.Time
+}
+
+func newDNSCache(ttl time.Duration) *dnsCache {
+	c := &dnsCache{
+		entries:    make(map[string]dnsCacheEntry),
+		ttl:        ttl,
+		dialer:     &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second},
+		lookupHost: new(net.Resolver).LookupHost,
+		now:        time.Now,
+	}
+	c.transport = http.DefaultTransport.(*http.Transport).Clone()
+	c.transport.DialContext = c.dialContext
+	return c
+}
+
+// resolve returns the addresses of the host, from the cache if they were resolved less than ttl ago
+func (c *dnsCache) resolve(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[host]
+	now := c.now()
+	c.mu.Unlock()
+	if ok && now.Before(entry.expiresAt) {
+		return entry.addrs, nil
+	}
+
+	addrs, err := c.lookupHost(ctx, host)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("%w: %s", errNoAddress, host)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	changed := ok && !slices.Equal(entry.addrs, addrs)
+	c.entries[host] = dnsCacheEntry{addrs: addrs, expiresAt: now.Add(c.ttl)}
+	c.mu.Unlock()
+
+	// Don't reuse the connections to the previous addresses
+	if changed {
+		c.transport.CloseIdleConnections()
+	}
+	return addrs, nil
+}
+
+// dialContext connects to the first reachable address of the host of addr
+func (c *dnsCache) dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := c.resolve(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	for _, a := range addrs {
+		conn, err = c.dialer.DialContext(ctx, network, net.JoinHostPort(a, port))
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return nil, err
+}
+
+func (c *dnsCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	// Refresh the addresses of the host if they expired, even if an open connection is reused for the request
+	if _, err := c.resolve(req.Context(), req.URL.Hostname()); err != nil {
+		return nil, err
+	}
+	return c.transport.RoundTrip(req)
+}
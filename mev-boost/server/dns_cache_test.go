@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// mockDNS resolves every host to its current address, which the test may change
+type mockDNS struct {
+	mu      sync.Mutex
+	addr    string
+	lookups int
+}
+
+func (d *mockDNS) setAddr(addr string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addr = addr
+}
+
+func (d *mockDNS) lookupHost(_ context.Context, _ string) ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.lookups++
+	return []string{d.addr}, nil
+}
+
+func (d *mockDNS) getLookups() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.lookups
+}
+
+// newServerAt starts a server on the given address replying with its name
+func newServerAt(t *testing.T, addr, name string) *httptest.Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		t.Skipf("cannot listen on %s: %v", addr, err)
+	}
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_, _ = w.Write([]byte(name))
+	}))
+	server.Listener = listener
+	server.Start()
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestWithDNSCacheTTL(t *testing.T) {
+	// Two servers on the same port at different IPs, for the relay moving from one to the other
+	oldServer := newServerAt(t, "127.0.0.1:0", "old")
+	_, port, err := net.SplitHostPort(oldServer.Listener.Addr().String())
+	require.NoError(t, err)
+	newServerAt(t, net.JoinHostPort("127.0.0.2", port), "new")
+
+	dns := &mockDNS{addr: "127.0.0.1"}
+	backend := newTestBackend(t, 1, time.Second, WithDNSCacheTTL(time.Minute))
+	backend.boost.dnsCache.lookupHost = dns.lookupHost
+	now := time.Unix(1700000000, 0)
+	backend.boost.SetClockSource(func() time.Time { return now })
+
+	relay, err := NewRelayEntry("http://0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249@relay.test:" + port)
+	require.NoError(t, err)
+	client := backend.boost.relayHTTPClient(backend.boost.httpClientGetHeader, relay)
+
+	get := func() string {
+		t.Helper()
+		req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, relay.GetURI(pathStatus), nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	require.Equal(t, "old", get())
+	require.Equal(t, 1, dns.getLookups())
+
+	// The cached address is used until the TTL expires
+	dns.setAddr("127.0.0.2")
+	now = now.Add(30 * time.Second)
+	require.Equal(t, "old", get())
+	require.Equal(t, 1, dns.getLookups())
+
+	// The host is then resolved again, and the client connects to the new address
+	now = now.Add(31 * time.Second)
+	require.Equal(t, "new", get())
+	require.Equal(t, 2, dns.getLookups())
+	require.Equal(t, "new", get())
+}
+
+func TestDNSCacheResolve(t *testing.T) {
+	cache := newDNSCache(time.Minute)
+	dns := &mockDNS{addr: "127.0.0.1"}
+	cache.lookupHost = dns.lookupHost
+
+	// IP addresses are not resolved
+	addrs, err := cache.resolve(context.Background(), "10.0.0.1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1"}, addrs)
+	require.Equal(t, 0, dns.getLookups())
+
+	// Hosts without address are an error
+	cache.lookupHost = func(context.Context, string) ([]string, error) { return nil, nil }
+	_, err = cache.resolve(context.Background(), "relay.test")
+	require.ErrorIs(t, err, errNoAddress)
+}
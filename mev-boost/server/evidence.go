@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	lru "github.com/hashicorp/golang-lru/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxConstraintEvidenceEntries is the number of payloads whose evidence is kept if
+// BoostServiceOpts.MaxConstraintEvidenceEntries is not set
+const defaultMaxConstraintEvidenceEntries = 64
+
+// ConstraintEvidence is what an operator needs to verify after the fact that a delivered payload satisfied
+// the constraints of its slot, see BoostService.GetConstraintEvidenceForPayload
+type ConstraintEvidence struct {
+	Slot      uint64
+	BlockHash phase0.Hash32
+
+	// Inclusion proofs sent by the relay along with the bid, against the transactions root of the payload
+	Proof *InclusionProof
+	// Transactions of the full payload returned by getPayload
+	Transactions []Transaction
+	// Signed attestation of the relay that the payload includes the constraints it received,
+	// nil if no relay sent a valid one
+	Attestation *SignedPayloadAttestation
+}
+
+// constraintEvidenceStore keeps the evidence of the latest delivered payloads, by block hash.
+// The stored entries are never modified, an update replaces the entry.
+type constraintEvidenceStore struct {
+	entries *lru.Cache[phase0.Hash32, *ConstraintEvidence]
+}
+
+func newConstraintEvidenceStore(cap int) *constraintEvidenceStore {
+	if cap <= 0 {
+		cap = defaultMaxConstraintEvidenceEntries
+	}
+	entries, _ := lru.New[phase0.Hash32, *ConstraintEvidence](cap)
+	return &constraintEvidenceStore{entries: entries}
+}
+
+// GetConstraintEvidenceForPayload returns the evidence stored for the payload with the given block hash, after
+// a successful getPayload for a bid with inclusion proofs. Only the latest MaxConstraintEvidenceEntries payloads
+// are kept.
+func (m *BoostService) GetConstraintEvidenceForPayload(blockHash phase0.Hash32) (*ConstraintEvidence, bool) {
+	return m.constraintEvidence.entries.Get(blockHash)
+}
+
+// storeConstraintEvidence keeps the inclusion proofs of the bid along with the transactions of the delivered
+// payload, then requests the relay attestation for it in the background
+func (m *BoostService) storeConstraintEvidence(log *logrus.Entry, slot phase0.Slot, blockHash phase0.Hash32, proof *InclusionProof, txs []bellatrix.Transaction) {
+	if proof == nil {
+		return
+	}
+
+	transactions := make([]Transaction, len(txs))
+	for i, tx := range txs {
+		transactions[i] = Transaction(tx)
+	}
+	evidence := &ConstraintEvidence{
+		Slot:         uint64(slot),
+		BlockHash:    blockHash,
+		Proof:        proof,
+		Transactions: transactions,
+	}
+	m.constraintEvidence.entries.Add(blockHash, evidence)
+
+	go func() {
+		attestation, err := m.GetAuditableProof(context.Background(), slot, blockHash)
+		if err != nil {
+			log.WithError(err).Warn("[BOLT]: no payload attestation for the constraint evidence")
+			return
+		}
+		withAttestation := *evidence
+		withAttestation.Attestation = attestation
+		m.constraintEvidence.entries.Add(blockHash, &withAttestation)
+	}()
+}
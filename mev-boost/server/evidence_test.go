@@ -0,0 +1,120 @@
+package server
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	builderApi "github.com/attestantio/go-builder-client/api"
+	eth2ApiV1Capella "github.com/attestantio/go-eth2-client/api/v1/capella"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetConstraintEvidenceForPayload(t *testing.T) {
+	// Load the signed blinded beacon block used for getPayload
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-capella.json")
+	require.NoError(t, err)
+	defer jsonFile.Close()
+	signedBlindedBeaconBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBeaconBlock))
+	slot := signedBlindedBeaconBlock.Message.Slot
+	blockHash := signedBlindedBeaconBlock.Message.Body.ExecutionPayloadHeader.BlockHash
+
+	rawTx := _HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765")
+	txHash, err := (&Constraint{Tx: Transaction(rawTx)}).TxHash()
+	require.NoError(t, err)
+	proof := &InclusionProof{
+		TransactionHashes:  []phase0.Hash32{txHash},
+		GeneralizedIndexes: []uint64{firstTransactionGeneralizedIndex},
+		MerkleHashes:       []*HexBytes{},
+	}
+
+	// setup returns a backend whose relay delivers a payload with the constrained transaction,
+	// for a bid received with the given proofs
+	setup := func(t *testing.T, proofs *InclusionProof) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 1, time.Second)
+
+		constraints := BatchedSignedConstraints{&SignedConstraints{
+			Message: ConstraintsMessage{
+				ValidatorIndex: 12345,
+				Slot:           uint64(slot),
+				Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+			},
+		}}
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, constraints)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		bidKey := bidRespKey{slot: uint64(slot), blockHash: blockHash.String()}
+		backend.boost.bids[bidKey] = bidResp{relays: []RelayEntry{backend.relays[0].RelayEntry}, proofs: proofs}
+
+		payload := blindedBlockToExecutionPayloadCapella(signedBlindedBeaconBlock)
+		payload.Transactions = []bellatrix.Transaction{rawTx}
+		backend.relays[0].GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
+			Version: spec.DataVersionCapella,
+			Capella: payload,
+		}
+		return backend
+	}
+
+	t.Run("Evidence of a bid with proofs", func(t *testing.T) {
+		backend := setup(t, proof)
+		_, ok := backend.boost.GetConstraintEvidenceForPayload(blockHash)
+		require.False(t, ok)
+
+		rr := backend.request(t, http.MethodPost, pathGetPayload, signedBlindedBeaconBlock)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		evidence, ok := backend.boost.GetConstraintEvidenceForPayload(blockHash)
+		require.True(t, ok)
+		require.Equal(t, uint64(slot), evidence.Slot)
+		require.Equal(t, blockHash, evidence.BlockHash)
+		require.Equal(t, proof, evidence.Proof)
+		require.Equal(t, []Transaction{rawTx}, evidence.Transactions)
+
+		// The relay attestation is added once received
+		require.Eventually(t, func() bool {
+			evidence, ok := backend.boost.GetConstraintEvidenceForPayload(blockHash)
+			return ok && evidence.Attestation != nil
+		}, time.Second, 10*time.Millisecond)
+		evidence, _ = backend.boost.GetConstraintEvidenceForPayload(blockHash)
+		require.Equal(t, blockHash, evidence.Attestation.Message.BlockHash)
+		require.Equal(t, []phase0.Hash32{txHash}, evidence.Attestation.Message.TransactionHashes)
+		require.NoError(t, backend.boost.verifyPayloadAttestation(evidence.Attestation, backend.relays[0].RelayEntry, slot, blockHash))
+	})
+
+	t.Run("No evidence without proofs", func(t *testing.T) {
+		backend := setup(t, nil)
+
+		rr := backend.request(t, http.MethodPost, pathGetPayload, signedBlindedBeaconBlock)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		_, ok := backend.boost.GetConstraintEvidenceForPayload(blockHash)
+		require.False(t, ok)
+	})
+}
+
+func TestConstraintEvidenceStore(t *testing.T) {
+	store := newConstraintEvidenceStore(2)
+	for i := byte(1); i <= 3; i++ {
+		store.entries.Add(phase0.Hash32{i}, &ConstraintEvidence{Slot: uint64(i), BlockHash: phase0.Hash32{i}})
+	}
+
+	// The least recently used entry is evicted
+	_, ok := store.entries.Get(phase0.Hash32{1})
+	require.False(t, ok)
+	evidence, ok := store.entries.Get(phase0.Hash32{3})
+	require.True(t, ok)
+	require.Equal(t, uint64(3), evidence.Slot)
+
+	// The default size is used if not set
+	store = newConstraintEvidenceStore(0)
+	for i := 0; i <= defaultMaxConstraintEvidenceEntries; i++ {
+		store.entries.Add(phase0.Hash32{byte(i)}, &ConstraintEvidence{Slot: uint64(i)})
+	}
+	require.Equal(t, defaultMaxConstraintEvidenceEntries, store.entries.Len())
+}
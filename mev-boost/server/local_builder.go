@@ -0,0 +1,150 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	builderApi "github.com/attestantio/go-builder-client/api"
+	builderSpec "github.com/attestantio/go-builder-client/spec"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/sirupsen/logrus"
+)
+
+// LocalBlockBuilder builds the payload of a block locally, used by GetBestBidOrLocalBlock when no relay delivers
+// a bid, see WithLocalBlockBuilder
+type LocalBlockBuilder interface {
+	BuildBlock(ctx context.Context, slot phase0.Slot) (*builderApi.VersionedSubmitBlindedBlockResponse, error)
+}
+
+// BidOrLocalBlock is the result of GetBestBidOrLocalBlock: either the best bid of the relays, or the payload built
+// by the local block builder if no relay delivered a bid
+type BidOrLocalBlock struct {
+	Bid        *builderSpec.VersionedSignedBuilderBid
+	LocalBlock *builderApi.VersionedSubmitBlindedBlockResponse
+}
+
+// GetBestBidOrLocalBlock requests bids from all relays like GetBestBidForSlot. If no relay delivers a bid and a local
+// block builder is set with WithLocalBlockBuilder, the block is built locally instead, and returned in LocalBlock.
+func (m *BoostService) GetBestBidOrLocalBlock(ctx context.Context, slot phase0.Slot, parentHash phase0.Hash32, pubkey phase0.BLSPubKey) (*BidOrLocalBlock, error) {
+	bid, err := m.GetBestBidForSlot(ctx, slot, parentHash, pubkey)
+	if err == nil {
+		return &BidOrLocalBlock{Bid: bid}, nil
+	}
+	if m.localBlockBuilder == nil || !errors.Is(err, errNoBidReceived) {
+		return nil, err
+	}
+
+	m.log.WithField("slot", slot).Warn("no bid received from the relays, building the block locally")
+	payload, err := m.buildLocalBlock(ctx, slot)
+	if err != nil {
+		return nil, err
+	}
+	return &BidOrLocalBlock{LocalBlock: payload}, nil
+}
+
+// buildLocalBlock builds the block of the slot with the local block builder, after no relay delivered a bid
+func (m *BoostService) buildLocalBlock(ctx context.Context, slot phase0.Slot) (*builderApi.VersionedSubmitBlindedBlockResponse, error) {
+	payload, err := m.localBlockBuilder.BuildBlock(ctx, slot)
+	if err != nil {
+		return nil, fmt.Errorf("%w: local block builder failed: %w", errNoBidReceived, err)
+	}
+	if payload == nil {
+		return nil, fmt.Errorf("%w: local block builder returned no payload", errNoBidReceived)
+	}
+	return payload, nil
+}
+
+// CompareWithLocalBuilder compares the value of an external bid with the value of the locally built block, to tell
+// how much the validator gains from the bid. valueDelta is how much more the bid pays than the local block, zero
+// if it doesn't pay more. The external bid should be used if it pays more than the local block, by at least
+// the threshold set with WithMinValueDelta.
+//
+// The payload doesn't tell the gas used by each transaction, so the value of the local block is estimated from
+// their gas limit. It is an upper bound, which errs on the side of the local block.
+func (m *BoostService) CompareWithLocalBuilder(ctx context.Context, localBlock *builderApi.VersionedSubmitBlindedBlockResponse, bid *builderSpec.VersionedSignedBuilderBid) (valueDelta *uint256.Int, useExternalBid bool, err error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	bidValue, err := bid.Value()
+	if err != nil {
+		return nil, false, err
+	}
+	localValue, err := localBlockValue(localBlock)
+	if err != nil {
+		return nil, false, err
+	}
+
+	valueDelta = new(uint256.Int)
+	if bidValue.Gt(localValue) {
+		valueDelta.Sub(bidValue, localValue)
+	}
+	useExternalBid = !valueDelta.IsZero()
+	if m.minValueDelta != nil && valueDelta.Lt(m.minValueDelta) {
+		useExternalBid = false
+	}
+
+	m.log.WithFields(logrus.Fields{
+		"bidValue":       bidValue.Dec(),
+		"localValue":     localValue.Dec(),
+		"valueDelta":     valueDelta.Dec(),
+		"useExternalBid": useExternalBid,
+	}).Info("compared bid with local block")
+	return valueDelta, useExternalBid, nil
+}
+
+// localBlockValue returns the priority fees paid by the transactions of the payload to the fee recipient,
+// assuming that each transaction used all of its gas limit
+func localBlockValue(payload *builderApi.VersionedSubmitBlindedBlockResponse) (*uint256.Int, error) {
+	if payload == nil {
+		return nil, errEmptyLocalBlock
+	}
+
+	var baseFee *uint256.Int
+	switch payload.Version {
+	case spec.DataVersionCapella:
+		if payload.Capella == nil {
+			return nil, errEmptyLocalBlock
+		}
+		// The base fee is little-endian in Capella payloads
+		baseFeeBytes := payload.Capella.BaseFeePerGas
+		for i, j := 0, len(baseFeeBytes)-1; i < j; i, j = i+1, j-1 {
+			baseFeeBytes[i], baseFeeBytes[j] = baseFeeBytes[j], baseFeeBytes[i]
+		}
+		baseFee = new(uint256.Int).SetBytes(baseFeeBytes[:])
+	case spec.DataVersionDeneb:
+		if payload.Deneb == nil || payload.Deneb.ExecutionPayload == nil {
+			return nil, errEmptyLocalBlock
+		}
+		baseFee = payload.Deneb.ExecutionPayload.BaseFeePerGas
+		if baseFee == nil {
+			return nil, errEmptyLocalBlock
+		}
+	default:
+		return nil, fmt.Errorf("%w: %s", errUnsupportedVersion, payload.Version)
+	}
+
+	txs, err := payload.Transactions()
+	if err != nil {
+		return nil, err
+	}
+	value := new(uint256.Int)
+	for i, rawTx := range txs {
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(rawTx); err != nil {
+			return nil, fmt.Errorf("could not decode transaction %d of the local block: %w", i, err)
+		}
+		tip, err := tx.EffectiveGasTip(baseFee.ToBig())
+		if err != nil {
+			return nil, fmt.Errorf("transaction %d of the local block: %w", i, err)
+		}
+		// The fee caps of a valid transaction fit in 256 bits
+		fee, _ := uint256.FromBig(tip)
+		value.Add(value, fee.Mul(fee, uint256.NewInt(tx.Gas())))
+	}
+	return value, nil
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/holiman/uint256"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompareWithLocalBuilder(t *testing.T) {
+	hash := "0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	relay := newMockRelay(t)
+
+	marshalTx := func(t *testing.T, tipCap, feeCap int64, gas uint64) bellatrix.Transaction {
+		t.Helper()
+		rawTx, err := types.NewTx(&types.DynamicFeeTx{GasTipCap: big.NewInt(tipCap), GasFeeCap: big.NewInt(feeCap), Gas: gas}).MarshalBinary()
+		require.NoError(t, err)
+		return rawTx
+	}
+
+	// With a base fee of 5 wei, the local block pays tips of 2*21000 + 7*30000 = 252000 wei
+	localBlock := relay.MakeGetPayloadResponse(hash, hash, "0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941", 12345, spec.DataVersionDeneb)
+	localBlock.Deneb.ExecutionPayload.BaseFeePerGas = uint256.NewInt(5)
+	localBlock.Deneb.ExecutionPayload.Transactions = []bellatrix.Transaction{
+		marshalTx(t, 2, 10, 21000),
+		marshalTx(t, 10, 12, 30000),
+	}
+
+	testCases := []struct {
+		name           string
+		bidValue       uint64
+		minValueDelta  *uint256.Int
+		expectedDelta  uint64
+		useExternalBid bool
+	}{
+		{
+			name:           "Bid above the local block",
+			bidValue:       300000,
+			expectedDelta:  48000,
+			useExternalBid: true,
+		},
+		{
+			name:          "Bid equal to the local block",
+			bidValue:      252000,
+			expectedDelta: 0,
+		},
+		{
+			name:          "Bid below the local block",
+			bidValue:      200000,
+			expectedDelta: 0,
+		},
+		{
+			name:          "Delta below the minimum",
+			bidValue:      300000,
+			minValueDelta: uint256.NewInt(50000),
+			expectedDelta: 48000,
+		},
+		{
+			name:           "Delta equal to the minimum",
+			bidValue:       300000,
+			minValueDelta:  uint256.NewInt(48000),
+			expectedDelta:  48000,
+			useExternalBid: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 1, time.Second)
+			if tt.minValueDelta != nil {
+				WithMinValueDelta(tt.minValueDelta)(backend.boost)
+			}
+			bid := relay.MakeGetHeaderResponse(tt.bidValue, hash, hash, relay.RelayEntry.PublicKey.String(), spec.DataVersionDeneb)
+
+			delta, useExternalBid, err := backend.boost.CompareWithLocalBuilder(context.Background(), localBlock, bid)
+			require.NoError(t, err)
+			require.Equal(t, uint256.NewInt(tt.expectedDelta), delta)
+			require.Equal(t, tt.useExternalBid, useExternalBid)
+		})
+	}
+
+	t.Run("Capella local block", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		capellaBlock := relay.MakeGetPayloadResponse(hash, hash, "0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941", 12345, spec.DataVersionCapella)
+		capellaBlock.Capella.BaseFeePerGas = [32]byte{5} // little-endian
+		capellaBlock.Capella.Transactions = localBlock.Deneb.ExecutionPayload.Transactions
+		bid := relay.MakeGetHeaderResponse(300000, hash, hash, relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella)
+
+		delta, useExternalBid, err := backend.boost.CompareWithLocalBuilder(context.Background(), capellaBlock, bid)
+		require.NoError(t, err)
+		require.Equal(t, uint256.NewInt(48000), delta)
+		require.True(t, useExternalBid)
+	})
+
+	t.Run("Invalid local blocks", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		bid := relay.MakeGetHeaderResponse(300000, hash, hash, relay.RelayEntry.PublicKey.String(), spec.DataVersionDeneb)
+
+		_, _, err := backend.boost.CompareWithLocalBuilder(context.Background(), nil, bid)
+		require.ErrorIs(t, err, errEmptyLocalBlock)
+
+		// A transaction paying less than the base fee can't be in the block
+		belowBaseFee := relay.MakeGetPayloadResponse(hash, hash, "0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941", 12345, spec.DataVersionDeneb)
+		belowBaseFee.Deneb.ExecutionPayload.BaseFeePerGas = uint256.NewInt(5)
+		belowBaseFee.Deneb.ExecutionPayload.Transactions = []bellatrix.Transaction{marshalTx(t, 2, 4, 21000)}
+		_, _, err = backend.boost.CompareWithLocalBuilder(context.Background(), belowBaseFee, bid)
+		require.Error(t, err)
+	})
+}
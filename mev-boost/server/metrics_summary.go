@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// relayRequestStats accumulates the outcome of the getHeader requests sent to a relay
+type relayRequestStats struct {
+	requests     uint64
+	errors       uint64
+	totalLatency time.Duration
+}
+
+// recordRelayRequest adds a getHeader request sent to the relay, which failed if err is not nil, to its statistics
+func (m *BoostService) recordRelayRequest(relay RelayEntry, latency time.Duration, err error) {
+	m.requestStatsLock.Lock()
+	defer m.requestStatsLock.Unlock()
+
+	stats, ok := m.requestStats[relay]
+	if !ok {
+		stats = new(relayRequestStats)
+		m.requestStats[relay] = stats
+	}
+	stats.requests++
+	stats.totalLatency += latency
+	if err != nil {
+		stats.errors++
+	}
+}
+
+// EmitMetricsSummary writes a table with a row per relay of the getHeader requests sent since startup:
+// their count, how many failed, their average latency, the best bid value received (in ETH) and the state
+// of the circuit breaker. Missing values are written as "-".
+func (m *BoostService) EmitMetricsSummary(w io.Writer) error {
+	bidStats := m.BestBidStats()
+
+	m.requestStatsLock.Lock()
+	requestStats := make(map[RelayEntry]relayRequestStats, len(m.requestStats))
+	for relay, stats := range m.requestStats {
+		requestStats[relay] = *stats
+	}
+	m.requestStatsLock.Unlock()
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "RELAY\tREQUESTS\tERRORS\tAVG LATENCY\tBEST BID\tCIRCUIT")
+	for _, relay := range m.getRelays() {
+		stats := requestStats[relay]
+
+		avgLatency := "-"
+		if stats.requests > 0 {
+			avgLatency = (stats.totalLatency / time.Duration(stats.requests)).Round(time.Microsecond).String()
+		}
+		bestBid := "-"
+		if relayBidStats, ok := bidStats[relay]; ok {
+			bestBid = weiBigIntToEthBigFloat(relayBidStats.Max.ToBig()).Text('f', 18)
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\n", relay.String(), stats.requests, stats.errors, avgLatency, bestBid, m.RelayCircuitState(relay))
+	}
+	return tw.Flush()
+}
@@ -1,12 +1,24 @@
 package server
 
 import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"runtime/debug"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -15,16 +27,21 @@ import (
 	builderApiDeneb "github.com/attestantio/go-builder-client/api/deneb"
 	builderApiV1 "github.com/attestantio/go-builder-client/api/v1"
 	builderSpec "github.com/attestantio/go-builder-client/spec"
+	eth2ApiV1Capella "github.com/attestantio/go-eth2-client/api/v1/capella"
+	eth2ApiV1Deneb "github.com/attestantio/go-eth2-client/api/v1/deneb"
 	"github.com/attestantio/go-eth2-client/spec"
 	"github.com/attestantio/go-eth2-client/spec/bellatrix"
 	"github.com/attestantio/go-eth2-client/spec/capella"
 	"github.com/attestantio/go-eth2-client/spec/deneb"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	utilbellatrix "github.com/attestantio/go-eth2-client/util/bellatrix"
+	utilcapella "github.com/attestantio/go-eth2-client/util/capella"
 	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/flashbots/go-boost-utils/bls"
 	"github.com/flashbots/go-boost-utils/ssz"
 	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
 	"github.com/holiman/uint256"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
@@ -32,6 +49,9 @@ import (
 
 const (
 	mockRelaySecretKeyHex = "0x4e343a647c5a5c44d76c2c58b63f02cdf3a9a0ec40f102ebc26363b4b1b95033"
+
+	// Block gas limit used by the strict constraint validation if MaxBlockGasLimit is not set
+	mockRelayDefaultBlockGasLimit = 30_000_000
 )
 
 var (
@@ -40,6 +60,38 @@ var (
 	mockRelayPublicKey, _ = bls.PublicKeyFromSecretKey(mockRelaySecretKey)
 )
 
+var (
+	errProposerSigningDomainMismatch = errors.New("signed blinded block does not match the proposer signing domain")
+	errConstraintGasLimitTooHigh     = errors.New("constraints gas limit too high")
+	errInvalidCancellationSignature  = errors.New("invalid constraint cancellation signature")
+	errConstraintSubmissionTimeout   = errors.New("timeout waiting for constraint submission")
+	errConstraintTxFeeTooLow         = errors.New("constraint tx fee too low")
+	errMissingRequiredHeader         = errors.New("missing required header")
+	errMissingOrigin                 = errors.New("missing Origin header")
+	errCORSMethodNotAllowed          = errors.New("method not allowed by CORS policy")
+	errUnexpectedCallSequence        = errors.New("unexpected call sequence")
+	errInvalidSlotRange              = errors.New("invalid slot range")
+)
+
+// ConstraintValidationMode is how thoroughly the mock relay validates the constraints it receives
+type ConstraintValidationMode int
+
+const (
+	// ConstraintValidationLenient only decodes the constraints, and runs the checks enabled individually
+	// (BlockBaseFee, MaxBlockGasLimit, VerifyConstraintSignatures)
+	ConstraintValidationLenient ConstraintValidationMode = iota
+	// ConstraintValidationStrict runs all the checks: proposer signatures, slot range, transaction fees
+	// and gas limit
+	ConstraintValidationStrict
+)
+
+// GetHeaderParams are the parameters of a getHeader request, decoded from its path
+type GetHeaderParams struct {
+	Slot           uint64
+	ParentHash     phase0.Hash32
+	ProposerPubkey phase0.BLSPubKey
+}
+
 // mockRelay is used to fake a relay's behavior.
 // You can override each of its handler by setting the instance's HandlerOverride_METHOD_TO_OVERRIDE to your own
 // handler.
@@ -47,6 +99,10 @@ type mockRelay struct {
 	// Used to panic if impossible error happens
 	t *testing.T
 
+	// Reports unexpected calls in StrictMode, t.Errorf by default. t.Fatalf can't be used, as the handlers don't run
+	// in the test goroutine.
+	errorf func(format string, args ...any)
+
 	// KeyPair used to sign messages
 	secretKey  *bls.SecretKey
 	publicKey  *bls.PublicKey
@@ -63,38 +119,283 @@ type mockRelay struct {
 	handlerOverrideGetHeaderWithProofs func(w http.ResponseWriter, req *http.Request)
 	handlerOverrideGetPayload          func(w http.ResponseWriter, req *http.Request)
 
+	// Handler of the requests to paths without a route, see SetHandlerForAllPaths
+	handlerAllPaths func(w http.ResponseWriter, req *http.Request)
+
+	// Validator registrations received by the default registerValidator handler
+	recordedRegistrations []*builderApiV1.SignedValidatorRegistration
+
+	// Parameters of the getHeader requests received, if CaptureGetHeaderParams is set
+	capturedGetHeaderParams []GetHeaderParams
+
+	// BOLT: constraints received by the default submitConstraint handler. constraintsCond is signaled
+	// on m.mu when new constraints are captured.
+	capturedConstraints BatchedSignedConstraints
+	constraintsCond     *sync.Cond
+
+	// BOLT: called asynchronously with the constraints accepted by the default submitConstraint handler,
+	// by lowercase proposer public key, see RegisterConstraintAckCallback
+	constraintAckCallbacks map[string]func(BatchedSignedConstraints)
+
+	// BOLT: constraint cancellations received by the deleteConstraint handler
+	cancelledConstraints []*SignedCancelConstraints
+
+	// BOLT: validator opt-ins received by the opt-in handler
+	capturedOptIns []SignedValidatorOptIn
+
+	// BOLT: WebSocket connections currently open on the constraint stream, and the total number opened
+	constraintStreams       []*websocket.Conn
+	constraintStreamsOpened int
+
+	// BOLT: routers of the handlers overriding the default ones for clients sending a given X-Bolt-Version,
+	// see SetHandlerForVersion
+	versionedHandlers map[string]http.Handler
+
 	// Default responses placeholders, used if overrider does not exist
 	GetHeaderResponse           *builderSpec.VersionedSignedBuilderBid
 	GetHeaderWithProofsResponse *BidWithInclusionProofs
 	GetPayloadResponse          *builderApi.VersionedSubmitBlindedBlockResponse
 
+	// BOLT: returned by the default getHeader handler instead of GetHeaderResponse if constraints were captured
+	// for the requested slot, like a relay bidding higher once it knows the proposer's constraints
+	GetHeaderResponseIfConstraintsPresent *builderSpec.VersionedSignedBuilderBid
+
+	// BOLT: returned by the capabilities endpoint, supporting only the first constraint API version by default
+	CapabilitiesResponse *CapabilitiesResponse
+
+	// BOLT: returned by the constraint types endpoint, supporting only inclusion constraints by default
+	ConstraintTypesResponse *ConstraintTypesResponse
+
+	// Returned by the registered validators endpoint instead of the recorded registrations, if set
+	RegisteredValidatorsResponse []*builderApiV1.SignedValidatorRegistration
+
+	// BOLT: status code written by the default submitConstraint handler on success, either 200 or 204 (no body)
+	ConstraintSuccessStatusCode int
+
+	// BOLT: if set, the default submitConstraint handler rejects constraint transactions whose max fee per gas
+	// is below this base fee
+	BlockBaseFee *uint256.Int
+
+	// BOLT: if set, the default submitConstraint handler rejects batches whose total declared gas limit is above it
+	MaxBlockGasLimit uint64
+
+	// BOLT: if set, the default getHeaderWithProofs handler builds its block from the constraints captured for
+	// the slot, and only includes (and proves) the first MaxConstraintsToReturn of them, like a relay silently
+	// dropping the constraints it can't accommodate
+	MaxConstraintsToReturn int
+
+	// BOLT: if set, the default submitConstraint handler rejects batches with a message not signed by the proposer,
+	// see SetProposerSigningDomain
+	VerifyConstraintSignatures bool
+
+	// BOLT: validation of the constraints by the default submitConstraint handler, see SetConstraintValidationMode
+	constraintValidationMode ConstraintValidationMode
+
+	// BOLT: range of the slots accepted by the strict constraint validation. A zero MaxConstraintSlot means
+	// no upper bound.
+	MinConstraintSlot uint64
+	MaxConstraintSlot uint64
+
+	// Domain and public key used to verify the proposer signature of the blinded blocks sent to getPayload,
+	// see SetProposerSigningDomain. A zero domain skips the check.
+	ProposerSigningDomain phase0.Domain
+	proposerPublicKey     phase0.BLSPubKey
+
+	// Delay applied by the default getHeader handler to bids above the value threshold,
+	// see SetGetHeaderLatencyByBidValue
+	getHeaderLatencyByValueThreshold *uint256.Int
+	getHeaderLatencyAboveThreshold   time.Duration
+
+	// Responses returned by the default getHeader handler for the requests with the given parent hash,
+	// see SetGetHeaderResponseForParentHash
+	getHeaderResponseByParentHash map[phase0.Hash32]*builderSpec.VersionedSignedBuilderBid
+
+	// Responses returned in turn by the default getHeader handler, see SetGetHeaderResponseSequence
+	getHeaderResponseSequence []*builderSpec.VersionedSignedBuilderBid
+	getHeaderSequenceIndex    int
+
+	// Block number of the last GetHeaderResponse returned, the next one must be its successor
+	lastReturnedBlockNumber uint64
+
+	// If non-zero, the getHeader handler sets the X-Wait-For-Bid header to this many milliseconds, like a relay
+	// asking the client to come back once its bid is ready
+	WaitForBidMS int
+
+	// Slots for which the bid was withdrawn, see WithdrawBidForSlot
+	withdrawnSlots map[uint64]bool
+
 	// Server section
 	Server        *httptest.Server
 	ResponseDelay time.Duration
+
+	// CORS headers are added to all responses if enabled, and preflight requests are answered, for browser-based tools.
+	// CORSAllowOrigin defaults to "*", and CORSAllowedMethods to GET, POST and OPTIONS. Preflight requests without
+	// Origin are rejected with 400, and those for a method which is not allowed with 403.
+	EnableCORS         bool
+	CORSAllowOrigin    string
+	CORSAllowedMethods []string
+
+	// The parameters of the getHeader requests are recorded if set, see CapturedGetHeaderParams
+	CaptureGetHeaderParams bool
+
+	// Request bodies sent with Content-Encoding: gzip are decompressed before reaching the handlers if enabled
+	UseGzipRequests bool
+
+	// Requests without this header, such as an API key of the relay operator, are rejected with 401 if set
+	RequiredHeader string
+
+	// Requests to a route that is neither expected (see ExpectPaths) nor handled by a handler override fail the test
+	// if enabled, to assert that an endpoint is not called
+	StrictMode    bool
+	expectedPaths map[string]bool
+
+	// Routes (path templates) expected to be called in this order, and the ones called since ExpectSequence
+	expectedSequence []string
+	callSequence     []string
+
+	// Every request received, in order, with the status of its response, see RequestSequence
+	requestSequence []RequestSequenceEntry
+
+	// TLS config currently served, see SetTLSConfig
+	tlsConfig atomic.Pointer[tls.Config]
+
+	// Connection counters, updated by the server ConnState hook
+	connectionsOpened atomic.Int64
+	connectionsClosed atomic.Int64
 }
 
 // newMockRelay creates a mocked relay which implements the backend.BoostBackend interface
 // A secret key must be provided to sign default and custom response messages
 func newMockRelay(t *testing.T) *mockRelay {
 	t.Helper()
-	relay := &mockRelay{t: t, secretKey: mockRelaySecretKey, publicKey: mockRelayPublicKey, requestCount: make(map[string]int)}
+	return newMockRelayWithSecretKey(t, mockRelaySecretKey)
+}
+
+// newMockRelayWithSecretKey creates a mocked relay which signs its responses with the given secret key
+func newMockRelayWithSecretKey(t *testing.T, secretKey *bls.SecretKey) *mockRelay {
+	t.Helper()
+	publicKey, err := bls.PublicKeyFromSecretKey(secretKey)
+	require.NoError(t, err)
+	relay := &mockRelay{
+		t:                           t,
+		errorf:                      t.Errorf,
+		secretKey:                   secretKey,
+		publicKey:                   publicKey,
+		requestCount:                make(map[string]int),
+		ConstraintSuccessStatusCode: http.StatusOK,
+	}
+	relay.constraintsCond = sync.NewCond(&relay.mu)
 
 	// Initialize server
-	relay.Server = httptest.NewServer(relay.getRouter())
+	relay.Server = relay.newUnstartedServer()
+	relay.Server.Start()
 
 	// Create the RelayEntry with correct pubkey
-	url, err := url.Parse(relay.Server.URL)
-	require.NoError(t, err)
-	urlWithKey := fmt.Sprintf("%s://%s@%s", url.Scheme, hexutil.Encode(bls.PublicKeyToBytes(mockRelayPublicKey)), url.Host)
-	relay.RelayEntry, err = NewRelayEntry(urlWithKey)
-	require.NoError(t, err)
+	relay.updateRelayEntry()
 	return relay
 }
 
-// newTestMiddleware creates a middleware which increases the Request counter and creates a fake delay for the response
+// updateRelayEntry sets the RelayEntry to point to the current server, using the relay's public key
+func (m *mockRelay) updateRelayEntry() {
+	url, err := url.Parse(m.Server.URL)
+	require.NoError(m.t, err)
+	urlWithKey := fmt.Sprintf("%s://%s@%s", url.Scheme, hexutil.Encode(bls.PublicKeyToBytes(m.publicKey)), url.Host)
+	m.RelayEntry, err = NewRelayEntry(urlWithKey)
+	require.NoError(m.t, err)
+}
+
+// SetTLSConfig makes the relay serve over TLS with the certificates of cfg. Calling it again rotates the
+// certificate without restarting the server: new connections use the new certificate, open ones keep the old one.
+func (m *mockRelay) SetTLSConfig(cfg *tls.Config) {
+	m.tlsConfig.Store(cfg)
+	if m.Server.TLS != nil {
+		return
+	}
+
+	// Restart the server with TLS. The config is looked up on every handshake, since Certificates
+	// (filled in by httptest) take precedence over the GetCertificate hook when the client sends no SNI.
+	m.Server.Close()
+	m.Server = m.newUnstartedServer()
+	m.Server.TLS = &tls.Config{
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return m.tlsConfig.Load(), nil
+		},
+	}
+	m.Server.StartTLS()
+	m.updateRelayEntry()
+}
+
+// Shutdown stops the server gracefully, unlike Server.Close: it stops accepting connections, and waits for the
+// requests in flight to complete or for the context to expire
+func (m *mockRelay) Shutdown(ctx context.Context) error {
+	return m.Server.Config.Shutdown(ctx)
+}
+
+// newUnstartedServer creates a server for the relay, which counts the opened and closed connections
+func (m *mockRelay) newUnstartedServer() *httptest.Server {
+	server := httptest.NewUnstartedServer(m.getRouter())
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		switch state {
+		case http.StateNew:
+			m.ConnectionOpened()
+		case http.StateHijacked, http.StateClosed:
+			m.ConnectionClosed()
+		case http.StateActive, http.StateIdle:
+		}
+	}
+	return server
+}
+
+// ConnectionOpened increments the opened connections counter
+func (m *mockRelay) ConnectionOpened() {
+	m.connectionsOpened.Add(1)
+}
+
+// ConnectionClosed increments the closed connections counter
+func (m *mockRelay) ConnectionClosed() {
+	m.connectionsClosed.Add(1)
+}
+
+// ActiveConnections returns the number of connections currently open to the relay
+func (m *mockRelay) ActiveConnections() int64 {
+	return m.connectionsOpened.Load() - m.connectionsClosed.Load()
+}
+
+// TotalConnectionsOpened returns the number of connections opened to the relay since it started
+func (m *mockRelay) TotalConnectionsOpened() int64 {
+	return m.connectionsOpened.Load()
+}
+
+// newTestMiddleware creates a middleware which increases the Request counter, records the request sequence and
+// creates a fake delay for the response
 func (m *mockRelay) newTestMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
+			// Record the request once the response is written, including a panic response
+			capture := &responseCapture{ResponseWriter: w}
+			w = capture
+			defer func() {
+				m.mu.Lock()
+				m.requestSequence = append(m.requestSequence, RequestSequenceEntry{
+					Timestamp: time.Now(),
+					Path:      r.URL.EscapedPath(),
+					Status:    capture.Status(),
+				})
+				m.mu.Unlock()
+			}()
+
+			// A panicking handler override results in an error response instead of a hanging test
+			defer func() {
+				if rec := recover(); rec != nil {
+					// Let the server abort the response as requested
+					if rec == http.ErrAbortHandler {
+						panic(rec)
+					}
+					m.t.Logf("mock relay handler for %s panicked: %v\n%s", r.URL.Path, rec, debug.Stack())
+					http.Error(w, fmt.Sprintf("handler panic: %v", rec), http.StatusInternalServerError)
+				}
+			}()
+
 			// Request counter
 			m.mu.Lock()
 			url := r.URL.EscapedPath()
@@ -106,11 +407,189 @@ func (m *mockRelay) newTestMiddleware(next http.Handler) http.Handler {
 				time.Sleep(m.ResponseDelay)
 			}
 
+			if m.EnableCORS {
+				m.setCORSHeaders(w)
+				if r.Method == http.MethodOptions {
+					m.handleCORSPreflight(w, r)
+					return
+				}
+			}
+
+			if m.RequiredHeader != "" && r.Header.Get(m.RequiredHeader) == "" {
+				http.Error(w, fmt.Sprintf("%s: %s", errMissingRequiredHeader, m.RequiredHeader), http.StatusUnauthorized)
+				return
+			}
+
+			if m.UseGzipRequests && r.Header.Get("Content-Encoding") == "gzip" {
+				body, err := gzip.NewReader(r.Body)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				defer body.Close()
+				r.Body = body
+				r.Header.Del("Content-Encoding")
+			}
+
+			// Delegate to the handler for the client version, if any
+			if handler, ok := m.versionHandler(r); ok {
+				handler.ServeHTTP(w, r)
+				return
+			}
+
 			next.ServeHTTP(w, r)
 		},
 	)
 }
 
+// RequestSequenceEntry is a request received by the mock relay, see RequestSequence
+type RequestSequenceEntry struct {
+	Timestamp time.Time
+	Path      string
+	Status    int // status code of the response
+}
+
+// RequestSequence returns the requests received by the relay so far, in the order their responses were written,
+// to tell in which order the endpoints were called when a test fails
+func (m *mockRelay) RequestSequence() []RequestSequenceEntry {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]RequestSequenceEntry{}, m.requestSequence...)
+}
+
+// responseCapture is an http.ResponseWriter keeping the status code of the response
+type responseCapture struct {
+	http.ResponseWriter
+	status int
+}
+
+func (c *responseCapture) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *responseCapture) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	return c.ResponseWriter.Write(b)
+}
+
+// Hijack lets the constraint stream upgrade the connection to a websocket
+func (c *responseCapture) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && c.status == 0 {
+		c.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+func (c *responseCapture) Unwrap() http.ResponseWriter {
+	return c.ResponseWriter
+}
+
+// Status returns the status code of the response, http.StatusOK if the handler wrote nothing
+func (c *responseCapture) Status() int {
+	if c.status == 0 {
+		return http.StatusOK
+	}
+	return c.status
+}
+
+// SetHandlerForVersion makes the relay serve requests to path (a route template) from clients sending the given
+// X-Bolt-Version header with handler, instead of the default handler
+func (m *mockRelay) SetHandlerForVersion(version, path string, handler http.Handler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.versionedHandlers == nil {
+		m.versionedHandlers = make(map[string]http.Handler)
+	}
+	router, ok := m.versionedHandlers[version].(*mux.Router)
+	if !ok {
+		router = mux.NewRouter()
+		m.versionedHandlers[version] = router
+	}
+	router.Handle(path, handler)
+}
+
+// versionHandler returns the handler set for the X-Bolt-Version and path of the request, if any
+func (m *mockRelay) versionHandler(r *http.Request) (http.Handler, bool) {
+	version := r.Header.Get(HeaderKeyBoltVersion)
+	if version == "" {
+		return nil, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	router, ok := m.versionedHandlers[version].(*mux.Router)
+	if !ok {
+		return nil, false
+	}
+	var match mux.RouteMatch
+	if !router.Match(r, &match) {
+		return nil, false
+	}
+	return router, true
+}
+
+// setCORSHeaders adds the CORS headers to the response
+func (m *mockRelay) setCORSHeaders(w http.ResponseWriter) {
+	allowOrigin := m.CORSAllowOrigin
+	if allowOrigin == "" {
+		allowOrigin = "*"
+	}
+	w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(m.corsAllowedMethods(), ", "))
+	w.Header().Set("Access-Control-Allow-Headers", "Accept, Content-Type, Eth-Consensus-Version")
+}
+
+// corsAllowedMethods returns CORSAllowedMethods, or the default methods if it is not set
+func (m *mockRelay) corsAllowedMethods() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.CORSAllowedMethods) == 0 {
+		return []string{http.MethodGet, http.MethodPost, http.MethodOptions}
+	}
+	return m.CORSAllowedMethods
+}
+
+// handleCORSPreflight answers a preflight request, checking the method it announces against the allowed methods
+func (m *mockRelay) handleCORSPreflight(w http.ResponseWriter, r *http.Request) {
+	if r.Header.Get("Origin") == "" {
+		http.Error(w, errMissingOrigin.Error(), http.StatusBadRequest)
+		return
+	}
+	if method := r.Header.Get("Access-Control-Request-Method"); method != "" {
+		allowed := false
+		for _, allowedMethod := range m.corsAllowedMethods() {
+			if method == allowedMethod {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			http.Error(w, fmt.Sprintf("%s: %s", errCORSMethodNotAllowed, method), http.StatusForbidden)
+			return
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetCORSAllowedMethods enables CORS, allowing the given methods in preflight requests
+func (m *mockRelay) SetCORSAllowedMethods(methods ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.EnableCORS = true
+	m.CORSAllowedMethods = methods
+}
+
 // getRouter registers all methods from the backend, apply the test middleware and return the configured router
 func (m *mockRelay) getRouter() http.Handler {
 	// Create router.
@@ -124,73 +603,770 @@ func (m *mockRelay) getRouter() http.Handler {
 	r.HandleFunc(pathGetHeaderWithProofs, m.handleGetHeaderWithProofs).Methods(http.MethodGet)
 	r.HandleFunc(pathSubmitConstraint, m.handleSubmitConstraint).Methods(http.MethodPost)
 	r.HandleFunc(pathGetPayload, m.handleGetPayload).Methods(http.MethodPost)
+	r.HandleFunc(pathConstraints, m.handleConstraints).Methods(http.MethodGet)
+	r.HandleFunc(pathDeleteConstraint, m.handleDeleteConstraint).Methods(http.MethodDelete)
+	r.HandleFunc(pathConstraintStatus, m.handleConstraintStatus).Methods(http.MethodGet)
+	r.HandleFunc(pathConstraintStream, m.handleConstraintStream).Methods(http.MethodGet)
+	r.HandleFunc(pathCapabilities, m.handleCapabilities).Methods(http.MethodGet)
+	r.HandleFunc(pathConstraintTypes, m.handleConstraintTypes).Methods(http.MethodGet)
+	r.HandleFunc(pathGetConstraintProof, m.handleGetConstraintProof).Methods(http.MethodGet)
+	r.HandleFunc(pathPayloadAttestation, m.handlePayloadAttestation).Methods(http.MethodGet)
+	r.HandleFunc(pathRegisteredValidators, m.handleRegisteredValidators).Methods(http.MethodGet)
+	r.HandleFunc(pathBoltOptIn, m.handleBoltOptIn).Methods(http.MethodPost)
+
+	// Catch-all route, registered last so that it only gets the requests whose path is not matched by the routes
+	// above. Requests to a known path with another method are still answered with 405: the method mismatch must
+	// be checked before the path matcher, which clears it.
+	r.MatcherFunc(func(_ *http.Request, match *mux.RouteMatch) bool {
+		return !errors.Is(match.MatchErr, mux.ErrMethodMismatch)
+	}).PathPrefix("/").HandlerFunc(m.handleAllPaths)
+
+	r.Use(m.strictModeMiddleware)
+	r.Use(m.callSequenceMiddleware)
+
+	return m.newTestMiddleware(r)
+}
+
+// strictModeMiddleware fails the test on requests to unexpected routes if StrictMode is enabled
+func (m *mockRelay) strictModeMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			if m.StrictMode {
+				path, err := mux.CurrentRoute(r).GetPathTemplate()
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+
+				m.mu.Lock()
+				expected := m.expectedPaths[path] || m.hasHandlerOverride(path)
+				m.mu.Unlock()
+				if !expected {
+					m.errorf("unexpected call to %s", path)
+					http.Error(w, fmt.Sprintf("unexpected call to %s", path), http.StatusInternalServerError)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+// ExpectPaths allows requests to the given routes (path templates, such as pathGetHeader) in StrictMode
+func (m *mockRelay) ExpectPaths(paths ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.expectedPaths == nil {
+		m.expectedPaths = make(map[string]bool)
+	}
+	for _, path := range paths {
+		m.expectedPaths[path] = true
+	}
+}
+
+// callSequenceMiddleware records the route of each request once a sequence is expected, see ExpectSequence
+func (m *mockRelay) callSequenceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			m.mu.Lock()
+			if m.expectedSequence != nil {
+				if path, err := mux.CurrentRoute(r).GetPathTemplate(); err == nil {
+					m.callSequence = append(m.callSequence, path)
+				}
+			}
+			m.mu.Unlock()
+			next.ServeHTTP(w, r)
+		},
+	)
+}
+
+// ExpectSequence sets the routes (path templates, such as pathGetHeader) the relay must be called on, in this order
+// and with no other call in between, and starts recording the calls. Check the calls with AssertSequence.
+func (m *mockRelay) ExpectSequence(paths ...string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.expectedSequence = append([]string{}, paths...)
+	m.callSequence = []string{}
+}
+
+// AssertSequence fails the test if the calls received since ExpectSequence are not the expected sequence
+func (m *mockRelay) AssertSequence(t *testing.T) {
+	t.Helper()
+	if err := m.checkSequence(); err != nil {
+		t.Error(err)
+	}
+}
+
+// checkSequence returns an error if the calls received since ExpectSequence are not the expected sequence
+func (m *mockRelay) checkSequence() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.callSequence) == len(m.expectedSequence) {
+		match := true
+		for i, path := range m.expectedSequence {
+			if m.callSequence[i] != path {
+				match = false
+				break
+			}
+		}
+		if match {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: expected %v, got %v", errUnexpectedCallSequence, m.expectedSequence, m.callSequence)
+}
+
+// hasHandlerOverride returns whether the handler of the route is overridden. m.mu must be held.
+func (m *mockRelay) hasHandlerOverride(path string) bool {
+	switch path {
+	case pathRegisterValidator:
+		return m.handlerOverrideRegisterValidator != nil
+	case pathSubmitConstraint:
+		return m.handlerOverrideSubmitConstraint != nil
+	case pathGetHeader:
+		return m.handlerOverrideGetHeader != nil
+	case pathGetHeaderWithProofs:
+		return m.handlerOverrideGetHeaderWithProofs != nil
+	case pathGetPayload:
+		return m.handlerOverrideGetPayload != nil
+	default:
+		return false
+	}
+}
+
+// handleAllPaths serves the requests not matched by any other route with the handler set with
+// SetHandlerForAllPaths, and responds 404 by default
+func (m *mockRelay) handleAllPaths(w http.ResponseWriter, req *http.Request) {
+	m.mu.Lock()
+	handler := m.handlerAllPaths
+	m.mu.Unlock()
+
+	if handler == nil {
+		http.NotFound(w, req)
+		return
+	}
+	handler(w, req)
+}
+
+// SetHandlerForAllPaths makes the relay serve the requests to any path without a route with handler, such as
+// to test the connectivity to the relay at the network level
+func (m *mockRelay) SetHandlerForAllPaths(handler func(w http.ResponseWriter, req *http.Request)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.handlerAllPaths = handler
+}
+
+// GetRequestCount returns the number of Request made to a specific URL
+func (m *mockRelay) GetRequestCount(path string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.requestCount[path]
+}
+
+// By default, handleRoot returns the relay's status
+func (m *mockRelay) handleRoot(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{}`)
+}
+
+// By default, handleStatus returns the relay's status as http.StatusOK
+func (m *mockRelay) handleStatus(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, `{}`)
+}
+
+// By default, handleRegisterValidator returns a default builderApiV1.SignedValidatorRegistration
+func (m *mockRelay) handleRegisterValidator(w http.ResponseWriter, req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.handlerOverrideRegisterValidator != nil {
+		m.handlerOverrideRegisterValidator(w, req)
+		return
+	}
+	m.defaultHandleRegisterValidator(w, req)
+}
+
+// defaultHandleRegisterValidator returns the default handler for handleRegisterValidator
+func (m *mockRelay) defaultHandleRegisterValidator(w http.ResponseWriter, req *http.Request) {
+	payload := []*builderApiV1.SignedValidatorRegistration{}
+	if err := DecodeJSONRequest(req, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	m.recordedRegistrations = append(m.recordedRegistrations, payload...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+}
+
+// handleRegisteredValidators returns the validator registrations received so far, or RegisteredValidatorsResponse
+// if set
+func (m *mockRelay) handleRegisteredValidators(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	response := m.recordedRegistrations
+	if m.RegisteredValidatorsResponse != nil {
+		response = m.RegisteredValidatorsResponse
+	}
+	if response == nil {
+		response = []*builderApiV1.SignedValidatorRegistration{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleBoltOptIn captures the opt-in of a validator to the BOLT constraint protocol
+func (m *mockRelay) handleBoltOptIn(w http.ResponseWriter, req *http.Request) {
+	payload := SignedValidatorOptIn{}
+	if err := DecodeJSONRequest(req, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.SlotRange.Start > payload.SlotRange.End {
+		http.Error(w, fmt.Sprintf("%s: start %d after end %d", errInvalidSlotRange, payload.SlotRange.Start, payload.SlotRange.End), http.StatusBadRequest)
+		return
+	}
+
+	m.mu.Lock()
+	m.capturedOptIns = append(m.capturedOptIns, payload)
+	m.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// CapturedOptIns returns the validator opt-ins received by the relay, in order
+func (m *mockRelay) CapturedOptIns() []SignedValidatorOptIn {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]SignedValidatorOptIn{}, m.capturedOptIns...)
+}
+
+func (m *mockRelay) handleSubmitConstraint(w http.ResponseWriter, req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.handlerOverrideSubmitConstraint != nil {
+		m.handlerOverrideSubmitConstraint(w, req)
+		return
+	}
+	m.defaultHandleSubmitConstraint(w, req)
+}
+
+func (m *mockRelay) defaultHandleSubmitConstraint(w http.ResponseWriter, req *http.Request) {
+	payload := BatchedSignedConstraints{}
+	if err := DecodeJSONRequest(req, &payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	strict := m.constraintValidationMode == ConstraintValidationStrict
+
+	if m.BlockBaseFee != nil || strict {
+		if err := m.checkConstraintFees(payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if m.VerifyConstraintSignatures || strict {
+		if err := m.checkConstraintSignatures(payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if m.MaxBlockGasLimit > 0 || strict {
+		if err := m.checkConstraintGasLimit(payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if strict {
+		if err := m.checkConstraintSlots(payload); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	m.capturedConstraints = append(m.capturedConstraints, payload...)
+	m.constraintsCond.Broadcast()
+
+	// Push the acknowledgment to the proposers, like a relay notifying the client
+	m.ackConstraints(payload)
+
+	if m.ConstraintSuccessStatusCode == http.StatusNoContent {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(m.ConstraintSuccessStatusCode)
+}
+
+// RegisterConstraintAckCallback sets a callback called asynchronously with the constraints signed by pubkey
+// of every batch accepted by the default submitConstraint handler
+func (m *mockRelay) RegisterConstraintAckCallback(pubkey string, fn func(BatchedSignedConstraints)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.constraintAckCallbacks == nil {
+		m.constraintAckCallbacks = make(map[string]func(BatchedSignedConstraints))
+	}
+	m.constraintAckCallbacks[strings.ToLower(pubkey)] = fn
+}
+
+// ackConstraints calls the acknowledgment callback of each proposer asynchronously with the messages of the batch
+// it signed, as the messages only carry the validator index of the proposer. m.mu must be held.
+func (m *mockRelay) ackConstraints(payload BatchedSignedConstraints) {
+	for pubkey, callback := range m.constraintAckCallbacks {
+		pubkeyBytes, err := hexutil.Decode(pubkey)
+		if err != nil {
+			continue
+		}
+		pk, err := bls.PublicKeyFromBytes(pubkeyBytes)
+		if err != nil {
+			continue
+		}
+
+		signed := BatchedSignedConstraints{}
+		for _, signedConstraints := range payload {
+			batch := BatchedSignedConstraints{signedConstraints}
+			if VerifyBatchedSignatures(batch, []*bls.PublicKey{pk}) == nil {
+				signed = append(signed, signedConstraints)
+			}
+		}
+		if len(signed) > 0 {
+			go callback(signed)
+		}
+	}
+}
+
+// checkConstraintFees returns an error if a constrained transaction can't be decoded, or if its max fee per gas
+// (or gas price) is below BlockBaseFee
+func (m *mockRelay) checkConstraintFees(payload BatchedSignedConstraints) error {
+	baseFee := new(uint256.Int)
+	if m.BlockBaseFee != nil {
+		baseFee = m.BlockBaseFee
+	}
+	for _, signedConstraints := range payload {
+		for _, constraint := range signedConstraints.Message.Constraints {
+			tx := new(types.Transaction)
+			if err := tx.UnmarshalBinary(constraint.Tx); err != nil {
+				return err
+			}
+			if tx.GasFeeCap().Cmp(baseFee.ToBig()) < 0 {
+				return fmt.Errorf("%w: tx %s", errConstraintTxFeeTooLow, tx.Hash())
+			}
+		}
+	}
+	return nil
+}
+
+// checkConstraintSignatures returns an error if a message of the batch is not signed by the proposer public key
+func (m *mockRelay) checkConstraintSignatures(payload BatchedSignedConstraints) error {
+	proposerPublicKey, err := bls.PublicKeyFromBytes(m.proposerPublicKey[:])
+	if err != nil {
+		return err
+	}
+	pks := make([]*bls.PublicKey, len(payload))
+	for i := range pks {
+		pks[i] = proposerPublicKey
+	}
+	return VerifyBatchedSignatures(payload, pks)
+}
+
+// checkConstraintGasLimit returns an error if the total gas limit declared by the constraints of the batch
+// is above MaxBlockGasLimit, or mockRelayDefaultBlockGasLimit if it is not set
+func (m *mockRelay) checkConstraintGasLimit(payload BatchedSignedConstraints) error {
+	maxGasLimit := m.MaxBlockGasLimit
+	if maxGasLimit == 0 {
+		maxGasLimit = mockRelayDefaultBlockGasLimit
+	}
+	total := uint64(0)
+	for _, signedConstraints := range payload {
+		// Compare before adding, so that the total cannot overflow
+		if signedConstraints.Message.GasLimit > maxGasLimit-total {
+			return fmt.Errorf("%w: above the maximum of %d", errConstraintGasLimitTooHigh, maxGasLimit)
+		}
+		total += signedConstraints.Message.GasLimit
+	}
+	return nil
+}
+
+// checkConstraintSlots returns an error if a message of the batch is for a slot outside of
+// [MinConstraintSlot, MaxConstraintSlot]
+func (m *mockRelay) checkConstraintSlots(payload BatchedSignedConstraints) error {
+	for _, signedConstraints := range payload {
+		slot := signedConstraints.Message.Slot
+		if slot < m.MinConstraintSlot || (m.MaxConstraintSlot != 0 && slot > m.MaxConstraintSlot) {
+			return fmt.Errorf("%w: slot %d, accepted range [%d, %d]", errConstraintSlotOutOfRange, slot, m.MinConstraintSlot, m.MaxConstraintSlot)
+		}
+	}
+	return nil
+}
+
+// SetConstraintValidationMode sets how thoroughly the default submitConstraint handler validates the constraints.
+// The strict mode needs the proposer public key, see SetProposerSigningDomain.
+func (m *mockRelay) SetConstraintValidationMode(mode ConstraintValidationMode) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.constraintValidationMode = mode
+}
+
+// capturedConstraintsForSlot returns the captured constraints for the given slot. m.mu must be held.
+func (m *mockRelay) capturedConstraintsForSlot(slot uint64) BatchedSignedConstraints {
+	constraints := BatchedSignedConstraints{}
+	for _, signedConstraints := range m.capturedConstraints {
+		if signedConstraints.Message.Slot == slot {
+			constraints = append(constraints, signedConstraints)
+		}
+	}
+	return constraints
+}
+
+// WaitForConstraintSubmission blocks until constraints for the slot have been captured, or the timeout expires
+func (m *mockRelay) WaitForConstraintSubmission(slot phase0.Slot, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+
+	// Wake up the waiter once the timeout expires
+	timer := time.AfterFunc(timeout, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		m.constraintsCond.Broadcast()
+	})
+	defer timer.Stop()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for len(m.capturedConstraintsForSlot(uint64(slot))) == 0 {
+		if !time.Now().Before(deadline) {
+			return fmt.Errorf("%w: slot %d", errConstraintSubmissionTimeout, slot)
+		}
+		m.constraintsCond.Wait()
+	}
+	return nil
+}
+
+// handleConstraintStream accepts WebSocket connections to the constraint stream, and captures the batches
+// of constraints received on them like the default submitConstraint handler
+func (m *mockRelay) handleConstraintStream(w http.ResponseWriter, req *http.Request) {
+	upgrader := websocket.Upgrader{}
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		return // the upgrader already responded with an error
+	}
+	defer conn.Close()
+
+	m.mu.Lock()
+	m.constraintStreams = append(m.constraintStreams, conn)
+	m.constraintStreamsOpened++
+	m.mu.Unlock()
+
+	for {
+		payload := BatchedSignedConstraints{}
+		if err := conn.ReadJSON(&payload); err != nil {
+			return
+		}
+
+		m.mu.Lock()
+		m.capturedConstraints = append(m.capturedConstraints, payload...)
+		m.constraintsCond.Broadcast()
+		m.mu.Unlock()
+	}
+}
+
+// handleCapabilities returns the versions of the constraint and proof API supported by the relay
+func (m *mockRelay) handleCapabilities(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	response := &CapabilitiesResponse{ConstraintAPIVersions: []APIVersion{ConstraintAPIVersionV1}}
+	if m.CapabilitiesResponse != nil {
+		response = m.CapabilitiesResponse
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleConstraintTypes returns the types of constraints supported by the relay
+func (m *mockRelay) handleConstraintTypes(w http.ResponseWriter, _ *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	response := &ConstraintTypesResponse{ConstraintTypes: []string{ConstraintTypeTxInclusion}}
+	if m.ConstraintTypesResponse != nil {
+		response = m.ConstraintTypesResponse
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// DisconnectConstraintStreams closes all the WebSocket connections currently open on the constraint stream
+func (m *mockRelay) DisconnectConstraintStreams() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, conn := range m.constraintStreams {
+		conn.Close()
+	}
+	m.constraintStreams = nil
+}
+
+// ConstraintStreamsOpened returns the number of WebSocket connections opened on the constraint stream
+func (m *mockRelay) ConstraintStreamsOpened() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.constraintStreamsOpened
+}
+
+// handleConstraints returns the constraints captured for the slot given as query argument
+func (m *mockRelay) handleConstraints(w http.ResponseWriter, req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	slot, err := strconv.ParseUint(req.URL.Query().Get("slot"), 10, 64)
+	if err != nil {
+		http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(m.capturedConstraintsForSlot(slot)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// handleGetConstraintProof returns the inclusion proof of the constrained transactions given as tx_hashes query
+// argument, for the slot given as query argument. The proof is against a block made of these transactions only,
+// in the requested order.
+func (m *mockRelay) handleGetConstraintProof(w http.ResponseWriter, req *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	slot, err := strconv.ParseUint(req.URL.Query().Get("slot"), 10, 64)
+	if err != nil {
+		http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Constrained transactions of the slot, by hash
+	txs := make(map[phase0.Hash32]Transaction)
+	for _, signedConstraints := range m.capturedConstraintsForSlot(slot) {
+		for _, constraint := range signedConstraints.Message.Constraints {
+			hash, err := constraint.TxHash()
+			if err != nil {
+				continue
+			}
+			txs[hash] = constraint.Tx
+		}
+	}
+
+	transactions := new(utilbellatrix.ExecutionPayloadTransactions)
+	constraints := []struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}{}
+	for _, hashHex := range strings.Split(req.URL.Query().Get("tx_hashes"), ",") {
+		hashBytes, err := hexutil.Decode(hashHex)
+		if err != nil || len(hashBytes) != len(phase0.Hash32{}) {
+			http.Error(w, errInvalidHash.Error(), http.StatusBadRequest)
+			return
+		}
+		hash := phase0.Hash32(hashBytes)
+		tx, ok := txs[hash]
+		if !ok {
+			http.Error(w, fmt.Sprintf("no constraint for transaction %s", hash), http.StatusNotFound)
+			return
+		}
+		transactions.Transactions = append(transactions.Transactions, bellatrix.Transaction(tx))
+		constraints = append(constraints, struct {
+			tx   Transaction
+			hash phase0.Hash32
+		}{tx, hash})
+	}
+
+	rootNode, err := transactions.GetTree()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Hash the tree before computing the proof, see MakeGetHeaderWithConstraintsResponse
+	rootNode.Hash()
+	proof, err := CalculateMerkleMultiProofs(rootNode, constraints)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	return m.newTestMiddleware(r)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(proof); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 }
 
-// GetRequestCount returns the number of Request made to a specific URL
-func (m *mockRelay) GetRequestCount(path string) int {
+// handleDeleteConstraint removes the captured constraints of the transactions listed in the cancellation,
+// for the slot given as query argument. The cancellation must be signed in the builder domain by the proposer
+// public key set with SetProposerSigningDomain, like BoostService.CancelConstraints does.
+func (m *mockRelay) handleDeleteConstraint(w http.ResponseWriter, req *http.Request) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	return m.requestCount[path]
-}
 
-// By default, handleRoot returns the relay's status
-func (m *mockRelay) handleRoot(w http.ResponseWriter, _ *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{}`)
-}
+	slot, err := strconv.ParseUint(req.URL.Query().Get("slot"), 10, 64)
+	if err != nil {
+		http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
+		return
+	}
+
+	payload := new(SignedCancelConstraints)
+	if err := DecodeJSONRequest(req, payload); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if payload.Message.Slot != slot {
+		http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
+		return
+	}
+	ok, err := ssz.VerifySignature(&payload.Message, ssz.DomainBuilder, m.proposerPublicKey[:], payload.Signature[:])
+	if err != nil || !ok {
+		http.Error(w, errInvalidCancellationSignature.Error(), http.StatusBadRequest)
+		return
+	}
+	m.cancelledConstraints = append(m.cancelledConstraints, payload)
+
+	cancelled := make(map[phase0.Hash32]bool, len(payload.Message.TransactionHashes))
+	for _, txHash := range payload.Message.TransactionHashes {
+		cancelled[txHash] = true
+	}
+
+	remaining := make(BatchedSignedConstraints, 0, len(m.capturedConstraints))
+	for _, signedConstraints := range m.capturedConstraints {
+		if signedConstraints.Message.Slot != slot {
+			remaining = append(remaining, signedConstraints)
+			continue
+		}
+
+		constraints := make([]*Constraint, 0, len(signedConstraints.Message.Constraints))
+		for _, constraint := range signedConstraints.Message.Constraints {
+			txHash, err := constraint.TxHash()
+			if err != nil || !cancelled[txHash] {
+				constraints = append(constraints, constraint)
+			}
+		}
+		if len(constraints) == 0 {
+			continue
+		}
+
+		kept := *signedConstraints
+		kept.Message.Constraints = constraints
+		remaining = append(remaining, &kept)
+	}
+	m.capturedConstraints = remaining
 
-// By default, handleStatus returns the relay's status as http.StatusOK
-func (m *mockRelay) handleStatus(w http.ResponseWriter, _ *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, `{}`)
 }
 
-// By default, handleRegisterValidator returns a default builderApiV1.SignedValidatorRegistration
-func (m *mockRelay) handleRegisterValidator(w http.ResponseWriter, req *http.Request) {
+// handleConstraintStatus returns the hashes of the transactions constrained for the slot given as query argument
+func (m *mockRelay) handleConstraintStatus(w http.ResponseWriter, req *http.Request) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if m.handlerOverrideRegisterValidator != nil {
-		m.handlerOverrideRegisterValidator(w, req)
+
+	slot, err := strconv.ParseUint(req.URL.Query().Get("slot"), 10, 64)
+	if err != nil {
+		http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
 		return
 	}
-	m.defaultHandleRegisterValidator(w, req)
-}
 
-// defaultHandleRegisterValidator returns the default handler for handleRegisterValidator
-func (m *mockRelay) defaultHandleRegisterValidator(w http.ResponseWriter, req *http.Request) {
-	payload := []builderApiV1.SignedValidatorRegistration{}
-	if err := DecodeJSON(req.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+	response := ConstraintStatusResponse{TransactionHashes: []phase0.Hash32{}}
+	for _, signedConstraints := range m.capturedConstraintsForSlot(slot) {
+		for _, constraint := range signedConstraints.Message.Constraints {
+			txHash, err := constraint.TxHash()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			response.TransactionHashes = append(response.TransactionHashes, txHash)
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 }
 
-func (m *mockRelay) handleSubmitConstraint(w http.ResponseWriter, req *http.Request) {
+// handlePayloadAttestation returns the attestation, signed with the relay key, that the payload with the block hash
+// given as query argument includes the constraints captured for the slot given as query argument
+func (m *mockRelay) handlePayloadAttestation(w http.ResponseWriter, req *http.Request) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	if m.handlerOverrideSubmitConstraint != nil {
-		m.handlerOverrideSubmitConstraint(w, req)
+
+	slot, err := strconv.ParseUint(req.URL.Query().Get("slot"), 10, 64)
+	if err != nil {
+		http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
+		return
+	}
+	blockHash, err := hexutil.Decode(req.URL.Query().Get("block_hash"))
+	if err != nil || len(blockHash) != len(phase0.Hash32{}) {
+		http.Error(w, errInvalidHash.Error(), http.StatusBadRequest)
 		return
 	}
-	m.defaultHandleSubmitConstraint(w, req)
-}
 
-func (m *mockRelay) defaultHandleSubmitConstraint(w http.ResponseWriter, req *http.Request) {
-	payload := BatchedSignedConstraints{}
-	if err := DecodeJSON(req.Body, &payload); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	attestation := SignedPayloadAttestation{
+		Message: PayloadAttestation{
+			Slot:              slot,
+			BlockHash:         phase0.Hash32(blockHash),
+			TransactionHashes: []phase0.Hash32{},
+		},
+	}
+	for _, signedConstraints := range m.capturedConstraintsForSlot(slot) {
+		for _, constraint := range signedConstraints.Message.Constraints {
+			txHash, err := constraint.TxHash()
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			attestation.Message.TransactionHashes = append(attestation.Message.TransactionHashes, txHash)
+		}
+	}
+
+	signature, err := ssz.SignMessage(&attestation.Message, ssz.DomainBuilder, m.secretKey)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	attestation.Signature = signature
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(attestation); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 }
 
 func (m *mockRelay) MakeGetHeaderWithConstraintsResponse(value uint64, blockHash, parentHash, publicKey string, version spec.DataVersion, constraints []struct {
@@ -231,6 +1407,31 @@ func (m *mockRelay) MakeGetHeaderWithConstraintsResponse(value uint64, blockHash
 // MakeGetHeaderResponse is used to create the default or can be used to create a custom response to the getHeader
 // method
 func (m *mockRelay) MakeGetHeaderResponse(value uint64, blockHash, parentHash, publicKey string, version spec.DataVersion) *builderSpec.VersionedSignedBuilderBid {
+	return m.MakeGetHeaderResponseWithTimestamp(value, blockHash, parentHash, publicKey, version, 0)
+}
+
+// MakeGetHeaderResponseWithTimestamp creates a getHeader response like MakeGetHeaderResponse, with the given
+// timestamp in the payload header
+func (m *mockRelay) MakeGetHeaderResponseWithTimestamp(value uint64, blockHash, parentHash, publicKey string, version spec.DataVersion, timestamp uint64) *builderSpec.VersionedSignedBuilderBid {
+	return m.makeGetHeaderResponse(value, blockHash, parentHash, publicKey, version, timestamp, phase0.Root{})
+}
+
+// SetGetHeaderResponseWithWithdrawals sets GetHeaderResponse to a bid created like MakeGetHeaderResponse, whose
+// header commits to the given withdrawals instead of an empty withdrawals root. It returns the withdrawals root.
+func (m *mockRelay) SetGetHeaderResponseWithWithdrawals(withdrawals []*capella.Withdrawal, value uint64, blockHash, parentHash, publicKey string, version spec.DataVersion) phase0.Root {
+	withdrawalsRoot, err := (&utilcapella.ExecutionPayloadWithdrawals{Withdrawals: withdrawals}).HashTreeRoot()
+	require.NoError(m.t, err)
+
+	response := m.makeGetHeaderResponse(value, blockHash, parentHash, publicKey, version, 0, withdrawalsRoot)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.GetHeaderResponse = response
+	return withdrawalsRoot
+}
+
+// makeGetHeaderResponse creates a signed getHeader response with the given fields of the payload header
+func (m *mockRelay) makeGetHeaderResponse(value uint64, blockHash, parentHash, publicKey string, version spec.DataVersion, timestamp uint64, withdrawalsRoot phase0.Root) *builderSpec.VersionedSignedBuilderBid {
 	switch version {
 	case spec.DataVersionCapella:
 		// Fill the payload with custom values.
@@ -238,7 +1439,8 @@ func (m *mockRelay) MakeGetHeaderResponse(value uint64, blockHash, parentHash, p
 			Header: &capella.ExecutionPayloadHeader{
 				BlockHash:       _HexToHash(blockHash),
 				ParentHash:      _HexToHash(parentHash),
-				WithdrawalsRoot: phase0.Root{},
+				WithdrawalsRoot: withdrawalsRoot,
+				Timestamp:       timestamp,
 			},
 			Value:  uint256.NewInt(value),
 			Pubkey: _HexToPubkey(publicKey),
@@ -261,8 +1463,9 @@ func (m *mockRelay) MakeGetHeaderResponse(value uint64, blockHash, parentHash, p
 			Header: &deneb.ExecutionPayloadHeader{
 				BlockHash:       _HexToHash(blockHash),
 				ParentHash:      _HexToHash(parentHash),
-				WithdrawalsRoot: phase0.Root{},
+				WithdrawalsRoot: withdrawalsRoot,
 				BaseFeePerGas:   uint256.NewInt(0),
+				Timestamp:       timestamp,
 			},
 			BlobKZGCommitments: make([]deneb.KZGCommitment, 0),
 			Value:              uint256.NewInt(value),
@@ -354,90 +1557,336 @@ func (m *mockRelay) MakeGetHeaderWithProofsResponseWithTxsRoot(value uint64, blo
 func (m *mockRelay) handleGetHeader(w http.ResponseWriter, req *http.Request) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if m.CaptureGetHeaderParams {
+		params, err := parseGetHeaderParams(req)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		m.capturedGetHeaderParams = append(m.capturedGetHeaderParams, params)
+	}
+	if m.WaitForBidMS != 0 {
+		w.Header().Set(HeaderWaitForBid, strconv.Itoa(m.WaitForBidMS))
+	}
 	// Try to override default behavior is custom handler is specified.
 	if m.handlerOverrideGetHeader != nil {
 		m.handlerOverrideGetHeader(w, req)
 		return
 	}
-	m.defaultHandleGetHeader(w)
+	m.defaultHandleGetHeader(w, req)
 }
 
-// defaultHandleGetHeader returns the default handler for handleGetHeader
-func (m *mockRelay) defaultHandleGetHeader(w http.ResponseWriter) {
-	// By default, everything will be ok.
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
+// defaultHandleGetHeader returns the default handler for handleGetHeader. m.mu must be held.
+func (m *mockRelay) defaultHandleGetHeader(w http.ResponseWriter, req *http.Request) {
 	// Build the default response.
 	response := m.MakeGetHeaderResponse(
 		12345,
 		"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
 		"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
-		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249",
+		m.RelayEntry.PublicKey.String(),
 		spec.DataVersionCapella,
 	)
 
-	if m.GetHeaderResponse != nil {
+	parentHashResponse := m.getHeaderResponseForParentHash(req)
+
+	switch {
+	case len(m.getHeaderResponseSequence) > 0:
+		response = m.getHeaderResponseSequence[m.getHeaderSequenceIndex]
+		m.getHeaderSequenceIndex = (m.getHeaderSequenceIndex + 1) % len(m.getHeaderResponseSequence)
+	case parentHashResponse != nil:
+		response = parentHashResponse
+	case m.GetHeaderResponseIfConstraintsPresent != nil && m.hasCapturedConstraints(req):
+		response = m.GetHeaderResponseIfConstraintsPresent
+	case m.GetHeaderResponse != nil:
 		response = m.GetHeaderResponse
+
+		// A block must build on the previously returned one, so its number must be the next one
+		blockNumber, err := response.BlockNumber()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if blockNumber != 0 {
+			if m.lastReturnedBlockNumber != 0 && blockNumber != m.lastReturnedBlockNumber+1 {
+				http.Error(w, fmt.Sprintf("invalid block number %d, expected %d", blockNumber, m.lastReturnedBlockNumber+1), http.StatusBadRequest)
+				return
+			}
+			m.lastReturnedBlockNumber = blockNumber
+		}
+	}
+
+	// Simulate a relay holding back high-value bids
+	if m.getHeaderLatencyByValueThreshold != nil {
+		value, err := response.Value()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if value.Cmp(m.getHeaderLatencyByValueThreshold) > 0 {
+			// Don't block the other requests to the relay while waiting
+			delay := m.getHeaderLatencyAboveThreshold
+			m.mu.Unlock()
+			time.Sleep(delay)
+			m.mu.Lock()
+		}
+	}
+
+	if strings.Contains(req.Header.Get("Accept"), MediaTypeOctetStream) {
+		m.respondGetHeaderSSZ(w, response)
+		return
 	}
 
+	// By default, everything will be ok.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+// getHeaderResponseForParentHash returns the response set for the parent hash of the getHeader request, or nil if
+// there is none. m.mu must be held.
+func (m *mockRelay) getHeaderResponseForParentHash(req *http.Request) *builderSpec.VersionedSignedBuilderBid {
+	params, err := parseGetHeaderParams(req)
+	if err != nil {
+		return nil
+	}
+	return m.getHeaderResponseByParentHash[params.ParentHash]
+}
+
+// SetGetHeaderResponseForParentHash makes the default getHeader handler return the response to the requests
+// for a block building on parentHash, for instance to return bids on different branches of a fork. It takes
+// precedence over GetHeaderResponse.
+func (m *mockRelay) SetGetHeaderResponseForParentHash(parentHash phase0.Hash32, response *builderSpec.VersionedSignedBuilderBid) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.getHeaderResponseByParentHash == nil {
+		m.getHeaderResponseByParentHash = make(map[phase0.Hash32]*builderSpec.VersionedSignedBuilderBid)
+	}
+	m.getHeaderResponseByParentHash[parentHash] = response
+}
+
+// hasCapturedConstraints returns whether constraints were captured for the slot of the getHeader request.
+// m.mu must be held.
+func (m *mockRelay) hasCapturedConstraints(req *http.Request) bool {
+	slot, err := strconv.ParseUint(mux.Vars(req)["slot"], 10, 64)
+	if err != nil {
+		return false
+	}
+	return len(m.capturedConstraintsForSlot(slot)) > 0
+}
+
+// parseGetHeaderParams decodes the parameters of a getHeader request from its path
+func parseGetHeaderParams(req *http.Request) (GetHeaderParams, error) {
+	slot, parentHash, pubkey, err := ParseGetHeaderPath(req.URL.Path)
+	if err != nil {
+		return GetHeaderParams{}, err
+	}
+	return GetHeaderParams{
+		Slot:           slot,
+		ParentHash:     parentHash,
+		ProposerPubkey: pubkey,
+	}, nil
+}
+
+// CapturedGetHeaderParams returns the parameters of the getHeader requests received since CaptureGetHeaderParams
+// was set, in order
+func (m *mockRelay) CapturedGetHeaderParams() []GetHeaderParams {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]GetHeaderParams{}, m.capturedGetHeaderParams...)
+}
+
+// LastCapturedGetHeaderParams returns the parameters of the last getHeader request received since
+// CaptureGetHeaderParams was set, or zero parameters if there is none
+func (m *mockRelay) LastCapturedGetHeaderParams() GetHeaderParams {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.capturedGetHeaderParams) == 0 {
+		return GetHeaderParams{}
+	}
+	return m.capturedGetHeaderParams[len(m.capturedGetHeaderParams)-1]
+}
+
+// SetGetHeaderResponseSequence makes the default getHeader handler return the given responses in turn,
+// cycling back to the first one once all were returned. It takes precedence over GetHeaderResponse.
+func (m *mockRelay) SetGetHeaderResponseSequence(responses []*builderSpec.VersionedSignedBuilderBid) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.getHeaderResponseSequence = responses
+	m.getHeaderSequenceIndex = 0
+}
+
+// SetGetHeaderLatencyByBidValue makes the default getHeader handler wait for delay before returning bids
+// whose value is above threshold
+func (m *mockRelay) SetGetHeaderLatencyByBidValue(threshold *uint256.Int, delay time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.getHeaderLatencyByValueThreshold = threshold
+	m.getHeaderLatencyAboveThreshold = delay
+}
+
+// respondGetHeaderSSZ writes the SSZ encoding of the bid, along with its consensus version
+func (m *mockRelay) respondGetHeaderSSZ(w http.ResponseWriter, bid *builderSpec.VersionedSignedBuilderBid) {
+	var encoded []byte
+	var err error
+	switch bid.Version {
+	case spec.DataVersionCapella:
+		encoded, err = bid.Capella.MarshalSSZ()
+	case spec.DataVersionDeneb:
+		encoded, err = bid.Deneb.MarshalSSZ()
+	case spec.DataVersionUnknown, spec.DataVersionPhase0, spec.DataVersionAltair, spec.DataVersionBellatrix:
+		err = fmt.Errorf("%w: %s", errUnsupportedVersion, bid.Version)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", MediaTypeOctetStream)
+	w.Header().Set(HeaderEthConsensusVersion, bid.Version.String())
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(encoded); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 // handleGetHeaderWithProofs handles incoming requests to server.pathGetHeader
 func (m *mockRelay) handleGetHeaderWithProofs(w http.ResponseWriter, req *http.Request) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
+	if m.WaitForBidMS != 0 {
+		w.Header().Set(HeaderWaitForBid, strconv.Itoa(m.WaitForBidMS))
+	}
 	// Try to override default behavior is custom handler is specified.
-	if m.handlerOverrideGetHeader != nil {
+	if m.handlerOverrideGetHeaderWithProofs != nil {
 		m.handlerOverrideGetHeaderWithProofs(w, req)
 		return
 	}
-	m.defaultHandleGetHeaderWithProofs(w)
+	m.defaultHandleGetHeaderWithProofs(w, req)
 }
 
 // defaultHandleGetHeaderWithProofs returns the default handler for handleGetHeaderWithProofs
-func (m *mockRelay) defaultHandleGetHeaderWithProofs(w http.ResponseWriter) {
-	// By default, everything will be ok.
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+func (m *mockRelay) defaultHandleGetHeaderWithProofs(w http.ResponseWriter, req *http.Request) {
+	var constraints []struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}
+	if m.MaxConstraintsToReturn > 0 {
+		slot, err := strconv.ParseUint(mux.Vars(req)["slot"], 10, 64)
+		if err != nil {
+			http.Error(w, errInvalidSlot.Error(), http.StatusBadRequest)
+			return
+		}
+		constraints, err = m.constraintsToReturn(slot)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
 
 	// Build the default response.
 	response := m.MakeGetHeaderWithConstraintsResponse(
 		12345,
 		"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
 		"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
-		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249",
+		m.RelayEntry.PublicKey.String(),
 		spec.DataVersionCapella,
-		nil,
+		constraints,
 	)
 
 	if m.GetHeaderWithProofsResponse != nil {
 		response = m.GetHeaderWithProofsResponse
 	}
 
+	// The bid is only SSZ-encoded if there are no proofs, which can't be sent with it
+	if strings.Contains(req.Header.Get("Accept"), MediaTypeOctetStream) && response.ProofCount() == 0 {
+		m.respondGetHeaderSSZ(w, response.Bid)
+		return
+	}
+
+	// By default, everything will be ok.
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 }
 
+// constraintsToReturn returns the first MaxConstraintsToReturn constraints captured for the slot, with the hashes
+// of their transactions. m.mu must be held.
+func (m *mockRelay) constraintsToReturn(slot uint64) ([]struct {
+	tx   Transaction
+	hash phase0.Hash32
+}, error,
+) {
+	var constraints []struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}
+	for _, signedConstraints := range m.capturedConstraintsForSlot(slot) {
+		for _, constraint := range signedConstraints.Message.Constraints {
+			if len(constraints) == m.MaxConstraintsToReturn {
+				return constraints, nil
+			}
+			txHash, err := constraint.TxHash()
+			if err != nil {
+				return nil, err
+			}
+			constraints = append(constraints, struct {
+				tx   Transaction
+				hash phase0.Hash32
+			}{constraint.Tx, txHash})
+		}
+	}
+	return constraints, nil
+}
+
 // MakeGetPayloadResponse is used to create the default or can be used to create a custom response to the getPayload
-// method
+// method. The payload of the given version is filled, and none for versions before Bellatrix.
 func (m *mockRelay) MakeGetPayloadResponse(parentHash, blockHash, feeRecipient string, blockNumber uint64, version spec.DataVersion) *builderApi.VersionedSubmitBlindedBlockResponse {
-	return &builderApi.VersionedSubmitBlindedBlockResponse{
-		Version: version,
-		Capella: &capella.ExecutionPayload{
+	response := &builderApi.VersionedSubmitBlindedBlockResponse{Version: version}
+	switch version {
+	case spec.DataVersionBellatrix:
+		response.Bellatrix = &bellatrix.ExecutionPayload{
+			ParentHash:   _HexToHash(parentHash),
+			BlockHash:    _HexToHash(blockHash),
+			BlockNumber:  blockNumber,
+			FeeRecipient: _HexToAddress(feeRecipient),
+		}
+	case spec.DataVersionCapella:
+		response.Capella = &capella.ExecutionPayload{
 			ParentHash:   _HexToHash(parentHash),
 			BlockHash:    _HexToHash(blockHash),
 			BlockNumber:  blockNumber,
 			FeeRecipient: _HexToAddress(feeRecipient),
 			Withdrawals:  make([]*capella.Withdrawal, 0),
-		},
+		}
+	case spec.DataVersionDeneb:
+		response.Deneb = &builderApiDeneb.ExecutionPayloadAndBlobsBundle{
+			ExecutionPayload: &deneb.ExecutionPayload{
+				ParentHash:    _HexToHash(parentHash),
+				BlockHash:     _HexToHash(blockHash),
+				BlockNumber:   blockNumber,
+				FeeRecipient:  _HexToAddress(feeRecipient),
+				BaseFeePerGas: uint256.NewInt(0),
+				Withdrawals:   make([]*capella.Withdrawal, 0),
+			},
+			BlobsBundle: &builderApiDeneb.BlobsBundle{
+				Commitments: make([]deneb.KZGCommitment, 0),
+				Proofs:      make([]deneb.KZGProof, 0),
+				Blobs:       make([]deneb.Blob, 0),
+			},
+		}
+	case spec.DataVersionUnknown, spec.DataVersionPhase0, spec.DataVersionAltair:
 	}
+	return response
 }
 
 // handleGetPayload handles incoming requests to server.pathGetPayload
@@ -449,11 +1898,44 @@ func (m *mockRelay) handleGetPayload(w http.ResponseWriter, req *http.Request) {
 		m.handlerOverrideGetPayload(w, req)
 		return
 	}
-	m.defaultHandleGetPayload(w)
+	m.defaultHandleGetPayload(w, req)
 }
 
 // defaultHandleGetPayload returns the default handler for handleGetPayload
-func (m *mockRelay) defaultHandleGetPayload(w http.ResponseWriter) {
+func (m *mockRelay) defaultHandleGetPayload(w http.ResponseWriter, req *http.Request) {
+	if m.ProposerSigningDomain != (phase0.Domain{}) || len(m.withdrawnSlots) > 0 {
+		if err := checkJSONContentType(req.Header.Get("Content-Type")); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body, err := io.ReadAll(req.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		slot, root, signature, err := decodeSignedBlindedBlock(body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if m.withdrawnSlots[uint64(slot)] {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			if err := json.NewEncoder(w).Encode(map[string]string{"error": "bid withdrawn"}); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+
+		if m.ProposerSigningDomain != (phase0.Domain{}) {
+			if err := m.checkProposerSignature(root, signature); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+	}
+
 	// By default, everything will be ok.
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
@@ -477,9 +1959,95 @@ func (m *mockRelay) defaultHandleGetPayload(w http.ResponseWriter) {
 	}
 }
 
+// SetProposerSigningDomain makes the default getPayload handler reject blinded blocks which are not signed
+// by proposerPublicKey with the given domain. The public key also verifies the constraint cancellations.
+func (m *mockRelay) SetProposerSigningDomain(domain phase0.Domain, proposerPublicKey phase0.BLSPubKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ProposerSigningDomain = domain
+	m.proposerPublicKey = proposerPublicKey
+}
+
+// VerifyAllReceivedConstraintSignatures verifies the signatures of all the constraints received by the relay
+// against the proposer public key set with SetProposerSigningDomain. It returns a MultiError
+// listing every invalid signature.
+func (m *mockRelay) VerifyAllReceivedConstraintSignatures() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var errs MultiError
+	for i, signedConstraints := range m.capturedConstraints {
+		digest := signedConstraints.Message.Digest()
+		ok, err := bls.VerifySignatureBytes(digest[:], signedConstraints.Signature[:], m.proposerPublicKey[:])
+		if err != nil || !ok {
+			errs = append(errs, fmt.Errorf("%w: constraints %d for slot %d", errInvalidConstraintSignature, i, signedConstraints.Message.Slot))
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// WithdrawBidForSlot makes the default getPayload handler reject blinded blocks for the slot, as if the relay
+// withdrew its bid
+func (m *mockRelay) WithdrawBidForSlot(slot uint64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.withdrawnSlots == nil {
+		m.withdrawnSlots = make(map[uint64]bool)
+	}
+	m.withdrawnSlots[slot] = true
+}
+
+// decodeSignedBlindedBlock decodes the Deneb or Capella signed blinded block in body, and returns its slot,
+// message root and signature
+func decodeSignedBlindedBlock(body []byte) (slot phase0.Slot, root phase0.Root, signature phase0.BLSSignature, err error) {
+	denebBlock := new(eth2ApiV1Deneb.SignedBlindedBeaconBlock)
+	if err := DecodeJSON(bytes.NewReader(body), denebBlock); err == nil {
+		root, err = denebBlock.Message.HashTreeRoot()
+		return denebBlock.Message.Slot, root, denebBlock.Signature, err
+	}
+
+	capellaBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
+	if err := DecodeJSON(bytes.NewReader(body), capellaBlock); err != nil {
+		return slot, root, signature, err
+	}
+	root, err = capellaBlock.Message.HashTreeRoot()
+	return capellaBlock.Message.Slot, root, capellaBlock.Signature, err
+}
+
+// checkProposerSignature verifies the signature of a signed blinded block message root against the proposer
+// signing domain and public key
+func (m *mockRelay) checkProposerSignature(root phase0.Root, signature phase0.BLSSignature) error {
+	signingData := phase0.SigningData{ObjectRoot: root, Domain: m.ProposerSigningDomain}
+	msg, err := signingData.HashTreeRoot()
+	if err != nil {
+		return err
+	}
+	ok, err := bls.VerifySignatureBytes(msg[:], signature[:], m.proposerPublicKey[:])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errProposerSigningDomainMismatch
+	}
+	return nil
+}
+
 func (m *mockRelay) overrideHandleRegisterValidator(method func(w http.ResponseWriter, req *http.Request)) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	m.handlerOverrideRegisterValidator = method
 }
+
+func (m *mockRelay) overrideHandleGetHeaderWithProofs(method func(w http.ResponseWriter, req *http.Request)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.handlerOverrideGetHeaderWithProofs = method
+}
@@ -2,13 +2,70 @@ package server
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	builderApi "github.com/attestantio/go-builder-client/api"
+	builderApiV1 "github.com/attestantio/go-builder-client/api/v1"
+	builderSpec "github.com/attestantio/go-builder-client/spec"
+	eth2ApiV1Capella "github.com/attestantio/go-eth2-client/api/v1/capella"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/capella"
+	"github.com/attestantio/go-eth2-client/spec/deneb"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	utilbellatrix "github.com/attestantio/go-eth2-client/util/bellatrix"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/flashbots/go-boost-utils/bls"
+	"github.com/flashbots/go-boost-utils/ssz"
+	"github.com/holiman/uint256"
 	"github.com/stretchr/testify/require"
 )
 
+// generateTestCertificate creates a self-signed certificate for the loopback addresses
+func generateTestCertificate(t *testing.T, serialNumber int64) (tls.Certificate, *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serialNumber),
+		Subject:               pkix.Name{Organization: []string{"mock relay"}},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, leaf
+}
+
 func Test_mockRelay(t *testing.T) {
 	t.Run("bad payload", func(t *testing.T) {
 		relay := newMockRelay(t)
@@ -19,3 +76,2056 @@ func Test_mockRelay(t *testing.T) {
 		require.Equal(t, http.StatusBadRequest, rr.Code)
 	})
 }
+
+func TestMockRelayGetHeaderReturnsCorrectVersion(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+
+	testCases := []struct {
+		version         spec.DataVersion
+		expectedVersion string
+	}{
+		{
+			version:         spec.DataVersionCapella,
+			expectedVersion: "capella",
+		},
+		{
+			version:         spec.DataVersionDeneb,
+			expectedVersion: "deneb",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.expectedVersion, func(t *testing.T) {
+			relay := newMockRelay(t)
+			relay.GetHeaderResponse = relay.MakeGetHeaderResponse(12345, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), tt.version)
+			require.NotNil(t, relay.GetHeaderResponse)
+
+			req := httptest.NewRequest(http.MethodGet, getHeaderPath(1, hash, relay.RelayEntry.PublicKey), nil)
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			response := struct {
+				Version string `json:"version"`
+			}{}
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), &response))
+			require.Equal(t, tt.expectedVersion, response.Version)
+		})
+	}
+}
+
+func TestMockRelayMakeGetPayloadResponseForAllVersions(t *testing.T) {
+	blockHash := _HexToHash("0x534809bd2b6832edff8d8ce4cb0e50068804fd1ef432c8362ad708a74fdc0e46")
+
+	testCases := []struct {
+		version spec.DataVersion
+		// payloadSet returns whether the payload field of the version is set, and no other
+		payloadSet func(response *builderApi.VersionedSubmitBlindedBlockResponse) bool
+	}{
+		{
+			version: spec.DataVersionPhase0,
+			payloadSet: func(r *builderApi.VersionedSubmitBlindedBlockResponse) bool {
+				return r.Bellatrix == nil && r.Capella == nil && r.Deneb == nil
+			},
+		},
+		{
+			version: spec.DataVersionAltair,
+			payloadSet: func(r *builderApi.VersionedSubmitBlindedBlockResponse) bool {
+				return r.Bellatrix == nil && r.Capella == nil && r.Deneb == nil
+			},
+		},
+		{
+			version: spec.DataVersionBellatrix,
+			payloadSet: func(r *builderApi.VersionedSubmitBlindedBlockResponse) bool {
+				return r.Bellatrix != nil && r.Capella == nil && r.Deneb == nil
+			},
+		},
+		{
+			version: spec.DataVersionCapella,
+			payloadSet: func(r *builderApi.VersionedSubmitBlindedBlockResponse) bool {
+				return r.Bellatrix == nil && r.Capella != nil && r.Deneb == nil
+			},
+		},
+		{
+			version: spec.DataVersionDeneb,
+			payloadSet: func(r *builderApi.VersionedSubmitBlindedBlockResponse) bool {
+				return r.Bellatrix == nil && r.Capella == nil && r.Deneb != nil &&
+					r.Deneb.ExecutionPayload != nil && r.Deneb.BlobsBundle != nil
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.version.String(), func(t *testing.T) {
+			relay := newMockRelay(t)
+			response := relay.MakeGetPayloadResponse(
+				"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+				blockHash.String(),
+				"0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941",
+				12345,
+				tt.version,
+			)
+			require.Equal(t, tt.version, response.Version)
+			require.True(t, tt.payloadSet(response))
+
+			if tt.version < spec.DataVersionBellatrix {
+				require.True(t, response.IsEmpty())
+				return
+			}
+			require.False(t, response.IsEmpty())
+			gotBlockHash, err := response.BlockHash()
+			require.NoError(t, err)
+			require.Equal(t, blockHash, gotBlockHash)
+
+			// The response survives the JSON round trip of the getPayload handler
+			body, err := json.Marshal(response)
+			require.NoError(t, err)
+			decoded := new(builderApi.VersionedSubmitBlindedBlockResponse)
+			require.NoError(t, json.Unmarshal(body, decoded))
+			require.Equal(t, tt.version, decoded.Version)
+			require.True(t, tt.payloadSet(decoded))
+		})
+	}
+}
+
+func TestMockRelaySetGetHeaderResponseWithWithdrawals(t *testing.T) {
+	blockHash := _HexToHash("0x534809bd2b6832edff8d8ce4cb0e50068804fd1ef432c8362ad708a74fdc0e46")
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	withdrawal := func(index uint64) *capella.Withdrawal {
+		return &capella.Withdrawal{
+			Index:          capella.WithdrawalIndex(index),
+			ValidatorIndex: phase0.ValidatorIndex(1000 + index),
+			Address:        bellatrix.ExecutionAddress{0xdb, byte(index)},
+			Amount:         phase0.Gwei(12345 * index),
+		}
+	}
+	transactionsRoot, err := (&utilbellatrix.ExecutionPayloadTransactions{Transactions: []bellatrix.Transaction{}}).HashTreeRoot()
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name        string
+		withdrawals []*capella.Withdrawal
+	}{
+		{name: "No withdrawals", withdrawals: []*capella.Withdrawal{}},
+		{name: "One withdrawal", withdrawals: []*capella.Withdrawal{withdrawal(1)}},
+		{name: "Multiple withdrawals", withdrawals: []*capella.Withdrawal{withdrawal(1), withdrawal(2), withdrawal(3)}},
+	}
+
+	for _, tt := range testCases {
+		for _, version := range []spec.DataVersion{spec.DataVersionCapella, spec.DataVersionDeneb} {
+			t.Run(fmt.Sprintf("%s %s", tt.name, version), func(t *testing.T) {
+				relay := newMockRelay(t)
+				withdrawalsRoot := relay.SetGetHeaderResponseWithWithdrawals(
+					tt.withdrawals, 12345, blockHash.String(), parentHash.String(), relay.RelayEntry.PublicKey.String(), version,
+				)
+
+				// The header must have the hash tree root of the payload with the withdrawals, once the
+				// transactions root of the (empty) transactions list is set too
+				var headerRoot, payloadRoot phase0.Root
+				switch version {
+				case spec.DataVersionCapella:
+					header := *relay.GetHeaderResponse.Capella.Message.Header
+					require.Equal(t, withdrawalsRoot, header.WithdrawalsRoot)
+					ok, err := ssz.VerifySignature(relay.GetHeaderResponse.Capella.Message, ssz.DomainBuilder, relay.RelayEntry.PublicKey[:], relay.GetHeaderResponse.Capella.Signature[:])
+					require.NoError(t, err)
+					require.True(t, ok)
+					header.TransactionsRoot = transactionsRoot
+					headerRoot, err = header.HashTreeRoot()
+					require.NoError(t, err)
+					payloadRoot, err = (&capella.ExecutionPayload{
+						ParentHash:   parentHash,
+						BlockHash:    blockHash,
+						Transactions: []bellatrix.Transaction{},
+						Withdrawals:  tt.withdrawals,
+					}).HashTreeRoot()
+					require.NoError(t, err)
+				case spec.DataVersionDeneb:
+					header := *relay.GetHeaderResponse.Deneb.Message.Header
+					require.Equal(t, withdrawalsRoot, header.WithdrawalsRoot)
+					ok, err := ssz.VerifySignature(relay.GetHeaderResponse.Deneb.Message, ssz.DomainBuilder, relay.RelayEntry.PublicKey[:], relay.GetHeaderResponse.Deneb.Signature[:])
+					require.NoError(t, err)
+					require.True(t, ok)
+					header.TransactionsRoot = transactionsRoot
+					headerRoot, err = header.HashTreeRoot()
+					require.NoError(t, err)
+					payloadRoot, err = (&deneb.ExecutionPayload{
+						ParentHash:    parentHash,
+						BlockHash:     blockHash,
+						BaseFeePerGas: uint256.NewInt(0),
+						Transactions:  []bellatrix.Transaction{},
+						Withdrawals:   tt.withdrawals,
+					}).HashTreeRoot()
+					require.NoError(t, err)
+				case spec.DataVersionUnknown, spec.DataVersionPhase0, spec.DataVersionAltair, spec.DataVersionBellatrix:
+				}
+				require.Equal(t, payloadRoot, headerRoot)
+			})
+		}
+	}
+
+	t.Run("Different withdrawals have different roots", func(t *testing.T) {
+		relay := newMockRelay(t)
+		roots := make(map[phase0.Root]bool)
+		for _, tt := range testCases {
+			root := relay.SetGetHeaderResponseWithWithdrawals(
+				tt.withdrawals, 12345, blockHash.String(), parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella,
+			)
+			require.NotEqual(t, phase0.Root{}, root)
+			roots[root] = true
+		}
+		require.Len(t, roots, len(testCases))
+	})
+}
+
+func TestMockRelayGetHeaderBlockNumber(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	relay := newMockRelay(t)
+
+	getHeader := func(blockNumber uint64) int {
+		relay.GetHeaderResponse = relay.MakeGetHeaderResponse(12345, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella)
+		relay.GetHeaderResponse.Capella.Message.Header.BlockNumber = blockNumber
+
+		req := httptest.NewRequest(http.MethodGet, getHeaderPath(1, hash, relay.RelayEntry.PublicKey), nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	testCases := []struct {
+		name         string
+		blockNumber  uint64
+		expectedCode int
+	}{
+		{
+			name:         "First block number is accepted",
+			blockNumber:  100,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Sequential block number",
+			blockNumber:  101,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Same block number again",
+			blockNumber:  101,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Skipped block number",
+			blockNumber:  103,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Sequential block number after a rejected one",
+			blockNumber:  102,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Unset block number is not checked",
+			blockNumber:  0,
+			expectedCode: http.StatusOK,
+		},
+	}
+
+	// The cases are run in order against the same relay
+	for _, tt := range testCases {
+		require.Equal(t, tt.expectedCode, getHeader(tt.blockNumber), tt.name)
+	}
+}
+
+func TestMockRelaySetTLSConfig(t *testing.T) {
+	cert1, leaf1 := generateTestCertificate(t, 1)
+	cert2, leaf2 := generateTestCertificate(t, 2)
+
+	certPool := x509.NewCertPool()
+	certPool.AddCert(leaf1)
+	certPool.AddCert(leaf2)
+	// Every request opens a new connection, so that the handshake uses the current certificate. Closing the idle
+	// connections isn't enough, as the previous connection may not be back in the idle pool yet.
+	transport := &http.Transport{
+		TLSClientConfig:   &tls.Config{RootCAs: certPool, MinVersion: tls.VersionTLS12},
+		DisableKeepAlives: true,
+	}
+	client := http.Client{Transport: transport}
+
+	relay := newMockRelay(t)
+	relay.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert1}, MinVersion: tls.VersionTLS12})
+	require.Equal(t, "https", relay.RelayEntry.URL.Scheme)
+
+	getStatusCert := func() *x509.Certificate {
+		resp, err := client.Get(relay.RelayEntry.GetURI(pathStatus))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp.TLS.PeerCertificates[0]
+	}
+	require.Equal(t, leaf1.SerialNumber, getStatusCert().SerialNumber)
+
+	// Rotate the certificate, new connections must use it
+	relay.SetTLSConfig(&tls.Config{Certificates: []tls.Certificate{cert2}, MinVersion: tls.VersionTLS12})
+	require.Equal(t, leaf2.SerialNumber, getStatusCert().SerialNumber)
+
+	// Wait for the handler of the second request to be done before counting
+	require.Eventually(t, func() bool {
+		return relay.GetRequestCount(pathStatus) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMockRelayHandleSubmitConstraintWithInvalidJSON(t *testing.T) {
+	relay := newMockRelay(t)
+	req, err := http.NewRequest(http.MethodPost, pathSubmitConstraint, bytes.NewReader([]byte("not-json")))
+	require.NoError(t, err)
+	rr := httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusBadRequest, rr.Code)
+	require.Contains(t, rr.Body.String(), "invalid character")
+	require.Equal(t, 1, relay.GetRequestCount(pathSubmitConstraint))
+}
+
+func TestMockRelayProposerSigningDomain(t *testing.T) {
+	// Load the blinded block and sign it for the Capella fork
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-capella.json")
+	require.NoError(t, err)
+	defer jsonFile.Close()
+	signedBlindedBeaconBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, signedBlindedBeaconBlock))
+
+	domainTypeBeaconProposer := phase0.DomainType{0x00, 0x00, 0x00, 0x00}
+	capellaDomain, err := ComputeDomain(domainTypeBeaconProposer, "0x03000000", phase0.Root{}.String())
+	require.NoError(t, err)
+	denebDomain, err := ComputeDomain(domainTypeBeaconProposer, "0x04000000", phase0.Root{}.String())
+	require.NoError(t, err)
+
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	var proposerPublicKey phase0.BLSPubKey
+	copy(proposerPublicKey[:], bls.PublicKeyToBytes(publicKey))
+
+	signedBlindedBeaconBlock.Signature, err = ssz.SignMessage(signedBlindedBeaconBlock.Message, capellaDomain, secretKey)
+	require.NoError(t, err)
+	body, err := json.Marshal(signedBlindedBeaconBlock)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		domain         phase0.Domain
+		expectedStatus int
+	}{
+		{
+			name:           "No domain skips the check",
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Matching domain",
+			domain:         capellaDomain,
+			expectedStatus: http.StatusOK,
+		},
+		{
+			name:           "Domain mismatch",
+			domain:         denebDomain,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			if tt.domain != (phase0.Domain{}) {
+				relay.SetProposerSigningDomain(tt.domain, proposerPublicKey)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, pathGetPayload, bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, tt.expectedStatus, rr.Code, rr.Body.String())
+			if tt.expectedStatus == http.StatusBadRequest {
+				require.Contains(t, rr.Body.String(), errProposerSigningDomainMismatch.Error())
+			}
+		})
+	}
+}
+
+func TestMockRelayConnectionTracking(t *testing.T) {
+	relay := newMockRelay(t)
+	transport := &http.Transport{}
+	client := http.Client{Transport: transport}
+
+	// With keep-alive, all the requests are sent over the same connection
+	numRequests := 10
+	for i := 0; i < numRequests; i++ {
+		resp, err := client.Get(relay.RelayEntry.GetURI(pathStatus))
+		require.NoError(t, err)
+		_, err = io.Copy(io.Discard, resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+	}
+	require.Equal(t, numRequests, relay.GetRequestCount(pathStatus))
+	require.Equal(t, int64(1), relay.TotalConnectionsOpened())
+	require.Equal(t, int64(1), relay.ActiveConnections())
+
+	// Connections are cleaned up once the client closes them
+	transport.CloseIdleConnections()
+	require.Eventually(t, func() bool {
+		return relay.ActiveConnections() == 0
+	}, time.Second, 10*time.Millisecond)
+	require.Equal(t, int64(1), relay.TotalConnectionsOpened())
+}
+
+func TestMockRelayWaitForConstraintSubmission(t *testing.T) {
+	slot := uint64(8978583)
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+
+	t.Run("Constraints submitted asynchronously", func(t *testing.T) {
+		relay := newMockRelay(t)
+
+		errCh := make(chan error, 1)
+		go func() {
+			time.Sleep(50 * time.Millisecond)
+			_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+			errCh <- err
+		}()
+
+		require.NoError(t, relay.WaitForConstraintSubmission(phase0.Slot(slot), time.Second))
+		require.NoError(t, <-errCh)
+		require.Equal(t, 1, relay.GetRequestCount(pathSubmitConstraint))
+	})
+
+	t.Run("Constraints already submitted", func(t *testing.T) {
+		relay := newMockRelay(t)
+		_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+		require.NoError(t, err)
+
+		require.NoError(t, relay.WaitForConstraintSubmission(phase0.Slot(slot), 0))
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		relay := newMockRelay(t)
+		_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+		require.NoError(t, err)
+
+		start := time.Now()
+		err = relay.WaitForConstraintSubmission(phase0.Slot(slot+1), 50*time.Millisecond)
+		require.ErrorIs(t, err, errConstraintSubmissionTimeout)
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+	})
+}
+
+func TestMockRelayDefaultHandleGetHeaderWithProofsReturnsValidSignature(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	relay := newMockRelay(t)
+
+	req := httptest.NewRequest(http.MethodGet, getHeaderWithProofsPath(1, hash, relay.RelayEntry.PublicKey), nil)
+	rr := httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	response := new(BidWithInclusionProofs)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), response))
+	require.NotNil(t, response.Bid)
+
+	root, err := response.Bid.MessageHashTreeRoot()
+	require.NoError(t, err)
+	signature, err := response.Bid.Signature()
+	require.NoError(t, err)
+	signingData := phase0.SigningData{ObjectRoot: root, Domain: ssz.DomainBuilder}
+	msg, err := signingData.HashTreeRoot()
+	require.NoError(t, err)
+
+	publicKey := bls.PublicKeyToBytes(mockRelayPublicKey)
+	ok, err := bls.VerifySignatureBytes(msg[:], signature[:], publicKey)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func TestMockRelayGetHeaderSignatureUsesCorrectDomain(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	publicKey := bls.PublicKeyToBytes(mockRelayPublicKey)
+
+	testCases := []struct {
+		name    string
+		version spec.DataVersion // unknown for the default response
+	}{
+		{
+			name:    "Default response",
+			version: spec.DataVersionUnknown,
+		},
+		{
+			name:    "Capella",
+			version: spec.DataVersionCapella,
+		},
+		{
+			name:    "Deneb",
+			version: spec.DataVersionDeneb,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			if tt.version != spec.DataVersionUnknown {
+				relay.GetHeaderResponse = relay.MakeGetHeaderResponse(12345, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), tt.version)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, getHeaderPath(1, hash, relay.RelayEntry.PublicKey), nil)
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			bid := new(builderSpec.VersionedSignedBuilderBid)
+			require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+			root, err := bid.MessageHashTreeRoot()
+			require.NoError(t, err)
+			signature, err := bid.Signature()
+			require.NoError(t, err)
+
+			verify := func(domain phase0.Domain) bool {
+				signingData := phase0.SigningData{ObjectRoot: root, Domain: domain}
+				msg, err := signingData.HashTreeRoot()
+				require.NoError(t, err)
+				ok, err := bls.VerifySignatureBytes(msg[:], signature[:], publicKey)
+				require.NoError(t, err)
+				return ok
+			}
+
+			require.True(t, verify(ssz.DomainBuilder))
+
+			// The signature does not verify against another domain
+			proposerDomain, err := ComputeDomain(phase0.DomainType{0x00, 0x00, 0x00, 0x00}, "0x00000000", phase0.Root{}.String())
+			require.NoError(t, err)
+			require.False(t, verify(proposerDomain))
+		})
+	}
+}
+
+func TestMockRelayMakeGetHeaderResponseWithTimestamp(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	publicKey := bls.PublicKeyToBytes(mockRelayPublicKey)
+	timestamp := uint64(1700000012)
+
+	verifySignature := func(t *testing.T, bid *builderSpec.VersionedSignedBuilderBid) bool {
+		t.Helper()
+		root, err := bid.MessageHashTreeRoot()
+		require.NoError(t, err)
+		signature, err := bid.Signature()
+		require.NoError(t, err)
+		signingData := phase0.SigningData{ObjectRoot: root, Domain: ssz.DomainBuilder}
+		msg, err := signingData.HashTreeRoot()
+		require.NoError(t, err)
+		ok, err := bls.VerifySignatureBytes(msg[:], signature[:], publicKey)
+		require.NoError(t, err)
+		return ok
+	}
+
+	for _, version := range []spec.DataVersion{spec.DataVersionCapella, spec.DataVersionDeneb} {
+		t.Run(version.String(), func(t *testing.T) {
+			relay := newMockRelay(t)
+			bid := relay.MakeGetHeaderResponseWithTimestamp(12345, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), version, timestamp)
+			require.NotNil(t, bid)
+
+			// The timestamp is covered by the signature
+			require.True(t, verifySignature(t, bid))
+			if version == spec.DataVersionCapella {
+				require.Equal(t, timestamp, bid.Capella.Message.Header.Timestamp)
+				bid.Capella.Message.Header.Timestamp++
+			} else {
+				require.Equal(t, timestamp, bid.Deneb.Message.Header.Timestamp)
+				bid.Deneb.Message.Header.Timestamp++
+			}
+			require.False(t, verifySignature(t, bid))
+		})
+	}
+
+	t.Run("MakeGetHeaderResponse leaves the timestamp unset", func(t *testing.T) {
+		relay := newMockRelay(t)
+		bid := relay.MakeGetHeaderResponse(12345, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella)
+		require.Zero(t, bid.Capella.Message.Header.Timestamp)
+	})
+}
+
+func TestMockRelayCORS(t *testing.T) {
+	testCases := []struct {
+		name                string
+		enableCORS          bool
+		allowOrigin         string
+		expectedCode        int
+		expectedAllowOrigin string
+	}{
+		{
+			name:                "CORS disabled",
+			enableCORS:          false,
+			expectedCode:        http.StatusMethodNotAllowed,
+			expectedAllowOrigin: "",
+		},
+		{
+			name:                "CORS enabled with default origin",
+			enableCORS:          true,
+			expectedCode:        http.StatusNoContent,
+			expectedAllowOrigin: "*",
+		},
+		{
+			name:                "CORS enabled with custom origin",
+			enableCORS:          true,
+			allowOrigin:         "http://localhost:3000",
+			expectedCode:        http.StatusNoContent,
+			expectedAllowOrigin: "http://localhost:3000",
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			relay.EnableCORS = tt.enableCORS
+			relay.CORSAllowOrigin = tt.allowOrigin
+
+			// Preflight request
+			req := httptest.NewRequest(http.MethodOptions, pathSubmitConstraint, nil)
+			req.Header.Set("Origin", "http://localhost:3000")
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", "Content-Type")
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, tt.expectedCode, rr.Code)
+			require.Equal(t, tt.expectedAllowOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+
+			if tt.enableCORS {
+				require.Equal(t, "GET, POST, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+				require.Contains(t, rr.Header().Get("Access-Control-Allow-Headers"), "Content-Type")
+			}
+
+			// The headers are also added to regular responses
+			req = httptest.NewRequest(http.MethodGet, pathStatus, nil)
+			rr = httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, tt.expectedAllowOrigin, rr.Header().Get("Access-Control-Allow-Origin"))
+		})
+	}
+}
+
+func TestMockRelayCORSAllowedMethods(t *testing.T) {
+	testCases := []struct {
+		name          string
+		origin        string
+		requestMethod string
+		expectedCode  int
+	}{
+		{
+			name:          "Allowed POST",
+			origin:        "http://localhost:3000",
+			requestMethod: http.MethodPost,
+			expectedCode:  http.StatusNoContent,
+		},
+		{
+			name:          "Disallowed DELETE",
+			origin:        "http://localhost:3000",
+			requestMethod: http.MethodDelete,
+			expectedCode:  http.StatusForbidden,
+		},
+		{
+			name:          "Missing Origin header",
+			requestMethod: http.MethodPost,
+			expectedCode:  http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			relay.SetCORSAllowedMethods(http.MethodPost, http.MethodOptions)
+
+			req := httptest.NewRequest(http.MethodOptions, pathSubmitConstraint, nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, tt.expectedCode, rr.Code, rr.Body.String())
+			require.Equal(t, "POST, OPTIONS", rr.Header().Get("Access-Control-Allow-Methods"))
+		})
+	}
+}
+
+func TestMockRelayGetHeaderResponseSequence(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	relay := newMockRelay(t)
+
+	values := []uint64{12345, 23456, 34567}
+	sequence := make([]*builderSpec.VersionedSignedBuilderBid, len(values))
+	for i, value := range values {
+		sequence[i] = relay.MakeGetHeaderResponse(value, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella)
+	}
+	relay.SetGetHeaderResponseSequence(sequence)
+
+	// The sequence is returned in order, then starts over
+	expectedValues := []uint64{12345, 23456, 34567, 12345}
+	for i, expectedValue := range expectedValues {
+		req := httptest.NewRequest(http.MethodGet, getHeaderPath(uint64(i+1), hash, relay.RelayEntry.PublicKey), nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		bid := new(builderSpec.VersionedSignedBuilderBid)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+		value, err := bid.Value()
+		require.NoError(t, err)
+		require.Equal(t, expectedValue, value.Uint64(), "response %d", i)
+	}
+}
+
+func TestMockRelaySubmitConstraintFeeValidation(t *testing.T) {
+	// Transaction with a max fee per gas of 10199506607 wei
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           1,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name         string
+		baseFee      *uint256.Int
+		expectedCode int
+	}{
+		{
+			name:         "No base fee",
+			baseFee:      nil,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Fee above base fee",
+			baseFee:      uint256.NewInt(10_000_000_000),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Fee equal to base fee",
+			baseFee:      uint256.NewInt(10_199_506_607),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Fee below base fee",
+			baseFee:      uint256.NewInt(11_000_000_000),
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			relay.BlockBaseFee = tt.baseFee
+
+			req := httptest.NewRequest(http.MethodPost, pathSubmitConstraint, bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, tt.expectedCode, rr.Code, rr.Body.String())
+
+			if tt.expectedCode == http.StatusBadRequest {
+				require.Contains(t, rr.Body.String(), "constraint tx fee too low")
+				require.Empty(t, relay.capturedConstraints)
+			} else {
+				require.Len(t, relay.capturedConstraints, 1)
+			}
+		})
+	}
+}
+
+func TestMockRelaySubmitConstraintGasLimit(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	constraints := func(gasLimit uint64) *SignedConstraints {
+		return &SignedConstraints{
+			Message: ConstraintsMessage{
+				ValidatorIndex: 12345,
+				Slot:           1,
+				Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+				GasLimit:       gasLimit,
+			},
+		}
+	}
+
+	testCases := []struct {
+		name             string
+		maxBlockGasLimit uint64
+		payload          BatchedSignedConstraints
+		expectedCode     int
+	}{
+		{
+			name:         "No maximum",
+			payload:      BatchedSignedConstraints{constraints(40_000_000)},
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:             "Under the limit",
+			maxBlockGasLimit: 30_000_000,
+			payload:          BatchedSignedConstraints{constraints(10_000_000), constraints(19_999_999)},
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "At the limit",
+			maxBlockGasLimit: 30_000_000,
+			payload:          BatchedSignedConstraints{constraints(10_000_000), constraints(20_000_000)},
+			expectedCode:     http.StatusOK,
+		},
+		{
+			name:             "Over the limit",
+			maxBlockGasLimit: 30_000_000,
+			payload:          BatchedSignedConstraints{constraints(10_000_000), constraints(20_000_001)},
+			expectedCode:     http.StatusBadRequest,
+		},
+		{
+			name:             "Overflowing total",
+			maxBlockGasLimit: 30_000_000,
+			payload:          BatchedSignedConstraints{constraints(1), constraints(math.MaxUint64)},
+			expectedCode:     http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			relay.MaxBlockGasLimit = tt.maxBlockGasLimit
+
+			body, err := json.Marshal(tt.payload)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, pathSubmitConstraint, bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, tt.expectedCode, rr.Code, rr.Body.String())
+
+			if tt.expectedCode == http.StatusBadRequest {
+				require.Contains(t, rr.Body.String(), "constraints gas limit too high")
+				require.Empty(t, relay.capturedConstraints)
+			} else {
+				require.Len(t, relay.capturedConstraints, len(tt.payload))
+			}
+		})
+	}
+}
+
+func TestMockRelayGetHeaderLatencyByBidValue(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	delay := 200 * time.Millisecond
+
+	testCases := []struct {
+		name          string
+		value         uint64
+		expectDelayed bool
+	}{
+		{
+			name:          "Low-value bid",
+			value:         12345,
+			expectDelayed: false,
+		},
+		{
+			name:          "Bid at threshold",
+			value:         20000,
+			expectDelayed: false,
+		},
+		{
+			name:          "High-value bid",
+			value:         30000,
+			expectDelayed: true,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			relay.SetGetHeaderLatencyByBidValue(uint256.NewInt(20000), delay)
+			relay.GetHeaderResponse = relay.MakeGetHeaderResponse(tt.value, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella)
+
+			req := httptest.NewRequest(http.MethodGet, getHeaderPath(1, hash, relay.RelayEntry.PublicKey), nil)
+			rr := httptest.NewRecorder()
+			start := time.Now()
+			relay.getRouter().ServeHTTP(rr, req)
+			elapsed := time.Since(start)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			if tt.expectDelayed {
+				require.GreaterOrEqual(t, elapsed, delay)
+			} else {
+				require.Less(t, elapsed, delay)
+			}
+		})
+	}
+
+	t.Run("Other requests are served during the delay", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.SetGetHeaderLatencyByBidValue(uint256.NewInt(20000), delay)
+		relay.GetHeaderResponse = relay.MakeGetHeaderResponse(30000, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, getHeaderPath(1, hash, relay.RelayEntry.PublicKey), nil))
+		}()
+		require.Eventually(t, func() bool {
+			return relay.GetRequestCount(getHeaderPath(1, hash, relay.RelayEntry.PublicKey)) == 1
+		}, delay, time.Millisecond)
+
+		start := time.Now()
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, pathStatus, nil))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Less(t, time.Since(start), delay/2)
+		<-done
+	})
+}
+
+func TestMockRelayRegisteredValidators(t *testing.T) {
+	registrations := []*builderApiV1.SignedValidatorRegistration{
+		{
+			Message: &builderApiV1.ValidatorRegistration{
+				FeeRecipient: _HexToAddress("0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941"),
+				GasLimit:     30000000,
+				Timestamp:    time.Unix(1234356, 0),
+				Pubkey: _HexToPubkey(
+					"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249"),
+			},
+			Signature: _HexToSignature(
+				"0x81510b571e22f89d1697545aac01c9ad0c1e7a3e778b3078bef524efae14990e58a6e960a152abd49de2e18d7fd3081c15d5c25867ccfad3d47beef6b39ac24b6b9fbf2cfa91c88f67aff750438a6841ec9e4a06a94ae41410c4f97b75ab284c"),
+		},
+	}
+	expected, err := json.Marshal(registrations)
+	require.NoError(t, err)
+
+	getRegisteredValidators := func(relay *mockRelay) string {
+		req := httptest.NewRequest(http.MethodGet, pathRegisteredValidators, nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		return rr.Body.String()
+	}
+
+	t.Run("Returns the registrations forwarded by the service", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		require.JSONEq(t, "[]", getRegisteredValidators(backend.relays[0]))
+
+		rr := backend.request(t, http.MethodPost, pathRegisterValidator, registrations)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.JSONEq(t, string(expected), getRegisteredValidators(backend.relays[0]))
+	})
+
+	t.Run("Override response", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.RegisteredValidatorsResponse = registrations
+		require.JSONEq(t, string(expected), getRegisteredValidators(relay))
+	})
+}
+
+func TestMockRelaySetHandlerForVersion(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	relay := newMockRelay(t)
+	for _, version := range []string{"1", "2"} {
+		body := "version " + version
+		relay.SetHandlerForVersion(version, pathGetHeaderWithProofs, http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_, _ = w.Write([]byte(body))
+		}))
+	}
+
+	getHeader := func(version string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, getHeaderWithProofsPath(1, hash, relay.RelayEntry.PublicKey), nil)
+		if version != "" {
+			req.Header.Set(HeaderKeyBoltVersion, version)
+		}
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		return rr
+	}
+
+	require.Equal(t, "version 1", getHeader("1").Body.String())
+	require.Equal(t, "version 2", getHeader("2").Body.String())
+
+	// Clients without a handler for their version, or without version, get the default response
+	for _, version := range []string{"", "3"} {
+		response := new(BidWithInclusionProofs)
+		require.NoError(t, json.Unmarshal(getHeader(version).Body.Bytes(), response))
+		require.NotNil(t, response.Bid)
+	}
+
+	// Other paths are served by the default handlers
+	req := httptest.NewRequest(http.MethodGet, pathStatus, nil)
+	req.Header.Set(HeaderKeyBoltVersion, "2")
+	rr := httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code)
+	require.JSONEq(t, "{}", rr.Body.String())
+}
+
+// TestMockRelayHandlerOverrideDataRace sets and clears handler overrides while requests are served, to be run with -race
+func TestMockRelayHandlerOverrideDataRace(t *testing.T) {
+	relay := newMockRelay(t)
+	router := relay.getRouter()
+	override := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	getHeaderPath := getHeaderWithProofsPath(1, _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"), _HexToPubkey("0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249"))
+
+	numIterations := 200
+	numRequesters := 4
+	codes := make(chan int, 2*numRequesters*numIterations)
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < numIterations; i++ {
+			if i%2 == 0 {
+				relay.overrideHandleGetHeaderWithProofs(override)
+				relay.overrideHandleRegisterValidator(override)
+			} else {
+				relay.overrideHandleGetHeaderWithProofs(nil)
+				relay.overrideHandleRegisterValidator(nil)
+			}
+		}
+	}()
+
+	for i := 0; i < numRequesters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < numIterations; j++ {
+				req := httptest.NewRequest(http.MethodGet, getHeaderPath, nil)
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				codes <- rr.Code
+
+				req = httptest.NewRequest(http.MethodPost, pathRegisterValidator, bytes.NewReader([]byte("[]")))
+				rr = httptest.NewRecorder()
+				router.ServeHTTP(rr, req)
+				codes <- rr.Code
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		require.Contains(t, []int{http.StatusOK, http.StatusNoContent}, code)
+	}
+}
+
+func TestMockRelayRequestCountAccuracy(t *testing.T) {
+	path := getHeaderPath(1, _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"), _HexToPubkey("0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249"))
+	numRequests := 37
+
+	t.Run("Sequential", func(t *testing.T) {
+		relay := newMockRelay(t)
+		router := relay.getRouter()
+		for i := 0; i < numRequests; i++ {
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+		}
+		require.Equal(t, numRequests, relay.GetRequestCount(path))
+	})
+
+	t.Run("Concurrent", func(t *testing.T) {
+		relay := newMockRelay(t)
+		router := relay.getRouter()
+
+		var numSent int32
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < numRequests; j++ {
+					rr := httptest.NewRecorder()
+					router.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, path, nil))
+					atomic.AddInt32(&numSent, 1)
+				}
+			}()
+		}
+		wg.Wait()
+		require.Equal(t, int(atomic.LoadInt32(&numSent)), relay.GetRequestCount(path))
+	})
+}
+
+func TestMockRelayVerifyAllReceivedConstraintSignatures(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	domain, err := ComputeDomain(phase0.DomainType{0x00, 0x00, 0x00, 0x00}, "0x03000000", phase0.Root{}.String())
+	require.NoError(t, err)
+
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	otherSecretKey, _, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	var proposerPublicKey phase0.BLSPubKey
+	copy(proposerPublicKey[:], bls.PublicKeyToBytes(publicKey))
+
+	signConstraints := func(t *testing.T, slot uint64, secretKey *bls.SecretKey) *SignedConstraints {
+		t.Helper()
+		message := ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		}
+		signature := signConstraintsMessage(&message, secretKey)
+		return &SignedConstraints{Message: message, Signature: signature}
+	}
+
+	submit := func(t *testing.T, relay *mockRelay, payload BatchedSignedConstraints) {
+		t.Helper()
+		_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+		require.NoError(t, err)
+	}
+
+	t.Run("All signatures valid", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.SetProposerSigningDomain(domain, proposerPublicKey)
+		submit(t, relay, BatchedSignedConstraints{signConstraints(t, 1, secretKey), signConstraints(t, 2, secretKey)})
+
+		require.NoError(t, relay.VerifyAllReceivedConstraintSignatures())
+	})
+
+	t.Run("Invalid signatures are listed", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.SetProposerSigningDomain(domain, proposerPublicKey)
+		submit(t, relay, BatchedSignedConstraints{signConstraints(t, 1, otherSecretKey), signConstraints(t, 2, secretKey)})
+
+		// A modified message no longer matches its signature
+		tampered := signConstraints(t, 3, secretKey)
+		tampered.Message.ValidatorIndex++
+		submit(t, relay, BatchedSignedConstraints{tampered})
+
+		err := relay.VerifyAllReceivedConstraintSignatures()
+		require.ErrorIs(t, err, errInvalidConstraintSignature)
+		var multiErr MultiError
+		require.ErrorAs(t, err, &multiErr)
+		require.Len(t, multiErr, 2)
+		require.Contains(t, multiErr[0].Error(), "slot 1")
+		require.Contains(t, multiErr[1].Error(), "slot 3")
+	})
+}
+
+func TestMockRelayGzipRequests(t *testing.T) {
+	registration := &builderApiV1.SignedValidatorRegistration{
+		Message: &builderApiV1.ValidatorRegistration{
+			FeeRecipient: _HexToAddress("0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941"),
+			GasLimit:     30000000,
+			Timestamp:    time.Unix(1234356, 0),
+			Pubkey: _HexToPubkey(
+				"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249"),
+		},
+		Signature: _HexToSignature(
+			"0x81510b571e22f89d1697545aac01c9ad0c1e7a3e778b3078bef524efae14990e58a6e960a152abd49de2e18d7fd3081c15d5c25867ccfad3d47beef6b39ac24b6b9fbf2cfa91c88f67aff750438a6841ec9e4a06a94ae41410c4f97b75ab284c"),
+	}
+	registrations := make([]*builderApiV1.SignedValidatorRegistration, 500)
+	for i := range registrations {
+		registrations[i] = registration
+	}
+	payload, err := json.Marshal(registrations)
+	require.NoError(t, err)
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	_, err = writer.Write(payload)
+	require.NoError(t, err)
+	require.NoError(t, writer.Close())
+
+	registerValidators := func(relay *mockRelay, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, pathRegisterValidator, bytes.NewReader(body))
+		req.Header.Set("Content-Encoding", "gzip")
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Compressed registrations are decoded", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.UseGzipRequests = true
+
+		rr := registerValidators(relay, compressed.Bytes())
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		relay.mu.Lock()
+		defer relay.mu.Unlock()
+		require.Equal(t, registrations, relay.recordedRegistrations)
+	})
+
+	t.Run("Invalid compressed body", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.UseGzipRequests = true
+
+		rr := registerValidators(relay, payload)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("Compressed body not decoded if disabled", func(t *testing.T) {
+		relay := newMockRelay(t)
+
+		rr := registerValidators(relay, compressed.Bytes())
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Empty(t, relay.recordedRegistrations)
+	})
+}
+
+func TestMockRelayHandlerPanicRecovery(t *testing.T) {
+	relay := newMockRelay(t)
+	relay.overrideHandleGetHeaderWithProofs(func(_ http.ResponseWriter, _ *http.Request) {
+		panic("broken override")
+	})
+	path := getHeaderWithProofsPath(1, _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"), relay.RelayEntry.PublicKey)
+	client := http.Client{Timeout: time.Second}
+
+	resp, err := client.Get(relay.RelayEntry.GetURI(path))
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.Contains(t, string(body), "broken override")
+
+	// The relay lock was released, so the relay keeps serving requests
+	relay.overrideHandleGetHeaderWithProofs(nil)
+	resp, err = client.Get(relay.RelayEntry.GetURI(path))
+	require.NoError(t, err)
+	require.NoError(t, resp.Body.Close())
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestMockRelayMaxConstraintsToReturn(t *testing.T) {
+	slot := uint64(8978583)
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	relay := newMockRelay(t)
+	relay.MaxConstraintsToReturn = 3
+
+	// Submit 5 constraints on distinct transactions
+	constraints := make([]*Constraint, 5)
+	txHashes := make([]phase0.Hash32, 5)
+	for i := range constraints {
+		tx := types.NewTx(&types.DynamicFeeTx{Nonce: uint64(i)})
+		rawTx, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		constraints[i] = &Constraint{Tx: Transaction(rawTx)}
+		txHashes[i] = phase0.Hash32(tx.Hash())
+	}
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    constraints,
+		},
+	}}
+	_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+	require.NoError(t, err)
+
+	req := httptest.NewRequest(http.MethodGet, getHeaderWithProofsPath(slot, hash, relay.RelayEntry.PublicKey), nil)
+	rr := httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	response := new(BidWithInclusionProofs)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), response))
+	require.NotNil(t, response.Proofs)
+	require.Equal(t, txHashes[:3], response.Proofs.TransactionHashes)
+	require.Len(t, response.Proofs.GeneralizedIndexes, 3)
+
+	// The proof is valid for the block made of the returned constraints
+	transactionsRoot, err := response.Bid.TransactionsRoot()
+	require.NoError(t, err)
+	leaves := make([]Transaction, 3)
+	for i := range leaves {
+		leaves[i] = constraints[i].Tx
+	}
+	require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(response.Proofs, transactionsRoot, leaves))
+}
+
+func TestMockRelayHandleGetHeaderWithProofsReturnsProofsForAllConstraints(t *testing.T) {
+	slot := uint64(8978583)
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	relay := newMockRelay(t)
+	relay.MaxConstraintsToReturn = 10
+
+	rawTxs := []Transaction{
+		_HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f"),
+		_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"),
+		_HexToBytes("0x02f87601836384348477359400850517683ba883019a28943678fce4028b6745eb04fa010d9c8e4b36d6288c872b0f1366ad800080c080a0b6b7aba1954160d081b2c8612e039518b9c46cd7df838b405a03f927ad196158a071d2fb6813e5b5184def6bd90fb5f29e0c52671dea433a7decb289560a58416e"),
+	}
+	constraints := make([]*Constraint, len(rawTxs))
+	txsByHash := make(map[phase0.Hash32]Transaction, len(rawTxs))
+	for i, rawTx := range rawTxs {
+		constraints[i] = &Constraint{Tx: rawTx}
+		txHash, err := constraints[i].TxHash()
+		require.NoError(t, err)
+		txsByHash[txHash] = rawTx
+	}
+
+	// Submit the constraints to the submitConstraint handler
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    constraints,
+		},
+	}}
+	body, err := json.Marshal(payload)
+	require.NoError(t, err)
+	req := httptest.NewRequest(http.MethodPost, pathSubmitConstraint, bytes.NewReader(body))
+	rr := httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	req = httptest.NewRequest(http.MethodGet, getHeaderWithProofsPath(slot, hash, relay.RelayEntry.PublicKey), nil)
+	rr = httptest.NewRecorder()
+	relay.getRouter().ServeHTTP(rr, req)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	response := new(BidWithInclusionProofs)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), response))
+	require.Equal(t, 3, response.ProofCount())
+
+	// Each proven leaf is one of the submitted transactions, and each of them is proven once
+	leaves := make([]Transaction, len(response.Proofs.TransactionHashes))
+	proven := make(map[phase0.Hash32]bool, len(leaves))
+	for i, txHash := range response.Proofs.TransactionHashes {
+		tx, ok := txsByHash[txHash]
+		require.True(t, ok, "proof %d is for transaction %s, which was not submitted", i, txHash)
+		require.False(t, proven[txHash], "transaction %s is proven twice", txHash)
+		proven[txHash] = true
+		leaves[i] = tx
+	}
+
+	// The leaves of the proof are the hash tree roots of these transactions in the block of the bid
+	transactionsRoot, err := response.Bid.TransactionsRoot()
+	require.NoError(t, err)
+	require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(response.Proofs, transactionsRoot, leaves))
+}
+
+func TestMockRelayGetHeaderResponseIfConstraintsPresent(t *testing.T) {
+	slot := uint64(8978583)
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+
+	getHeaderValue := func(t *testing.T, relay *mockRelay, slot uint64) *uint256.Int {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, getHeaderPath(slot, hash, relay.RelayEntry.PublicKey), nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		bid := new(builderSpec.VersionedSignedBuilderBid)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+		value, err := bid.Value()
+		require.NoError(t, err)
+		return value
+	}
+
+	relay := newMockRelay(t)
+	relay.GetHeaderResponse = relay.MakeGetHeaderResponse(
+		20000, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella,
+	)
+	relay.GetHeaderResponseIfConstraintsPresent = relay.MakeGetHeaderResponse(
+		30000, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella,
+	)
+
+	t.Run("No constraints", func(t *testing.T) {
+		require.Equal(t, uint256.NewInt(20000), getHeaderValue(t, relay, slot))
+	})
+
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+	_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+	require.NoError(t, err)
+
+	t.Run("Constraints for the slot", func(t *testing.T) {
+		require.Equal(t, uint256.NewInt(30000), getHeaderValue(t, relay, slot))
+	})
+
+	t.Run("Constraints for another slot", func(t *testing.T) {
+		require.Equal(t, uint256.NewInt(20000), getHeaderValue(t, relay, slot+1))
+	})
+}
+
+func TestMockRelayGetHeaderResponseForParentHash(t *testing.T) {
+	// Two competing heads of a fork, and a third unknown one
+	parentHashA := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	parentHashB := _HexToHash("0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	unknownParentHash := _HexToHash("0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+
+	getHeader := func(t *testing.T, relay *mockRelay, parentHash phase0.Hash32) *builderSpec.VersionedSignedBuilderBid {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, getHeaderPath(1, parentHash, relay.RelayEntry.PublicKey), nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		bid := new(builderSpec.VersionedSignedBuilderBid)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+		return bid
+	}
+
+	relay := newMockRelay(t)
+	pubkey := relay.RelayEntry.PublicKey.String()
+	relay.SetGetHeaderResponseForParentHash(parentHashA, relay.MakeGetHeaderResponse(
+		20000, "0x1100000000000000000000000000000000000000000000000000000000000000", parentHashA.String(), pubkey, spec.DataVersionCapella,
+	))
+	relay.SetGetHeaderResponseForParentHash(parentHashB, relay.MakeGetHeaderResponse(
+		30000, "0x2200000000000000000000000000000000000000000000000000000000000000", parentHashB.String(), pubkey, spec.DataVersionCapella,
+	))
+
+	t.Run("Each branch gets its own bid", func(t *testing.T) {
+		for _, tt := range []struct {
+			parentHash phase0.Hash32
+			value      uint64
+		}{
+			{parentHashA, 20000},
+			{parentHashB, 30000},
+			{parentHashA, 20000},
+		} {
+			bid := getHeader(t, relay, tt.parentHash)
+			value, err := bid.Value()
+			require.NoError(t, err)
+			require.Equal(t, uint256.NewInt(tt.value), value)
+
+			parentHash, err := bid.ParentHash()
+			require.NoError(t, err)
+			require.Equal(t, tt.parentHash, parentHash)
+		}
+	})
+
+	t.Run("Unknown parent hash gets the default bid", func(t *testing.T) {
+		value, err := getHeader(t, relay, unknownParentHash).Value()
+		require.NoError(t, err)
+		require.Equal(t, uint256.NewInt(12345), value)
+	})
+
+	t.Run("Unknown parent hash gets GetHeaderResponse", func(t *testing.T) {
+		relay.GetHeaderResponse = relay.MakeGetHeaderResponse(
+			40000, unknownParentHash.String(), unknownParentHash.String(), pubkey, spec.DataVersionCapella,
+		)
+		value, err := getHeader(t, relay, unknownParentHash).Value()
+		require.NoError(t, err)
+		require.Equal(t, uint256.NewInt(40000), value)
+
+		// The per-parent-hash responses take precedence
+		value, err = getHeader(t, relay, parentHashB).Value()
+		require.NoError(t, err)
+		require.Equal(t, uint256.NewInt(30000), value)
+	})
+}
+
+func TestMockRelayCaptureGetHeaderParams(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	otherParentHash := _HexToHash("0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	getHeader := func(t *testing.T, relay *mockRelay, path string) {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		relay := newMockRelay(t)
+		getHeader(t, relay, getHeaderPath(1, parentHash, pubkey))
+		require.Empty(t, relay.CapturedGetHeaderParams())
+		require.Equal(t, GetHeaderParams{}, relay.LastCapturedGetHeaderParams())
+	})
+
+	t.Run("Params match the request URLs", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.CaptureGetHeaderParams = true
+
+		getHeader(t, relay, getHeaderPath(1, parentHash, pubkey))
+		getHeader(t, relay, getHeaderPath(2, otherParentHash, pubkey))
+
+		expected := []GetHeaderParams{
+			{Slot: 1, ParentHash: parentHash, ProposerPubkey: pubkey},
+			{Slot: 2, ParentHash: otherParentHash, ProposerPubkey: pubkey},
+		}
+		require.Equal(t, expected, relay.CapturedGetHeaderParams())
+		require.Equal(t, expected[1], relay.LastCapturedGetHeaderParams())
+	})
+
+	t.Run("Invalid params rejected", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.CaptureGetHeaderParams = true
+
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/eth/v1/builder/header/1/0x1234/%s", pubkey), nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Empty(t, relay.CapturedGetHeaderParams())
+	})
+}
+
+func TestMockRelayShutdown(t *testing.T) {
+	// startSlowRequest sends a status request to the relay, and waits until the relay is handling it
+	startSlowRequest := func(t *testing.T, relay *mockRelay) <-chan error {
+		t.Helper()
+		done := make(chan error, 1)
+		go func() {
+			_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodGet, relay.RelayEntry.GetURI(pathStatus), "", nil, nil, nil)
+			done <- err
+		}()
+		require.Eventually(t, func() bool {
+			return relay.GetRequestCount(pathStatus) == 1
+		}, time.Second, 5*time.Millisecond)
+		return done
+	}
+
+	t.Run("In-flight request completes", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.ResponseDelay = 200 * time.Millisecond
+		done := startSlowRequest(t, relay)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		start := time.Now()
+		require.NoError(t, relay.Shutdown(ctx))
+
+		// The shutdown waited for the request, which completed successfully
+		require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+		require.NoError(t, <-done)
+
+		// New requests are refused
+		_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodGet, relay.RelayEntry.GetURI(pathStatus), "", nil, nil, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("Deadline expires before the request completes", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.ResponseDelay = 500 * time.Millisecond
+		done := startSlowRequest(t, relay)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		require.ErrorIs(t, relay.Shutdown(ctx), context.DeadlineExceeded)
+		require.NoError(t, <-done)
+	})
+}
+
+func TestMockRelayVerifyConstraintSignatures(t *testing.T) {
+	domain, err := ComputeDomain(phase0.DomainType{0x00, 0x00, 0x00, 0x00}, "0x03000000", phase0.Root{}.String())
+	require.NoError(t, err)
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	otherSecretKey, _, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	var proposerPublicKey phase0.BLSPubKey
+	copy(proposerPublicKey[:], bls.PublicKeyToBytes(publicKey))
+
+	testCases := []struct {
+		name         string
+		batch        BatchedSignedConstraints
+		expectedCode int
+	}{
+		{
+			name:         "Signed by the proposer",
+			batch:        makeSignedConstraintsBatch(t, 3, secretKey),
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Signed by another key",
+			batch:        append(makeSignedConstraintsBatch(t, 2, secretKey), makeSignedConstraintsBatch(t, 1, otherSecretKey)...),
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			relay.SetProposerSigningDomain(domain, proposerPublicKey)
+			relay.VerifyConstraintSignatures = true
+
+			body, err := json.Marshal(tt.batch)
+			require.NoError(t, err)
+			req := httptest.NewRequest(http.MethodPost, pathSubmitConstraint, bytes.NewReader(body))
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, tt.expectedCode, rr.Code, rr.Body.String())
+
+			relay.mu.Lock()
+			defer relay.mu.Unlock()
+			if tt.expectedCode == http.StatusOK {
+				require.Len(t, relay.capturedConstraints, len(tt.batch))
+			} else {
+				require.Contains(t, rr.Body.String(), errInvalidConstraintSignature.Error())
+				require.Empty(t, relay.capturedConstraints)
+			}
+		})
+	}
+}
+
+func TestMockRelayConstraintValidationMode(t *testing.T) {
+	domain, err := ComputeDomain(phase0.DomainType{0x00, 0x00, 0x00, 0x00}, "0x03000000", phase0.Root{}.String())
+	require.NoError(t, err)
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	otherSecretKey, _, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	var proposerPublicKey phase0.BLSPubKey
+	copy(proposerPublicKey[:], bls.PublicKeyToBytes(publicKey))
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+
+	// signedConstraints returns a valid message signed by the proposer, after applying modify to it
+	signedConstraints := func(t *testing.T, signingKey *bls.SecretKey, modify func(message *ConstraintsMessage)) BatchedSignedConstraints {
+		t.Helper()
+		message := ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           5,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+			GasLimit:       21_000,
+		}
+		modify(&message)
+		signature := signConstraintsMessage(&message, signingKey)
+		return BatchedSignedConstraints{&SignedConstraints{Message: message, Signature: signature}}
+	}
+
+	testCases := []struct {
+		name        string
+		batch       BatchedSignedConstraints
+		strictError error // nil if accepted in strict mode
+	}{
+		{
+			name:  "Valid constraints",
+			batch: signedConstraints(t, secretKey, func(*ConstraintsMessage) {}),
+		},
+		{
+			name:        "Not signed by the proposer",
+			batch:       signedConstraints(t, otherSecretKey, func(*ConstraintsMessage) {}),
+			strictError: errInvalidConstraintSignature,
+		},
+		{
+			name:        "Slot out of range",
+			batch:       signedConstraints(t, secretKey, func(message *ConstraintsMessage) { message.Slot = 11 }),
+			strictError: errConstraintSlotOutOfRange,
+		},
+		{
+			name:        "Gas limit above the block gas limit",
+			batch:       signedConstraints(t, secretKey, func(message *ConstraintsMessage) { message.GasLimit = mockRelayDefaultBlockGasLimit + 1 }),
+			strictError: errConstraintGasLimitTooHigh,
+		},
+	}
+
+	submit := func(t *testing.T, relay *mockRelay, batch BatchedSignedConstraints) *httptest.ResponseRecorder {
+		t.Helper()
+		body, err := json.Marshal(batch)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, pathSubmitConstraint, bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Run("Lenient", func(t *testing.T) {
+				relay := newMockRelay(t)
+				relay.SetProposerSigningDomain(domain, proposerPublicKey)
+				relay.MinConstraintSlot = 1
+				relay.MaxConstraintSlot = 10
+
+				rr := submit(t, relay, tt.batch)
+				require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+				require.Len(t, relay.capturedConstraints, 1)
+			})
+
+			t.Run("Strict", func(t *testing.T) {
+				relay := newMockRelay(t)
+				relay.SetProposerSigningDomain(domain, proposerPublicKey)
+				relay.SetConstraintValidationMode(ConstraintValidationStrict)
+				relay.MinConstraintSlot = 1
+				relay.MaxConstraintSlot = 10
+
+				rr := submit(t, relay, tt.batch)
+				if tt.strictError == nil {
+					require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+					require.Len(t, relay.capturedConstraints, 1)
+				} else {
+					require.Equal(t, http.StatusBadRequest, rr.Code)
+					require.Contains(t, rr.Body.String(), tt.strictError.Error())
+					require.Empty(t, relay.capturedConstraints)
+				}
+			})
+		})
+	}
+
+	t.Run("Strict fee validation", func(t *testing.T) {
+		batch := signedConstraints(t, secretKey, func(*ConstraintsMessage) {})
+
+		relay := newMockRelay(t)
+		relay.SetProposerSigningDomain(domain, proposerPublicKey)
+		relay.SetConstraintValidationMode(ConstraintValidationStrict)
+		// Below the max fee per gas of 10199506607 wei of the transaction
+		relay.BlockBaseFee = uint256.NewInt(11_000_000_000)
+		rr := submit(t, relay, batch)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errConstraintTxFeeTooLow.Error())
+
+		// Undecodable transactions are rejected even without a base fee
+		batch = signedConstraints(t, secretKey, func(message *ConstraintsMessage) {
+			message.Constraints = []*Constraint{{Transaction{0x01, 0x02}, nil}}
+		})
+		relay.BlockBaseFee = nil
+		rr = submit(t, relay, batch)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Empty(t, relay.capturedConstraints)
+	})
+}
+
+func TestMockRelayStrictMode(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+
+	// newStrictRelay returns a strict relay recording the test failures instead of failing the test
+	newStrictRelay := func(t *testing.T) (*mockRelay, *[]string) {
+		t.Helper()
+		relay := newMockRelay(t)
+		relay.StrictMode = true
+		failures := []string{}
+		relay.errorf = func(format string, args ...any) {
+			failures = append(failures, fmt.Sprintf(format, args...))
+		}
+		return relay, &failures
+	}
+
+	serve := func(relay *mockRelay, method, path string) int {
+		req := httptest.NewRequest(method, path, nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	t.Run("Unexpected call fails the test", func(t *testing.T) {
+		relay, failures := newStrictRelay(t)
+		require.Equal(t, http.StatusInternalServerError, serve(relay, http.MethodGet, pathStatus))
+		require.Equal(t, []string{"unexpected call to " + pathStatus}, *failures)
+	})
+
+	t.Run("Expected call is served", func(t *testing.T) {
+		relay, failures := newStrictRelay(t)
+		relay.ExpectPaths(pathStatus, pathGetHeader)
+		require.Equal(t, http.StatusOK, serve(relay, http.MethodGet, pathStatus))
+		require.Equal(t, http.StatusOK, serve(relay, http.MethodGet, getHeaderPath(1, hash, relay.RelayEntry.PublicKey)))
+		require.Empty(t, *failures)
+
+		// getPayload must not be called
+		require.Equal(t, http.StatusInternalServerError, serve(relay, http.MethodPost, pathGetPayload))
+		require.Equal(t, []string{"unexpected call to " + pathGetPayload}, *failures)
+	})
+
+	t.Run("Overridden handler is expected", func(t *testing.T) {
+		relay, failures := newStrictRelay(t)
+		relay.handlerOverrideGetPayload = func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		}
+		require.Equal(t, http.StatusNoContent, serve(relay, http.MethodPost, pathGetPayload))
+		require.Empty(t, *failures)
+	})
+
+	t.Run("Disabled by default", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.errorf = func(format string, args ...any) {
+			t.Errorf("unexpected failure: "+format, args...)
+		}
+		require.Equal(t, http.StatusOK, serve(relay, http.MethodGet, pathStatus))
+	})
+}
+
+func TestMockRelaySetHandlerForAllPaths(t *testing.T) {
+	serve := func(relay *mockRelay, method, path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("Unmapped path without handler", func(t *testing.T) {
+		relay := newMockRelay(t)
+		require.Equal(t, http.StatusNotFound, serve(relay, http.MethodGet, "/unknown/path").Code)
+	})
+
+	t.Run("Unmapped path with handler", func(t *testing.T) {
+		relay := newMockRelay(t)
+		calledPaths := []string{}
+		relay.SetHandlerForAllPaths(func(w http.ResponseWriter, req *http.Request) {
+			calledPaths = append(calledPaths, req.URL.Path)
+			w.WriteHeader(http.StatusTeapot)
+		})
+
+		require.Equal(t, http.StatusTeapot, serve(relay, http.MethodGet, "/unknown/path").Code)
+		require.Equal(t, http.StatusTeapot, serve(relay, http.MethodPost, "/eth/v1/builder/unknown").Code)
+		require.Equal(t, []string{"/unknown/path", "/eth/v1/builder/unknown"}, calledPaths)
+		require.Equal(t, 1, relay.GetRequestCount("/unknown/path"))
+
+		// Mapped paths keep their handlers, even for another method
+		require.Equal(t, http.StatusOK, serve(relay, http.MethodGet, pathStatus).Code)
+		require.Equal(t, http.StatusMethodNotAllowed, serve(relay, http.MethodPost, pathStatus).Code)
+		require.Len(t, calledPaths, 2)
+	})
+}
+
+func TestMockRelayConstraintAckCallback(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	otherSecretKey, otherPublicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	var proposerPubkey, otherPubkey phase0.BLSPubKey
+	copy(proposerPubkey[:], bls.PublicKeyToBytes(publicKey))
+	copy(otherPubkey[:], bls.PublicKeyToBytes(otherPublicKey))
+
+	// signedConstraints returns a message for the slot signed with the key
+	signedConstraints := func(t *testing.T, secretKey *bls.SecretKey, slot uint64) *SignedConstraints {
+		t.Helper()
+		message := ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		}
+		signature := signConstraintsMessage(&message, secretKey)
+		return &SignedConstraints{Message: message, Signature: signature}
+	}
+
+	relay := newMockRelay(t)
+	acks := make(chan BatchedSignedConstraints, 1)
+	relay.RegisterConstraintAckCallback(proposerPubkey.String(), func(constraints BatchedSignedConstraints) {
+		acks <- constraints
+	})
+	otherAcks := make(chan BatchedSignedConstraints, 1)
+	relay.RegisterConstraintAckCallback(otherPubkey.String(), func(constraints BatchedSignedConstraints) {
+		otherAcks <- constraints
+	})
+
+	t.Run("Rejected submission", func(t *testing.T) {
+		_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, "invalid constraints", nil)
+		require.Error(t, err)
+
+		select {
+		case <-acks:
+			t.Fatal("rejected constraints acknowledged")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("Accepted submission", func(t *testing.T) {
+		payload := BatchedSignedConstraints{signedConstraints(t, secretKey, 1)}
+		_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+		require.NoError(t, err)
+
+		select {
+		case constraints := <-acks:
+			require.Equal(t, payload, constraints)
+		case <-time.After(time.Second):
+			t.Fatal("constraints not acknowledged")
+		}
+
+		// Only the signer of the constraints is notified
+		select {
+		case <-otherAcks:
+			t.Fatal("callback of another proposer fired")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("Batch signed by two proposers", func(t *testing.T) {
+		payload := BatchedSignedConstraints{signedConstraints(t, secretKey, 2), signedConstraints(t, otherSecretKey, 3)}
+		_, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+		require.NoError(t, err)
+
+		for _, tc := range []struct {
+			acks     chan BatchedSignedConstraints
+			expected BatchedSignedConstraints
+		}{
+			{acks, payload[:1]},
+			{otherAcks, payload[1:]},
+		} {
+			select {
+			case constraints := <-tc.acks:
+				require.Equal(t, tc.expected, constraints)
+			case <-time.After(time.Second):
+				t.Fatal("constraints not acknowledged")
+			}
+		}
+	})
+}
+
+func TestMockRelaySubmitConstraintContentType(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	payload, err := json.Marshal(BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           1,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}})
+	require.NoError(t, err)
+
+	testCases := []struct {
+		contentType  string
+		expectedCode int
+	}{
+		{contentType: "application/json", expectedCode: http.StatusOK},
+		{contentType: "application/json; charset=utf-8", expectedCode: http.StatusOK},
+		{contentType: "text/plain", expectedCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.contentType, func(t *testing.T) {
+			relay := newMockRelay(t)
+			req, err := http.NewRequest(http.MethodPost, pathSubmitConstraint, bytes.NewReader(payload))
+			require.NoError(t, err)
+			req.Header.Set("Content-Type", tt.contentType)
+
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, tt.expectedCode, rr.Code, rr.Body.String())
+			if tt.expectedCode == http.StatusOK {
+				require.Len(t, relay.capturedConstraints, 1)
+			}
+		})
+	}
+}
+
+func TestMockRelayExpectSequence(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+
+	serve := func(relay *mockRelay, method, path string) {
+		req := httptest.NewRequest(method, path, nil)
+		relay.getRouter().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	testCases := []struct {
+		name  string
+		calls []string
+		match bool
+	}{
+		{
+			name:  "Matching sequence",
+			calls: []string{pathRegisterValidator, pathGetHeader, pathGetPayload},
+			match: true,
+		},
+		{
+			name:  "Wrong order",
+			calls: []string{pathRegisterValidator, pathGetPayload, pathGetHeader},
+		},
+		{
+			name:  "Missing call",
+			calls: []string{pathRegisterValidator, pathGetHeader},
+		},
+		{
+			name:  "Extra call",
+			calls: []string{pathRegisterValidator, pathStatus, pathGetHeader, pathGetPayload},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			// Calls before ExpectSequence are not recorded
+			serve(relay, http.MethodGet, pathStatus)
+			relay.ExpectSequence(pathRegisterValidator, pathGetHeader, pathGetPayload)
+
+			for _, call := range tt.calls {
+				switch call {
+				case pathGetHeader:
+					serve(relay, http.MethodGet, getHeaderPath(1, hash, relay.RelayEntry.PublicKey))
+				case pathStatus:
+					serve(relay, http.MethodGet, pathStatus)
+				default:
+					serve(relay, http.MethodPost, call)
+				}
+			}
+
+			err := relay.checkSequence()
+			if tt.match {
+				require.NoError(t, err)
+				relay.AssertSequence(t)
+			} else {
+				require.ErrorIs(t, err, errUnexpectedCallSequence)
+			}
+		})
+	}
+}
+
+func TestMockRelayBoltOptIn(t *testing.T) {
+	pubkey := _HexToPubkey("0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	t.Run("Opt-ins are stored in order", func(t *testing.T) {
+		relay := newMockRelay(t)
+		url := relay.RelayEntry.GetURI(pathBoltOptIn)
+		optIns := []SignedValidatorOptIn{
+			{Pubkey: pubkey, Signature: phase0.BLSSignature{0x01}, SlotRange: SlotRange{Start: 100, End: 200}},
+			{Pubkey: pubkey, Signature: phase0.BLSSignature{0x02}, SlotRange: SlotRange{Start: 300, End: 300}},
+		}
+		for _, optIn := range optIns {
+			code, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, url, "", nil, optIn, nil)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, code)
+		}
+
+		require.Equal(t, optIns, relay.CapturedOptIns())
+		require.Equal(t, 2, relay.GetRequestCount(pathBoltOptIn))
+	})
+
+	t.Run("Invalid opt-ins are rejected", func(t *testing.T) {
+		relay := newMockRelay(t)
+
+		optIn := SignedValidatorOptIn{Pubkey: pubkey, SlotRange: SlotRange{Start: 200, End: 100}}
+		body, err := json.Marshal(optIn)
+		require.NoError(t, err)
+		req := httptest.NewRequest(http.MethodPost, pathBoltOptIn, bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errInvalidSlotRange.Error())
+
+		req = httptest.NewRequest(http.MethodPost, pathBoltOptIn, bytes.NewReader([]byte("{")))
+		rr = httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, req)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+
+		require.Empty(t, relay.CapturedOptIns())
+	})
+}
+
+func TestMockRelayRequestSequence(t *testing.T) {
+	relay := newMockRelay(t)
+	require.Empty(t, relay.RequestSequence())
+
+	calls := []struct {
+		path   string
+		status int
+	}{
+		{pathStatus, http.StatusOK},
+		{"/unknown", http.StatusNotFound},
+		{pathSubmitConstraint, http.StatusMethodNotAllowed},
+		{pathStatus, http.StatusOK},
+	}
+	for _, call := range calls {
+		req := httptest.NewRequest(http.MethodGet, call.path, nil)
+		relay.getRouter().ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	sequence := relay.RequestSequence()
+	require.Len(t, sequence, len(calls))
+	for i, call := range calls {
+		require.Equal(t, call.path, sequence[i].Path)
+		require.Equal(t, call.status, sequence[i].Status)
+		if i > 0 {
+			require.False(t, sequence[i].Timestamp.Before(sequence[i-1].Timestamp))
+		}
+	}
+}
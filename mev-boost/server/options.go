@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/flashbots/go-boost-utils/bls"
+	"github.com/holiman/uint256"
+)
+
+// BoostServiceOption configures optional behavior of the BoostService, see NewBoostService
+type BoostServiceOption func(*BoostService)
+
+// WithMinBidValue sets the minimum bid value (in wei) accepted from a relay. Bids below it are ignored, and
+// GetBestBidForSlot returns a NoBidAboveMinimumError if no bid reaches it.
+func WithMinBidValue(minValue *uint256.Int) BoostServiceOption {
+	return func(m *BoostService) {
+		m.minBidValue = minValue
+	}
+}
+
+// WithMaxBidValue sets the maximum bid value (in wei) accepted from a relay. Bids above it are ignored,
+// as such values usually point to a relay bug or manipulation attempt.
+func WithMaxBidValue(maxValue *uint256.Int) BoostServiceOption {
+	return func(m *BoostService) {
+		m.maxBidValue = maxValue
+	}
+}
+
+// WithConstraintProofVerifier replaces the default MerkleProofVerifier used to verify the relays' inclusion proofs
+func WithConstraintProofVerifier(v ConstraintProofVerifier) BoostServiceOption {
+	return func(m *BoostService) {
+		m.proofVerifier = v
+	}
+}
+
+// WithMaxFutureSlots sets how many slots after the current one the constraints may be for. Constraints for
+// a slot further in the future are rejected, as they are likely a bug. The default is 1.
+func WithMaxFutureSlots(slots uint64) BoostServiceOption {
+	return func(m *BoostService) {
+		m.maxFutureSlots = slots
+	}
+}
+
+// WithLatencyPreference makes the BoostService track the getHeader latency of every relay, and prefer
+// the relay with the lowest average latency when several bids have the same value.
+func WithLatencyPreference() BoostServiceOption {
+	return func(m *BoostService) {
+		m.relayLatency = newRelayLatencyTracker()
+	}
+}
+
+// WithRelayListShuffle randomizes the relay order for every bid request, and uses it to choose between bids
+// of equal value, so that the load is spread evenly between relays instead of depending on the block hash.
+func WithRelayListShuffle() BoostServiceOption {
+	return func(m *BoostService) {
+		m.relayShuffle = true
+	}
+}
+
+// WithConstraintWeightedSelection makes the BoostService prefer the bid proving the inclusion of the most
+// constraints when several bids have the same value, before any other tiebreaker.
+func WithConstraintWeightedSelection() BoostServiceOption {
+	return func(m *BoostService) {
+		m.constraintWeighted = true
+	}
+}
+
+// WithExtraRequestHeaders adds the headers, such as the API keys required by some relay operators, to every
+// request sent to the relays. They replace the headers of the same name set by the BoostService.
+func WithExtraRequestHeaders(headers http.Header) BoostServiceOption {
+	return func(m *BoostService) {
+		m.extraHeaders = headers.Clone()
+	}
+}
+
+// WithRelaySelector makes the BoostService choose the bid returned to the beacon node with the selector,
+// instead of taking the most profitable one. The tiebreakers enabled by other options are not applied.
+func WithRelaySelector(selector RelaySelector) BoostServiceOption {
+	return func(m *BoostService) {
+		m.relaySelector = selector
+	}
+}
+
+// WithCircuitBreaker stops requesting bids from a relay for openDuration after failureThreshold consecutive
+// failed requests within window. A single trial request is then sent, which closes the circuit if it succeeds.
+func WithCircuitBreaker(failureThreshold int, window, openDuration time.Duration) BoostServiceOption {
+	return func(m *BoostService) {
+		m.circuitBreaker = newCircuitBreaker(failureThreshold, window, openDuration)
+	}
+}
+
+// WithConstraintSigningKey sets the key used to sign the requests sent to the relays by CancelConstraints
+func WithConstraintSigningKey(secretKey *bls.SecretKey) BoostServiceOption {
+	return func(m *BoostService) {
+		m.constraintSigningKey = secretKey
+	}
+}
+
+// WithRelayTimeout sets the timeout of all the requests to the relay, instead of the timeouts set per request
+// type in BoostServiceOpts
+func WithRelayTimeout(relay RelayEntry, timeout time.Duration) BoostServiceOption {
+	return func(m *BoostService) {
+		if m.relayTimeouts == nil {
+			m.relayTimeouts = make(map[string]time.Duration)
+		}
+		m.relayTimeouts[relay.String()] = timeout
+	}
+}
+
+// WithPrimaryRelays makes the configured relays which are not listed fallback relays, only called for bids
+// if none of the primary relays delivers one
+func WithPrimaryRelays(relays ...RelayEntry) BoostServiceOption {
+	return func(m *BoostService) {
+		if m.primaryRelays == nil {
+			m.primaryRelays = make(map[string]bool, len(relays))
+		}
+		for _, relay := range relays {
+			m.primaryRelays[relay.String()] = true
+		}
+	}
+}
+
+// WithFallbackRelays makes the listed relays fallback relays, only called for bids if none of the primary
+// relays delivers one
+func WithFallbackRelays(relays ...RelayEntry) BoostServiceOption {
+	return func(m *BoostService) {
+		if m.fallbackRelays == nil {
+			m.fallbackRelays = make(map[string]bool, len(relays))
+		}
+		for _, relay := range relays {
+			m.fallbackRelays[relay.String()] = true
+		}
+	}
+}
+
+// WithLocalBlockBuilder makes GetBestBidOrLocalBlock build the block with the local builder when no relay delivers
+// a bid, instead of leaving the proposer with an empty block.
+func WithLocalBlockBuilder(builder LocalBlockBuilder) BoostServiceOption {
+	return func(m *BoostService) {
+		m.localBlockBuilder = builder
+	}
+}
+
+// WithMinValueDelta sets how much more (in wei) an external bid must pay than the local block for
+// CompareWithLocalBuilder to recommend it, to make up for the risk of relying on a relay
+func WithMinValueDelta(delta *uint256.Int) BoostServiceOption {
+	return func(m *BoostService) {
+		m.minValueDelta = delta
+	}
+}
+
+// WithRequestInterceptor sets a hook called before every HTTP request to a relay, with the HTTP method of the request.
+// The request is sent with the context it returns, such as to add a tracing span. It must be safe for concurrent use.
+func WithRequestInterceptor(fn func(ctx context.Context, relay RelayEntry, method string) context.Context) BoostServiceOption {
+	return func(m *BoostService) {
+		m.requestInterceptor = fn
+	}
+}
+
+// WithResponseInterceptor sets a hook called after every HTTP request to a relay, with the status code of the
+// response (0 if the request failed without a response) and the time it took. ctx is the context returned by the
+// request interceptor, if any. It must be safe for concurrent use.
+func WithResponseInterceptor(fn func(ctx context.Context, relay RelayEntry, method string, statusCode int, elapsed time.Duration)) BoostServiceOption {
+	return func(m *BoostService) {
+		m.responseInterceptor = fn
+	}
+}
+
+// WithStateStore sets the store keeping the submitted constraints, such as a persistent one, so that the
+// constraints of a slot are still checked if the service restarts before getPayload. The default
+// InMemoryConstraintStateStore doesn't survive a restart.
+func WithStateStore(store ConstraintStateStore) BoostServiceOption {
+	return func(m *BoostService) {
+		m.stateStore = store
+	}
+}
+
+// WithDNSCacheTTL makes the BoostService resolve the relay hostnames itself and keep their addresses for ttl.
+// They are then resolved again, and the open connections to a relay are dropped if its addresses changed,
+// so that a relay moving to a new IP is reached there instead of over a connection to the old one.
+func WithDNSCacheTTL(ttl time.Duration) BoostServiceOption {
+	return func(m *BoostService) {
+		m.dnsCache = newDNSCache(ttl)
+	}
+}
@@ -2,10 +2,15 @@ package server
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
 	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math/bits"
+	"slices"
+	"sort"
 	"strings"
 
 	fastSsz "github.com/ferranbt/fastssz"
@@ -21,6 +26,31 @@ type BidWithInclusionProofs struct {
 	Proofs *InclusionProof `json:"proofs"`
 }
 
+// NewBidWithInclusionProofs returns an empty BidWithInclusionProofs, to be filled with WithBid and WithProofs
+func NewBidWithInclusionProofs() *BidWithInclusionProofs {
+	return &BidWithInclusionProofs{}
+}
+
+// WithBid sets the block bid and returns b
+func (b *BidWithInclusionProofs) WithBid(bid *builderSpec.VersionedSignedBuilderBid) *BidWithInclusionProofs {
+	b.Bid = bid
+	return b
+}
+
+// WithProofs sets the inclusion proofs and returns b
+func (b *BidWithInclusionProofs) WithProofs(proofs *InclusionProof) *BidWithInclusionProofs {
+	b.Proofs = proofs
+	return b
+}
+
+// ProofCount returns the number of transactions whose inclusion is proven with the bid
+func (b *BidWithInclusionProofs) ProofCount() int {
+	if b.Proofs == nil {
+		return 0
+	}
+	return len(b.Proofs.TransactionHashes)
+}
+
 func (b *BidWithInclusionProofs) String() string {
 	out, err := json.Marshal(b)
 	if err != nil {
@@ -45,7 +75,8 @@ func (h HexBytes) Equal(other HexBytes) bool {
 
 // MarshalJSON implements json.Marshaler.
 func (h HexBytes) MarshalJSON() ([]byte, error) {
-	return []byte(fmt.Sprintf(`"%#x"`, []byte(h))), nil
+	// Not using %#x, which omits the prefix of empty values
+	return []byte(fmt.Sprintf(`"0x%x"`, []byte(h))), nil
 }
 
 // UnmarshalJSON implements json.Unmarshaler.
@@ -63,9 +94,14 @@ func (h *HexBytes) UnmarshalJSON(input []byte) error {
 	}
 
 	var data string
-	json.Unmarshal(input, &data)
+	if err := json.Unmarshal(input, &data); err != nil {
+		return err
+	}
 
-	res, _ := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	res, err := hex.DecodeString(strings.TrimPrefix(data, "0x"))
+	if err != nil {
+		return err
+	}
 
 	*h = res
 
@@ -102,3 +138,298 @@ func InclusionProofFromMultiProof(mp *fastSsz.Multiproof) *InclusionProof {
 		GeneralizedIndexes: generalIndexes,
 	}
 }
+
+// Size in bytes of the fixed part of a serialized leaf: transaction hash, generalized index and depth
+const serializedLeafSize = 32 + 8 + 1
+
+// Serialize encodes the proof in a compact binary format: a 4-byte leaf count, then for each leaf its
+// 32-byte transaction hash, 8-byte generalized index, 1-byte depth and depth×32-byte sibling hashes.
+// Each Merkle hash of the multiproof is sent once, with the first leaf whose branch needs it.
+// Integers are little-endian.
+func (p *InclusionProof) Serialize() ([]byte, error) {
+	if len(p.TransactionHashes) != len(p.GeneralizedIndexes) {
+		return nil, fmt.Errorf("%w: %d transaction hashes for %d generalized indexes", errInvalidProofEncoding, len(p.TransactionHashes), len(p.GeneralizedIndexes))
+	}
+
+	siblings, helperIndexes := proofHelperIndexes(p.GeneralizedIndexes)
+	if len(helperIndexes) != len(p.MerkleHashes) {
+		return nil, fmt.Errorf("%w: expected %d merkle hashes, got %d", errInvalidProofEncoding, len(helperIndexes), len(p.MerkleHashes))
+	}
+	hashes := make(map[uint64][]byte, len(helperIndexes))
+	for i, index := range helperIndexes {
+		hash := p.MerkleHashes[i]
+		if hash == nil || len(*hash) != 32 {
+			return nil, fmt.Errorf("%w: merkle hash %d is not 32 bytes", errInvalidProofEncoding, i)
+		}
+		hashes[index] = *hash
+	}
+
+	out := make([]byte, 4, 4+len(p.TransactionHashes)*serializedLeafSize+len(helperIndexes)*32)
+	binary.LittleEndian.PutUint32(out, uint32(len(p.TransactionHashes)))
+	for i, txHash := range p.TransactionHashes {
+		out = append(out, txHash[:]...)
+		out = binary.LittleEndian.AppendUint64(out, p.GeneralizedIndexes[i])
+		out = append(out, byte(len(siblings[i])))
+		for _, index := range siblings[i] {
+			out = append(out, hashes[index]...)
+		}
+	}
+	return out, nil
+}
+
+// Deserialize decodes a proof encoded with Serialize, replacing the content of p
+func (p *InclusionProof) Deserialize(data []byte) error {
+	if len(data) < 4 {
+		return fmt.Errorf("%w: missing leaf count", errInvalidProofEncoding)
+	}
+	count := binary.LittleEndian.Uint32(data)
+	data = data[4:]
+
+	// Bound the leaf count by the input size before allocating
+	if uint64(count)*serializedLeafSize > uint64(len(data)) {
+		return fmt.Errorf("%w: %d leaves do not fit in %d bytes", errInvalidProofEncoding, count, len(data))
+	}
+
+	transactionHashes := make([]phase0.Hash32, count)
+	generalizedIndexes := make([]uint64, count)
+	siblingHashes := make([][]HexBytes, count)
+	for i := range transactionHashes {
+		if len(data) < serializedLeafSize {
+			return fmt.Errorf("%w: leaf %d is truncated", errInvalidProofEncoding, i)
+		}
+		copy(transactionHashes[i][:], data[:32])
+		generalizedIndexes[i] = binary.LittleEndian.Uint64(data[32:40])
+		depth := int(data[40])
+		data = data[serializedLeafSize:]
+
+		if len(data) < depth*32 {
+			return fmt.Errorf("%w: sibling hashes of leaf %d are truncated", errInvalidProofEncoding, i)
+		}
+		for j := 0; j < depth; j++ {
+			siblingHashes[i] = append(siblingHashes[i], HexBytes(bytes.Clone(data[j*32:(j+1)*32])))
+		}
+		data = data[depth*32:]
+	}
+	if len(data) != 0 {
+		return fmt.Errorf("%w: %d trailing bytes", errInvalidProofEncoding, len(data))
+	}
+
+	siblings, helperIndexes := proofHelperIndexes(generalizedIndexes)
+	hashes := make(map[uint64]HexBytes, len(helperIndexes))
+	for i, leafSiblings := range siblings {
+		if len(leafSiblings) != len(siblingHashes[i]) {
+			return fmt.Errorf("%w: leaf %d has %d sibling hashes, expected %d", errInvalidProofEncoding, i, len(siblingHashes[i]), len(leafSiblings))
+		}
+		for j, index := range leafSiblings {
+			hashes[index] = siblingHashes[i][j]
+		}
+	}
+
+	merkleHashes := make([]*HexBytes, len(helperIndexes))
+	for i, index := range helperIndexes {
+		hash := hashes[index]
+		merkleHashes[i] = &hash
+	}
+
+	p.TransactionHashes = transactionHashes
+	p.GeneralizedIndexes = generalizedIndexes
+	p.MerkleHashes = merkleHashes
+	return nil
+}
+
+// proofHelperIndexes returns the generalized indexes of the helper nodes of a multiproof for the given leaves.
+// siblings lists, for each leaf and from the leaf up to the root, the helpers on its branch not already listed
+// for a previous leaf. all lists every helper in decreasing order, which is the order of the multiproof hashes.
+func proofHelperIndexes(leafIndexes []uint64) (siblings [][]uint64, all []uint64) {
+	// Nodes on the path of a leaf are computed by the verifier, so they are not helpers
+	paths := make(map[uint64]bool)
+	for _, index := range leafIndexes {
+		for i := index; i > 1; i /= 2 {
+			paths[i] = true
+		}
+	}
+
+	seen := make(map[uint64]bool)
+	siblings = make([][]uint64, len(leafIndexes))
+	for n, index := range leafIndexes {
+		for i := index; i > 1; i /= 2 {
+			sibling := i ^ 1
+			if paths[sibling] || seen[sibling] {
+				continue
+			}
+			seen[sibling] = true
+			siblings[n] = append(siblings[n], sibling)
+			all = append(all, sibling)
+		}
+	}
+
+	sort.Slice(all, func(i, j int) bool { return all[i] > all[j] })
+	return siblings, all
+}
+
+const (
+	// MaxTransactionsPerPayload is the maximum number of transactions in an execution payload
+	MaxTransactionsPerPayload = 1 << 20
+	// firstTransactionGeneralizedIndex is the generalized index of the first transaction in the tree of the
+	// transactions list, which is the left subtree of depth log2(MaxTransactionsPerPayload) under the root
+	firstTransactionGeneralizedIndex = 2 * MaxTransactionsPerPayload
+)
+
+// ValidateProofIndices checks that the generalized indexes of the proof are distinct and point to transactions
+// in [0, MaxTransactionsPerPayload). Duplicate indexes could otherwise make the multiproof verification pass for
+// a different set of leaves. The indexes may come in any order, as builders list the constrained transactions
+// in the random order of a map.
+func ValidateProofIndices(proof *InclusionProof) error {
+	if proof == nil {
+		return errNilProof
+	}
+
+	sorted := slices.Clone(proof.GeneralizedIndexes)
+	slices.Sort(sorted)
+	for i, index := range sorted {
+		if index < firstTransactionGeneralizedIndex || index >= firstTransactionGeneralizedIndex+MaxTransactionsPerPayload {
+			return fmt.Errorf("%w: %d", errProofIndexOutOfRange, index)
+		}
+		if i > 0 && index == sorted[i-1] {
+			return fmt.Errorf("%w: %d", errDuplicateProofIndex, index)
+		}
+	}
+	return nil
+}
+
+// ConstraintProofVerifier verifies the inclusion proofs sent by the relays along with their bids.
+type ConstraintProofVerifier interface {
+	// VerifyInclusionProof returns an error if the proof does not show that all the constraints
+	// are included in the transactions with the given root.
+	VerifyInclusionProof(proof *InclusionProof, txsRoot phase0.Root, constraints []Transaction) error
+}
+
+// MerkleProofVerifier is the default ConstraintProofVerifier, verifying the proof as an SSZ Merkle multiproof
+type MerkleProofVerifier struct{}
+
+// VerifyInclusionProof implements ConstraintProofVerifier.
+func (v MerkleProofVerifier) VerifyInclusionProof(proof *InclusionProof, txsRoot phase0.Root, constraints []Transaction) error {
+	if err := ValidateProofIndices(proof); err != nil {
+		return err
+	}
+
+	// Compute the hash tree root for the raw preconfirmed transactions
+	// and use them as "Leaves" in the proof to be verified against
+	leaves := make([][]byte, len(constraints))
+	for i, tx := range constraints {
+		txHashTreeRoot, err := tx.HashTreeRoot()
+		if err != nil {
+			return errInvalidRoot
+		}
+		leaves[i] = txHashTreeRoot[:]
+	}
+
+	hashes := make([][]byte, len(proof.MerkleHashes))
+	for i, hash := range proof.MerkleHashes {
+		hashes[i] = []byte(*hash)
+	}
+	indexes := make([]int, len(proof.GeneralizedIndexes))
+	for i, index := range proof.GeneralizedIndexes {
+		indexes[i] = int(index)
+	}
+
+	ok, err := verifyMultiproof(txsRoot[:], hashes, leaves, indexes)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidProofs
+	}
+
+	return nil
+}
+
+// verifyMultiproof returns whether the multiproof of the leaves at the given generalized indices matches the root.
+// It replaces fastssz.VerifyMultiproof, which hashes the nodes it computes after all the given ones instead of level
+// by level: a node computed from two leaves is then missing when its sibling is reached, and valid proofs of
+// leaves which are not all next to each other are rejected.
+func verifyMultiproof(root []byte, proof, leaves [][]byte, indices []int) (bool, error) {
+	if len(leaves) != len(indices) {
+		return false, fmt.Errorf("%w: %d leaves for %d indices", errMismatchProofSize, len(leaves), len(indices))
+	}
+	required := requiredProofIndices(indices)
+	if len(required) != len(proof) {
+		return false, fmt.Errorf("%w: %d hashes for %d required nodes", errMismatchProofSize, len(proof), len(required))
+	}
+	// Shorter or longer hashes would be padded or truncated when hashed into their parent
+	for _, hashes := range [][][]byte{leaves, proof} {
+		for _, hash := range hashes {
+			if len(hash) != 32 {
+				return false, fmt.Errorf("%w: %d bytes", errInvalidHashLength, len(hash))
+			}
+		}
+	}
+
+	// Known nodes by generalized index, and the indices of each level of the tree
+	nodes := make(map[int][]byte, len(leaves)+len(proof))
+	levels := make(map[int][]int)
+	maxLevel := 0
+	add := func(index int, hash []byte) {
+		nodes[index] = hash
+		level := bits.Len(uint(index)) - 1
+		levels[level] = append(levels[level], index)
+		maxLevel = max(maxLevel, level)
+	}
+	for i, leaf := range leaves {
+		add(indices[i], leaf)
+	}
+	for i, hash := range proof {
+		add(required[i], hash)
+	}
+
+	// Hash the nodes of each level into their parents, from the deepest level up to the root
+	buf := make([]byte, 64)
+	for level := maxLevel; level > 0; level-- {
+		for _, index := range levels[level] {
+			parent := index >> 1
+			if _, ok := nodes[parent]; ok {
+				continue
+			}
+			left, hasLeft := nodes[index&^1]
+			right, hasRight := nodes[index|1]
+			if !hasLeft || !hasRight {
+				return false, fmt.Errorf("%w: %d or %d", errMissingProofNode, index&^1, index|1)
+			}
+			copy(buf[:32], left)
+			copy(buf[32:], right)
+			hash := sha256.Sum256(buf)
+			nodes[parent] = hash[:]
+			levels[level-1] = append(levels[level-1], parent)
+		}
+	}
+
+	return bytes.Equal(nodes[1], root), nil
+}
+
+// requiredProofIndices returns the generalized indices of the sibling nodes needed to prove the leaves, in
+// decreasing order. This is the order fastssz uses for the hashes of a multiproof, see Node.ProveMulti.
+func requiredProofIndices(leafIndices []int) []int {
+	required := make(map[int]struct{})
+	// Nodes on the path from a leaf to the root are computed by the verifier
+	computed := make(map[int]struct{})
+	leaves := make(map[int]struct{}, len(leafIndices))
+
+	for _, leaf := range leafIndices {
+		leaves[leaf] = struct{}{}
+		for cur := leaf; cur > 1; cur >>= 1 {
+			required[cur^1] = struct{}{}
+			computed[cur>>1] = struct{}{}
+		}
+	}
+
+	requiredList := make([]int, 0, len(required))
+	for index := range required {
+		_, isComputed := computed[index]
+		_, isLeaf := leaves[index]
+		if !isComputed && !isLeaf {
+			requiredList = append(requiredList, index)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(requiredList)))
+	return requiredList
+}
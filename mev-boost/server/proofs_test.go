@@ -0,0 +1,802 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	mathrand "math/rand"
+	"reflect"
+	"testing"
+	"time"
+
+	builderSpec "github.com/attestantio/go-builder-client/spec"
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	utilbellatrix "github.com/attestantio/go-eth2-client/util/bellatrix"
+	"github.com/ethereum/go-ethereum/common"
+	fastssz "github.com/ferranbt/fastssz"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"github.com/stretchr/testify/require"
+)
+
+// alwaysPassVerifier is a ConstraintProofVerifier accepting any proof
+type alwaysPassVerifier struct{}
+
+func (alwaysPassVerifier) VerifyInclusionProof(_ *InclusionProof, _ phase0.Root, _ []Transaction) error {
+	return nil
+}
+
+func TestMerkleProofVerifier(t *testing.T) {
+	txs := []Transaction{
+		_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"),
+		_HexToBytes("0xf8708305dc6885029332e35883019a2894500b0107e172e420561565c8177c28ac0f62017f8810ffb80e6cc327008025a0e9c0b380c68f040ae7affefd11979f5ed18ae82c00e46aa3238857c372a358eca06b26e179dd2f7a7f1601755249f4cff56690c4033553658f0d73e26c36fe7815"),
+	}
+
+	transactions := new(utilbellatrix.ExecutionPayloadTransactions)
+	constraints := make([]struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}, len(txs))
+	for i, tx := range txs {
+		transactions.Transactions = append(transactions.Transactions, bellatrix.Transaction(tx))
+		constraints[i].tx = tx
+	}
+
+	rootNode, err := transactions.GetTree()
+	require.NoError(t, err)
+	txsRoot := phase0.Root(rootNode.Hash())
+
+	proof, err := CalculateMerkleMultiProofs(rootNode, constraints)
+	require.NoError(t, err)
+
+	verifier := MerkleProofVerifier{}
+
+	t.Run("Valid proof", func(t *testing.T) {
+		require.NoError(t, verifier.VerifyInclusionProof(proof, txsRoot, txs))
+	})
+
+	t.Run("Wrong transactions root", func(t *testing.T) {
+		require.Error(t, verifier.VerifyInclusionProof(proof, phase0.Root{0x01}, txs))
+	})
+
+	t.Run("Nil proof", func(t *testing.T) {
+		require.ErrorIs(t, verifier.VerifyInclusionProof(nil, txsRoot, txs), errNilProof)
+	})
+
+	t.Run("Indices in map order", func(t *testing.T) {
+		// Builders list the constrained transactions in the random order of a map
+		reversed := *proof
+		reversed.GeneralizedIndexes = []uint64{proof.GeneralizedIndexes[1], proof.GeneralizedIndexes[0]}
+		require.NoError(t, verifier.VerifyInclusionProof(&reversed, txsRoot, []Transaction{txs[1], txs[0]}))
+	})
+
+	t.Run("Duplicate indices", func(t *testing.T) {
+		duplicate := *proof
+		duplicate.GeneralizedIndexes = []uint64{proof.GeneralizedIndexes[0], proof.GeneralizedIndexes[0]}
+		require.ErrorIs(t, verifier.VerifyInclusionProof(&duplicate, txsRoot, txs), errDuplicateProofIndex)
+	})
+}
+
+func TestValidateProofIndices(t *testing.T) {
+	first := uint64(firstTransactionGeneralizedIndex)
+
+	testCases := []struct {
+		name        string
+		indexes     []uint64
+		expectedErr error
+	}{
+		{
+			name:    "No indices",
+			indexes: []uint64{},
+		},
+		{
+			name:    "Strictly increasing",
+			indexes: []uint64{first, first + 1, first + 5},
+		},
+		{
+			name:    "Last transaction",
+			indexes: []uint64{first + MaxTransactionsPerPayload - 1},
+		},
+		{
+			name:        "Duplicate",
+			indexes:     []uint64{first, first + 1, first + 1},
+			expectedErr: errDuplicateProofIndex,
+		},
+		{
+			name:    "Unsorted",
+			indexes: []uint64{first + 2, first + 1},
+		},
+		{
+			name:        "Unsorted duplicate",
+			indexes:     []uint64{first + 1, first + 2, first + 1},
+			expectedErr: errDuplicateProofIndex,
+		},
+		{
+			name:        "Below the transactions",
+			indexes:     []uint64{first - 1},
+			expectedErr: errProofIndexOutOfRange,
+		},
+		{
+			name:        "Above the transactions",
+			indexes:     []uint64{first, first + MaxTransactionsPerPayload},
+			expectedErr: errProofIndexOutOfRange,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateProofIndices(&InclusionProof{GeneralizedIndexes: tt.indexes})
+			if tt.expectedErr == nil {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+
+	t.Run("Nil proof", func(t *testing.T) {
+		require.ErrorIs(t, ValidateProofIndices(nil), errNilProof)
+	})
+}
+
+func TestVerifyMultiproof(t *testing.T) {
+	// fastssz.VerifyMultiproof rejects this valid proof of the first 3 of 10 transactions
+	transactions := new(utilbellatrix.ExecutionPayloadTransactions)
+	constraints := make([]struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}, 3)
+	txs := make([]Transaction, len(constraints))
+	for i := 0; i < 10; i++ {
+		tx := make(Transaction, 120)
+		_, err := rand.Read(tx)
+		require.NoError(t, err)
+		transactions.Transactions = append(transactions.Transactions, bellatrix.Transaction(tx))
+		if i < len(constraints) {
+			constraints[i].tx = tx
+			txs[i] = tx
+		}
+	}
+	rootNode, err := transactions.GetTree()
+	require.NoError(t, err)
+	txsRoot := phase0.Root(rootNode.Hash())
+	proof, err := CalculateMerkleMultiProofs(rootNode, constraints)
+	require.NoError(t, err)
+	require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(proof, txsRoot, txs))
+
+	t.Run("Leaves in the wrong order", func(t *testing.T) {
+		swapped := []Transaction{txs[1], txs[0], txs[2]}
+		require.ErrorIs(t, MerkleProofVerifier{}.VerifyInclusionProof(proof, txsRoot, swapped), errInvalidProofs)
+	})
+
+	t.Run("Missing proof hash", func(t *testing.T) {
+		truncated := *proof
+		truncated.MerkleHashes = proof.MerkleHashes[1:]
+		require.ErrorIs(t, MerkleProofVerifier{}.VerifyInclusionProof(&truncated, txsRoot, txs), errMismatchProofSize)
+	})
+
+	t.Run("Missing leaf", func(t *testing.T) {
+		require.ErrorIs(t, MerkleProofVerifier{}.VerifyInclusionProof(proof, txsRoot, txs[:2]), errMismatchProofSize)
+	})
+
+	t.Run("Proof hash of the wrong length", func(t *testing.T) {
+		// A trailing byte would be ignored when hashing the node into its parent
+		extended := *proof
+		extended.MerkleHashes = append([]*HexBytes{}, proof.MerkleHashes...)
+		hash := append(HexBytes{}, *proof.MerkleHashes[0]...)
+		hash = append(hash, 0x01)
+		extended.MerkleHashes[0] = &hash
+		require.ErrorIs(t, MerkleProofVerifier{}.VerifyInclusionProof(&extended, txsRoot, txs), errInvalidHashLength)
+	})
+}
+
+func TestConstraintProofVerifierOption(t *testing.T) {
+	slot := uint64(8978583)
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	hash := "0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+
+	txHash, err := (&Constraint{Tx: rawTx}).TxHash()
+	require.NoError(t, err)
+
+	// A bid with a bogus proof of the constrained transaction, which only a custom verifier would accept
+	makeBid := func(relay *mockRelay) *BidWithInclusionProofs {
+		bid := relay.MakeGetHeaderWithProofsResponseWithTxsRoot(12345, hash, hash, relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01})
+		bid.Proofs = &InclusionProof{
+			TransactionHashes:  []phase0.Hash32{txHash},
+			GeneralizedIndexes: []uint64{2097152},
+			MerkleHashes:       []*HexBytes{},
+		}
+		return bid
+	}
+
+	t.Run("Default verifier rejects invalid proof", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		require.NoError(t, backend.boost.constraints.AddInclusionConstraints(slot, []*Constraint{{Transaction(rawTx), nil}}))
+		require.Error(t, backend.boost.verifyInclusionProof(makeBid(backend.relays[0]), slot))
+	})
+
+	t.Run("Custom verifier is used", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second, WithConstraintProofVerifier(alwaysPassVerifier{}))
+		require.NoError(t, backend.boost.constraints.AddInclusionConstraints(slot, []*Constraint{{Transaction(rawTx), nil}}))
+		require.NoError(t, backend.boost.verifyInclusionProof(makeBid(backend.relays[0]), slot))
+	})
+}
+
+func TestVerifyInclusionProofLeaves(t *testing.T) {
+	slot := uint64(8978583)
+	hash := "0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	rootNode, constraints, _ := makeTestTransactionsTree(t, 5, 3)
+	txsRoot := phase0.Root(rootNode.Hash())
+	proof, err := CalculateMerkleMultiProofs(rootNode, constraints)
+	require.NoError(t, err)
+
+	// The random transactions cannot be parsed, so they are added to the cache under the hashes of the proof
+	setup := func(t *testing.T) (*testBackend, map[common.Hash]*Constraint) {
+		t.Helper()
+		backend := newTestBackend(t, 1, time.Second)
+		require.NoError(t, backend.boost.constraints.AddInclusionConstraints(slot, nil))
+		cached, _ := backend.boost.constraints.Get(slot)
+		for _, c := range constraints {
+			cached[common.Hash(c.hash)] = &Constraint{Tx: c.tx}
+		}
+		return backend, cached
+	}
+	makeBid := func(relay *mockRelay, txHashes []phase0.Hash32) *BidWithInclusionProofs {
+		bid := relay.MakeGetHeaderWithProofsResponseWithTxsRoot(12345, hash, hash, relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, txsRoot)
+		bid.Proofs = &InclusionProof{
+			TransactionHashes:  txHashes,
+			GeneralizedIndexes: proof.GeneralizedIndexes,
+			MerkleHashes:       proof.MerkleHashes,
+		}
+		return bid
+	}
+
+	t.Run("Leaves in the order of the proof", func(t *testing.T) {
+		backend, _ := setup(t)
+		// Ranging over the constraints map would only give the right order once in 6 times
+		for i := 0; i < 10; i++ {
+			require.NoError(t, backend.boost.verifyInclusionProof(makeBid(backend.relays[0], proof.TransactionHashes), slot))
+		}
+	})
+
+	t.Run("Duplicate proven transaction", func(t *testing.T) {
+		backend, _ := setup(t)
+		txHashes := []phase0.Hash32{proof.TransactionHashes[0], proof.TransactionHashes[0], proof.TransactionHashes[2]}
+		err := backend.boost.verifyInclusionProof(makeBid(backend.relays[0], txHashes), slot)
+		require.ErrorIs(t, err, errDuplicateProvenTransaction)
+	})
+
+	t.Run("Empty constraint transaction", func(t *testing.T) {
+		backend, cached := setup(t)
+		cached[common.Hash(proof.TransactionHashes[1])].Tx = nil
+		err := backend.boost.verifyInclusionProof(makeBid(backend.relays[0], proof.TransactionHashes), slot)
+		require.ErrorIs(t, err, errEmptyConstraintTx)
+	})
+}
+
+func TestBidWithInclusionProofsBuilder(t *testing.T) {
+	relay := newMockRelay(t)
+	hash := "0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	bid := relay.MakeGetHeaderWithProofsResponseWithTxsRoot(12345, hash, hash, relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01}).Bid
+	proof, _, _ := makeTestInclusionProof(t, 20, 3)
+
+	t.Run("Empty", func(t *testing.T) {
+		b := NewBidWithInclusionProofs()
+		require.Nil(t, b.Bid)
+		require.Nil(t, b.Proofs)
+	})
+
+	t.Run("Chained", func(t *testing.T) {
+		b := NewBidWithInclusionProofs().WithBid(bid).WithProofs(proof)
+		require.Equal(t, &BidWithInclusionProofs{Bid: bid, Proofs: proof}, b)
+	})
+
+	t.Run("Methods return the receiver", func(t *testing.T) {
+		b := NewBidWithInclusionProofs()
+		require.Same(t, b, b.WithBid(bid))
+		require.Same(t, b, b.WithProofs(proof))
+		require.Same(t, bid, b.Bid)
+		require.Same(t, proof, b.Proofs)
+	})
+
+	t.Run("Overwrites previous values", func(t *testing.T) {
+		b := NewBidWithInclusionProofs().WithBid(bid).WithProofs(proof).WithProofs(nil)
+		require.Same(t, bid, b.Bid)
+		require.Nil(t, b.Proofs)
+	})
+}
+
+// TestBidWithInclusionProofsDifferentialEncoding checks that the JSON and SSZ encodings of a bid with proofs
+// decode to the same value. Only Capella bids are checked: the SSZ encoding of Deneb bids panics in
+// go-builder-client v0.4.2, which writes 32 words for the 4 words of the bid value.
+func TestBidWithInclusionProofsDifferentialEncoding(t *testing.T) {
+	relay := newMockRelay(t)
+	hash := "0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	proof, txsRoot, _ := makeTestInclusionProof(t, 20, 3)
+	original := relay.MakeGetHeaderWithProofsResponseWithTxsRoot(12345, hash, hash, relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, txsRoot).WithProofs(proof)
+
+	// JSON round trip
+	jsonEncoded, err := json.Marshal(original)
+	require.NoError(t, err)
+	fromJSON := new(BidWithInclusionProofs)
+	require.NoError(t, json.Unmarshal(jsonEncoded, fromJSON))
+
+	// SSZ round trip of the bid, and binary round trip of the proofs
+	sszEncoded, err := original.Bid.Capella.MarshalSSZ()
+	require.NoError(t, err)
+	proofEncoded, err := original.Proofs.Serialize()
+	require.NoError(t, err)
+
+	fromSSZ := NewBidWithInclusionProofs().WithBid(new(builderSpec.VersionedSignedBuilderBid)).WithProofs(new(InclusionProof))
+	require.NoError(t, decodeSignedBuilderBidSSZ(spec.DataVersionCapella.String(), sszEncoded, fromSSZ.Bid))
+	require.NoError(t, fromSSZ.Proofs.Deserialize(proofEncoded))
+
+	require.True(t, reflect.DeepEqual(fromJSON, fromSSZ), "JSON decoded %s\nSSZ decoded %s", fromJSON, fromSSZ)
+}
+
+// TestBidWithInclusionProofsGetHeaderWithProofsRoundTrip checks the whole pipeline of a getHeaderWithProofs
+// response: proof generation by the relay, JSON encoding, and verification against the decoded header
+func TestBidWithInclusionProofsGetHeaderWithProofsRoundTrip(t *testing.T) {
+	relay := newMockRelay(t)
+	hash := "0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	txs := []Transaction{
+		_HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f"),
+		_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"),
+		_HexToBytes("0x02f87601836384348477359400850517683ba883019a28943678fce4028b6745eb04fa010d9c8e4b36d6288c872b0f1366ad800080c080a0b6b7aba1954160d081b2c8612e039518b9c46cd7df838b405a03f927ad196158a071d2fb6813e5b5184def6bd90fb5f29e0c52671dea433a7decb289560a58416e"),
+		_HexToBytes("0xf86c0785028fa6ae0082520894098d880c4753d0332ca737aa592332ed2522cd22880d2f09f6558750008026a0963e58027576b3a8930d7d9b4a49253b6e1a2060e259b2102e34a451d375ce87a063f802538d3efed17962c96fcea431388483bbe3860ea9bb3ef01d4781450fbf"),
+		_HexToBytes("0xf8708305dc6885029332e35883019a2894500b0107e172e420561565c8177c28ac0f62017f8810ffb80e6cc327008025a0e9c0b380c68f040ae7affefd11979f5ed18ae82c00e46aa3238857c372a358eca06b26e179dd2f7a7f1601755249f4cff56690c4033553658f0d73e26c36fe7815"),
+	}
+	constraints := make([]struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}, len(txs))
+	for i, tx := range txs {
+		constraints[i].tx = tx
+	}
+
+	for _, version := range []spec.DataVersion{spec.DataVersionCapella, spec.DataVersionDeneb} {
+		t.Run(version.String(), func(t *testing.T) {
+			original := relay.MakeGetHeaderWithConstraintsResponse(12345, hash, hash, relay.RelayEntry.PublicKey.String(), version, constraints)
+			require.NotNil(t, original)
+
+			encoded, err := json.Marshal(original)
+			require.NoError(t, err)
+			decoded := new(BidWithInclusionProofs)
+			require.NoError(t, json.Unmarshal(encoded, decoded))
+
+			txsRoot, err := decoded.Bid.TransactionsRoot()
+			require.NoError(t, err)
+			require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(decoded.Proofs, txsRoot, txs))
+
+			// The proof only holds for the root of the header
+			require.Error(t, MerkleProofVerifier{}.VerifyInclusionProof(decoded.Proofs, phase0.Root{0x01}, txs))
+		})
+	}
+}
+
+func TestBidWithInclusionProofsJSONSchema(t *testing.T) {
+	schema, err := jsonschema.Compile("../testdata/bid_with_proofs.schema.json")
+	require.NoError(t, err)
+
+	relay := newMockRelay(t)
+	hash := "0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	merkleHash := HexBytes(_HexToBytes(hash))
+
+	// Helpers to reach into the decoded JSON document
+	message := func(doc map[string]interface{}) map[string]interface{} {
+		data := doc["bid"].(map[string]interface{})["data"].(map[string]interface{})
+		return data["message"].(map[string]interface{})
+	}
+	header := func(doc map[string]interface{}) map[string]interface{} {
+		return message(doc)["header"].(map[string]interface{})
+	}
+
+	testCases := []struct {
+		name    string
+		version spec.DataVersion
+		modify  func(doc map[string]interface{})
+		valid   bool
+	}{
+		{
+			name:    "Valid Capella bid",
+			version: spec.DataVersionCapella,
+			valid:   true,
+		},
+		{
+			name:    "Valid Deneb bid",
+			version: spec.DataVersionDeneb,
+			valid:   true,
+		},
+		{
+			name:    "Missing proofs",
+			version: spec.DataVersionCapella,
+			modify:  func(doc map[string]interface{}) { delete(doc, "proofs") },
+		},
+		{
+			name:    "Null proofs",
+			version: spec.DataVersionCapella,
+			modify:  func(doc map[string]interface{}) { doc["proofs"] = nil },
+		},
+		{
+			name:    "Missing bid",
+			version: spec.DataVersionCapella,
+			modify:  func(doc map[string]interface{}) { delete(doc, "bid") },
+		},
+		{
+			name:    "Short block hash",
+			version: spec.DataVersionCapella,
+			modify:  func(doc map[string]interface{}) { header(doc)["block_hash"] = "0xe28385e7" },
+		},
+		{
+			name:    "Short pubkey",
+			version: spec.DataVersionDeneb,
+			modify:  func(doc map[string]interface{}) { message(doc)["pubkey"] = hash },
+		},
+		{
+			name:    "Value is not a decimal string",
+			version: spec.DataVersionCapella,
+			modify:  func(doc map[string]interface{}) { message(doc)["value"] = 12345 },
+		},
+		{
+			name:    "Negative generalized index",
+			version: spec.DataVersionCapella,
+			modify: func(doc map[string]interface{}) {
+				doc["proofs"].(map[string]interface{})["generalized_indexes"] = []interface{}{-1}
+			},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			bid := relay.MakeGetHeaderWithProofsResponseWithTxsRoot(12345, hash, hash, relay.RelayEntry.PublicKey.String(), tt.version, phase0.Root{0x01})
+			bid.Proofs = &InclusionProof{
+				TransactionHashes:  []phase0.Hash32{_HexToHash("0xba40436abdc8adc037e2c92ea1099a5849053510c3911037ff663085ce44bc49")},
+				GeneralizedIndexes: []uint64{2097152},
+				MerkleHashes:       []*HexBytes{&merkleHash},
+			}
+
+			encoded, err := json.Marshal(bid)
+			require.NoError(t, err)
+
+			var doc map[string]interface{}
+			require.NoError(t, json.Unmarshal(encoded, &doc))
+			if tt.modify != nil {
+				tt.modify(doc)
+			}
+
+			// Round-trip the document so the validator only sees JSON-decoded values
+			encoded, err = json.Marshal(doc)
+			require.NoError(t, err)
+			var value interface{}
+			require.NoError(t, json.Unmarshal(encoded, &value))
+
+			err = schema.Validate(value)
+			if tt.valid {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
+
+// makeTestInclusionProof builds a block of numTxs random transactions and proves the inclusion of the
+// first numConstraints ones. It returns the proof, the transactions root and the proven transactions.
+// makeTestTransactionsTree returns the tree of numTxs random transactions, the first numConstraints of which are constrained
+func makeTestTransactionsTree(t testing.TB, numTxs, numConstraints int) (*fastssz.Node, []struct {
+	tx   Transaction
+	hash phase0.Hash32
+}, []Transaction,
+) {
+	t.Helper()
+	transactions := new(utilbellatrix.ExecutionPayloadTransactions)
+	constraints := make([]struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}, numConstraints)
+	txs := make([]Transaction, numConstraints)
+	for i := 0; i < numTxs; i++ {
+		tx := make(Transaction, 120)
+		_, err := rand.Read(tx)
+		require.NoError(t, err)
+		transactions.Transactions = append(transactions.Transactions, bellatrix.Transaction(tx))
+		if i < numConstraints {
+			constraints[i].tx = tx
+			_, err = rand.Read(constraints[i].hash[:])
+			require.NoError(t, err)
+			txs[i] = tx
+		}
+	}
+
+	rootNode, err := transactions.GetTree()
+	require.NoError(t, err)
+	return rootNode, constraints, txs
+}
+
+func makeTestInclusionProof(t testing.TB, numTxs, numConstraints int) (*InclusionProof, phase0.Root, []Transaction) {
+	t.Helper()
+	rootNode, constraints, txs := makeTestTransactionsTree(t, numTxs, numConstraints)
+	txsRoot := phase0.Root(rootNode.Hash())
+
+	proof, err := CalculateMerkleMultiProofs(rootNode, constraints)
+	require.NoError(t, err)
+	return proof, txsRoot, txs
+}
+
+func TestCalculateMerkleMultiProofsMaxTransactions(t *testing.T) {
+	maxTransactions := MaxMultiProofTransactions
+	MaxMultiProofTransactions = 10
+	t.Cleanup(func() { MaxMultiProofTransactions = maxTransactions })
+
+	t.Run("At the limit", func(t *testing.T) {
+		rootNode, constraints, _ := makeTestTransactionsTree(t, 10, 2)
+		_, err := CalculateMerkleMultiProofs(rootNode, constraints)
+		require.NoError(t, err)
+	})
+
+	t.Run("Above the limit", func(t *testing.T) {
+		rootNode, constraints, _ := makeTestTransactionsTree(t, 11, 2)
+		_, err := CalculateMerkleMultiProofs(rootNode, constraints)
+		require.ErrorIs(t, err, errTooManyTransactions)
+	})
+}
+
+func TestCalculateMerkleMultiProofsPositions(t *testing.T) {
+	rootNode, all, _ := makeTestTransactionsTree(t, 10, 10)
+	txsRoot := phase0.Root(rootNode.Hash())
+
+	// The constraints are proven at the position of their transaction in the block, in block order
+	constraints := append(all[7:8:8], all[3])
+	proof, err := CalculateMerkleMultiProofs(rootNode, constraints)
+	require.NoError(t, err)
+	require.Equal(t, []uint64{firstTransactionGeneralizedIndex + 3, firstTransactionGeneralizedIndex + 7}, proof.GeneralizedIndexes)
+	require.Equal(t, []phase0.Hash32{all[3].hash, all[7].hash}, proof.TransactionHashes)
+
+	proof, err = CalculateMerkleMultiProofs(rootNode, all[7:8])
+	require.NoError(t, err)
+	require.Equal(t, []uint64{firstTransactionGeneralizedIndex + 7}, proof.GeneralizedIndexes)
+	require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(proof, txsRoot, []Transaction{all[7].tx}))
+
+	t.Run("Transaction not in the block", func(t *testing.T) {
+		missing := append(all[:1:1], struct {
+			tx   Transaction
+			hash phase0.Hash32
+		}{Transaction{0x01}, phase0.Hash32{0x01}})
+		_, err := CalculateMerkleMultiProofs(rootNode, missing)
+		require.ErrorIs(t, err, errMissingConstraint)
+	})
+}
+
+func TestInclusionProofSerialize(t *testing.T) {
+	proof, txsRoot, txs := makeTestInclusionProof(t, 20, 3)
+
+	encoded, err := proof.Serialize()
+	require.NoError(t, err)
+
+	t.Run("Round trip", func(t *testing.T) {
+		decoded := new(InclusionProof)
+		require.NoError(t, decoded.Deserialize(encoded))
+		require.Equal(t, proof, decoded)
+		require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(decoded, txsRoot, txs))
+	})
+
+	t.Run("Empty proof", func(t *testing.T) {
+		empty := &InclusionProof{}
+		encoded, err := empty.Serialize()
+		require.NoError(t, err)
+		require.Len(t, encoded, 4)
+
+		decoded := new(InclusionProof)
+		require.NoError(t, decoded.Deserialize(encoded))
+		require.Empty(t, decoded.TransactionHashes)
+		require.Empty(t, decoded.MerkleHashes)
+	})
+
+	t.Run("Serialize errors", func(t *testing.T) {
+		missingHash := *proof
+		missingHash.MerkleHashes = proof.MerkleHashes[1:]
+		_, err := missingHash.Serialize()
+		require.ErrorIs(t, err, errInvalidProofEncoding)
+
+		missingIndex := *proof
+		missingIndex.GeneralizedIndexes = proof.GeneralizedIndexes[1:]
+		_, err = missingIndex.Serialize()
+		require.ErrorIs(t, err, errInvalidProofEncoding)
+	})
+
+	tooManyLeaves := append([]byte{}, encoded...)
+	binary.LittleEndian.PutUint32(tooManyLeaves, 1000)
+
+	testCases := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "Empty input",
+			data: []byte{},
+		},
+		{
+			name: "Truncated",
+			data: encoded[:len(encoded)-1],
+		},
+		{
+			name: "Trailing bytes",
+			data: append(append([]byte{}, encoded...), 0x00),
+		},
+		{
+			name: "Leaf count too large",
+			data: tooManyLeaves,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := new(InclusionProof).Deserialize(tt.data)
+			require.ErrorIs(t, err, errInvalidProofEncoding)
+		})
+	}
+}
+
+func BenchmarkInclusionProofEncoding(b *testing.B) {
+	proof, _, _ := makeTestInclusionProof(b, 300, 100)
+
+	jsonEncoded, err := json.Marshal(proof)
+	require.NoError(b, err)
+	binaryEncoded, err := proof.Serialize()
+	require.NoError(b, err)
+
+	b.Run("JSON", func(b *testing.B) {
+		b.ReportMetric(float64(len(jsonEncoded)), "bytes/proof")
+		for i := 0; i < b.N; i++ {
+			if _, err := json.Marshal(proof); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("Binary", func(b *testing.B) {
+		b.ReportMetric(float64(len(binaryEncoded)), "bytes/proof")
+		for i := 0; i < b.N; i++ {
+			if _, err := proof.Serialize(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkCalculateMerkleMultiProofs(b *testing.B) {
+	for _, numTxs := range []int{100, 1000, 10_000} {
+		rootNode, constraints, _ := makeTestTransactionsTree(b, numTxs, 10)
+
+		b.Run(fmt.Sprintf("%d transactions", numTxs), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := CalculateMerkleMultiProofs(rootNode, constraints); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// makeLargeBlockTree returns the transactions tree of a block of numTxs random transactions, and numConstraints
+// of them chosen at random as constraints, with their position in the block
+func makeLargeBlockTree(t testing.TB, numTxs, numConstraints int) (*fastssz.Node, []struct {
+	tx   Transaction
+	hash phase0.Hash32
+}, map[phase0.Hash32]int,
+) {
+	t.Helper()
+	transactions := new(utilbellatrix.ExecutionPayloadTransactions)
+	for i := 0; i < numTxs; i++ {
+		tx := make(Transaction, 120)
+		_, err := rand.Read(tx)
+		require.NoError(t, err)
+		transactions.Transactions = append(transactions.Transactions, bellatrix.Transaction(tx))
+	}
+
+	constraints := make([]struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}, numConstraints)
+	positions := make(map[phase0.Hash32]int, numConstraints)
+	for i, position := range mathrand.Perm(numTxs)[:numConstraints] {
+		constraints[i].tx = Transaction(transactions.Transactions[position])
+		_, err := rand.Read(constraints[i].hash[:])
+		require.NoError(t, err)
+		positions[constraints[i].hash] = position
+	}
+
+	rootNode, err := transactions.GetTree()
+	require.NoError(t, err)
+	rootNode.Hash()
+	return rootNode, constraints, positions
+}
+
+func TestCalculateMerkleMultiProofsLargeBlock(t *testing.T) {
+	rootNode, constraints, positions := makeLargeBlockTree(t, 1000, 100)
+	txsRoot := phase0.Root(rootNode.Hash())
+
+	proof, err := CalculateMerkleMultiProofs(rootNode, constraints)
+	require.NoError(t, err)
+	require.Len(t, proof.TransactionHashes, len(constraints))
+	require.Len(t, proof.GeneralizedIndexes, len(constraints))
+	require.NoError(t, ValidateProofIndices(proof))
+
+	// Each proven leaf is the transaction with the hash at the same position in the proof
+	txsByHash := make(map[phase0.Hash32]Transaction, len(constraints))
+	for _, constraint := range constraints {
+		txsByHash[constraint.hash] = constraint.tx
+	}
+	leaves := make([]Transaction, len(proof.TransactionHashes))
+	for i, txHash := range proof.TransactionHashes {
+		tx, ok := txsByHash[txHash]
+		require.True(t, ok)
+		leaves[i] = tx
+
+		require.Equal(t, uint64(firstTransactionGeneralizedIndex+positions[txHash]), proof.GeneralizedIndexes[i])
+		leaf, err := rootNode.Get(int(proof.GeneralizedIndexes[i]))
+		require.NoError(t, err)
+		txRoot, err := tx.HashTreeRoot()
+		require.NoError(t, err)
+		require.Equal(t, txRoot[:], leaf.Hash())
+	}
+
+	require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(proof, txsRoot, leaves))
+}
+
+func BenchmarkCalculateMerkleMultiProofsLargeBlock(b *testing.B) {
+	rootNode, constraints, _ := makeLargeBlockTree(b, 1000, 100)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := CalculateMerkleMultiProofs(rootNode, constraints); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestCalculateMerkleMultiProofsParallel(t *testing.T) {
+	rootNode, constraints, _ := makeLargeBlockTree(t, 1000, 100)
+
+	serial, err := CalculateMerkleMultiProofs(rootNode, constraints)
+	require.NoError(t, err)
+
+	for _, numWorkers := range []int{1, 2, 4, 7, 200} {
+		t.Run(fmt.Sprintf("%d workers", numWorkers), func(t *testing.T) {
+			proof, err := CalculateMerkleMultiProofsParallel(rootNode, constraints, numWorkers)
+			require.NoError(t, err)
+			require.Equal(t, serial, proof)
+		})
+	}
+
+	t.Run("Transaction not in the block", func(t *testing.T) {
+		missing := append(constraints[:1:1], struct {
+			tx   Transaction
+			hash phase0.Hash32
+		}{Transaction{0x01}, phase0.Hash32{0x01}})
+		_, err := CalculateMerkleMultiProofsParallel(rootNode, missing, 4)
+		require.ErrorIs(t, err, errMissingConstraint)
+	})
+}
+
+func BenchmarkCalculateMerkleMultiProofsParallel(b *testing.B) {
+	rootNode, constraints, _ := makeLargeBlockTree(b, 5000, 500)
+
+	b.Run("Serial", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := CalculateMerkleMultiProofs(rootNode, constraints); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("4 workers", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := CalculateMerkleMultiProofsParallel(rootNode, constraints, 4); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
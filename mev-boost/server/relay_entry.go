@@ -27,6 +27,23 @@ func (r *RelayEntry) GetURI(path string) string {
 	return GetURI(r.URL, path)
 }
 
+// Clone returns a copy of the relay entry with its own URL, which can be modified without affecting the original
+func (r *RelayEntry) Clone() RelayEntry {
+	clone := RelayEntry{PublicKey: r.PublicKey}
+	if r.URL == nil {
+		return clone
+	}
+
+	u, err := url.Parse(r.URL.String())
+	if err != nil {
+		// The URL was parsed before, but fall back to a shallow copy of it if it can't be parsed back
+		copied := *r.URL
+		u = &copied
+	}
+	clone.URL = u
+	return clone
+}
+
 // NewRelayEntry creates a new instance based on an input string
 // relayURL can be IP@PORT, PUBKEY@IP:PORT, https://IP, etc.
 func NewRelayEntry(relayURL string) (entry RelayEntry, err error) {
@@ -98,3 +98,19 @@ func TestParseRelaysURLs(t *testing.T) {
 		})
 	}
 }
+
+func TestRelayEntryClone(t *testing.T) {
+	publicKey := phase0.BLSPubKey{0x01}
+	relay, err := NewRelayEntry(fmt.Sprintf("http://%s@foo.com/api", publicKey.String()))
+	require.NoError(t, err)
+
+	clone := relay.Clone()
+	require.Equal(t, relay.String(), clone.String())
+	require.Equal(t, relay.PublicKey, clone.PublicKey)
+	require.NotSame(t, relay.URL, clone.URL)
+
+	// Modifying the clone leaves the original untouched
+	clone.URL.Path = "/other"
+	require.Equal(t, "/api", relay.URL.Path)
+	require.Equal(t, fmt.Sprintf("http://%s@foo.com/api", publicKey.String()), relay.String())
+}
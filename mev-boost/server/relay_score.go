@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// initialRelayScore is the score of a relay which did not fail yet, and of a relay whose ban is over
+	initialRelayScore = 100
+
+	relayScorePenaltyInvalidSignature = 50
+	relayScorePenaltyHTTPError        = 10
+	relayScorePenaltyTimeout          = 5
+)
+
+// relayScorer keeps a score for each relay, lowered by every failure of the relay. A relay whose score drops
+// below zero is banned for banDuration, after which it starts over with initialRelayScore.
+type relayScorer struct {
+	mu          sync.Mutex
+	scores      map[string]int
+	bannedUntil map[string]time.Time
+
+	banDuration time.Duration
+
+	now func() time.Time
+}
+
+func newRelayScorer(banDuration time.Duration) *relayScorer {
+	return &relayScorer{
+		scores:      make(map[string]int),
+		bannedUntil: make(map[string]time.Time),
+		banDuration: banDuration,
+		now:         time.Now,
+	}
+}
+
+// score returns the score of the relay. s.mu must be held.
+func (s *relayScorer) score(relay RelayEntry) int {
+	score, ok := s.scores[relay.String()]
+	if !ok {
+		return initialRelayScore
+	}
+	return score
+}
+
+// banned returns whether the relay is banned, and lifts the ban if it is over
+func (s *relayScorer) banned(relay RelayEntry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := relay.String()
+	until, ok := s.bannedUntil[key]
+	if !ok {
+		return false
+	}
+	if s.now().Before(until) {
+		return true
+	}
+	delete(s.bannedUntil, key)
+	delete(s.scores, key)
+	return false
+}
+
+// penalize lowers the score of the relay, and bans it if the score drops below zero. It returns whether
+// the relay was banned by this penalty.
+func (s *relayScorer) penalize(relay RelayEntry, penalty int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := relay.String()
+	if _, ok := s.bannedUntil[key]; ok {
+		return false
+	}
+	score := s.score(relay) - penalty
+	s.scores[key] = score
+	if score >= 0 {
+		return false
+	}
+	s.bannedUntil[key] = s.now().Add(s.banDuration)
+	return true
+}
+
+// relayScore returns the current score of the relay
+func (s *relayScorer) relayScore(relay RelayEntry) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.score(relay)
+}
+
+// requestFailurePenalty returns the penalty for a failed request to a relay. Timeouts are penalized less
+// than other errors, since they are more often caused by the network than by the relay.
+func requestFailurePenalty(err error) int {
+	if errors.Is(err, context.DeadlineExceeded) || os.IsTimeout(err) {
+		return relayScorePenaltyTimeout
+	}
+	return relayScorePenaltyHTTPError
+}
+
+// penalizeRelay lowers the score of the relay by penalty, if BanDuration is set
+func (m *BoostService) penalizeRelay(relay RelayEntry, penalty int) {
+	if m.relayScorer == nil {
+		return
+	}
+	if m.relayScorer.penalize(relay, penalty) {
+		m.log.WithFields(logrus.Fields{
+			"url":         relay.String(),
+			"banDuration": m.relayScorer.banDuration,
+		}).Warn("banning relay after repeated failures")
+	}
+}
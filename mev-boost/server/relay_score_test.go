@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelayScorer(t *testing.T) {
+	relay, err := NewRelayEntry("http://0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249@localhost:12345")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name           string
+		penalties      []int
+		expectedScore  int
+		expectedBanned bool
+	}{
+		{
+			name:          "No failure",
+			expectedScore: initialRelayScore,
+		},
+		{
+			name:          "Score of zero is not banned",
+			penalties:     []int{relayScorePenaltyInvalidSignature, relayScorePenaltyInvalidSignature},
+			expectedScore: 0,
+		},
+		{
+			name:           "Score below zero is banned",
+			penalties:      []int{relayScorePenaltyInvalidSignature, relayScorePenaltyInvalidSignature, relayScorePenaltyTimeout},
+			expectedScore:  -5,
+			expectedBanned: true,
+		},
+		{
+			name:          "Penalties add up",
+			penalties:     []int{relayScorePenaltyHTTPError, relayScorePenaltyTimeout, relayScorePenaltyHTTPError},
+			expectedScore: 75,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			scorer := newRelayScorer(time.Minute)
+			for _, penalty := range tt.penalties {
+				scorer.penalize(relay, penalty)
+			}
+			require.Equal(t, tt.expectedScore, scorer.relayScore(relay))
+			require.Equal(t, tt.expectedBanned, scorer.banned(relay))
+		})
+	}
+
+	t.Run("Ban is lifted after the ban duration", func(t *testing.T) {
+		now := time.Unix(1700000000, 0)
+		scorer := newRelayScorer(time.Minute)
+		scorer.now = func() time.Time { return now }
+
+		require.False(t, scorer.penalize(relay, relayScorePenaltyInvalidSignature))
+		require.False(t, scorer.penalize(relay, relayScorePenaltyInvalidSignature))
+		require.True(t, scorer.penalize(relay, relayScorePenaltyInvalidSignature))
+		require.True(t, scorer.banned(relay))
+
+		// Failures while banned don't extend the ban
+		now = now.Add(59 * time.Second)
+		require.False(t, scorer.penalize(relay, relayScorePenaltyInvalidSignature))
+		require.True(t, scorer.banned(relay))
+
+		// The relay starts over with the initial score
+		now = now.Add(time.Second)
+		require.False(t, scorer.banned(relay))
+		require.Equal(t, initialRelayScore, scorer.relayScore(relay))
+	})
+}
+
+func TestRequestFailurePenalty(t *testing.T) {
+	require.Equal(t, relayScorePenaltyTimeout, requestFailurePenalty(context.DeadlineExceeded))
+	require.Equal(t, relayScorePenaltyTimeout, requestFailurePenalty(&url.Error{Op: "Get", URL: "http://localhost", Err: context.DeadlineExceeded}))
+	require.Equal(t, relayScorePenaltyHTTPError, requestFailurePenalty(errHTTPErrorResponse))
+	require.Equal(t, relayScorePenaltyHTTPError, requestFailurePenalty(errors.New("connection refused")))
+}
+
+func TestRelayBanning(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	slot := phase0.Slot(1)
+	path := getHeaderWithProofsPath(uint64(slot), parentHash, pubkey)
+
+	setup := func(t *testing.T) (*testBackend, *fakeClock) {
+		t.Helper()
+		backend := newTestBackend(t, 1, time.Second)
+		backend.boost.relayScorer = newRelayScorer(time.Minute)
+		clock := &fakeClock{now: time.Unix(1700000000, 0)}
+		backend.boost.SetClockSource(clock.Now)
+		return backend, clock
+	}
+
+	t.Run("Relay is banned after invalid signatures", func(t *testing.T) {
+		backend, clock := setup(t)
+		relay := backend.relays[0]
+		validResponse := relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			12345, "0x534809bd2b6832edff8d8ce4cb0e50068804fd1ef432c8362ad708a74fdc0e46", parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+		invalidResponse := relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			12345, "0x534809bd2b6832edff8d8ce4cb0e50068804fd1ef432c8362ad708a74fdc0e46", parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+		invalidResponse.Bid.Capella.Signature = phase0.BLSSignature{}
+		relay.GetHeaderWithProofsResponse = invalidResponse
+
+		// Each invalid signature costs 50 points, the third one bans the relay
+		for i := 1; i <= 3; i++ {
+			_, err := backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+			require.ErrorIs(t, err, errNoBidReceived)
+			require.Equal(t, initialRelayScore-i*relayScorePenaltyInvalidSignature, backend.boost.RelayScore(relay.RelayEntry))
+		}
+		require.True(t, backend.boost.IsRelayBanned(relay.RelayEntry))
+
+		// The banned relay is skipped, even once it sends valid bids again
+		relay.mu.Lock()
+		relay.GetHeaderWithProofsResponse = validResponse
+		relay.mu.Unlock()
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Equal(t, 3, relay.GetRequestCount(path))
+
+		// Once the ban is over, the relay is requested again with a fresh score
+		clock.Advance(time.Minute)
+		require.False(t, backend.boost.IsRelayBanned(relay.RelayEntry))
+		bid, err := backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+		require.NoError(t, err)
+		require.NotNil(t, bid)
+		require.Equal(t, 4, relay.GetRequestCount(path))
+		require.Equal(t, initialRelayScore, backend.boost.RelayScore(relay.RelayEntry))
+	})
+
+	t.Run("HTTP errors lower the score", func(t *testing.T) {
+		backend, _ := setup(t)
+		relay := backend.relays[0]
+		relay.RequiredHeader = "X-API-Key"
+
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Equal(t, initialRelayScore-relayScorePenaltyHTTPError, backend.boost.RelayScore(relay.RelayEntry))
+		require.False(t, backend.boost.IsRelayBanned(relay.RelayEntry))
+	})
+
+	t.Run("Scoring is disabled without ban duration", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		relay := backend.relays[0]
+		relay.RequiredHeader = "X-API-Key"
+
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Equal(t, initialRelayScore, backend.boost.RelayScore(relay.RelayEntry))
+		require.False(t, backend.boost.IsRelayBanned(relay.RelayEntry))
+	})
+}
@@ -0,0 +1,36 @@
+package server
+
+// RelaySelector chooses the bid returned to the beacon node among the valid bids received from the relays,
+// see WithRelaySelector
+type RelaySelector interface {
+	// SelectBestBid returns one of the bids, or nil to return no bid. bids is never empty.
+	SelectBestBid(bids []RelayBid) *RelayBid
+}
+
+// MaxValueSelector selects the bid with the highest value, and the one with the lowest block hash among
+// bids of equal value. This is the selection of the BoostService when no RelaySelector is set, without
+// the tiebreakers enabled by its options.
+type MaxValueSelector struct{}
+
+func (MaxValueSelector) SelectBestBid(bids []RelayBid) *RelayBid {
+	var best *RelayBid
+	var bestInfo bidInfo
+	for i := range bids {
+		if bids[i].Bid == nil || bids[i].Bid.Bid == nil {
+			continue
+		}
+		info, err := parseBidInfo(bids[i].Bid.Bid)
+		if err != nil {
+			continue
+		}
+		if best != nil {
+			valueDiff := info.value.Cmp(bestInfo.value)
+			if valueDiff < 0 || (valueDiff == 0 && info.blockHash.String() >= bestInfo.blockHash.String()) {
+				continue
+			}
+		}
+		best = &bids[i]
+		bestInfo = info
+	}
+	return best
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/attestantio/go-eth2-client/spec"
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxValueSelector(t *testing.T) {
+	relay := newMockRelay(t)
+	parentHash := "0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	makeBid := func(value uint64, blockHash string) RelayBid {
+		return RelayBid{
+			Relay: relay.RelayEntry,
+			Bid: relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				value, blockHash, parentHash, relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			),
+		}
+	}
+
+	testCases := []struct {
+		name          string
+		bids          []RelayBid
+		expectedIndex int
+	}{
+		{
+			name: "Highest value",
+			bids: []RelayBid{
+				makeBid(20000, "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"),
+				makeBid(30000, "0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"),
+				makeBid(10000, "0xc28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"),
+			},
+			expectedIndex: 1,
+		},
+		{
+			name: "Lowest block hash among equal values",
+			bids: []RelayBid{
+				makeBid(20000, "0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"),
+				makeBid(20000, "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"),
+			},
+			expectedIndex: 1,
+		},
+		{
+			name: "Empty bids skipped",
+			bids: []RelayBid{
+				{Relay: relay.RelayEntry},
+				makeBid(20000, "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"),
+			},
+			expectedIndex: 1,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			selected := MaxValueSelector{}.SelectBestBid(tt.bids)
+			require.Same(t, &tt.bids[tt.expectedIndex], selected)
+		})
+	}
+
+	t.Run("No valid bid", func(t *testing.T) {
+		require.Nil(t, MaxValueSelector{}.SelectBestBid([]RelayBid{{Relay: relay.RelayEntry}}))
+	})
+}
@@ -7,8 +7,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -21,8 +23,10 @@ import (
 	eth2ApiV1Bellatrix "github.com/attestantio/go-eth2-client/api/v1/bellatrix"
 	eth2ApiV1Capella "github.com/attestantio/go-eth2-client/api/v1/capella"
 	eth2ApiV1Deneb "github.com/attestantio/go-eth2-client/api/v1/deneb"
+	"github.com/attestantio/go-eth2-client/spec/bellatrix"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
-	fastSsz "github.com/ferranbt/fastssz"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/flashbots/go-boost-utils/bls"
 	"github.com/flashbots/go-boost-utils/ssz"
 	"github.com/flashbots/go-boost-utils/types"
 	"github.com/flashbots/go-boost-utils/utils"
@@ -30,6 +34,7 @@ import (
 	"github.com/flashbots/mev-boost/config"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"github.com/holiman/uint256"
 	"github.com/sirupsen/logrus"
 )
 
@@ -41,17 +46,51 @@ var (
 	errInvalidPubkey             = errors.New("invalid pubkey")
 	errNoSuccessfulRelayResponse = errors.New("no successful relay response")
 	errServerAlreadyRunning      = errors.New("server already running")
+	errDuplicateRelay            = errors.New("duplicate relay")
+	errNoBidReceived             = errors.New("no bid received")
+	errServerShuttingDown        = errors.New("server is shutting down")
+	errUnknownPriorityRelay      = errors.New("priority set for relays which are not configured")
+	errNoAddress                 = errors.New("no address found for host")
+	errEmptyLocalBlock           = errors.New("empty local block")
+	errInvalidBid                = errors.New("invalid bid")
+	errBidBelowMinimum           = errors.New("bid below minimum value")
 )
 
 // Bolt errors
 var (
-	errNilProof          = errors.New("nil proof")
-	errMissingConstraint = errors.New("missing constraint")
-	errMismatchProofSize = errors.New("proof size mismatch")
-	errInvalidProofs     = errors.New("proof verification failed")
-	errInvalidRoot       = errors.New("failed getting tx root from bid")
+	errNilProof                   = errors.New("nil proof")
+	errMissingConstraint          = errors.New("missing constraint")
+	errMismatchProofSize          = errors.New("proof size mismatch")
+	errInvalidProofs              = errors.New("proof verification failed")
+	errMissingProofNode           = errors.New("proof is missing required nodes")
+	errInvalidHashLength          = errors.New("proof hash is not 32 bytes long")
+	errInvalidProofEncoding       = errors.New("invalid inclusion proof encoding")
+	errInvalidRoot                = errors.New("failed getting tx root from bid")
+	errConstraintSlotOutOfRange   = errors.New("constraint slot out of range")
+	errUnknownGenesisTime         = errors.New("genesis time unknown, cannot validate the constraint slot")
+	errNoCommonAPIVersion         = errors.New("no constraint API version supported by all relays")
+	errNoConstraintSigningKey     = errors.New("no constraint signing key configured")
+	errProofIndexOutOfRange       = errors.New("proof index out of range")
+	errDuplicateProofIndex        = errors.New("duplicate proof index")
+	errAttestationMismatch        = errors.New("payload attestation does not match the requested payload")
+	errInvalidAttestation         = errors.New("invalid payload attestation signature")
+	errInvalidConstraintSignature = errors.New("invalid constraint signature")
+	errConstraintKeysMismatch     = errors.New("number of public keys does not match the number of constraints messages")
+	errDuplicateProvenTransaction = errors.New("transaction proven more than once")
+	errEmptyConstraintTx          = errors.New("empty constraint transaction")
 )
 
+// NoBidAboveMinimumError is returned by GetBestBidForSlot when relays delivered bids, but none of them
+// reached the minimum bid value set with WithMinBidValue, and no other relay failed
+type NoBidAboveMinimumError struct {
+	MinBidValue *uint256.Int
+	NumBids     int // number of bids below the minimum
+}
+
+func (e *NoBidAboveMinimumError) Error() string {
+	return fmt.Sprintf("no bid above minimum value %s (%d bids below)", e.MinBidValue.Dec(), e.NumBids)
+}
+
 var (
 	nilHash     = phase0.Hash32{}
 	nilResponse = struct{}{}
@@ -89,12 +128,24 @@ type BoostServiceOpts struct {
 	RequestTimeoutRegVal           time.Duration
 	RequestTimeoutSubmitConstraint time.Duration
 	RequestMaxRetries              int
+
+	// Request SSZ-encoded getHeader responses from the relays instead of JSON
+	SSZPreferred bool
+
+	// Relays whose score drops below zero because of repeated failures are skipped for this duration,
+	// disabled if zero
+	BanDuration time.Duration
+
+	// BOLT: number of delivered payloads whose constraint evidence is kept, see GetConstraintEvidenceForPayload.
+	// Defaults to 64 if zero.
+	MaxConstraintEvidenceEntries int
 }
 
 // BoostService - the mev-boost service
 type BoostService struct {
 	listenAddr    string
-	relays        []RelayEntry
+	relays        []RelayEntry // replaced by ForceRelayRefresh, read with getRelays
+	relaysLock    sync.RWMutex
 	relayMonitors []*url.URL
 	log           *logrus.Entry
 	srv           *http.Server
@@ -108,19 +159,82 @@ type BoostService struct {
 	httpClientRegVal           http.Client
 	httpClientSubmitConstraint http.Client
 	requestMaxRetries          int
+	sszPreferred               bool
 
 	bids     map[bidRespKey]bidResp // keeping track of bids, to log the originating relay on withholding
 	bidsLock sync.Mutex
 
+	bidStats     map[RelayEntry]*bidStatsAccumulator // values of the bids received from each relay since startup
+	bidStatsLock sync.Mutex
+
+	requestStats     map[RelayEntry]*relayRequestStats // getHeader requests sent to each relay since startup
+	requestStatsLock sync.Mutex
+
+	auditLog     []AuditEntry // events since the last EmitAuditLog
+	auditLogLock sync.Mutex
+
 	slotUID     *slotUID
 	slotUIDLock sync.Mutex
 
+	// in-flight requests, drained on shutdown
+	inFlight     sync.WaitGroup
+	inFlightLock sync.Mutex
+	shuttingDown bool
+
 	// BOLT: constraint cache
 	constraints *ConstraintCache
+	// BOLT: store of the submitted constraints, restored into the cache after a restart
+	stateStore ConstraintStateStore
+	// BOLT: constraint submissions which failed transiently, retried in the background
+	constraintRetries *constraintRetryQueue
+	// BOLT: proofs and transactions of the latest delivered payloads, see GetConstraintEvidenceForPayload
+	constraintEvidence *constraintEvidenceStore
+
+	// BOLT: verifier for the inclusion proofs sent by the relays
+	proofVerifier ConstraintProofVerifier
+
+	// BOLT: constraints are only accepted for slots within [currentSlot, currentSlot+maxFutureSlots],
+	// see WithMaxFutureSlots
+	maxFutureSlots uint64
+
+	// BOLT: versions of the constraint and proof API offered in NegotiateConstraintAPIVersion
+	constraintAPIVersions []APIVersion
+
+	// BOLT: called after getPayload with the constrained transactions missing from the payload, see OnPayloadReceived
+	onPayloadReceived     func(slot phase0.Slot, missingTxs []Transaction)
+	onPayloadReceivedLock sync.Mutex
+
+	// Optional settings, see BoostServiceOption
+	minBidValue        *uint256.Int
+	maxBidValue        *uint256.Int
+	relayLatency       *relayLatencyTracker // nil unless latency preference is enabled
+	circuitBreaker     *circuitBreaker      // nil unless the circuit breaker is enabled
+	relayScorer        *relayScorer         // nil unless BanDuration is set
+	relayShuffle       bool
+	constraintWeighted bool
+	relayTimeouts      map[string]time.Duration // by RelayEntry.String(), overriding the request timeouts of the options
+	primaryRelays      map[string]bool          // by RelayEntry.String(), nil unless set with WithPrimaryRelays
+	fallbackRelays     map[string]bool          // by RelayEntry.String(), nil unless set with WithFallbackRelays
+	extraHeaders       http.Header              // added to every request to the relays, see WithExtraRequestHeaders
+	relaySelector      RelaySelector            // nil unless set with WithRelaySelector
+	localBlockBuilder  LocalBlockBuilder        // nil unless set with WithLocalBlockBuilder
+	minValueDelta      *uint256.Int             // nil unless set with WithMinValueDelta
+	dnsCache           *dnsCache                // nil unless set with WithDNSCacheTTL
+
+	// Hooks called around every request to a relay, nil unless set with WithRequestInterceptor
+	// and WithResponseInterceptor
+	requestInterceptor  func(ctx context.Context, relay RelayEntry, method string) context.Context
+	responseInterceptor func(ctx context.Context, relay RelayEntry, method string, statusCode int, elapsed time.Duration)
+
+	// BOLT: key signing the constraint cancellations, nil unless set with WithConstraintSigningKey
+	constraintSigningKey *bls.SecretKey
+
+	// Clock source, time.Now unless set with SetClockSource
+	now func() time.Time
 }
 
 // NewBoostService created a new BoostService
-func NewBoostService(opts BoostServiceOpts) (*BoostService, error) {
+func NewBoostService(opts BoostServiceOpts, options ...BoostServiceOption) (*BoostService, error) {
 	if len(opts.Relays) == 0 {
 		return nil, errNoRelays
 	}
@@ -130,7 +244,7 @@ func NewBoostService(opts BoostServiceOpts) (*BoostService, error) {
 		return nil, err
 	}
 
-	return &BoostService{
+	m := &BoostService{
 		listenAddr:    opts.ListenAddr,
 		relays:        opts.Relays,
 		relayMonitors: opts.RelayMonitors,
@@ -139,6 +253,8 @@ func NewBoostService(opts BoostServiceOpts) (*BoostService, error) {
 		relayMinBid:   opts.RelayMinBid,
 		genesisTime:   opts.GenesisTime,
 		bids:          make(map[bidRespKey]bidResp),
+		bidStats:      make(map[RelayEntry]*bidStatsAccumulator),
+		requestStats:  make(map[RelayEntry]*relayRequestStats),
 		slotUID:       &slotUID{},
 
 		builderSigningDomain: builderSigningDomain,
@@ -159,10 +275,149 @@ func NewBoostService(opts BoostServiceOpts) (*BoostService, error) {
 			CheckRedirect: httpClientDisallowRedirects,
 		},
 		requestMaxRetries: opts.RequestMaxRetries,
+		sszPreferred:      opts.SSZPreferred,
 
 		// BOLT: Initialize the constraint cache
-		constraints: NewConstraintCache(64),
-	}, nil
+		constraints:       NewConstraintCache(64),
+		stateStore:        NewInMemoryConstraintStateStore(64),
+		constraintRetries: newConstraintRetryQueue(),
+
+		constraintEvidence: newConstraintEvidenceStore(opts.MaxConstraintEvidenceEntries),
+
+		proofVerifier:         MerkleProofVerifier{},
+		maxFutureSlots:        1,
+		constraintAPIVersions: supportedConstraintAPIVersions,
+
+		now: time.Now,
+	}
+
+	if opts.BanDuration > 0 {
+		m.relayScorer = newRelayScorer(opts.BanDuration)
+	}
+
+	for _, option := range options {
+		option(m)
+	}
+
+	if err := m.ValidateRelayList(); err != nil {
+		return nil, err
+	}
+	if err := m.validateRelayPriorities(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// ValidateRelayList checks the configured relays for duplicate public keys and duplicate URLs.
+// The same relay configured twice (for example under different URL aliases) would have its bids counted twice.
+func (m *BoostService) ValidateRelayList() error {
+	return validateRelayList(m.getRelays())
+}
+
+func validateRelayList(relays []RelayEntry) error {
+	seenPubkeys := make(map[phase0.BLSPubKey]bool)
+	seenURLs := make(map[string]bool)
+	duplicatePubkeys := []string{}
+	duplicateURLs := []string{}
+
+	for _, relay := range relays {
+		if seenPubkeys[relay.PublicKey] {
+			duplicatePubkeys = append(duplicatePubkeys, relay.PublicKey.String())
+		}
+		seenPubkeys[relay.PublicKey] = true
+
+		// Compare the URLs without the public key, so that the same host is caught regardless of the key used
+		url := GetURI(relay.URL, relay.URL.Path)
+		if seenURLs[url] {
+			duplicateURLs = append(duplicateURLs, url)
+		}
+		seenURLs[url] = true
+	}
+
+	if len(duplicatePubkeys) == 0 && len(duplicateURLs) == 0 {
+		return nil
+	}
+
+	return fmt.Errorf("%w: public keys [%s], urls [%s]", errDuplicateRelay, strings.Join(duplicatePubkeys, ", "), strings.Join(duplicateURLs, ", "))
+}
+
+// validateRelayPriorities checks that the relays set with WithPrimaryRelays and WithFallbackRelays are configured
+func (m *BoostService) validateRelayPriorities() error {
+	relays := m.getRelays()
+	configured := make(map[string]bool, len(relays))
+	for _, relay := range relays {
+		configured[relay.String()] = true
+	}
+
+	unknown := []string{}
+	for _, priorityRelays := range []map[string]bool{m.primaryRelays, m.fallbackRelays} {
+		for relay := range priorityRelays {
+			if !configured[relay] {
+				unknown = append(unknown, relay)
+			}
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	sort.Strings(unknown)
+	return fmt.Errorf("%w: %s", errUnknownPriorityRelay, strings.Join(unknown, ", "))
+}
+
+// getRelays returns the current list of relays
+func (m *BoostService) getRelays() []RelayEntry {
+	m.relaysLock.RLock()
+	defer m.relaysLock.RUnlock()
+	return m.relays
+}
+
+// ForceRelayRefresh replaces the list of relays, such as after reloading a dynamic configuration file.
+// Requests already in flight complete with the previous list. The idle connections to the removed relays
+// are closed, and the circuit breakers of the new relays start closed.
+func (m *BoostService) ForceRelayRefresh(relays []RelayEntry) error {
+	if len(relays) == 0 {
+		return errNoRelays
+	}
+	if err := validateRelayList(relays); err != nil {
+		return err
+	}
+
+	kept := make(map[string]bool, len(relays))
+	for _, relay := range relays {
+		kept[relay.String()] = true
+	}
+
+	m.relaysLock.Lock()
+	previous := m.relays
+	m.relays = append([]RelayEntry{}, relays...)
+	m.relaysLock.Unlock()
+
+	removed := 0
+	for _, relay := range previous {
+		if !kept[relay.String()] {
+			removed++
+		}
+	}
+	m.log.WithFields(logrus.Fields{
+		"numRelays":        len(relays),
+		"numRemovedRelays": removed,
+	}).Info("relay list refreshed")
+
+	if m.circuitBreaker != nil {
+		m.circuitBreaker.resetRelays(relays)
+	}
+	m.constraintRetries.removeRelays(relays)
+	if removed > 0 {
+		// The clients share their connection pools between relays, so this closes the idle connections
+		// to the remaining relays too, which are reopened on their next request
+		m.httpClientGetHeader.CloseIdleConnections()
+		m.httpClientGetPayload.CloseIdleConnections()
+		m.httpClientRegVal.CloseIdleConnections()
+		m.httpClientSubmitConstraint.CloseIdleConnections()
+	}
+	return nil
 }
 
 func (m *BoostService) respondError(w http.ResponseWriter, code int, message string) {
@@ -199,10 +454,28 @@ func (m *BoostService) getRouter() http.Handler {
 	r.HandleFunc(pathGetPayload, m.handleGetPayload).Methods(http.MethodPost)
 
 	r.Use(mux.CORSMethodMiddleware(r))
+	r.Use(m.trackInFlightRequests)
 	loggedRouter := httplogger.LoggingMiddlewareLogrus(m.log, r)
 	return loggedRouter
 }
 
+// trackInFlightRequests keeps count of the requests being served, and rejects new ones once shutdown has started
+func (m *BoostService) trackInFlightRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		m.inFlightLock.Lock()
+		if m.shuttingDown {
+			m.inFlightLock.Unlock()
+			m.respondError(w, http.StatusServiceUnavailable, errServerShuttingDown.Error())
+			return
+		}
+		m.inFlight.Add(1)
+		m.inFlightLock.Unlock()
+		defer m.inFlight.Done()
+
+		next.ServeHTTP(w, req)
+	})
+}
+
 // StartHTTPServer starts the HTTP server for this boost service instance
 func (m *BoostService) StartHTTPServer() error {
 	if m.srv != nil {
@@ -230,16 +503,76 @@ func (m *BoostService) StartHTTPServer() error {
 	return err
 }
 
+// Shutdown stops accepting new requests and waits for the in-flight ones, including their relay calls, to complete.
+// The constraint submissions waiting to be retried are dropped. If ctx expires before all requests are done, the
+// context error is returned.
+func (m *BoostService) Shutdown(ctx context.Context) error {
+	m.inFlightLock.Lock()
+	m.shuttingDown = true
+	m.inFlightLock.Unlock()
+	m.constraintRetries.stop()
+
+	if m.srv != nil {
+		if err := m.srv.Shutdown(ctx); err != nil {
+			return err
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		m.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// bidCacheTTL is how long the bids are kept in the bids cache
+const bidCacheTTL = 3 * time.Minute
+
 func (m *BoostService) startBidCacheCleanupTask() {
 	for {
 		time.Sleep(1 * time.Minute)
-		m.bidsLock.Lock()
-		for k, bidResp := range m.bids {
-			if time.Since(bidResp.t) > 3*time.Minute {
-				delete(m.bids, k)
-			}
+		m.removeExpiredBids()
+	}
+}
+
+// removeExpiredBids removes the bids received more than bidCacheTTL ago from the bids cache
+func (m *BoostService) removeExpiredBids() {
+	m.bidsLock.Lock()
+	defer m.bidsLock.Unlock()
+
+	now := m.now()
+	for k, bidResp := range m.bids {
+		if now.Sub(bidResp.t) > bidCacheTTL {
+			delete(m.bids, k)
 		}
-		m.bidsLock.Unlock()
+	}
+}
+
+// SetClockSource replaces the clock used for slot timing, bid expiry and latency measurements, such as
+// to advance time deterministically in tests. It must be called before the service is used.
+func (m *BoostService) SetClockSource(fn func() time.Time) {
+	m.now = fn
+	if m.circuitBreaker != nil {
+		m.circuitBreaker.mu.Lock()
+		m.circuitBreaker.now = fn
+		m.circuitBreaker.mu.Unlock()
+	}
+	if m.relayScorer != nil {
+		m.relayScorer.mu.Lock()
+		m.relayScorer.now = fn
+		m.relayScorer.mu.Unlock()
+	}
+	if m.dnsCache != nil {
+		m.dnsCache.mu.Lock()
+		m.dnsCache.now = fn
+		m.dnsCache.mu.Unlock()
 	}
 }
 
@@ -307,14 +640,15 @@ func (m *BoostService) handleRegisterValidator(w http.ResponseWriter, req *http.
 		"ua":               ua,
 	})
 
-	relayRespCh := make(chan error, len(m.relays))
+	relays := m.getRelays()
+	relayRespCh := make(chan error, len(relays))
 
-	for _, relay := range m.relays {
+	for _, relay := range relays {
 		go func(relay RelayEntry) {
 			url := relay.GetURI(pathRegisterValidator)
 			log := log.WithField("url", url)
 
-			_, err := SendHTTPRequest(context.Background(), m.httpClientRegVal, http.MethodPost, url, ua, nil, payload, nil)
+			_, err := SendHTTPRequest(context.Background(), m.relayHTTPClient(m.httpClientRegVal, relay), http.MethodPost, url, ua, nil, payload, nil)
 			relayRespCh <- err
 			if err != nil {
 				log.WithError(err).Warn("error calling registerValidator on relay")
@@ -325,7 +659,7 @@ func (m *BoostService) handleRegisterValidator(w http.ResponseWriter, req *http.
 
 	go m.sendValidatorRegistrationsToRelayMonitors(payload)
 
-	for i := 0; i < len(m.relays); i++ {
+	for i := 0; i < len(relays); i++ {
 		respErr := <-relayRespCh
 		if respErr == nil {
 			m.respondOK(w, nilResponse)
@@ -342,6 +676,9 @@ func (m *BoostService) verifyInclusionProof(responsePayload *BidWithInclusionPro
 
 	// BOLT: get constraints for the slot
 	inclusionConstraints, exists := m.constraints.Get(slot)
+	if !exists && m.restoreConstraintState(slot) {
+		inclusionConstraints, exists = m.constraints.Get(slot)
+	}
 	if !exists {
 		log.Warnf("[BOLT]: No constraints found for slot %d", slot)
 		return errMissingConstraint
@@ -362,61 +699,45 @@ func (m *BoostService) verifyInclusionProof(responsePayload *BidWithInclusionPro
 		return errInvalidRoot
 	}
 
-	leaves := make([][]byte, len(inclusionConstraints))
-	i := 0
-
-	for hash, constraint := range inclusionConstraints {
-		if len(constraint.Tx) == 0 {
-			log.Warnf("[BOLT]: Raw tx is empty for constraint tx hash %s", hash)
-			continue
+	// The leaves must be in the order of the proven transactions, not in the random order of the constraints map.
+	// Each constraint must be proven once: with duplicates, a proof of [A, A] would stand in for {A, B}.
+	constraints := make([]Transaction, 0, len(inclusionConstraints))
+	proven := make(map[common.Hash]bool, len(inclusionConstraints))
+	for _, hash := range responsePayload.Proofs.TransactionHashes {
+		if proven[common.Hash(hash)] {
+			return fmt.Errorf("%w: %s", errDuplicateProvenTransaction, hash)
 		}
+		proven[common.Hash(hash)] = true
 
-		// Compute the hash tree root for the raw preconfirmed transaction
-		// and use it as "Leaf" in the proof to be verified against
-		tx := Transaction(constraint.Tx)
-		txHashTreeRoot, err := tx.HashTreeRoot()
-		if err != nil {
-			return errInvalidRoot
+		constraint, ok := inclusionConstraints[common.Hash(hash)]
+		if !ok {
+			return fmt.Errorf("%w: %s", errMissingConstraint, hash)
 		}
-
-		leaves[i] = txHashTreeRoot[:]
-		i++
-	}
-
-	hashes := make([][]byte, len(responsePayload.Proofs.MerkleHashes))
-	for i, hash := range responsePayload.Proofs.MerkleHashes {
-		hashes[i] = []byte(*hash)
-	}
-	indexes := make([]int, len(responsePayload.Proofs.GeneralizedIndexes))
-	for i, index := range responsePayload.Proofs.GeneralizedIndexes {
-		indexes[i] = int(index)
+		if len(constraint.Tx) == 0 {
+			return fmt.Errorf("%w: %s", errEmptyConstraintTx, hash)
+		}
+		constraints = append(constraints, constraint.Tx)
 	}
 
-	currentTime := time.Now()
-	ok, err := fastSsz.VerifyMultiproof(transactionsRoot[:], hashes, leaves, indexes)
-	elapsed := time.Since(currentTime)
+	currentTime := m.now()
+	err = m.proofVerifier.VerifyInclusionProof(responsePayload.Proofs, transactionsRoot, constraints)
+	elapsed := m.now().Sub(currentTime)
 	if err != nil {
-		log.WithError(err).Error("error verifying merkle proof")
-		return err
-	}
-
-	if !ok {
-		log.Error("[BOLT]: proof verification failed")
+		log.WithError(err).Error("[BOLT]: proof verification failed")
 
 		// BOLT: send event to web demo
 		message := fmt.Sprintf("failed to verify merkle proof for slot %d", slot)
 		EmitBoltDemoEvent(message)
 
-		return errInvalidProofs
-	} else {
-		log.Info(fmt.Sprintf("[BOLT]: merkle proof verified in %s", elapsed))
-
-		// BOLT: send event to web demo
-		// verified merkle proof for tx: %s in %v", proof.TxHash.String(), elapsed)
-		message := fmt.Sprintf("verified merkle proof for slot %d in %v", slot, elapsed)
-		EmitBoltDemoEvent(message)
+		return err
 	}
 
+	log.Info(fmt.Sprintf("[BOLT]: merkle proof verified in %s", elapsed))
+
+	// BOLT: send event to web demo
+	message := fmt.Sprintf("verified merkle proof for slot %d in %v", slot, elapsed)
+	EmitBoltDemoEvent(message)
+
 	return nil
 }
 
@@ -440,11 +761,22 @@ func (m *BoostService) handleSubmitConstraint(w http.ResponseWriter, req *http.R
 		return
 	}
 
+	// Reject constraints for past slots or slots too far in the future, which are likely a bug
+	for _, signedConstraints := range payload {
+		if err := m.validateConstraintSlot(signedConstraints.Message.Slot); err != nil {
+			log.WithError(err).Warn("[BOLT]: rejecting constraints")
+			m.respondError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	relays := m.getRelays()
+
 	// Add all constraints to the cache
 	for _, signedConstraints := range payload {
 		constraintMessage := signedConstraints.Message
 
-		log.Infof("[BOLT]: adding inclusion constraints to cache. slot = %d, validatorIndex = %d, number of relays = %d", constraintMessage.Slot, constraintMessage.ValidatorIndex, len(m.relays))
+		log.Infof("[BOLT]: adding inclusion constraints to cache. slot = %d, validatorIndex = %d, number of relays = %d", constraintMessage.Slot, constraintMessage.ValidatorIndex, len(relays))
 
 		// Add the constraints to the cache.
 		// They will be cleared when we receive a payload for the slot in `handleGetPayload`
@@ -454,30 +786,45 @@ func (m *BoostService) handleSubmitConstraint(w http.ResponseWriter, req *http.R
 			continue
 		}
 
-		log.Infof("[BOLT]: added inclusion constraints to cache. slot = %d, validatorIndex = %d, number of relays = %d", constraintMessage.Slot, constraintMessage.ValidatorIndex, len(m.relays))
+		log.Infof("[BOLT]: added inclusion constraints to cache. slot = %d, validatorIndex = %d, number of relays = %d", constraintMessage.Slot, constraintMessage.ValidatorIndex, len(relays))
+	}
+
+	// BOLT: keep the constraints in the state store, to restore them after a restart
+	m.saveConstraintState(payload)
+
+	// BOLT: don't forward signed constraints which only repeat transactions already in the batch
+	if deduplicated := deduplicateConstraints(payload); len(deduplicated) < len(payload) {
+		log.Infof("[BOLT]: dropped %d duplicate signed constraints", len(payload)-len(deduplicated))
+		payload = deduplicated
 	}
 
-	relayRespCh := make(chan error, len(m.relays))
+	relayRespCh := make(chan error, len(relays))
 
 	EmitBoltDemoEvent(fmt.Sprintf("received %d constraints, forwarding to Bolt relays... (path: %s)", len(payload), path))
 
-	for _, relay := range m.relays {
+	for _, relay := range relays {
 		go func(relay RelayEntry) {
 			url := relay.GetURI(pathSubmitConstraint)
 			log := log.WithField("url", url)
 
 			log.Infof("sending request for %d constraint to relay", len(payload))
-			_, err := SendHTTPRequest(context.Background(), m.httpClientSubmitConstraint, http.MethodPost, url, ua, nil, payload, nil)
+			code, err := SendHTTPRequest(context.Background(), m.relayHTTPClient(m.httpClientSubmitConstraint, relay), http.MethodPost, url, ua, nil, payload, nil)
 			log.Infof("sent request for %d constraint to relay. err = %v", len(payload), err)
-			relayRespCh <- err
 			if err != nil {
 				log.WithError(err).Warn("error calling submitConstraint on relay")
+				// BOLT: deliver the constraints eventually if the relay is only temporarily unavailable
+				if isTransientFailure(code) {
+					m.retryConstraintSubmission(log, relay, ua, payload)
+				}
+				relayRespCh <- err
 				return
 			}
+			m.recordConstraintsSubmitted(relay, payload)
+			relayRespCh <- nil
 		}(relay)
 	}
 
-	for i := 0; i < len(m.relays); i++ {
+	for i := 0; i < len(relays); i++ {
 		respErr := <-relayRespCh
 		if respErr == nil {
 			m.respondOK(w, nilResponse)
@@ -488,216 +835,385 @@ func (m *BoostService) handleSubmitConstraint(w http.ResponseWriter, req *http.R
 	m.respondError(w, http.StatusBadGateway, errNoSuccessfulRelayResponse.Error())
 }
 
-// handleGetHeader requests bids from the relays
-func (m *BoostService) handleGetHeader(w http.ResponseWriter, req *http.Request) {
-	vars := mux.Vars(req)
-	slot := vars["slot"]
-	parentHashHex := vars["parent_hash"]
-	pubkey := vars["pubkey"]
-
-	ua := UserAgent(req.Header.Get("User-Agent"))
+// CancelConstraints revokes the constraints of the given transactions for the slot, by sending a signed
+// cancellation to all relays. The constraints are also removed from the cache, so that bids are not expected
+// to prove their inclusion anymore. It fails only if no relay accepted the cancellation.
+func (m *BoostService) CancelConstraints(ctx context.Context, slot phase0.Slot, txHashes []phase0.Hash32) error {
 	log := m.log.WithFields(logrus.Fields{
-		"method":     "getHeader",
-		"slot":       slot,
-		"parentHash": parentHashHex,
-		"pubkey":     pubkey,
-		"ua":         ua,
+		"method":         "cancelConstraints",
+		"slot":           slot,
+		"numConstraints": len(txHashes),
 	})
-	log.Debug("getHeader")
 
-	_slot, err := strconv.ParseUint(slot, 10, 64)
+	if m.constraintSigningKey == nil {
+		return errNoConstraintSigningKey
+	}
+
+	payload := &SignedCancelConstraints{
+		Message: CancelConstraintsMessage{
+			Slot:              uint64(slot),
+			TransactionHashes: txHashes,
+		},
+	}
+	signature, err := ssz.SignMessage(&payload.Message, m.builderSigningDomain, m.constraintSigningKey)
 	if err != nil {
-		m.respondError(w, http.StatusBadRequest, errInvalidSlot.Error())
-		return
+		return err
 	}
+	payload.Signature = signature
 
-	if len(pubkey) != 98 {
-		m.respondError(w, http.StatusBadRequest, errInvalidPubkey.Error())
-		return
+	m.constraints.RemoveConstraints(uint64(slot), txHashes)
+	m.removeConstraintState(uint64(slot), txHashes)
+
+	var wg sync.WaitGroup
+	var numSuccessRequestsToRelay uint32
+	for _, relay := range m.getRelays() {
+		wg.Add(1)
+		go func(relay RelayEntry) {
+			defer wg.Done()
+			url := fmt.Sprintf("%s?slot=%d", relay.GetURI(pathDeleteConstraint), slot)
+			log := log.WithField("url", url)
+
+			_, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientSubmitConstraint, relay), http.MethodDelete, url, "", nil, payload, nil)
+			if err != nil {
+				log.WithError(err).Warn("error cancelling constraints on relay")
+				return
+			}
+			atomic.AddUint32(&numSuccessRequestsToRelay, 1)
+		}(relay)
 	}
 
-	if len(parentHashHex) != 66 {
-		m.respondError(w, http.StatusBadRequest, errInvalidHash.Error())
-		return
+	wg.Wait()
+
+	if numSuccessRequestsToRelay == 0 {
+		return errNoSuccessfulRelayResponse
 	}
+	log.Info("[BOLT]: cancelled constraints")
+	return nil
+}
 
-	// Make sure we have a uid for this slot
-	m.slotUIDLock.Lock()
-	if m.slotUID.slot < _slot {
-		m.slotUID.slot = _slot
-		m.slotUID.uid = uuid.New()
+// validateConstraintSlot returns an error if the slot is not within [currentSlot, currentSlot+maxFutureSlots],
+// or if the current slot is unknown because the genesis time is not set.
+func (m *BoostService) validateConstraintSlot(slot uint64) error {
+	if m.genesisTime == 0 {
+		return fmt.Errorf("%w: slot %d", errUnknownGenesisTime, slot)
 	}
-	slotUID := m.slotUID.uid
-	m.slotUIDLock.Unlock()
-	log = log.WithField("slotUID", slotUID)
 
-	// Log how late into the slot the request starts
-	slotStartTimestamp := m.genesisTime + _slot*config.SlotTimeSec
-	msIntoSlot := uint64(time.Now().UTC().UnixMilli()) - slotStartTimestamp*1000
-	log.WithFields(logrus.Fields{
-		"genesisTime": m.genesisTime,
-		"slotTimeSec": config.SlotTimeSec,
-		"msIntoSlot":  msIntoSlot,
-	}).Infof("getHeader request start - %d milliseconds into slot %d", msIntoSlot, _slot)
+	currentSlot := uint64(0)
+	if now := uint64(m.now().Unix()); now > m.genesisTime {
+		currentSlot = (now - m.genesisTime) / config.SlotTimeSec
+	}
+	// Compare the distance to the current slot, so that a large maxFutureSlots cannot overflow
+	if slot < currentSlot || slot-currentSlot > m.maxFutureSlots {
+		return fmt.Errorf("%w: slot %d, current slot %d, max future slots %d", errConstraintSlotOutOfRange, slot, currentSlot, m.maxFutureSlots)
+	}
+	return nil
+}
 
-	// Add request headers
-	headers := map[string]string{
-		HeaderKeySlotUID: slotUID.String(),
+// recordBidValue adds a valid bid value received from the relay to its statistics
+func (m *BoostService) recordBidValue(relay RelayEntry, value *uint256.Int) {
+	m.bidStatsLock.Lock()
+	defer m.bidStatsLock.Unlock()
+
+	stats, ok := m.bidStats[relay]
+	if !ok {
+		stats = new(bidStatsAccumulator)
+		m.bidStats[relay] = stats
 	}
+	stats.add(value)
+}
 
-	// Prepare relay responses
-	result := bidResp{}                           // the final response, containing the highest bid (if any)
-	relays := make(map[BlockHashHex][]RelayEntry) // relays that sent the bid for a specific blockHash
+// BestBidStats returns statistics of the values of the valid bids received from each relay by getHeader since startup.
+// Relays which did not send any valid bid are omitted.
+func (m *BoostService) BestBidStats() map[RelayEntry]BidStats {
+	m.bidStatsLock.Lock()
+	defer m.bidStatsLock.Unlock()
+
+	stats := make(map[RelayEntry]BidStats, len(m.bidStats))
+	for relay, relayStats := range m.bidStats {
+		stats[relay] = relayStats.stats()
+	}
+	return stats
+}
+
+// RelayScore returns the score of the relay, which starts at 100 and is lowered by its failures.
+// It is always 100 if BanDuration is not set.
+func (m *BoostService) RelayScore(relay RelayEntry) int {
+	if m.relayScorer == nil {
+		return initialRelayScore
+	}
+	return m.relayScorer.relayScore(relay)
+}
+
+// IsRelayBanned returns whether the relay is skipped because its score dropped below zero
+func (m *BoostService) IsRelayBanned(relay RelayEntry) bool {
+	return m.relayScorer != nil && m.relayScorer.banned(relay)
+}
+
+// RelayCircuitState returns the state of the circuit breaker of the relay, which is always
+// CircuitClosed if the circuit breaker is disabled
+func (m *BoostService) RelayCircuitState(relay RelayEntry) CircuitState {
+	if m.circuitBreaker == nil {
+		return CircuitClosed
+	}
+	return m.circuitBreaker.state(relay)
+}
+
+// GetConstraintStatus asks every relay which of the given constraint transactions it acknowledged for the slot,
+// and returns the union of their answers. It fails only if no relay could be queried.
+func (m *BoostService) GetConstraintStatus(ctx context.Context, slot phase0.Slot, txHashes []phase0.Hash32) (ConstraintStatus, error) {
+	log := m.log.WithFields(logrus.Fields{
+		"method": "getConstraintStatus",
+		"slot":   slot,
+	})
+
+	status := make(ConstraintStatus, len(txHashes))
+	for _, txHash := range txHashes {
+		status[txHash] = make(map[string]bool)
+	}
 
-	// Call the relays
 	var mu sync.Mutex
 	var wg sync.WaitGroup
-	for _, relay := range m.relays {
+	var numSuccessRequestsToRelay uint32
+	for _, relay := range m.getRelays() {
 		wg.Add(1)
 		go func(relay RelayEntry) {
 			defer wg.Done()
-			path := fmt.Sprintf("/eth/v1/builder/header/%s/%s/%s", slot, parentHashHex, pubkey)
-			url := relay.GetURI(path)
+			url := fmt.Sprintf("%s?slot=%d", relay.GetURI(pathConstraintStatus), slot)
 			log := log.WithField("url", url)
-			responsePayload := new(builderSpec.VersionedSignedBuilderBid)
-			code, err := SendHTTPRequest(context.Background(), m.httpClientGetHeader, http.MethodGet, url, ua, headers, nil, responsePayload)
+
+			responsePayload := new(ConstraintStatusResponse)
+			_, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientSubmitConstraint, relay), http.MethodGet, url, "", nil, nil, responsePayload)
 			if err != nil {
-				log.WithError(err).Warn("error making request to relay")
+				log.WithError(err).Warn("error calling constraint status on relay")
 				return
 			}
+			atomic.AddUint32(&numSuccessRequestsToRelay, 1)
 
-			if code == http.StatusNoContent {
-				log.Debug("no-content response")
-				return
+			mu.Lock()
+			defer mu.Unlock()
+			for _, txHash := range responsePayload.TransactionHashes {
+				if relays, ok := status[txHash]; ok {
+					relays[relay.String()] = true
+				}
 			}
+		}(relay)
+	}
 
-			// Skip if payload is empty
-			if responsePayload.IsEmpty() {
-				return
-			}
+	wg.Wait()
 
-			// Getting the bid info will check if there are missing fields in the response
-			bidInfo, err := parseBidInfo(responsePayload)
+	if numSuccessRequestsToRelay == 0 {
+		return nil, errNoSuccessfulRelayResponse
+	}
+	return status, nil
+}
+
+// ConstraintsForSlot retrieves the constraints stored by the relays for the slot, for example to recover the
+// constraints submitted before a restart. Constraints stored by several relays are returned once, and relays
+// which fail are ignored unless all of them do.
+func (m *BoostService) ConstraintsForSlot(ctx context.Context, slot phase0.Slot) (BatchedSignedConstraints, error) {
+	log := m.log.WithFields(logrus.Fields{
+		"method": "constraintsForSlot",
+		"slot":   slot,
+	})
+
+	relays := m.getRelays()
+	relayConstraints := make([]BatchedSignedConstraints, len(relays))
+	var wg sync.WaitGroup
+	var numSuccessRequestsToRelay uint32
+	for i, relay := range relays {
+		wg.Add(1)
+		go func(i int, relay RelayEntry) {
+			defer wg.Done()
+			url := fmt.Sprintf("%s?slot=%d", relay.GetURI(pathConstraints), slot)
+			log := log.WithField("url", url)
+
+			responsePayload := BatchedSignedConstraints{}
+			_, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientSubmitConstraint, relay), http.MethodGet, url, "", nil, nil, &responsePayload)
 			if err != nil {
-				log.WithError(err).Warn("error parsing bid info")
+				log.WithError(err).Warn("error getting constraints from relay")
 				return
 			}
+			atomic.AddUint32(&numSuccessRequestsToRelay, 1)
+			relayConstraints[i] = responsePayload
+		}(i, relay)
+	}
 
-			if bidInfo.blockHash == nilHash {
-				log.Warn("relay responded with empty block hash")
-				return
-			}
+	wg.Wait()
 
-			valueEth := weiBigIntToEthBigFloat(bidInfo.value.ToBig())
-			log = log.WithFields(logrus.Fields{
-				"blockNumber": bidInfo.blockNumber,
-				"blockHash":   bidInfo.blockHash.String(),
-				"txRoot":      bidInfo.txRoot.String(),
-				"value":       valueEth.Text('f', 18),
-			})
+	if numSuccessRequestsToRelay == 0 {
+		return nil, errNoSuccessfulRelayResponse
+	}
 
-			if relay.PublicKey.String() != bidInfo.pubkey.String() {
-				log.Errorf("bid pubkey mismatch. expected: %s - got: %s", relay.PublicKey.String(), bidInfo.pubkey.String())
-				return
+	// Merge the constraints of all relays, in relay order
+	constraints := make(BatchedSignedConstraints, 0)
+	seen := make(map[string]bool)
+	for _, batch := range relayConstraints {
+		for _, signedConstraints := range batch {
+			if signedConstraints == nil {
+				continue
 			}
-
-			// Verify the relay signature in the relay response
-			if !config.SkipRelaySignatureCheck {
-				ok, err := checkRelaySignature(responsePayload, m.builderSigningDomain, relay.PublicKey)
-				if err != nil {
-					log.WithError(err).Error("error verifying relay signature")
-					return
-				}
-				if !ok {
-					log.Error("failed to verify relay signature")
-					return
-				}
+			key := signedConstraints.String()
+			if seen[key] {
+				continue
 			}
+			seen[key] = true
+			constraints = append(constraints, signedConstraints)
+		}
+	}
+	return constraints, nil
+}
 
-			// Verify response coherence with proposer's input data
-			if bidInfo.parentHash.String() != parentHashHex {
-				log.WithFields(logrus.Fields{
-					"originalParentHash": parentHashHex,
-					"responseParentHash": bidInfo.parentHash.String(),
-				}).Error("proposer and relay parent hashes are not the same")
+// GetConstraintProofForSlot requests the inclusion proof of the given constrained transactions for the slot
+// from all relays, independently of any bid. It returns the proof of the first relay, in relay order, which
+// sent a well-formed proof covering all the transactions.
+func (m *BoostService) GetConstraintProofForSlot(ctx context.Context, slot phase0.Slot, txHashes []phase0.Hash32) (*InclusionProof, error) {
+	log := m.log.WithFields(logrus.Fields{
+		"method":         "getConstraintProofForSlot",
+		"slot":           slot,
+		"numConstraints": len(txHashes),
+	})
+
+	hashes := make([]string, len(txHashes))
+	for i, txHash := range txHashes {
+		hashes[i] = txHash.String()
+	}
+
+	relays := m.getRelays()
+	relayProofs := make([]*InclusionProof, len(relays))
+	var wg sync.WaitGroup
+	for i, relay := range relays {
+		wg.Add(1)
+		go func(i int, relay RelayEntry) {
+			defer wg.Done()
+			url := fmt.Sprintf("%s?slot=%d&tx_hashes=%s", relay.GetURI(pathGetConstraintProof), slot, strings.Join(hashes, ","))
+			log := log.WithField("url", url)
+
+			responsePayload := new(InclusionProof)
+			_, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientSubmitConstraint, relay), http.MethodGet, url, "", nil, nil, responsePayload)
+			if err != nil {
+				log.WithError(err).Warn("error getting constraint proof from relay")
 				return
 			}
-
-			isZeroValue := bidInfo.value.IsZero()
-			isEmptyListTxRoot := bidInfo.txRoot.String() == "0x7ffe241ea60187fdb0187bfa22de35d1f9bed7ab061d9401fd47e34a54fbede1"
-			if isZeroValue || isEmptyListTxRoot {
-				log.Warn("ignoring bid with 0 value")
+			if err := checkProofCoversTransactions(responsePayload, txHashes); err != nil {
+				log.WithError(err).Warn("invalid constraint proof from relay")
 				return
 			}
-			log.Debug("bid received")
+			relayProofs[i] = responsePayload
+		}(i, relay)
+	}
 
-			// Skip if value (fee) is lower than the minimum bid
-			if bidInfo.value.CmpBig(m.relayMinBid.BigInt()) == -1 {
-				log.Debug("ignoring bid below min-bid value")
+	wg.Wait()
+
+	for _, proof := range relayProofs {
+		if proof != nil {
+			return proof, nil
+		}
+	}
+	return nil, errNoSuccessfulRelayResponse
+}
+
+// checkProofCoversTransactions returns an error if the proof indices are invalid, or if the proof does not
+// include all the given transactions
+func checkProofCoversTransactions(proof *InclusionProof, txHashes []phase0.Hash32) error {
+	if err := ValidateProofIndices(proof); err != nil {
+		return err
+	}
+	if len(proof.TransactionHashes) != len(proof.GeneralizedIndexes) {
+		return errMismatchProofSize
+	}
+
+	proven := make(map[phase0.Hash32]bool, len(proof.TransactionHashes))
+	for _, txHash := range proof.TransactionHashes {
+		proven[txHash] = true
+	}
+	for _, txHash := range txHashes {
+		if !proven[txHash] {
+			return fmt.Errorf("%w: %s", errMissingConstraint, txHash)
+		}
+	}
+	return nil
+}
+
+// GetSupportedConstraintTypes asks the relay which types of constraints it supports, such as
+// ConstraintTypeTxInclusion
+func (m *BoostService) GetSupportedConstraintTypes(ctx context.Context, relay RelayEntry) ([]string, error) {
+	url := relay.GetURI(pathConstraintTypes)
+	log := m.log.WithFields(logrus.Fields{
+		"method": "getSupportedConstraintTypes",
+		"url":    url,
+	})
+
+	responsePayload := new(ConstraintTypesResponse)
+	_, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientSubmitConstraint, relay), http.MethodGet, url, "", nil, nil, responsePayload)
+	if err != nil {
+		log.WithError(err).Warn("error getting relay constraint types")
+		return nil, err
+	}
+	return responsePayload.ConstraintTypes, nil
+}
+
+// NegotiateConstraintAPIVersion asks every relay which versions of the constraint and proof API it supports,
+// and returns the highest version supported by the BoostService and all the relays which answered.
+func (m *BoostService) NegotiateConstraintAPIVersion(ctx context.Context) (APIVersion, error) {
+	log := m.log.WithField("method", "negotiateConstraintAPIVersion")
+
+	// Number of relays supporting each version
+	versionSupport := make(map[APIVersion]int)
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	numSuccessRequestsToRelay := 0
+	for _, relay := range m.getRelays() {
+		wg.Add(1)
+		go func(relay RelayEntry) {
+			defer wg.Done()
+			url := relay.GetURI(pathCapabilities)
+			log := log.WithField("url", url)
+
+			responsePayload := new(CapabilitiesResponse)
+			_, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientSubmitConstraint, relay), http.MethodGet, url, "", nil, nil, responsePayload)
+			if err != nil {
+				log.WithError(err).Warn("error getting relay capabilities")
 				return
 			}
 
+			// Count each version once, even if listed several times
+			versions := make(map[APIVersion]bool)
+			for _, version := range responsePayload.ConstraintAPIVersions {
+				versions[version] = true
+			}
+
 			mu.Lock()
 			defer mu.Unlock()
-
-			// Remember which relays delivered which bids (multiple relays might deliver the top bid)
-			relays[BlockHashHex(bidInfo.blockHash.String())] = append(relays[BlockHashHex(bidInfo.blockHash.String())], relay)
-
-			// Compare the bid with already known top bid (if any)
-			if !result.response.IsEmpty() {
-				valueDiff := bidInfo.value.Cmp(result.bidInfo.value)
-				if valueDiff == -1 { // current bid is less profitable than already known one
-					return
-				} else if valueDiff == 0 { // current bid is equally profitable as already known one. Use hash as tiebreaker
-					previousBidBlockHash := result.bidInfo.blockHash
-					if bidInfo.blockHash.String() >= previousBidBlockHash.String() {
-						return
-					}
-				}
+			numSuccessRequestsToRelay++
+			for version := range versions {
+				versionSupport[version]++
 			}
-
-			// Use this relay's response as mev-boost response because it's most profitable
-			log.Debug("new best bid")
-			result.response = *responsePayload
-			result.bidInfo = bidInfo
-			result.t = time.Now()
 		}(relay)
 	}
 
-	// Wait for all requests to complete...
 	wg.Wait()
 
-	if result.response.IsEmpty() {
-		log.Info("no bid received")
-		w.WriteHeader(http.StatusNoContent)
-		return
+	if numSuccessRequestsToRelay == 0 {
+		return 0, errNoSuccessfulRelayResponse
 	}
 
-	// Log result
-	valueEth := weiBigIntToEthBigFloat(result.bidInfo.value.ToBig())
-	result.relays = relays[BlockHashHex(result.bidInfo.blockHash.String())]
-	log.WithFields(logrus.Fields{
-		"blockHash":   result.bidInfo.blockHash.String(),
-		"blockNumber": result.bidInfo.blockNumber,
-		"txRoot":      result.bidInfo.txRoot.String(),
-		"value":       valueEth.Text('f', 18),
-		"relays":      strings.Join(RelayEntriesToStrings(result.relays), ", "),
-	}).Info("best bid")
-
-	// Remember the bid, for future logging in case of withholding
-	bidKey := bidRespKey{slot: _slot, blockHash: result.bidInfo.blockHash.String()}
-	m.bidsLock.Lock()
-	m.bids[bidKey] = result
-	m.bidsLock.Unlock()
+	var best APIVersion
+	for _, version := range m.constraintAPIVersions {
+		if versionSupport[version] == numSuccessRequestsToRelay && version > best {
+			best = version
+		}
+	}
+	if best == 0 {
+		return 0, errNoCommonAPIVersion
+	}
 
-	// Return the bid
-	m.respondOK(w, &result.response)
+	log.Infof("[BOLT]: negotiated constraint API version %d", best)
+	return best, nil
 }
 
 // handleGetHeader requests bids from the relays
-// BOLT: receiving preconfirmation proofs from relays along with bids, and
-// verify them. If not valid, the bid is discarded
-func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *http.Request) {
+func (m *BoostService) handleGetHeader(w http.ResponseWriter, req *http.Request) {
 	vars := mux.Vars(req)
 	slot := vars["slot"]
 	parentHashHex := vars["parent_hash"]
@@ -705,7 +1221,7 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 
 	ua := UserAgent(req.Header.Get("User-Agent"))
 	log := m.log.WithFields(logrus.Fields{
-		"method":     "getHeaderWithProofs",
+		"method":     "getHeader",
 		"slot":       slot,
 		"parentHash": parentHashHex,
 		"pubkey":     pubkey,
@@ -713,7 +1229,7 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 	})
 	log.Debug("getHeader")
 
-	slotUint, err := strconv.ParseUint(slot, 10, 64)
+	_slot, err := strconv.ParseUint(slot, 10, 64)
 	if err != nil {
 		m.respondError(w, http.StatusBadRequest, errInvalidSlot.Error())
 		return
@@ -731,8 +1247,8 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 
 	// Make sure we have a uid for this slot
 	m.slotUIDLock.Lock()
-	if m.slotUID.slot < slotUint {
-		m.slotUID.slot = slotUint
+	if m.slotUID.slot < _slot {
+		m.slotUID.slot = _slot
 		m.slotUID.uid = uuid.New()
 	}
 	slotUID := m.slotUID.uid
@@ -740,13 +1256,13 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 	log = log.WithField("slotUID", slotUID)
 
 	// Log how late into the slot the request starts
-	slotStartTimestamp := m.genesisTime + slotUint*config.SlotTimeSec
-	msIntoSlot := uint64(time.Now().UTC().UnixMilli()) - slotStartTimestamp*1000
+	slotStartTimestamp := m.genesisTime + _slot*config.SlotTimeSec
+	msIntoSlot := uint64(m.now().UTC().UnixMilli()) - slotStartTimestamp*1000
 	log.WithFields(logrus.Fields{
 		"genesisTime": m.genesisTime,
 		"slotTimeSec": config.SlotTimeSec,
 		"msIntoSlot":  msIntoSlot,
-	}).Infof("getHeader request start - %d milliseconds into slot %d", msIntoSlot, slotUint)
+	}).Infof("getHeader request start - %d milliseconds into slot %d", msIntoSlot, _slot)
 
 	// Add request headers
 	headers := map[string]string{
@@ -760,42 +1276,32 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 	// Call the relays
 	var mu sync.Mutex
 	var wg sync.WaitGroup
-	for _, relay := range m.relays {
+	for _, relay := range m.getRelays() {
 		wg.Add(1)
 		go func(relay RelayEntry) {
 			defer wg.Done()
-			path := fmt.Sprintf("/eth/v1/builder/header_with_proofs/%s/%s/%s", slot, parentHashHex, pubkey)
+			path := fmt.Sprintf("/eth/v1/builder/header/%s/%s/%s", slot, parentHashHex, pubkey)
 			url := relay.GetURI(path)
 			log := log.WithField("url", url)
-			responsePayload := new(BidWithInclusionProofs)
-			code, err := SendHTTPRequest(context.Background(), m.httpClientGetHeader, http.MethodGet, url, ua, headers, nil, responsePayload)
+			responsePayload := new(builderSpec.VersionedSignedBuilderBid)
+			code, err := SendHTTPRequest(context.Background(), m.relayHTTPClient(m.httpClientGetHeader, relay), http.MethodGet, url, ua, headers, nil, responsePayload)
 			if err != nil {
 				log.WithError(err).Warn("error making request to relay")
 				return
 			}
 
-			if responsePayload.Proofs != nil {
-				log.Infof("[BOLT]: get header with proofs at slot %s, received payload with proofs: %s", slot, responsePayload)
-			}
-
 			if code == http.StatusNoContent {
-				log.Warn("no-content response")
-				return
-			}
-
-			if responsePayload.Bid == nil {
-				log.Warn("Bid in response is nil")
+				log.Debug("no-content response")
 				return
 			}
 
 			// Skip if payload is empty
-			if responsePayload.Bid.IsEmpty() {
-				log.Warn("Bid is empty")
+			if responsePayload.IsEmpty() {
 				return
 			}
 
 			// Getting the bid info will check if there are missing fields in the response
-			bidInfo, err := parseBidInfo(responsePayload.Bid)
+			bidInfo, err := parseBidInfo(responsePayload)
 			if err != nil {
 				log.WithError(err).Warn("error parsing bid info")
 				return
@@ -821,7 +1327,7 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 
 			// Verify the relay signature in the relay response
 			if !config.SkipRelaySignatureCheck {
-				ok, err := checkRelaySignature(responsePayload.Bid, m.builderSigningDomain, relay.PublicKey)
+				ok, err := checkRelaySignature(responsePayload, m.builderSigningDomain, relay.PublicKey)
 				if err != nil {
 					log.WithError(err).Error("error verifying relay signature")
 					return
@@ -851,19 +1357,10 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 
 			// Skip if value (fee) is lower than the minimum bid
 			if bidInfo.value.CmpBig(m.relayMinBid.BigInt()) == -1 {
-				log.Warn("ignoring bid below min-bid value")
+				log.Debug("ignoring bid below min-bid value")
 				return
 			}
 
-			// BOLT: verify preconfirmation inclusion proofs. If they don't match, we don't consider the bid to be valid.
-			if responsePayload.Proofs != nil {
-				// BOLT: verify the proofs against the constraints. If they don't match, we don't consider the bid to be valid.
-				if err := m.verifyInclusionProof(responsePayload, slotUint); err != nil {
-					log.Warnf("[BOLT]: Proof verification failed for relay %s: %s", relay.URL, err)
-					return
-				}
-			}
-
 			mu.Lock()
 			defer mu.Unlock()
 
@@ -884,10 +1381,10 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 			}
 
 			// Use this relay's response as mev-boost response because it's most profitable
-			log.Infof("new best bid. Has proofs: %v", responsePayload.Proofs != nil)
-			result.response = *responsePayload.Bid
+			log.Debug("new best bid")
+			result.response = *responsePayload
 			result.bidInfo = bidInfo
-			result.t = time.Now()
+			result.t = m.now()
 		}(relay)
 	}
 
@@ -903,6 +1400,93 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 	// Log result
 	valueEth := weiBigIntToEthBigFloat(result.bidInfo.value.ToBig())
 	result.relays = relays[BlockHashHex(result.bidInfo.blockHash.String())]
+	log.WithFields(logrus.Fields{
+		"blockHash":   result.bidInfo.blockHash.String(),
+		"blockNumber": result.bidInfo.blockNumber,
+		"txRoot":      result.bidInfo.txRoot.String(),
+		"value":       valueEth.Text('f', 18),
+		"relays":      strings.Join(RelayEntriesToStrings(result.relays), ", "),
+	}).Info("best bid")
+
+	// Remember the bid, for future logging in case of withholding
+	bidKey := bidRespKey{slot: _slot, blockHash: result.bidInfo.blockHash.String()}
+	m.bidsLock.Lock()
+	m.bids[bidKey] = result
+	m.bidsLock.Unlock()
+
+	// Return the bid
+	m.respondOK(w, &result.response)
+}
+
+// handleGetHeader requests bids from the relays
+// BOLT: receiving preconfirmation proofs from relays along with bids, and
+// verify them. If not valid, the bid is discarded
+func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *http.Request) {
+	vars := mux.Vars(req)
+	slot := vars["slot"]
+	parentHashHex := vars["parent_hash"]
+	pubkey := vars["pubkey"]
+
+	ua := UserAgent(req.Header.Get("User-Agent"))
+	log := m.log.WithFields(logrus.Fields{
+		"method":     "getHeaderWithProofs",
+		"slot":       slot,
+		"parentHash": parentHashHex,
+		"pubkey":     pubkey,
+		"ua":         ua,
+	})
+	log.Debug("getHeader")
+
+	slotUint, err := strconv.ParseUint(slot, 10, 64)
+	if err != nil {
+		m.respondError(w, http.StatusBadRequest, errInvalidSlot.Error())
+		return
+	}
+
+	if len(pubkey) != 98 {
+		m.respondError(w, http.StatusBadRequest, errInvalidPubkey.Error())
+		return
+	}
+
+	if len(parentHashHex) != 66 {
+		m.respondError(w, http.StatusBadRequest, errInvalidHash.Error())
+		return
+	}
+
+	// Make sure we have a uid for this slot
+	m.slotUIDLock.Lock()
+	if m.slotUID.slot < slotUint {
+		m.slotUID.slot = slotUint
+		m.slotUID.uid = uuid.New()
+	}
+	slotUID := m.slotUID.uid
+	m.slotUIDLock.Unlock()
+	log = log.WithField("slotUID", slotUID)
+
+	// Log how late into the slot the request starts
+	slotStartTimestamp := m.genesisTime + slotUint*config.SlotTimeSec
+	msIntoSlot := uint64(m.now().UTC().UnixMilli()) - slotStartTimestamp*1000
+	log.WithFields(logrus.Fields{
+		"genesisTime": m.genesisTime,
+		"slotTimeSec": config.SlotTimeSec,
+		"msIntoSlot":  msIntoSlot,
+	}).Infof("getHeader request start - %d milliseconds into slot %d", msIntoSlot, slotUint)
+
+	// Add request headers
+	headers := map[string]string{
+		HeaderKeySlotUID: slotUID.String(),
+	}
+
+	// Call the relays and pick the best bid
+	result := m.getBestBid(context.Background(), log, ua, headers, slotUint, parentHashHex, pubkey)
+	if result.response.IsEmpty() {
+		log.Info("no bid received")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// Log result
+	valueEth := weiBigIntToEthBigFloat(result.bidInfo.value.ToBig())
 	log.WithFields(logrus.Fields{
 		"blockHash":   result.bidInfo.blockHash.String(),
 		"blockNumber": result.bidInfo.blockNumber,
@@ -922,6 +1506,506 @@ func (m *BoostService) handleGetHeaderWithProofs(w http.ResponseWriter, req *htt
 	log.Infof("responded with best bid to beacon client")
 }
 
+// getBestBid requests bids with inclusion proofs from all relays, verifies them and returns the most profitable one.
+// The returned response is empty if no relay delivered a valid bid.
+func (m *BoostService) getBestBid(ctx context.Context, log *logrus.Entry, ua UserAgent, headers map[string]string, slot uint64, parentHashHex, pubkey string) bidResp {
+	// Prepare relay responses
+	result := bidResp{}                           // the final response, containing the highest bid (if any)
+	relays := make(map[BlockHashHex][]RelayEntry) // relays that sent the bid for a specific blockHash
+	var bestRelay RelayEntry                      // relay that sent the current best bid, for the latency tiebreaker
+	var bestProofCount int                        // number of transactions proven with the current best bid
+	var relayBids []RelayBid                      // all valid bids of the current relay group, for the relay selector
+	var relayBidInfos []bidInfo                   // parsed relayBids
+
+	// With the shuffle option, equal bids are decided by the relay position in a random order, instead of
+	// by block hash, to spread the load evenly between relays
+	var relayRank map[string]int
+	if m.relayShuffle {
+		allRelays := m.getRelays()
+		relayRank = make(map[string]int, len(allRelays))
+		for i, rank := range rand.Perm(len(allRelays)) {
+			relayRank[allRelays[i].String()] = rank
+		}
+	}
+
+	// Call the relays
+	path := fmt.Sprintf("/eth/v1/builder/header_with_proofs/%d/%s/%s", slot, parentHashHex, pubkey)
+	var mu sync.Mutex
+	for _, group := range m.relayGroups() {
+		var wg sync.WaitGroup
+		for _, relay := range group {
+			wg.Add(1)
+			go func(relay RelayEntry) {
+				defer wg.Done()
+				responsePayload, bidInfo, err := m.requestRelayBid(ctx, log, relay, path, ua, headers, slot, parentHashHex)
+				if errors.Is(err, errBidBelowMinimum) {
+					mu.Lock()
+					result.numBelowMinBidValue++
+					mu.Unlock()
+					return
+				}
+				if err != nil {
+					mu.Lock()
+					result.relayErrors = append(result.relayErrors, fmt.Errorf("relay %s: %w", relay.String(), err))
+					mu.Unlock()
+					return
+				}
+				if responsePayload == nil {
+					return
+				}
+				log := log.WithFields(logrus.Fields{
+					"url":       relay.GetURI(path),
+					"blockHash": bidInfo.blockHash.String(),
+					"value":     weiBigIntToEthBigFloat(bidInfo.value.ToBig()).Text('f', 18),
+				})
+
+				m.recordBidValue(relay, bidInfo.value)
+				m.recordAuditEntry(AuditEntry{
+					EventType: AuditEventBid,
+					Slot:      slot,
+					RelayURL:  relay.String(),
+					BlockHash: bidInfo.blockHash.String(),
+					BidValue:  bidInfo.value.Dec(),
+				})
+
+				mu.Lock()
+				defer mu.Unlock()
+
+				// Remember which relays delivered which bids (multiple relays might deliver the top bid)
+				relays[BlockHashHex(bidInfo.blockHash.String())] = append(relays[BlockHashHex(bidInfo.blockHash.String())], relay)
+
+				if m.relaySelector != nil {
+					relayBids = append(relayBids, RelayBid{Relay: relay, Bid: responsePayload})
+					relayBidInfos = append(relayBidInfos, bidInfo)
+				}
+
+				// Compare the bid with already known top bid (if any)
+				if !result.response.IsEmpty() {
+					valueDiff := bidInfo.value.Cmp(result.bidInfo.value)
+					if valueDiff == -1 { // current bid is less profitable than already known one
+						return
+					} else if valueDiff == 0 { // current bid is equally profitable as already known one
+						// Prefer the bid proving the most constraints if enabled, then the faster relay if enabled,
+						// then the random relay order if enabled, otherwise use hash as tiebreaker
+						tieDiff := 0 // positive if the current bid is worse than the already known one
+						if m.constraintWeighted {
+							tieDiff = bestProofCount - responsePayload.ProofCount()
+						}
+						if tieDiff == 0 && m.relayLatency != nil {
+							tieDiff = m.relayLatency.compare(relay, bestRelay)
+						}
+						if tieDiff > 0 {
+							return
+						}
+						if tieDiff == 0 {
+							if relayRank != nil {
+								if relayRank[relay.String()] > relayRank[bestRelay.String()] {
+									return
+								}
+							} else if bidInfo.blockHash.String() >= result.bidInfo.blockHash.String() {
+								return
+							}
+						}
+					}
+				}
+
+				// Use this relay's response as mev-boost response because it's most profitable
+				log.Infof("new best bid. Has proofs: %v", responsePayload.Proofs != nil)
+				bestRelay = relay
+				bestProofCount = responsePayload.ProofCount()
+				result.response = *responsePayload.Bid
+				result.bidInfo = bidInfo
+				result.proofs = responsePayload.Proofs
+				result.t = m.now()
+			}(relay)
+		}
+
+		// Wait for all requests to complete...
+		wg.Wait()
+
+		// Let the relay selector choose among the bids instead, if set
+		if len(relayBids) > 0 {
+			result.response = builderSpec.VersionedSignedBuilderBid{}
+			result.bidInfo = bidInfo{}
+			result.proofs = nil
+			if selected := m.relaySelector.SelectBestBid(relayBids); selected != nil {
+				for i := range relayBids {
+					if relayBids[i].Bid == selected.Bid {
+						log.WithField("url", relayBids[i].Relay.String()).Info("bid selected by the relay selector")
+						result.response = *relayBids[i].Bid.Bid
+						result.bidInfo = relayBidInfos[i]
+						result.proofs = relayBids[i].Bid.Proofs
+						result.t = m.now()
+						break
+					}
+				}
+			}
+			relayBids, relayBidInfos = nil, nil
+		}
+
+		// The fallback relays are only called if no primary relay delivered a bid
+		if !result.response.IsEmpty() {
+			break
+		}
+	}
+
+	result.relays = relays[BlockHashHex(result.bidInfo.blockHash.String())]
+	return result
+}
+
+// relayHTTPClient returns the client to use for a request to the relay: the given client, with the timeout
+// set with WithRelayTimeout if there is one, resolving the relay host with the cache set with WithDNSCacheTTL,
+// adding the headers set with WithExtraRequestHeaders, and calling the interceptors set with
+// WithRequestInterceptor and WithResponseInterceptor
+func (m *BoostService) relayHTTPClient(client http.Client, relay RelayEntry) http.Client {
+	if m.dnsCache != nil {
+		client.Transport = m.dnsCache
+	}
+	if timeout, ok := m.relayTimeouts[relay.String()]; ok {
+		client.Timeout = timeout
+	}
+	if len(m.extraHeaders) > 0 {
+		client.Transport = &headerTransport{base: client.Transport, headers: m.extraHeaders}
+	}
+	if m.requestInterceptor != nil || m.responseInterceptor != nil {
+		client.Transport = &interceptorTransport{
+			base:       client.Transport,
+			relay:      relay,
+			onRequest:  m.requestInterceptor,
+			onResponse: m.responseInterceptor,
+			now:        m.now,
+		}
+	}
+	return client
+}
+
+// isFallbackRelay returns whether the relay is only called when no primary relay delivers a bid, see
+// WithPrimaryRelays and WithFallbackRelays
+func (m *BoostService) isFallbackRelay(relay RelayEntry) bool {
+	key := relay.String()
+	return m.fallbackRelays[key] || (m.primaryRelays != nil && !m.primaryRelays[key])
+}
+
+// relayGroups returns the relays to call in order of priority: the primary relays, then the fallback relays
+// if there are any
+func (m *BoostService) relayGroups() [][]RelayEntry {
+	relays := m.getRelays()
+	if m.primaryRelays == nil && m.fallbackRelays == nil {
+		return [][]RelayEntry{relays}
+	}
+
+	var primary, fallback []RelayEntry
+	for _, relay := range relays {
+		if m.isFallbackRelay(relay) {
+			fallback = append(fallback, relay)
+		} else {
+			primary = append(primary, relay)
+		}
+	}
+	return [][]RelayEntry{primary, fallback}
+}
+
+// requestRelayBid requests the bid at path from the relay and validates it. It returns a nil bid if the relay
+// did not send a valid bid, with an error if the request failed or the bid is invalid, and errBidBelowMinimum if
+// the bid was only ignored because of the WithMinBidValue option.
+func (m *BoostService) requestRelayBid(ctx context.Context, log *logrus.Entry, relay RelayEntry, path string, ua UserAgent, headers map[string]string, slot uint64, parentHashHex string) (*BidWithInclusionProofs, bidInfo, error) {
+	url := relay.GetURI(path)
+	log = log.WithField("url", url)
+
+	if m.circuitBreaker != nil && !m.circuitBreaker.allow(relay) {
+		log.Warn("skipping relay with open circuit breaker")
+		return nil, bidInfo{}, nil
+	}
+	if m.relayScorer != nil && m.relayScorer.banned(relay) {
+		log.Warn("skipping banned relay")
+		return nil, bidInfo{}, nil
+	}
+
+	// SSZ responses can't carry inclusion proofs, so they are only requested if there are no constraints to prove
+	sszPreferred := m.sszPreferred
+	if _, hasConstraints := m.constraints.Get(slot); hasConstraints {
+		sszPreferred = false
+	}
+
+	responsePayload := new(BidWithInclusionProofs)
+	requestStart := m.now()
+	code, err := SendGetHeaderRequest(ctx, m.relayHTTPClient(m.httpClientGetHeader, relay), url, ua, headers, sszPreferred, responsePayload)
+	m.recordRelayRequest(relay, m.now().Sub(requestStart), err)
+	if m.circuitBreaker != nil {
+		if err != nil {
+			m.circuitBreaker.recordFailure(relay)
+		} else {
+			m.circuitBreaker.recordSuccess(relay)
+		}
+	}
+	if err != nil {
+		log.WithError(err).Warn("error making request to relay")
+		m.penalizeRelay(relay, requestFailurePenalty(err))
+		return nil, bidInfo{}, err
+	}
+	if m.relayLatency != nil {
+		m.relayLatency.record(relay, m.now().Sub(requestStart))
+	}
+
+	if responsePayload.Proofs != nil {
+		log.Infof("[BOLT]: get header with proofs at slot %d, received payload with proofs: %s", slot, responsePayload)
+	}
+
+	if code == http.StatusNoContent {
+		log.Warn("no-content response")
+		return nil, bidInfo{}, nil
+	}
+
+	if responsePayload.Bid == nil {
+		log.Warn("Bid in response is nil")
+		return nil, bidInfo{}, fmt.Errorf("%w: nil bid", errInvalidBid)
+	}
+
+	// Skip if payload is empty
+	if responsePayload.Bid.IsEmpty() {
+		log.Warn("Bid is empty")
+		return nil, bidInfo{}, nil
+	}
+
+	// Getting the bid info will check if there are missing fields in the response
+	info, err := parseBidInfo(responsePayload.Bid)
+	if err != nil {
+		log.WithError(err).Warn("error parsing bid info")
+		return nil, bidInfo{}, fmt.Errorf("%w: %w", errInvalidBid, err)
+	}
+
+	if info.blockHash == nilHash {
+		log.Warn("relay responded with empty block hash")
+		return nil, bidInfo{}, fmt.Errorf("%w: empty block hash", errInvalidBid)
+	}
+
+	valueEth := weiBigIntToEthBigFloat(info.value.ToBig())
+	log = log.WithFields(logrus.Fields{
+		"blockNumber": info.blockNumber,
+		"blockHash":   info.blockHash.String(),
+		"txRoot":      info.txRoot.String(),
+		"value":       valueEth.Text('f', 18),
+	})
+
+	if relay.PublicKey.String() != info.pubkey.String() {
+		log.Errorf("bid pubkey mismatch. expected: %s - got: %s", relay.PublicKey.String(), info.pubkey.String())
+		return nil, bidInfo{}, fmt.Errorf("%w: pubkey mismatch", errInvalidBid)
+	}
+
+	// Verify the relay signature in the relay response
+	if !config.SkipRelaySignatureCheck {
+		ok, err := checkRelaySignature(responsePayload.Bid, m.builderSigningDomain, relay.PublicKey)
+		if err != nil {
+			log.WithError(err).Error("error verifying relay signature")
+			m.penalizeRelay(relay, relayScorePenaltyInvalidSignature)
+			return nil, bidInfo{}, fmt.Errorf("%w: %w", errInvalidBid, err)
+		}
+		if !ok {
+			log.Error("failed to verify relay signature")
+			m.penalizeRelay(relay, relayScorePenaltyInvalidSignature)
+			return nil, bidInfo{}, fmt.Errorf("%w: invalid relay signature", errInvalidBid)
+		}
+	}
+
+	// Verify response coherence with proposer's input data
+	if info.parentHash.String() != parentHashHex {
+		log.WithFields(logrus.Fields{
+			"originalParentHash": parentHashHex,
+			"responseParentHash": info.parentHash.String(),
+		}).Error("proposer and relay parent hashes are not the same")
+		return nil, bidInfo{}, fmt.Errorf("%w: parent hash mismatch", errInvalidBid)
+	}
+
+	isZeroValue := info.value.IsZero()
+	isEmptyListTxRoot := info.txRoot.String() == "0x7ffe241ea60187fdb0187bfa22de35d1f9bed7ab061d9401fd47e34a54fbede1"
+	if isZeroValue || isEmptyListTxRoot {
+		log.Warn("ignoring bid with 0 value")
+		return nil, bidInfo{}, nil
+	}
+	log.Debug("bid received")
+
+	// Skip if value (fee) is lower than the minimum bid
+	if info.value.CmpBig(m.relayMinBid.BigInt()) == -1 {
+		log.Warn("ignoring bid below min-bid value")
+		return nil, bidInfo{}, nil
+	}
+
+	// Skip if value is lower than the minimum bid value option
+	if m.minBidValue != nil && info.value.Cmp(m.minBidValue) == -1 {
+		log.WithField("minBidValue", weiBigIntToEthBigFloat(m.minBidValue.ToBig()).Text('f', 18)).Warn("ignoring bid below min-bid-value option")
+		return nil, info, errBidBelowMinimum
+	}
+
+	// Skip if value is higher than the maximum bid, which hints at a relay bug or manipulation
+	if m.maxBidValue != nil && info.value.Cmp(m.maxBidValue) == 1 {
+		log.WithField("maxBidValue", weiBigIntToEthBigFloat(m.maxBidValue.ToBig()).Text('f', 18)).Warn("ignoring bid above max-bid value")
+		return nil, bidInfo{}, fmt.Errorf("%w: above max-bid value", errInvalidBid)
+	}
+
+	// BOLT: verify preconfirmation inclusion proofs. If they don't match, we don't consider the bid to be valid.
+	if responsePayload.Proofs != nil {
+		// BOLT: verify the proofs against the constraints. If they don't match, we don't consider the bid to be valid.
+		if err := m.verifyInclusionProof(responsePayload, slot); err != nil {
+			log.Warnf("[BOLT]: Proof verification failed for relay %s: %s", relay.URL, err)
+			return nil, bidInfo{}, fmt.Errorf("%w: %w", errInvalidBid, err)
+		}
+	}
+
+	return responsePayload, info, nil
+}
+
+// RelayBid is a valid bid received from a relay
+type RelayBid struct {
+	Relay RelayEntry
+	Bid   *BidWithInclusionProofs
+}
+
+// GetHeadersFromAllRelays requests bids from all relays for the given slot and returns all the valid ones,
+// in the order of the relays. Relays which fail or send an invalid bid are omitted.
+func (m *BoostService) GetHeadersFromAllRelays(ctx context.Context, slot phase0.Slot, parentHash phase0.Hash32, pubkey phase0.BLSPubKey) ([]RelayBid, error) {
+	log := m.log.WithFields(logrus.Fields{
+		"method":     "getHeadersFromAllRelays",
+		"slot":       slot,
+		"parentHash": parentHash.String(),
+		"pubkey":     pubkey.String(),
+	})
+
+	path := fmt.Sprintf("/eth/v1/builder/header_with_proofs/%d/%s/%s", slot, parentHash.String(), pubkey.String())
+	relays := m.getRelays()
+	bids := make([]*BidWithInclusionProofs, len(relays))
+	var wg sync.WaitGroup
+	for i, relay := range relays {
+		wg.Add(1)
+		go func(i int, relay RelayEntry) {
+			defer wg.Done()
+			bids[i], _, _ = m.requestRelayBid(ctx, log, relay, path, "", nil, uint64(slot), parentHash.String())
+		}(i, relay)
+	}
+	wg.Wait()
+
+	relayBids := make([]RelayBid, 0, len(relays))
+	for i, bid := range bids {
+		if bid != nil {
+			relayBids = append(relayBids, RelayBid{Relay: relays[i], Bid: bid})
+		}
+	}
+	if len(relayBids) == 0 {
+		return nil, errNoBidReceived
+	}
+	return relayBids, nil
+}
+
+// GetBestBidForSlot requests bids from all relays for the given slot and returns the most profitable valid one.
+// It does not fall back to the local block builder set with WithLocalBlockBuilder, as a locally built block is
+// a payload and not a signed builder bid. GetBestBidOrLocalBlock does.
+func (m *BoostService) GetBestBidForSlot(ctx context.Context, slot phase0.Slot, parentHash phase0.Hash32, pubkey phase0.BLSPubKey) (*builderSpec.VersionedSignedBuilderBid, error) {
+	log := m.log.WithFields(logrus.Fields{
+		"method":     "getBestBidForSlot",
+		"slot":       slot,
+		"parentHash": parentHash.String(),
+		"pubkey":     pubkey.String(),
+	})
+
+	result := m.getBestBid(ctx, log, "", nil, uint64(slot), parentHash.String(), pubkey.String())
+	if result.response.IsEmpty() {
+		relayErr := errors.Join(result.relayErrors...)
+		switch {
+		case result.numBelowMinBidValue > 0 && relayErr == nil:
+			return nil, &NoBidAboveMinimumError{MinBidValue: m.minBidValue, NumBids: result.numBelowMinBidValue}
+		case result.numBelowMinBidValue > 0:
+			return nil, fmt.Errorf("%w: %d bids below minimum value %s: %w", errNoBidReceived, result.numBelowMinBidValue, m.minBidValue.Dec(), relayErr)
+		case relayErr != nil:
+			return nil, fmt.Errorf("%w: %w", errNoBidReceived, relayErr)
+		}
+		return nil, errNoBidReceived
+	}
+
+	return &result.response, nil
+}
+
+// GetAuditableProof requests from all relays their signed attestation that the payload they delivered for the slot,
+// with the given block hash, includes the constraints they received. It returns the attestation of the first relay,
+// in relay order, which sent one matching the payload and signed with its key.
+func (m *BoostService) GetAuditableProof(ctx context.Context, slot phase0.Slot, blockHash phase0.Hash32) (*SignedPayloadAttestation, error) {
+	log := m.log.WithFields(logrus.Fields{
+		"method":    "getAuditableProof",
+		"slot":      slot,
+		"blockHash": blockHash.String(),
+	})
+
+	relays := m.getRelays()
+	relayAttestations := make([]*SignedPayloadAttestation, len(relays))
+	var wg sync.WaitGroup
+	for i, relay := range relays {
+		wg.Add(1)
+		go func(i int, relay RelayEntry) {
+			defer wg.Done()
+			url := fmt.Sprintf("%s?slot=%d&block_hash=%s", relay.GetURI(pathPayloadAttestation), slot, blockHash)
+			log := log.WithField("url", url)
+
+			responsePayload := new(SignedPayloadAttestation)
+			_, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientGetPayload, relay), http.MethodGet, url, "", nil, nil, responsePayload)
+			if err != nil {
+				log.WithError(err).Warn("error getting payload attestation from relay")
+				return
+			}
+			if err := m.verifyPayloadAttestation(responsePayload, relay, slot, blockHash); err != nil {
+				log.WithError(err).Warn("invalid payload attestation from relay")
+				return
+			}
+			relayAttestations[i] = responsePayload
+		}(i, relay)
+	}
+
+	wg.Wait()
+
+	for _, attestation := range relayAttestations {
+		if attestation != nil {
+			return attestation, nil
+		}
+	}
+	return nil, errNoSuccessfulRelayResponse
+}
+
+// verifyPayloadAttestation returns an error if the attestation is not for the given payload, or not signed by the relay
+func (m *BoostService) verifyPayloadAttestation(attestation *SignedPayloadAttestation, relay RelayEntry, slot phase0.Slot, blockHash phase0.Hash32) error {
+	if attestation.Message.Slot != uint64(slot) || attestation.Message.BlockHash != blockHash {
+		return fmt.Errorf("%w: slot %d, block hash %s", errAttestationMismatch, attestation.Message.Slot, attestation.Message.BlockHash)
+	}
+	ok, err := ssz.VerifySignature(&attestation.Message, m.builderSigningDomain, relay.PublicKey[:], attestation.Signature[:])
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errInvalidAttestation
+	}
+	return nil
+}
+
+// waitForFirstBidInterval is the interval at which WaitForFirstBid polls the relays
+const waitForFirstBidInterval = 50 * time.Millisecond
+
+// WaitForFirstBid polls GetBestBidForSlot until a relay returns a bid for the given slot, or the context expires.
+// It takes the parent hash and proposer public key along with the slot, since the relays need both to return
+// a bid, and the service doesn't know them before the beacon node requests the header.
+func (m *BoostService) WaitForFirstBid(ctx context.Context, slot phase0.Slot, parentHash phase0.Hash32, pubkey phase0.BLSPubKey) (*builderSpec.VersionedSignedBuilderBid, error) {
+	ticker := time.NewTicker(waitForFirstBidInterval)
+	defer ticker.Stop()
+
+	for {
+		bid, err := m.GetBestBidForSlot(ctx, slot, parentHash, pubkey)
+		if err == nil {
+			return bid, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-ticker.C:
+		}
+	}
+}
+
 func (m *BoostService) processCapellaPayload(w http.ResponseWriter, req *http.Request, log *logrus.Entry, payload *eth2ApiV1Capella.SignedBlindedBeaconBlock, body []byte) {
 	if payload.Message == nil || payload.Message.Body == nil || payload.Message.Body.ExecutionPayloadHeader == nil {
 		log.WithField("body", string(body)).Error("missing parts of the request payload from the beacon-node")
@@ -951,7 +2035,7 @@ func (m *BoostService) processCapellaPayload(w http.ResponseWriter, req *http.Re
 
 	// Log how late into the slot the request starts
 	slotStartTimestamp := m.genesisTime + uint64(payload.Message.Slot)*config.SlotTimeSec
-	msIntoSlot := uint64(time.Now().UTC().UnixMilli()) - slotStartTimestamp*1000
+	msIntoSlot := uint64(m.now().UTC().UnixMilli()) - slotStartTimestamp*1000
 	log.WithFields(logrus.Fields{
 		"genesisTime": m.genesisTime,
 		"slotTimeSec": config.SlotTimeSec,
@@ -984,7 +2068,7 @@ func (m *BoostService) processCapellaPayload(w http.ResponseWriter, req *http.Re
 	requestCtx, requestCtxCancel := context.WithCancel(context.Background())
 	defer requestCtxCancel()
 
-	for _, relay := range m.relays {
+	for _, relay := range m.getRelays() {
 		wg.Add(1)
 		go func(relay RelayEntry) {
 			defer wg.Done()
@@ -993,7 +2077,7 @@ func (m *BoostService) processCapellaPayload(w http.ResponseWriter, req *http.Re
 			log.Debug("calling getPayload")
 
 			responsePayload := new(builderApi.VersionedSubmitBlindedBlockResponse)
-			_, err := SendHTTPRequestWithRetries(requestCtx, m.httpClientGetPayload, http.MethodPost, url, ua, headers, payload, responsePayload, m.requestMaxRetries, log)
+			_, err := SendHTTPRequestWithRetries(requestCtx, m.relayHTTPClient(m.httpClientGetPayload, relay), http.MethodPost, url, ua, headers, payload, responsePayload, m.requestMaxRetries, log)
 			if err != nil {
 				if errors.Is(requestCtx.Err(), context.Canceled) {
 					log.Info("request was cancelled") // this is expected, if payload has already been received by another relay
@@ -1042,6 +2126,12 @@ func (m *BoostService) processCapellaPayload(w http.ResponseWriter, req *http.Re
 			requestCtxCancel()
 			*result = *responsePayload
 			log.Info("received payload from relay")
+			m.recordAuditEntry(AuditEntry{
+				EventType: AuditEventPayloadUnblinded,
+				Slot:      uint64(payload.Message.Slot),
+				RelayURL:  relay.String(),
+				BlockHash: responsePayload.Capella.BlockHash.String(),
+			})
 		}(relay)
 	}
 
@@ -1056,6 +2146,9 @@ func (m *BoostService) processCapellaPayload(w http.ResponseWriter, req *http.Re
 		return
 	}
 
+	m.checkPayloadConstraints(log, payload.Message.Slot, result.Capella.Transactions)
+	m.storeConstraintEvidence(log, payload.Message.Slot, result.Capella.BlockHash, originalBid.proofs, result.Capella.Transactions)
+
 	m.respondOK(w, result)
 }
 
@@ -1082,7 +2175,7 @@ func (m *BoostService) processDenebPayload(w http.ResponseWriter, req *http.Requ
 
 	// Log how late into the slot the request starts
 	slotStartTimestamp := m.genesisTime + uint64(blindedBlock.Message.Slot)*config.SlotTimeSec
-	msIntoSlot := uint64(time.Now().UTC().UnixMilli()) - slotStartTimestamp*1000
+	msIntoSlot := uint64(m.now().UTC().UnixMilli()) - slotStartTimestamp*1000
 	log.WithFields(logrus.Fields{
 		"genesisTime": m.genesisTime,
 		"slotTimeSec": config.SlotTimeSec,
@@ -1112,7 +2205,7 @@ func (m *BoostService) processDenebPayload(w http.ResponseWriter, req *http.Requ
 	requestCtx, requestCtxCancel := context.WithCancel(context.Background())
 	defer requestCtxCancel()
 
-	for _, relay := range m.relays {
+	for _, relay := range m.getRelays() {
 		wg.Add(1)
 		go func(relay RelayEntry) {
 			defer wg.Done()
@@ -1121,7 +2214,7 @@ func (m *BoostService) processDenebPayload(w http.ResponseWriter, req *http.Requ
 			log.Debug("calling getPayload")
 
 			responsePayload := new(builderApi.VersionedSubmitBlindedBlockResponse)
-			_, err := SendHTTPRequestWithRetries(requestCtx, m.httpClientGetPayload, http.MethodPost, url, ua, headers, blindedBlock, responsePayload, m.requestMaxRetries, log)
+			_, err := SendHTTPRequestWithRetries(requestCtx, m.relayHTTPClient(m.httpClientGetPayload, relay), http.MethodPost, url, ua, headers, blindedBlock, responsePayload, m.requestMaxRetries, log)
 			if err != nil {
 				if errors.Is(requestCtx.Err(), context.Canceled) {
 					log.Info("request was cancelled") // this is expected, if payload has already been received by another relay
@@ -1147,6 +2240,12 @@ func (m *BoostService) processDenebPayload(w http.ResponseWriter, req *http.Requ
 				return
 			}
 
+			// Ensure that the blobs bundle is consistent
+			if err := validateBlobsBundle(blobs); err != nil {
+				log.WithError(err).Error("response blobs bundle is invalid")
+				return
+			}
+
 			commitments := blindedBlock.Message.Body.BlobKZGCommitments
 			// Ensure that blobs are valid and matches the request
 			if len(commitments) != len(blobs.Blobs) || len(commitments) != len(blobs.Commitments) || len(commitments) != len(blobs.Proofs) {
@@ -1182,6 +2281,12 @@ func (m *BoostService) processDenebPayload(w http.ResponseWriter, req *http.Requ
 			requestCtxCancel()
 			*result = *responsePayload
 			log.Info("received payload from relay")
+			m.recordAuditEntry(AuditEntry{
+				EventType: AuditEventPayloadUnblinded,
+				Slot:      uint64(blindedBlock.Message.Slot),
+				RelayURL:  relay.String(),
+				BlockHash: responsePayload.Deneb.ExecutionPayload.BlockHash.String(),
+			})
 		}(relay)
 	}
 
@@ -1196,9 +2301,47 @@ func (m *BoostService) processDenebPayload(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
+	m.checkPayloadConstraints(log, blindedBlock.Message.Slot, result.Deneb.ExecutionPayload.Transactions)
+	m.storeConstraintEvidence(log, blindedBlock.Message.Slot, result.Deneb.ExecutionPayload.BlockHash, originalBid.proofs, result.Deneb.ExecutionPayload.Transactions)
+
 	m.respondOK(w, result)
 }
 
+// OnPayloadReceived registers a callback which is invoked after every successful getPayload for a slot with
+// constraints, with the constrained transactions missing from the payload (if any). The callback runs before
+// the payload is returned to the beacon node, so it should not block.
+func (m *BoostService) OnPayloadReceived(callback func(slot phase0.Slot, missingTxs []Transaction)) {
+	m.onPayloadReceivedLock.Lock()
+	defer m.onPayloadReceivedLock.Unlock()
+	m.onPayloadReceived = callback
+}
+
+// BOLT: checkPayloadConstraints verifies that the payload received for the slot includes all the
+// constrained transactions, and notifies the OnPayloadReceived callback
+func (m *BoostService) checkPayloadConstraints(log *logrus.Entry, slot phase0.Slot, txs []bellatrix.Transaction) {
+	missingTxs, exists := m.constraints.MissingTransactions(uint64(slot), txs)
+	if !exists && m.restoreConstraintState(uint64(slot)) {
+		missingTxs, exists = m.constraints.MissingTransactions(uint64(slot), txs)
+	}
+	if !exists {
+		return
+	}
+	// The payload of the slot was delivered, its constraints don't need to survive a restart anymore
+	if err := m.stateStore.DeleteConstraints(uint64(slot)); err != nil {
+		log.WithError(err).Error("[BOLT]: error deleting constraints from the state store")
+	}
+	if len(missingTxs) > 0 {
+		log.Warnf("[BOLT]: payload is missing %d constrained transactions", len(missingTxs))
+	}
+
+	m.onPayloadReceivedLock.Lock()
+	callback := m.onPayloadReceived
+	m.onPayloadReceivedLock.Unlock()
+	if callback != nil {
+		callback(slot, missingTxs)
+	}
+}
+
 // handleGetPayload submits a signed blinded header to receive the payload body from the relays.
 // BOLT: when receiving the payload, we also remove the associated constraints for this slot.
 func (m *BoostService) handleGetPayload(w http.ResponseWriter, req *http.Request) {
@@ -1236,7 +2379,7 @@ func (m *BoostService) CheckRelays() int {
 	var wg sync.WaitGroup
 	var numSuccessRequestsToRelay uint32
 
-	for _, r := range m.relays {
+	for _, r := range m.getRelays() {
 		wg.Add(1)
 
 		go func(relay RelayEntry) {
@@ -1245,7 +2388,7 @@ func (m *BoostService) CheckRelays() int {
 			log := m.log.WithField("url", url)
 			log.Debug("checking relay status")
 
-			code, err := SendHTTPRequest(context.Background(), m.httpClientGetHeader, http.MethodGet, url, "", nil, nil, nil)
+			code, err := SendHTTPRequest(context.Background(), m.relayHTTPClient(m.httpClientGetHeader, relay), http.MethodGet, url, "", nil, nil, nil)
 			if err != nil {
 				log.WithError(err).Error("relay status error - request failed")
 				return
@@ -1266,3 +2409,52 @@ func (m *BoostService) CheckRelays() int {
 	wg.Wait()
 	return int(numSuccessRequestsToRelay)
 }
+
+// RelayHealth is the result of the health check of a relay
+type RelayHealth struct {
+	Relay     RelayEntry
+	Healthy   bool
+	Latency   time.Duration // latency of the status request, even if it failed
+	LastError error
+}
+
+// HealthReport is the result of HealthCheck, with an entry per relay in the configured order
+type HealthReport struct {
+	Relays []RelayHealth
+}
+
+// HealthCheck calls the status endpoint of every relay concurrently, and reports which relays responded in time
+// (per the context deadline) and how fast
+func (m *BoostService) HealthCheck(ctx context.Context) HealthReport {
+	relays := m.getRelays()
+	report := HealthReport{Relays: make([]RelayHealth, len(relays))}
+
+	var wg sync.WaitGroup
+	for i, relay := range relays {
+		wg.Add(1)
+		go func(i int, relay RelayEntry) {
+			defer wg.Done()
+			url := relay.GetURI(pathStatus)
+			log := m.log.WithField("url", url)
+
+			start := m.now()
+			code, err := SendHTTPRequest(ctx, m.relayHTTPClient(m.httpClientGetHeader, relay), http.MethodGet, url, "", nil, nil, nil)
+			if err == nil && code != http.StatusOK {
+				err = fmt.Errorf("%w: %d", errHTTPErrorResponse, code)
+			}
+			if err != nil {
+				log.WithError(err).Warn("relay health check failed")
+			}
+
+			report.Relays[i] = RelayHealth{
+				Relay:     relay,
+				Healthy:   err == nil,
+				Latency:   m.now().Sub(start),
+				LastError: err,
+			}
+		}(i, relay)
+	}
+
+	wg.Wait()
+	return report
+}
@@ -1,9 +1,11 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"math"
 	"net/http"
@@ -11,6 +13,7 @@ import (
 	"net/url"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -28,7 +31,10 @@ import (
 	"github.com/attestantio/go-eth2-client/spec/phase0"
 	eth2UtilBellatrix "github.com/attestantio/go-eth2-client/util/bellatrix"
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/flashbots/go-boost-utils/bls"
+	"github.com/flashbots/go-boost-utils/ssz"
 	"github.com/flashbots/go-boost-utils/types"
+	"github.com/flashbots/mev-boost/config"
 	"github.com/holiman/uint256"
 	"github.com/prysmaticlabs/go-bitfield"
 	"github.com/stretchr/testify/require"
@@ -40,7 +46,7 @@ type testBackend struct {
 }
 
 // newTestBackend creates a new backend, initializes mock relays, registers them and return the instance
-func newTestBackend(t *testing.T, numRelays int, relayTimeout time.Duration) *testBackend {
+func newTestBackend(t *testing.T, numRelays int, relayTimeout time.Duration, options ...BoostServiceOption) *testBackend {
 	t.Helper()
 	backend := testBackend{
 		relays: make([]*mockRelay, numRelays),
@@ -48,8 +54,15 @@ func newTestBackend(t *testing.T, numRelays int, relayTimeout time.Duration) *te
 
 	relayEntries := make([]RelayEntry, numRelays)
 	for i := 0; i < numRelays; i++ {
-		// Create a mock relay
-		backend.relays[i] = newMockRelay(t)
+		// Create a mock relay. Every relay but the first one gets its own key pair, since relays
+		// with duplicate public keys are rejected by the service.
+		if i == 0 {
+			backend.relays[i] = newMockRelay(t)
+		} else {
+			secretKey, _, err := bls.GenerateNewKeypair()
+			require.NoError(t, err)
+			backend.relays[i] = newMockRelayWithSecretKey(t, secretKey)
+		}
 		relayEntries[i] = backend.relays[i].RelayEntry
 	}
 
@@ -65,8 +78,11 @@ func newTestBackend(t *testing.T, numRelays int, relayTimeout time.Duration) *te
 		RequestTimeoutRegVal:           relayTimeout,
 		RequestTimeoutSubmitConstraint: relayTimeout,
 		RequestMaxRetries:              5,
+		// The current slot is 0 until the genesis, so that the tests can submit constraints for any slot
+		GenesisTime: uint64(time.Now().Add(24 * time.Hour).Unix()),
 	}
-	service, err := NewBoostService(opts)
+	options = append([]BoostServiceOption{WithMaxFutureSlots(math.MaxUint64)}, options...)
+	service, err := NewBoostService(opts, options...)
 	require.NoError(t, err)
 
 	backend.boost = service
@@ -167,6 +183,149 @@ func TestNewBoostServiceErrors(t *testing.T) {
 	})
 }
 
+func TestValidateRelayList(t *testing.T) {
+	pubkey1, pubkey2, pubkey3, pubkey4 := phase0.BLSPubKey{0x01}, phase0.BLSPubKey{0x02}, phase0.BLSPubKey{0x03}, phase0.BLSPubKey{0x04}
+	relayA, err := NewRelayEntry(fmt.Sprintf("http://%s@relay-a.com", pubkey1.String()))
+	require.NoError(t, err)
+	relayB, err := NewRelayEntry(fmt.Sprintf("http://%s@relay-b.com", pubkey2.String()))
+	require.NoError(t, err)
+	relayC, err := NewRelayEntry(fmt.Sprintf("http://%s@relay-c.com", pubkey3.String()))
+	require.NoError(t, err)
+	relayAAlias, err := NewRelayEntry(fmt.Sprintf("http://%s@relay-a-alias.com", pubkey1.String()))
+	require.NoError(t, err)
+	relayBOtherKey, err := NewRelayEntry(fmt.Sprintf("http://%s@relay-b.com", pubkey4.String()))
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name   string
+		relays []RelayEntry
+
+		expectedErr      bool
+		expectedInErrMsg []string
+	}{
+		{
+			name:   "No duplicates",
+			relays: []RelayEntry{relayA, relayB, relayC},
+		},
+		{
+			name:             "One duplicate public key",
+			relays:           []RelayEntry{relayA, relayB, relayAAlias},
+			expectedErr:      true,
+			expectedInErrMsg: []string{relayA.PublicKey.String()},
+		},
+		{
+			name:             "Multiple duplicates",
+			relays:           []RelayEntry{relayA, relayB, relayAAlias, relayBOtherKey, relayC},
+			expectedErr:      true,
+			expectedInErrMsg: []string{relayA.PublicKey.String(), "http://relay-b.com"},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			service := &BoostService{relays: tt.relays}
+			err := service.ValidateRelayList()
+			if !tt.expectedErr {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorIs(t, err, errDuplicateRelay)
+			for _, msg := range tt.expectedInErrMsg {
+				require.Contains(t, err.Error(), msg)
+			}
+		})
+	}
+
+	t.Run("NewBoostService rejects duplicate relays", func(t *testing.T) {
+		_, err := NewBoostService(BoostServiceOpts{
+			Log:                   testLog,
+			Relays:                []RelayEntry{relayA, relayAAlias},
+			GenesisForkVersionHex: "0x00000000",
+		})
+		require.ErrorIs(t, err, errDuplicateRelay)
+	})
+}
+
+func TestForceRelayRefresh(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	slot := phase0.Slot(1)
+	path := getHeaderWithProofsPath(uint64(slot), parentHash, pubkey)
+
+	// setBid makes the relay send a valid bid, the default response has no transactions and is ignored
+	setBid := func(relay *mockRelay) {
+		relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			12345, "0x534809bd2b6832edff8d8ce4cb0e50068804fd1ef432c8362ad708a74fdc0e46", parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+	}
+	newBackend := func(t *testing.T, options ...BoostServiceOption) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 2, time.Second, options...)
+		for _, relay := range backend.relays {
+			setBid(relay)
+		}
+		return backend
+	}
+	newRelay := func(t *testing.T) *mockRelay {
+		t.Helper()
+		secretKey, _, err := bls.GenerateNewKeypair()
+		require.NoError(t, err)
+		relay := newMockRelayWithSecretKey(t, secretKey)
+		setBid(relay)
+		return relay
+	}
+
+	t.Run("Only the new relays are queried", func(t *testing.T) {
+		backend := newBackend(t)
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+		require.NoError(t, err)
+		require.Equal(t, 1, backend.relays[0].GetRequestCount(path))
+		require.Equal(t, 1, backend.relays[1].GetRequestCount(path))
+
+		added := newRelay(t)
+		relays := []RelayEntry{backend.relays[1].RelayEntry, added.RelayEntry}
+		require.NoError(t, backend.boost.ForceRelayRefresh(relays))
+		require.Equal(t, relays, backend.boost.getRelays())
+
+		_, err = backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+		require.NoError(t, err)
+		require.Equal(t, 1, backend.relays[0].GetRequestCount(path))
+		require.Equal(t, 2, backend.relays[1].GetRequestCount(path))
+		require.Equal(t, 1, added.GetRequestCount(path))
+	})
+
+	t.Run("Invalid relay lists are rejected", func(t *testing.T) {
+		backend := newBackend(t)
+		relays := backend.boost.getRelays()
+
+		require.ErrorIs(t, backend.boost.ForceRelayRefresh(nil), errNoRelays)
+		err := backend.boost.ForceRelayRefresh([]RelayEntry{backend.relays[0].RelayEntry, backend.relays[0].RelayEntry})
+		require.ErrorIs(t, err, errDuplicateRelay)
+		require.Equal(t, relays, backend.boost.getRelays())
+	})
+
+	t.Run("New relays start with a closed circuit", func(t *testing.T) {
+		backend := newBackend(t, WithCircuitBreaker(1, time.Minute, time.Minute))
+		backend.relays[1].RequiredHeader = "X-API-Key"
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+		require.NoError(t, err)
+		require.Equal(t, CircuitOpen, backend.boost.RelayCircuitState(backend.relays[1].RelayEntry))
+
+		added := newRelay(t)
+		require.NoError(t, backend.boost.ForceRelayRefresh([]RelayEntry{backend.relays[1].RelayEntry, added.RelayEntry}))
+
+		// The kept relay keeps its open circuit
+		require.Equal(t, CircuitOpen, backend.boost.RelayCircuitState(backend.relays[1].RelayEntry))
+		require.Equal(t, CircuitClosed, backend.boost.RelayCircuitState(added.RelayEntry))
+
+		_, err = backend.boost.GetBestBidForSlot(context.Background(), slot, parentHash, pubkey)
+		require.NoError(t, err)
+		require.Equal(t, 1, backend.relays[1].GetRequestCount(path))
+		require.Equal(t, 1, added.GetRequestCount(path))
+	})
+}
+
 func TestWebserver(t *testing.T) {
 	t.Run("errors when webserver is already existing", func(t *testing.T) {
 		backend := newTestBackend(t, 1, time.Second)
@@ -193,6 +352,43 @@ func TestWebserver(t *testing.T) {
 	// })
 }
 
+func TestShutdown(t *testing.T) {
+	path := "/eth/v1/builder/validators"
+
+	t.Run("Returns once in-flight requests are done", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		require.NoError(t, backend.boost.Shutdown(context.Background()))
+
+		// New requests are rejected after shutdown
+		rr := backend.request(t, http.MethodPost, path, []builderApiV1.SignedValidatorRegistration{})
+		require.Equal(t, http.StatusServiceUnavailable, rr.Code)
+		require.Equal(t, 0, backend.relays[0].GetRequestCount(path))
+	})
+
+	t.Run("Deadline exceeded with slow relay", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		backend.relays[0].ResponseDelay = 500 * time.Millisecond
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			backend.request(t, http.MethodPost, path, []builderApiV1.SignedValidatorRegistration{})
+		}()
+
+		// Wait for the request to reach the relay
+		require.Eventually(t, func() bool {
+			return backend.relays[0].GetRequestCount(path) == 1
+		}, time.Second, 5*time.Millisecond)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		err := backend.boost.Shutdown(ctx)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+
+		<-done
+	})
+}
+
 func TestWebserverRootHandler(t *testing.T) {
 	backend := newTestBackend(t, 1, time.Second)
 
@@ -348,7 +544,7 @@ func TestConstraintsAndProofs(t *testing.T) {
 			Slot:           slot,
 			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
 		},
-		Signature: _HexToBytes(
+		Signature: _HexToSignature(
 			"0x81510b571e22f89d1697545aac01c9ad0c1e7a3e778b3078bef524efae14990e58a6e960a152abd49de2e18d7fd3081c15d5c25867ccfad3d47beef6b39ac24b6b9fbf2cfa91c88f67aff750438a6841ec9e4a06a94ae41410c4f97b75ab284c"),
 	}}
 
@@ -417,6 +613,266 @@ func TestConstraintsAndProofs(t *testing.T) {
 	})
 }
 
+func TestSubmitConstraintSlotRange(t *testing.T) {
+	currentSlot := uint64(1000)
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+
+	testCases := []struct {
+		name         string
+		slot         uint64
+		expectedCode int
+	}{
+		{
+			name:         "Past slot",
+			slot:         currentSlot - 1,
+			expectedCode: http.StatusBadRequest,
+		},
+		{
+			name:         "Current slot",
+			slot:         currentSlot,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "Max future slot",
+			slot:         currentSlot + 1,
+			expectedCode: http.StatusOK,
+		},
+		{
+			name:         "One slot beyond max future slot",
+			slot:         currentSlot + 2,
+			expectedCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 1, time.Second, WithMaxFutureSlots(1))
+			// Place the clock in the middle of the current slot
+			backend.boost.genesisTime = uint64(time.Now().Unix()) - currentSlot*config.SlotTimeSec - config.SlotTimeSec/2
+
+			payload := BatchedSignedConstraints{&SignedConstraints{
+				Message: ConstraintsMessage{
+					ValidatorIndex: 12345,
+					Slot:           tt.slot,
+					Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+				},
+			}}
+			rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+			require.Equal(t, tt.expectedCode, rr.Code, rr.Body.String())
+
+			if tt.expectedCode == http.StatusOK {
+				require.Equal(t, 1, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+			} else {
+				require.Contains(t, rr.Body.String(), errConstraintSlotOutOfRange.Error())
+				require.Equal(t, 0, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+			}
+		})
+	}
+
+	t.Run("Unknown genesis time", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		backend.boost.genesisTime = 0
+
+		payload := BatchedSignedConstraints{&SignedConstraints{
+			Message: ConstraintsMessage{
+				ValidatorIndex: 12345,
+				Slot:           currentSlot,
+				Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+			},
+		}}
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, http.StatusBadRequest, rr.Code)
+		require.Contains(t, rr.Body.String(), errUnknownGenesisTime.Error())
+		require.Equal(t, 0, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+	})
+}
+
+// fakeClock is a clock source for SetClockSource which only moves when advanced
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestSetClockSource(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	genesisTime := uint64(1_606_824_023)
+	slotDuration := time.Duration(config.SlotTimeSec) * time.Second
+
+	t.Run("Constraint slot range follows the clock", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second, WithMaxFutureSlots(1))
+		backend.boost.genesisTime = genesisTime
+		// In the middle of slot 1000
+		clock := &fakeClock{now: time.Unix(int64(genesisTime), 0).Add(1000*slotDuration + slotDuration/2)}
+		backend.boost.SetClockSource(clock.Now)
+
+		submit := func(slot uint64) int {
+			payload := BatchedSignedConstraints{&SignedConstraints{
+				Message: ConstraintsMessage{
+					ValidatorIndex: 12345,
+					Slot:           slot,
+					Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+				},
+			}}
+			return backend.request(t, http.MethodPost, pathSubmitConstraint, payload).Code
+		}
+
+		require.Equal(t, http.StatusOK, submit(1001))
+		require.Equal(t, http.StatusBadRequest, submit(1002))
+
+		// Two slots later, slot 1001 is in the past and slot 1002 is the current one
+		clock.Advance(2 * slotDuration)
+		require.Equal(t, http.StatusBadRequest, submit(1001))
+		require.Equal(t, http.StatusOK, submit(1002))
+	})
+
+	t.Run("Bids expire from the cache", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		clock := &fakeClock{now: time.Unix(int64(genesisTime), 0)}
+		backend.boost.SetClockSource(clock.Now)
+
+		key := bidRespKey{slot: 1, blockHash: "0x01"}
+		backend.boost.bids[key] = bidResp{t: clock.Now()}
+
+		clock.Advance(bidCacheTTL)
+		backend.boost.removeExpiredBids()
+		require.Contains(t, backend.boost.bids, key)
+
+		clock.Advance(time.Second)
+		backend.boost.removeExpiredBids()
+		require.NotContains(t, backend.boost.bids, key)
+	})
+
+	t.Run("Audit log timestamps", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		clock := &fakeClock{now: time.Unix(int64(genesisTime), 0)}
+		backend.boost.SetClockSource(clock.Now)
+
+		backend.boost.recordAuditEntry(AuditEntry{EventType: AuditEventBid, Slot: 1})
+		clock.Advance(slotDuration)
+		backend.boost.recordAuditEntry(AuditEntry{EventType: AuditEventBid, Slot: 2})
+
+		require.Len(t, backend.boost.auditLog, 2)
+		require.Equal(t, time.Unix(int64(genesisTime), 0).UTC(), backend.boost.auditLog[0].Timestamp)
+		require.Equal(t, time.Unix(int64(genesisTime), 0).Add(slotDuration).UTC(), backend.boost.auditLog[1].Timestamp)
+	})
+
+	t.Run("Circuit breaker open period follows the clock", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second, WithCircuitBreaker(1, time.Minute, time.Minute))
+		clock := &fakeClock{now: time.Unix(int64(genesisTime), 0)}
+		backend.boost.SetClockSource(clock.Now)
+		relay := backend.relays[0].RelayEntry
+
+		backend.boost.circuitBreaker.recordFailure(relay)
+		require.Equal(t, CircuitOpen, backend.boost.RelayCircuitState(relay))
+
+		clock.Advance(time.Minute)
+		require.Equal(t, CircuitHalfOpen, backend.boost.RelayCircuitState(relay))
+	})
+}
+
+func TestSubmitConstraintSuccessStatusCodes(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           8978583,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+
+	testCases := []struct {
+		name       string
+		statusCode int
+	}{
+		{
+			name:       "Relay responds with 200",
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "Relay responds with 204 and no body",
+			statusCode: http.StatusNoContent,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 1, time.Second)
+			backend.relays[0].ConstraintSuccessStatusCode = tt.statusCode
+
+			// The relay answers with the configured status code
+			code, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, backend.relays[0].RelayEntry.GetURI(pathSubmitConstraint), "", nil, payload, nil)
+			require.NoError(t, err)
+			require.Equal(t, tt.statusCode, code)
+
+			// mev-boost treats both as success
+			rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+			require.Equal(t, 2, backend.relays[0].GetRequestCount(pathSubmitConstraint))
+		})
+	}
+}
+
+func TestGetConstraintStatus(t *testing.T) {
+	slot := uint64(8978583)
+	txHash := _HexToHash("0xba40436abdc8adc037e2c92ea1099a5849053510c3911037ff663085ce44bc49")
+	otherTxHash := _HexToHash("0x138a5f8ba7950521d9dec66ee760b101e0c875039e695c9fcfb34f5ef02a881b")
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+
+	t.Run("Acknowledged by one of two relays", func(t *testing.T) {
+		backend := newTestBackend(t, 2, time.Second)
+
+		// The second relay accepts the constraints without storing them
+		backend.relays[1].handlerOverrideSubmitConstraint = func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, http.StatusOK, rr.Code)
+
+		status, err := backend.boost.GetConstraintStatus(context.Background(), phase0.Slot(slot), []phase0.Hash32{txHash, otherTxHash})
+		require.NoError(t, err)
+		require.Equal(t, map[string]bool{backend.relays[0].RelayEntry.String(): true}, status[txHash])
+		require.Empty(t, status[otherTxHash])
+		require.Equal(t, 1, backend.relays[1].GetRequestCount(pathConstraintStatus))
+	})
+
+	t.Run("No constraints for another slot", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+
+		status, err := backend.boost.GetConstraintStatus(context.Background(), phase0.Slot(slot+1), []phase0.Hash32{txHash})
+		require.NoError(t, err)
+		require.Empty(t, status[txHash])
+	})
+
+	t.Run("All relays unavailable", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		backend.relays[0].Server.Close()
+
+		_, err := backend.boost.GetConstraintStatus(context.Background(), phase0.Slot(slot), []phase0.Hash32{txHash})
+		require.ErrorIs(t, err, errNoSuccessfulRelayResponse)
+	})
+}
+
 func getHeaderPath(slot uint64, parentHash phase0.Hash32, pubkey phase0.BLSPubKey) string {
 	return fmt.Sprintf("/eth/v1/builder/header/%d/%s/%s", slot, parentHash.String(), pubkey.String())
 }
@@ -454,6 +910,35 @@ func TestGetHeader(t *testing.T) {
 		require.Equal(t, 1, backend.relays[0].GetRequestCount(path))
 	})
 
+	t.Run("Relay asks to wait for the bid", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		relay := backend.relays[0]
+		relay.WaitForBidMS = 100
+		responses := []*BidWithInclusionProofs{
+			relay.MakeGetHeaderWithProofsResponseWithTxsRoot(12345, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01}),
+			relay.MakeGetHeaderWithProofsResponseWithTxsRoot(12346, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01}),
+		}
+		numRequests := 0
+		relay.overrideHandleGetHeaderWithProofs(func(w http.ResponseWriter, req *http.Request) {
+			relay.GetHeaderWithProofsResponse = responses[numRequests%len(responses)]
+			numRequests++
+			relay.defaultHandleGetHeaderWithProofs(w, req)
+		})
+
+		start := time.Now()
+		rr := backend.request(t, http.MethodGet, path, nil)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+
+		// The bid is requested again after the suggested delay, and the second bid is returned
+		require.Equal(t, 2, relay.GetRequestCount(getHeaderWithProofsPath(1, hash, pubkey)))
+		resp := new(builderSpec.VersionedSignedBuilderBid)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), resp))
+		value, err := resp.Value()
+		require.NoError(t, err)
+		require.Equal(t, uint256.NewInt(12346), value)
+	})
+
 	t.Run("Bad response from relays", func(t *testing.T) {
 		backend := newTestBackend(t, 2, time.Second)
 		resp := backend.relays[0].MakeGetHeaderResponse(
@@ -590,7 +1075,7 @@ func TestGetHeaderBids(t *testing.T) {
 			12347,
 			"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
 			"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
-			"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249",
+			backend.relays[1].RelayEntry.PublicKey.String(),
 			spec.DataVersionCapella,
 		)
 
@@ -599,7 +1084,7 @@ func TestGetHeaderBids(t *testing.T) {
 			12346,
 			"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
 			"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
-			"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249",
+			backend.relays[2].RelayEntry.PublicKey.String(),
 			spec.DataVersionCapella,
 		)
 
@@ -638,7 +1123,7 @@ func TestGetHeaderBids(t *testing.T) {
 			12345,
 			"0xa18385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
 			"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
-			"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249",
+			backend.relays[1].RelayEntry.PublicKey.String(),
 			spec.DataVersionCapella,
 		)
 
@@ -646,7 +1131,7 @@ func TestGetHeaderBids(t *testing.T) {
 			12345,
 			"0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
 			"0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
-			"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249",
+			backend.relays[2].RelayEntry.PublicKey.String(),
 			spec.DataVersionCapella,
 		)
 
@@ -725,6 +1210,58 @@ func TestGetHeaderBids(t *testing.T) {
 	})
 }
 
+func TestGetBestBidForSlotMaxBidValue(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	maxBidValue := uint256.NewInt(20000)
+
+	testCases := []struct {
+		name  string
+		value uint64
+
+		expectedErr error
+	}{
+		{
+			name:  "Bid below the max bid value is accepted",
+			value: 19999,
+		},
+		{
+			name:  "Bid at the max bid value is accepted",
+			value: 20000,
+		},
+		{
+			name:        "Bid above the max bid value is ignored",
+			value:       20001,
+			expectedErr: errNoBidReceived,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 1, time.Second, WithMaxBidValue(maxBidValue))
+			backend.relays[0].GetHeaderWithProofsResponse = backend.relays[0].MakeGetHeaderWithProofsResponseWithTxsRoot(
+				tt.value,
+				"0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+				parentHash.String(),
+				backend.relays[0].RelayEntry.PublicKey.String(),
+				spec.DataVersionCapella,
+				phase0.Root{0x01},
+			)
+
+			bid, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			value, err := bid.Value()
+			require.NoError(t, err)
+			require.Equal(t, uint256.NewInt(tt.value), value)
+		})
+	}
+}
+
 func TestGetPayload(t *testing.T) {
 	path := "/eth/v1/builder/blinded_blocks"
 
@@ -804,7 +1341,7 @@ func TestGetPayload(t *testing.T) {
 		backend.relays[0].handlerOverrideGetPayload = func(w http.ResponseWriter, r *http.Request) {
 			if count > 0 {
 				// success response on the second attempt
-				backend.relays[0].defaultHandleGetPayload(w)
+				backend.relays[0].defaultHandleGetPayload(w, r)
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
 				_, err := w.Write([]byte(`{"code":500,"message":"internal server error"}`))
@@ -826,7 +1363,7 @@ func TestGetPayload(t *testing.T) {
 			count++
 			if count > maxRetries {
 				// success response after max retry attempts
-				backend.relays[0].defaultHandleGetPayload(w)
+				backend.relays[0].defaultHandleGetPayload(w, r)
 			} else {
 				w.WriteHeader(http.StatusInternalServerError)
 				_, err := w.Write([]byte(`{"code":500,"message":"internal server error"}`))
@@ -978,41 +1515,1939 @@ func TestGetPayloadDeneb(t *testing.T) {
 	require.Equal(t, signedBlindedBlock.Message.Body.ExecutionPayloadHeader.BlockHash, resp.Deneb.ExecutionPayload.BlockHash)
 }
 
-func TestGetPayloadToAllRelays(t *testing.T) {
+func TestGetPayloadDenebInconsistentBlobsBundle(t *testing.T) {
 	// Load the signed blinded beacon block used for getPayload
-	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-capella.json")
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-deneb.json")
 	require.NoError(t, err)
 	defer jsonFile.Close()
-	signedBlindedBeaconBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
-	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBeaconBlock))
-
-	// Create a test backend with 2 relays
-	backend := newTestBackend(t, 2, time.Second)
+	signedBlindedBlock := new(eth2ApiV1Deneb.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBlock))
 
-	// call getHeader, highest bid is returned by relay 0
-	getHeaderPath := "/eth/v1/builder/header/12345/0xcf8e0d4e9587369b2301d0790347320302cc0943d5a1884560367e8208d920f2/0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249"
-	backend.relays[0].GetHeaderResponse = backend.relays[0].MakeGetHeaderResponse(
-		12345,
-		"0xcf8e0d4e9587369b2301d0790347320302cc0943d5a1884560367e8208d920f2",
-		"0xcf8e0d4e9587369b2301d0790347320302cc0943d5a1884560367e8208d920f2",
-		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249",
-		spec.DataVersionCapella,
-	)
-	rr := backend.request(t, http.MethodGet, getHeaderPath, nil)
-	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
-	require.Equal(t, 1, backend.relays[0].GetRequestCount(getHeaderPath))
-	require.Equal(t, 1, backend.relays[1].GetRequestCount(getHeaderPath))
+	backend := newTestBackend(t, 1, time.Second)
 
-	// Prepare getPayload response
+	// Prepare getPayload response with a KZG proof missing
+	payload := blindedBlockContentsToPayloadDeneb(signedBlindedBlock)
+	payload.BlobsBundle.Proofs = payload.BlobsBundle.Proofs[1:]
 	backend.relays[0].GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
-		Version: spec.DataVersionCapella,
-		Capella: blindedBlockToExecutionPayloadCapella(signedBlindedBeaconBlock),
+		Version: spec.DataVersionDeneb,
+		Deneb:   payload,
 	}
 
-	// call getPayload, ensure it's called to all relays
 	getPayloadPath := "/eth/v1/builder/blinded_blocks"
-	rr = backend.request(t, http.MethodPost, getPayloadPath, signedBlindedBeaconBlock)
-	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	rr := backend.request(t, http.MethodPost, getPayloadPath, signedBlindedBlock)
 	require.Equal(t, 1, backend.relays[0].GetRequestCount(getPayloadPath))
-	require.Equal(t, 1, backend.relays[1].GetRequestCount(getPayloadPath))
+	require.Equal(t, `{"code":502,"message":"no successful relay response"}`+"\n", rr.Body.String())
+	require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+}
+
+func TestGetPayloadWithdrawnBid(t *testing.T) {
+	// Load the signed blinded beacon block used for getPayload
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-capella.json")
+	require.NoError(t, err)
+	defer jsonFile.Close()
+	signedBlindedBeaconBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBeaconBlock))
+	slot := uint64(signedBlindedBeaconBlock.Message.Slot)
+
+	setup := func(t *testing.T) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 2, time.Second)
+		for _, relay := range backend.relays {
+			relay.GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
+				Version: spec.DataVersionCapella,
+				Capella: blindedBlockToExecutionPayloadCapella(signedBlindedBeaconBlock),
+			}
+		}
+		return backend
+	}
+
+	t.Run("Relay responds with bid withdrawn", func(t *testing.T) {
+		relay := newMockRelay(t)
+		relay.WithdrawBidForSlot(slot)
+
+		code, err := SendHTTPRequest(context.Background(), *http.DefaultClient, http.MethodPost, relay.RelayEntry.GetURI(pathGetPayload), "", nil, signedBlindedBeaconBlock, nil)
+		require.Equal(t, http.StatusBadRequest, code)
+		require.ErrorContains(t, err, `{"error":"bid withdrawn"}`)
+	})
+
+	t.Run("Other slots are not affected", func(t *testing.T) {
+		backend := setup(t)
+		backend.relays[0].WithdrawBidForSlot(slot + 1)
+		backend.relays[1].WithdrawBidForSlot(slot + 1)
+
+		rr := backend.request(t, http.MethodPost, pathGetPayload, signedBlindedBeaconBlock)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	})
+
+	t.Run("Falls back to the relay which did not withdraw", func(t *testing.T) {
+		backend := setup(t)
+		backend.relays[0].WithdrawBidForSlot(slot)
+
+		rr := backend.request(t, http.MethodPost, pathGetPayload, signedBlindedBeaconBlock)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, 1, backend.relays[1].GetRequestCount(pathGetPayload))
+
+		resp := new(builderApi.VersionedSubmitBlindedBlockResponse)
+		require.NoError(t, json.Unmarshal(rr.Body.Bytes(), resp))
+		require.Equal(t, signedBlindedBeaconBlock.Message.Body.ExecutionPayloadHeader.BlockHash, resp.Capella.BlockHash)
+	})
+
+	t.Run("Fails if all relays withdrew", func(t *testing.T) {
+		backend := setup(t)
+		backend.relays[0].WithdrawBidForSlot(slot)
+		backend.relays[1].WithdrawBidForSlot(slot)
+
+		rr := backend.request(t, http.MethodPost, pathGetPayload, signedBlindedBeaconBlock)
+		require.Equal(t, http.StatusBadGateway, rr.Code, rr.Body.String())
+	})
+}
+
+func TestGetPayloadToAllRelays(t *testing.T) {
+	// Load the signed blinded beacon block used for getPayload
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-capella.json")
+	require.NoError(t, err)
+	defer jsonFile.Close()
+	signedBlindedBeaconBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBeaconBlock))
+
+	// Create a test backend with 2 relays
+	backend := newTestBackend(t, 2, time.Second)
+
+	// call getHeader, highest bid is returned by relay 0
+	getHeaderPath := "/eth/v1/builder/header/12345/0xcf8e0d4e9587369b2301d0790347320302cc0943d5a1884560367e8208d920f2/0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249"
+	backend.relays[0].GetHeaderResponse = backend.relays[0].MakeGetHeaderResponse(
+		12345,
+		"0xcf8e0d4e9587369b2301d0790347320302cc0943d5a1884560367e8208d920f2",
+		"0xcf8e0d4e9587369b2301d0790347320302cc0943d5a1884560367e8208d920f2",
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249",
+		spec.DataVersionCapella,
+	)
+	rr := backend.request(t, http.MethodGet, getHeaderPath, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, 1, backend.relays[0].GetRequestCount(getHeaderPath))
+	require.Equal(t, 1, backend.relays[1].GetRequestCount(getHeaderPath))
+
+	// Prepare getPayload response
+	backend.relays[0].GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
+		Version: spec.DataVersionCapella,
+		Capella: blindedBlockToExecutionPayloadCapella(signedBlindedBeaconBlock),
+	}
+
+	// call getPayload, ensure it's called to all relays
+	getPayloadPath := "/eth/v1/builder/blinded_blocks"
+	rr = backend.request(t, http.MethodPost, getPayloadPath, signedBlindedBeaconBlock)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, 1, backend.relays[0].GetRequestCount(getPayloadPath))
+	require.Equal(t, 1, backend.relays[1].GetRequestCount(getPayloadPath))
+}
+
+func TestGetBestBidForSlotLatencyPreference(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	// The fast relay sends the bid with the higher block hash, so it only wins with the latency tiebreaker
+	fastBlockHash := "0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	slowBlockHash := "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+
+	testCases := []struct {
+		name    string
+		options []BoostServiceOption
+
+		expectedBlockHash string
+	}{
+		{
+			name:              "Without latency preference the lowest block hash wins",
+			expectedBlockHash: slowBlockHash,
+		},
+		{
+			name:              "With latency preference the fastest relay wins",
+			options:           []BoostServiceOption{WithLatencyPreference()},
+			expectedBlockHash: fastBlockHash,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 2, time.Second, tt.options...)
+			fastRelay, slowRelay := backend.relays[0], backend.relays[1]
+			slowRelay.ResponseDelay = 100 * time.Millisecond
+
+			fastRelay.GetHeaderWithProofsResponse = fastRelay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				12345, fastBlockHash, parentHash.String(), fastRelay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			)
+			slowRelay.GetHeaderWithProofsResponse = slowRelay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				12345, slowBlockHash, parentHash.String(), slowRelay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			)
+
+			bid, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+			require.NoError(t, err)
+			blockHash, err := bid.BlockHash()
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedBlockHash, blockHash.String())
+		})
+	}
+}
+
+func TestGetBestBidForSlotCircuitBreaker(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	path := getHeaderWithProofsPath(1, parentHash, pubkey)
+
+	setup := func(t *testing.T, openDuration time.Duration) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 1, time.Second, WithCircuitBreaker(3, time.Minute, openDuration))
+		relay := backend.relays[0]
+		relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			12345, "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7", parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+		relay.handlerOverrideGetHeaderWithProofs = func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+
+		// Trip the circuit
+		for i := 0; i < 3; i++ {
+			require.Equal(t, CircuitClosed, backend.boost.RelayCircuitState(relay.RelayEntry))
+			_, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+			require.ErrorIs(t, err, errNoBidReceived)
+		}
+		require.Equal(t, CircuitOpen, backend.boost.RelayCircuitState(relay.RelayEntry))
+		require.Equal(t, 3, relay.GetRequestCount(path))
+		return backend
+	}
+
+	t.Run("Relay is skipped while the circuit is open", func(t *testing.T) {
+		backend := setup(t, time.Minute)
+		relay := backend.relays[0]
+		relay.overrideHandleGetHeaderWithProofs(nil)
+
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Equal(t, 3, relay.GetRequestCount(path))
+		require.Equal(t, CircuitOpen, backend.boost.RelayCircuitState(relay.RelayEntry))
+	})
+
+	t.Run("Successful trial request closes the circuit", func(t *testing.T) {
+		backend := setup(t, 50*time.Millisecond)
+		relay := backend.relays[0]
+		relay.overrideHandleGetHeaderWithProofs(nil)
+
+		time.Sleep(60 * time.Millisecond)
+		require.Equal(t, CircuitHalfOpen, backend.boost.RelayCircuitState(relay.RelayEntry))
+
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+		require.NoError(t, err)
+		require.Equal(t, 4, relay.GetRequestCount(path))
+		require.Equal(t, CircuitClosed, backend.boost.RelayCircuitState(relay.RelayEntry))
+	})
+
+	t.Run("Failed trial request opens the circuit again", func(t *testing.T) {
+		backend := setup(t, 50*time.Millisecond)
+		relay := backend.relays[0]
+
+		time.Sleep(60 * time.Millisecond)
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Equal(t, 4, relay.GetRequestCount(path))
+		require.Equal(t, CircuitOpen, backend.boost.RelayCircuitState(relay.RelayEntry))
+	})
+}
+
+func TestBestBidStats(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	backend := newTestBackend(t, 3, time.Second)
+	require.Empty(t, backend.boost.BestBidStats())
+
+	// The third relay never sends a valid bid
+	backend.relays[2].overrideHandleGetHeaderWithProofs(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	relayValues := [][]uint64{
+		{20000, 40000, 30000},
+		{50000, 50000, 50001},
+	}
+	for round := 0; round < 3; round++ {
+		for i, values := range relayValues {
+			relay := backend.relays[i]
+			relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				values[round], "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7", parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			)
+		}
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), phase0.Slot(round+1), parentHash, pubkey)
+		require.NoError(t, err)
+	}
+
+	stats := backend.boost.BestBidStats()
+	require.Len(t, stats, 2)
+	require.Equal(t, BidStats{
+		Min:   uint256.NewInt(20000),
+		Max:   uint256.NewInt(40000),
+		Mean:  uint256.NewInt(30000),
+		Count: uint256.NewInt(3),
+	}, stats[backend.relays[0].RelayEntry])
+	require.Equal(t, BidStats{
+		Min:   uint256.NewInt(50000),
+		Max:   uint256.NewInt(50001),
+		Mean:  uint256.NewInt(50000),
+		Count: uint256.NewInt(3),
+	}, stats[backend.relays[1].RelayEntry])
+}
+
+func TestEmitMetricsSummary(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	backend := newTestBackend(t, 2, time.Second)
+
+	// The first relay is slow, and the second one always fails
+	backend.relays[0].ResponseDelay = 20 * time.Millisecond
+	backend.relays[1].overrideHandleGetHeaderWithProofs(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+
+	for round, value := range []uint64{20000, 40000, 30000} {
+		relay := backend.relays[0]
+		relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			value, "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7", parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+		_, err := backend.boost.GetBestBidForSlot(context.Background(), phase0.Slot(round+1), parentHash, pubkey)
+		require.NoError(t, err)
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, backend.boost.EmitMetricsSummary(&out))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, []string{"RELAY", "REQUESTS", "ERRORS", "AVG", "LATENCY", "BEST", "BID", "CIRCUIT"}, strings.Fields(lines[0]))
+
+	// RELAY, REQUESTS, ERRORS, AVG LATENCY, BEST BID, CIRCUIT
+	row := strings.Fields(lines[1])
+	require.Len(t, row, 6)
+	require.Equal(t, backend.relays[0].RelayEntry.String(), row[0])
+	require.Equal(t, "3", row[1])
+	require.Equal(t, "0", row[2])
+	latency, err := time.ParseDuration(row[3])
+	require.NoError(t, err)
+	require.GreaterOrEqual(t, latency, 20*time.Millisecond)
+	require.Less(t, latency, time.Second)
+	require.Equal(t, "0.000000000000040000", row[4])
+	require.Equal(t, "closed", row[5])
+
+	row = strings.Fields(lines[2])
+	require.Len(t, row, 6)
+	require.Equal(t, backend.relays[1].RelayEntry.String(), row[0])
+	require.Equal(t, "3", row[1])
+	require.Equal(t, "3", row[2])
+	_, err = time.ParseDuration(row[3])
+	require.NoError(t, err)
+	require.Equal(t, "-", row[4])
+	require.Equal(t, "closed", row[5])
+}
+
+func TestGetHeaderSSZ(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	blockHash := "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+
+	// Deneb bids aren't covered, because the SSZ encoding of their value panics in go-builder-client v0.4.2
+	backend := newTestBackend(t, 1, time.Second)
+	backend.boost.sszPreferred = true
+	relay := backend.relays[0]
+	relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+		12345, blockHash, hash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+	)
+
+	var contentType string
+	relay.overrideHandleGetHeaderWithProofs(func(w http.ResponseWriter, req *http.Request) {
+		rec := httptest.NewRecorder()
+		relay.defaultHandleGetHeaderWithProofs(rec, req)
+		contentType = rec.Header().Get("Content-Type")
+		for key, values := range rec.Header() {
+			w.Header()[key] = values
+		}
+		w.WriteHeader(rec.Code)
+		_, _ = w.Write(rec.Body.Bytes())
+	})
+
+	rr := backend.request(t, http.MethodGet, getHeaderPath(1, hash, pubkey), nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, 1, relay.GetRequestCount(getHeaderWithProofsPath(1, hash, pubkey)))
+	require.Equal(t, MediaTypeOctetStream, contentType)
+
+	resp := new(builderSpec.VersionedSignedBuilderBid)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), resp))
+	require.Equal(t, spec.DataVersionCapella, resp.Version)
+	respBlockHash, err := resp.BlockHash()
+	require.NoError(t, err)
+	require.Equal(t, blockHash, respBlockHash.String())
+}
+
+func TestHealthCheck(t *testing.T) {
+	backend := newTestBackend(t, 2, time.Second)
+
+	// The second relay is paused for longer than the health check deadline
+	backend.relays[1].ResponseDelay = 500 * time.Millisecond
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	report := backend.boost.HealthCheck(ctx)
+	require.Len(t, report.Relays, 2)
+
+	healthy := report.Relays[0]
+	require.Equal(t, backend.relays[0].RelayEntry, healthy.Relay)
+	require.True(t, healthy.Healthy)
+	require.NoError(t, healthy.LastError)
+	require.Less(t, healthy.Latency, 100*time.Millisecond)
+
+	unhealthy := report.Relays[1]
+	require.Equal(t, backend.relays[1].RelayEntry, unhealthy.Relay)
+	require.False(t, unhealthy.Healthy)
+	require.ErrorIs(t, unhealthy.LastError, context.DeadlineExceeded)
+	// The request starts a bit after the deadline is set, so it fails slightly before 100ms
+	require.Greater(t, unhealthy.Latency, 50*time.Millisecond)
+}
+
+func TestGetBestBidForSlotMinBidValue(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	blockHashes := []string{
+		"0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+		"0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+		"0xc28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+	}
+	// Relay values: below, at, and above the minimum of 20000
+	relayValues := []uint64{19999, 20000, 20001}
+
+	testCases := []struct {
+		name          string
+		minBidValue   uint64
+		expectedValue uint64
+		expectedErr   *NoBidAboveMinimumError
+	}{
+		{
+			name:          "bid above minimum wins",
+			minBidValue:   20000,
+			expectedValue: 20001,
+		},
+		{
+			name:          "bid at minimum is accepted",
+			minBidValue:   20001,
+			expectedValue: 20001,
+		},
+		{
+			name:        "all bids below minimum",
+			minBidValue: 20002,
+			expectedErr: &NoBidAboveMinimumError{MinBidValue: uint256.NewInt(20002), NumBids: 3},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 3, time.Second, WithMinBidValue(uint256.NewInt(tt.minBidValue)))
+			for i, relay := range backend.relays {
+				relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+					relayValues[i], blockHashes[i], parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+				)
+			}
+
+			bid, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+			if tt.expectedErr != nil {
+				var minErr *NoBidAboveMinimumError
+				require.ErrorAs(t, err, &minErr)
+				require.Equal(t, tt.expectedErr, minErr)
+				require.Nil(t, bid)
+				return
+			}
+			require.NoError(t, err)
+			value, err := bid.Value()
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedValue, value.Uint64())
+		})
+	}
+
+	t.Run("Bids below minimum and failing relay", func(t *testing.T) {
+		backend := newTestBackend(t, 3, time.Second, WithMinBidValue(uint256.NewInt(20002)))
+		for i, relay := range backend.relays[:2] {
+			relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				relayValues[i], blockHashes[i], parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			)
+		}
+		backend.relays[2].overrideHandleGetHeaderWithProofs(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+
+		// The failure is reported along with the bids below the minimum
+		bid, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+		require.Nil(t, bid)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.ErrorIs(t, err, errHTTPErrorResponse)
+		require.Contains(t, err.Error(), "2 bids below minimum value 20002")
+		var minErr *NoBidAboveMinimumError
+		require.False(t, errors.As(err, &minErr))
+	})
+}
+
+func TestWaitForFirstBid(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	blockHash := "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+
+	noBid := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+
+	t.Run("Bid after 100ms", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		relay := backend.relays[0]
+		relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			20000, blockHash, parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+		relay.overrideHandleGetHeaderWithProofs(noBid)
+		time.AfterFunc(100*time.Millisecond, func() {
+			relay.overrideHandleGetHeaderWithProofs(nil)
+		})
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		bid, err := backend.boost.WaitForFirstBid(ctx, 1, parentHash, pubkey)
+		require.NoError(t, err)
+		value, err := bid.Value()
+		require.NoError(t, err)
+		require.Equal(t, uint256.NewInt(20000), value)
+		require.Greater(t, relay.GetRequestCount(getHeaderWithProofsPath(1, parentHash, pubkey)), 1)
+	})
+
+	t.Run("Context expires", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		backend.relays[0].overrideHandleGetHeaderWithProofs(noBid)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		bid, err := backend.boost.WaitForFirstBid(ctx, 1, parentHash, pubkey)
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Nil(t, bid)
+	})
+}
+
+func TestGetBestBidForSlotFallbackRelays(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	blockHashes := []string{
+		"0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+		"0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+		"0xc28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+	}
+	// The fallback relay (the last one) has the highest bid, so its bid wins whenever it is called
+	relayValues := []uint64{20001, 20002, 20003}
+	path := getHeaderWithProofsPath(1, parentHash, pubkey)
+
+	noBid := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+	relayError := func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	// The relay entries are only known once the backend is created, so the options are applied afterwards
+	priorityOptions := map[string]func(relays []*mockRelay) BoostServiceOption{
+		"WithFallbackRelays": func(relays []*mockRelay) BoostServiceOption {
+			return WithFallbackRelays(relays[2].RelayEntry)
+		},
+		"WithPrimaryRelays": func(relays []*mockRelay) BoostServiceOption {
+			return WithPrimaryRelays(relays[0].RelayEntry, relays[1].RelayEntry)
+		},
+	}
+
+	testCases := []struct {
+		name             string
+		primaryOverrides []func(w http.ResponseWriter, req *http.Request)
+		fallbackCalled   bool
+		expectedValue    uint64
+	}{
+		{
+			name:             "Fallback not called if a primary relay delivers a bid",
+			primaryOverrides: []func(w http.ResponseWriter, req *http.Request){relayError, nil},
+			expectedValue:    20002,
+		},
+		{
+			name:             "Fallback called if all primary relays fail",
+			primaryOverrides: []func(w http.ResponseWriter, req *http.Request){relayError, relayError},
+			fallbackCalled:   true,
+			expectedValue:    20003,
+		},
+		{
+			name:             "Fallback called if all primary relays return empty bids",
+			primaryOverrides: []func(w http.ResponseWriter, req *http.Request){noBid, relayError},
+			fallbackCalled:   true,
+			expectedValue:    20003,
+		},
+	}
+
+	for optionName, priorityOption := range priorityOptions {
+		for _, tt := range testCases {
+			t.Run(optionName+"/"+tt.name, func(t *testing.T) {
+				backend := newTestBackend(t, 3, time.Second)
+				priorityOption(backend.relays)(backend.boost)
+				require.NoError(t, backend.boost.validateRelayPriorities())
+
+				for i, relay := range backend.relays {
+					relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+						relayValues[i], blockHashes[i], parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+					)
+				}
+				for i, override := range tt.primaryOverrides {
+					backend.relays[i].overrideHandleGetHeaderWithProofs(override)
+				}
+
+				bid, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+				require.NoError(t, err)
+				value, err := bid.Value()
+				require.NoError(t, err)
+				require.Equal(t, uint256.NewInt(tt.expectedValue), value)
+
+				require.Equal(t, 1, backend.relays[0].GetRequestCount(path))
+				require.Equal(t, 1, backend.relays[1].GetRequestCount(path))
+				expectedFallbackCount := 0
+				if tt.fallbackCalled {
+					expectedFallbackCount = 1
+				}
+				require.Equal(t, expectedFallbackCount, backend.relays[2].GetRequestCount(path))
+			})
+		}
+	}
+
+	t.Run("NewBoostService rejects unknown priority relays", func(t *testing.T) {
+		relay := newMockRelay(t)
+		otherRelay, err := NewRelayEntry("http://0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249@other-relay.com")
+		require.NoError(t, err)
+		_, err = NewBoostService(BoostServiceOpts{
+			Log:                   testLog,
+			Relays:                []RelayEntry{relay.RelayEntry},
+			GenesisForkVersionHex: "0x00000000",
+		}, WithFallbackRelays(otherRelay))
+		require.ErrorIs(t, err, errUnknownPriorityRelay)
+	})
+}
+
+func TestWithRelayTimeout(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	blockHashes := []string{
+		"0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+		"0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+	}
+
+	t.Run("Clients use the relay timeout", func(t *testing.T) {
+		backend := newTestBackend(t, 2, time.Second)
+		WithRelayTimeout(backend.relays[0].RelayEntry, 50*time.Millisecond)(backend.boost)
+
+		clients := []http.Client{
+			backend.boost.httpClientGetHeader,
+			backend.boost.httpClientGetPayload,
+			backend.boost.httpClientRegVal,
+			backend.boost.httpClientSubmitConstraint,
+		}
+		for _, client := range clients {
+			require.Equal(t, 50*time.Millisecond, backend.boost.relayHTTPClient(client, backend.relays[0].RelayEntry).Timeout)
+			require.Equal(t, time.Second, backend.boost.relayHTTPClient(client, backend.relays[1].RelayEntry).Timeout)
+		}
+		// The shared clients are left unchanged
+		require.Equal(t, time.Second, backend.boost.httpClientGetHeader.Timeout)
+	})
+
+	t.Run("Slow relay times out", func(t *testing.T) {
+		backend := newTestBackend(t, 2, time.Second)
+		WithRelayTimeout(backend.relays[0].RelayEntry, 50*time.Millisecond)(backend.boost)
+
+		// The first relay has the highest bid, but is slower than its timeout
+		relayValues := []uint64{20002, 20001}
+		for i, relay := range backend.relays {
+			relay.ResponseDelay = 150 * time.Millisecond
+			relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				relayValues[i], blockHashes[i], parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			)
+		}
+
+		bid, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+		require.NoError(t, err)
+		value, err := bid.Value()
+		require.NoError(t, err)
+		require.Equal(t, uint256.NewInt(20001), value)
+	})
+}
+
+func TestOnPayloadReceived(t *testing.T) {
+	// Load the signed blinded beacon block used for getPayload
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-capella.json")
+	require.NoError(t, err)
+	defer jsonFile.Close()
+	signedBlindedBeaconBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBeaconBlock))
+	slot := signedBlindedBeaconBlock.Message.Slot
+
+	includedTx := _HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765")
+	missingTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+
+	backend := newTestBackend(t, 1, time.Second)
+
+	type callbackArgs struct {
+		slot       phase0.Slot
+		missingTxs []Transaction
+	}
+	calls := make([]callbackArgs, 0)
+	backend.boost.OnPayloadReceived(func(slot phase0.Slot, missingTxs []Transaction) {
+		calls = append(calls, callbackArgs{slot, missingTxs})
+	})
+
+	// Submit the constraints for the slot of the block
+	constraints := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           uint64(slot),
+			Constraints:    []*Constraint{{Transaction(includedTx), nil}, {Transaction(missingTx), nil}},
+		},
+	}}
+	rr := backend.request(t, http.MethodPost, pathSubmitConstraint, constraints)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// The relay returns a payload with only one of the constrained transactions
+	payload := blindedBlockToExecutionPayloadCapella(signedBlindedBeaconBlock)
+	payload.Transactions = []bellatrix.Transaction{includedTx}
+	backend.relays[0].GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
+		Version: spec.DataVersionCapella,
+		Capella: payload,
+	}
+
+	rr = backend.request(t, http.MethodPost, pathGetPayload, signedBlindedBeaconBlock)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	require.Equal(t, []callbackArgs{{slot, []Transaction{missingTx}}}, calls)
+}
+
+func TestGetBestBidForSlotRelayListShuffle(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	backend := newTestBackend(t, 3, time.Second, WithRelayListShuffle())
+
+	// Every relay sends a bid of the same value, for a different block
+	relayIndexByBlockHash := make(map[phase0.Hash32]int)
+	for i, relay := range backend.relays {
+		blockHash := phase0.Hash32{byte(i + 1)}
+		relayIndexByBlockHash[blockHash] = i
+		relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			12345, blockHash.String(), parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+	}
+
+	const numRequests = 1000
+	selected := make([]int, len(backend.relays))
+	for i := 0; i < numRequests; i++ {
+		bid, err := backend.boost.GetBestBidForSlot(context.Background(), phase0.Slot(i+1), parentHash, pubkey)
+		require.NoError(t, err)
+		blockHash, err := bid.BlockHash()
+		require.NoError(t, err)
+		selected[relayIndexByBlockHash[blockHash]]++
+	}
+
+	// Each relay is selected with probability 1/3, allow for 3 standard deviations
+	p := 1.0 / 3
+	expected := numRequests * p
+	tolerance := 3 * math.Sqrt(numRequests*p*(1-p))
+	for i, count := range selected {
+		require.InDelta(t, expected, float64(count), tolerance, "relay %d selected %d times", i, count)
+	}
+}
+
+func TestGetHeadersFromAllRelays(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	setup := func(t *testing.T) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 3, time.Second)
+		for i, relay := range backend.relays {
+			relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				uint64(20000+i), phase0.Hash32{byte(i + 1)}.String(), parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			)
+		}
+		return backend
+	}
+	failRelay := func(relay *mockRelay) {
+		relay.overrideHandleGetHeaderWithProofs(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})
+	}
+
+	t.Run("Returns the bids of all relays", func(t *testing.T) {
+		backend := setup(t)
+
+		bids, err := backend.boost.GetHeadersFromAllRelays(context.Background(), 1, parentHash, pubkey)
+		require.NoError(t, err)
+		require.Len(t, bids, 3)
+		for i, bid := range bids {
+			require.Equal(t, backend.relays[i].RelayEntry, bid.Relay)
+			value, err := bid.Bid.Bid.Value()
+			require.NoError(t, err)
+			require.Equal(t, uint64(20000+i), value.Uint64())
+		}
+	})
+
+	t.Run("Omits failed and invalid relays", func(t *testing.T) {
+		backend := setup(t)
+		failRelay(backend.relays[1])
+		// Bid for another parent hash
+		relay := backend.relays[2]
+		relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			30000, phase0.Hash32{0x03}.String(), phase0.Hash32{0x04}.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+
+		bids, err := backend.boost.GetHeadersFromAllRelays(context.Background(), 1, parentHash, pubkey)
+		require.NoError(t, err)
+		require.Len(t, bids, 1)
+		require.Equal(t, backend.relays[0].RelayEntry, bids[0].Relay)
+	})
+
+	t.Run("Fails if no relay sends a valid bid", func(t *testing.T) {
+		backend := setup(t)
+		for _, relay := range backend.relays {
+			failRelay(relay)
+		}
+
+		bids, err := backend.boost.GetHeadersFromAllRelays(context.Background(), 1, parentHash, pubkey)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Nil(t, bids)
+	})
+}
+
+func TestGetSupportedConstraintTypes(t *testing.T) {
+	testCases := []struct {
+		name          string
+		response      *ConstraintTypesResponse
+		expectedTypes []string
+	}{
+		{
+			name:          "Default types",
+			expectedTypes: []string{ConstraintTypeTxInclusion},
+		},
+		{
+			name:          "All types",
+			response:      &ConstraintTypesResponse{ConstraintTypes: []string{ConstraintTypeTxInclusion, ConstraintTypeTxExclusion, ConstraintTypeBundle}},
+			expectedTypes: []string{ConstraintTypeTxInclusion, ConstraintTypeTxExclusion, ConstraintTypeBundle},
+		},
+		{
+			name:          "Unknown types are kept",
+			response:      &ConstraintTypesResponse{ConstraintTypes: []string{ConstraintTypeBundle, "tx_ordering"}},
+			expectedTypes: []string{ConstraintTypeBundle, "tx_ordering"},
+		},
+		{
+			name:          "No types",
+			response:      &ConstraintTypesResponse{ConstraintTypes: []string{}},
+			expectedTypes: []string{},
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 2, time.Second)
+			backend.relays[0].ConstraintTypesResponse = tt.response
+
+			types, err := backend.boost.GetSupportedConstraintTypes(context.Background(), backend.relays[0].RelayEntry)
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedTypes, types)
+			require.Equal(t, 1, backend.relays[0].GetRequestCount(pathConstraintTypes))
+			require.Equal(t, 0, backend.relays[1].GetRequestCount(pathConstraintTypes))
+		})
+	}
+
+	t.Run("Relay error", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		backend.relays[0].RequiredHeader = "X-API-Key"
+
+		types, err := backend.boost.GetSupportedConstraintTypes(context.Background(), backend.relays[0].RelayEntry)
+		require.ErrorIs(t, err, errHTTPErrorResponse)
+		require.Nil(t, types)
+	})
+}
+
+func TestNegotiateConstraintAPIVersion(t *testing.T) {
+	testCases := []struct {
+		name            string
+		serviceVersions []APIVersion
+		relayVersions   [][]APIVersion // nil for a relay which is down
+		expectedVersion APIVersion
+		expectedErr     error
+	}{
+		{
+			name:            "Default versions",
+			serviceVersions: supportedConstraintAPIVersions,
+			relayVersions:   [][]APIVersion{{1}, {1}},
+			expectedVersion: ConstraintAPIVersionV1,
+		},
+		{
+			name:            "Highest common version",
+			serviceVersions: []APIVersion{1, 2},
+			relayVersions:   [][]APIVersion{{1, 2}, {2, 1, 3}},
+			expectedVersion: 2,
+		},
+		{
+			name:            "Relay supporting fewer versions",
+			serviceVersions: []APIVersion{1, 2},
+			relayVersions:   [][]APIVersion{{1, 2}, {1}},
+			expectedVersion: 1,
+		},
+		{
+			name:            "Version not supported by the service",
+			serviceVersions: []APIVersion{1},
+			relayVersions:   [][]APIVersion{{1, 2}, {1, 2}},
+			expectedVersion: 1,
+		},
+		{
+			name:            "No common version",
+			serviceVersions: []APIVersion{1, 2},
+			relayVersions:   [][]APIVersion{{2}, {1}},
+			expectedErr:     errNoCommonAPIVersion,
+		},
+		{
+			name:            "Relay down is ignored",
+			serviceVersions: []APIVersion{1, 2},
+			relayVersions:   [][]APIVersion{{1, 2}, nil},
+			expectedVersion: 2,
+		},
+		{
+			name:            "All relays down",
+			serviceVersions: []APIVersion{1, 2},
+			relayVersions:   [][]APIVersion{nil, nil},
+			expectedErr:     errNoSuccessfulRelayResponse,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, len(tt.relayVersions), time.Second)
+			backend.boost.constraintAPIVersions = tt.serviceVersions
+			for i, versions := range tt.relayVersions {
+				if versions == nil {
+					backend.relays[i].Server.Close()
+					continue
+				}
+				backend.relays[i].CapabilitiesResponse = &CapabilitiesResponse{ConstraintAPIVersions: versions}
+			}
+
+			version, err := backend.boost.NegotiateConstraintAPIVersion(context.Background())
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedVersion, version)
+		})
+	}
+}
+
+func TestConstraintsForSlot(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	makeConstraints := func(slot uint64) *SignedConstraints {
+		return &SignedConstraints{
+			Message: ConstraintsMessage{
+				ValidatorIndex: 12345,
+				Slot:           slot,
+				Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+			},
+		}
+	}
+
+	setup := func(t *testing.T) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 2, time.Second)
+		payload := BatchedSignedConstraints{makeConstraints(10), makeConstraints(11)}
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		return backend
+	}
+
+	t.Run("Returns the constraints of the slot once", func(t *testing.T) {
+		backend := setup(t)
+
+		constraints, err := backend.boost.ConstraintsForSlot(context.Background(), 10)
+		require.NoError(t, err)
+		require.Equal(t, BatchedSignedConstraints{makeConstraints(10)}, constraints)
+	})
+
+	t.Run("Merges the constraints of all relays", func(t *testing.T) {
+		backend := setup(t)
+		// Only the second relay knows about these constraints
+		relay := backend.relays[1]
+		relay.mu.Lock()
+		relay.capturedConstraints = append(relay.capturedConstraints, makeConstraints(12))
+		relay.mu.Unlock()
+
+		constraints, err := backend.boost.ConstraintsForSlot(context.Background(), 12)
+		require.NoError(t, err)
+		require.Equal(t, BatchedSignedConstraints{makeConstraints(12)}, constraints)
+	})
+
+	t.Run("No constraints for the slot", func(t *testing.T) {
+		backend := setup(t)
+
+		constraints, err := backend.boost.ConstraintsForSlot(context.Background(), 13)
+		require.NoError(t, err)
+		require.Empty(t, constraints)
+	})
+
+	t.Run("Relay down is ignored", func(t *testing.T) {
+		backend := setup(t)
+		backend.relays[0].Server.Close()
+
+		constraints, err := backend.boost.ConstraintsForSlot(context.Background(), 11)
+		require.NoError(t, err)
+		require.Equal(t, BatchedSignedConstraints{makeConstraints(11)}, constraints)
+	})
+
+	t.Run("All relays down", func(t *testing.T) {
+		backend := setup(t)
+		backend.relays[0].Server.Close()
+		backend.relays[1].Server.Close()
+
+		_, err := backend.boost.ConstraintsForSlot(context.Background(), 10)
+		require.ErrorIs(t, err, errNoSuccessfulRelayResponse)
+	})
+}
+
+func TestGetConstraintProofForSlot(t *testing.T) {
+	txA := Transaction(_HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f"))
+	txB := Transaction(_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"))
+	txAHash, err := (&Constraint{Tx: txA}).TxHash()
+	require.NoError(t, err)
+	txBHash, err := (&Constraint{Tx: txB}).TxHash()
+	require.NoError(t, err)
+	slot := phase0.Slot(10)
+
+	setup := func(t *testing.T) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 2, time.Second)
+		payload := BatchedSignedConstraints{&SignedConstraints{
+			Message: ConstraintsMessage{
+				ValidatorIndex: 12345,
+				Slot:           uint64(slot),
+				Constraints:    []*Constraint{{txA, nil}, {txB, nil}},
+			},
+		}}
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		return backend
+	}
+
+	// The mock relay proves the transactions against a block made of them only
+	txsRoot := func(t *testing.T, txs ...Transaction) phase0.Root {
+		t.Helper()
+		transactions := new(eth2UtilBellatrix.ExecutionPayloadTransactions)
+		for _, tx := range txs {
+			transactions.Transactions = append(transactions.Transactions, bellatrix.Transaction(tx))
+		}
+		root, err := transactions.HashTreeRoot()
+		require.NoError(t, err)
+		return root
+	}
+
+	t.Run("Proof for all the constraints", func(t *testing.T) {
+		backend := setup(t)
+
+		proof, err := backend.boost.GetConstraintProofForSlot(context.Background(), slot, []phase0.Hash32{txAHash, txBHash})
+		require.NoError(t, err)
+		require.Equal(t, []phase0.Hash32{txAHash, txBHash}, proof.TransactionHashes)
+		require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(proof, txsRoot(t, txA, txB), []Transaction{txA, txB}))
+		for _, relay := range backend.relays {
+			require.Equal(t, 1, relay.GetRequestCount(pathGetConstraintProof))
+		}
+	})
+
+	t.Run("Proof for a single constraint", func(t *testing.T) {
+		backend := setup(t)
+
+		proof, err := backend.boost.GetConstraintProofForSlot(context.Background(), slot, []phase0.Hash32{txBHash})
+		require.NoError(t, err)
+		require.Equal(t, []phase0.Hash32{txBHash}, proof.TransactionHashes)
+		require.NoError(t, MerkleProofVerifier{}.VerifyInclusionProof(proof, txsRoot(t, txB), []Transaction{txB}))
+	})
+
+	t.Run("Relay down", func(t *testing.T) {
+		backend := setup(t)
+		backend.relays[0].Server.Close()
+
+		proof, err := backend.boost.GetConstraintProofForSlot(context.Background(), slot, []phase0.Hash32{txAHash})
+		require.NoError(t, err)
+		require.Equal(t, []phase0.Hash32{txAHash}, proof.TransactionHashes)
+	})
+
+	t.Run("Unknown transaction", func(t *testing.T) {
+		backend := setup(t)
+
+		_, err := backend.boost.GetConstraintProofForSlot(context.Background(), slot+1, []phase0.Hash32{txAHash})
+		require.ErrorIs(t, err, errNoSuccessfulRelayResponse)
+	})
+}
+
+func TestCheckProofCoversTransactions(t *testing.T) {
+	index := uint64(firstTransactionGeneralizedIndex)
+	proof := &InclusionProof{
+		TransactionHashes:  []phase0.Hash32{{0x01}, {0x02}},
+		GeneralizedIndexes: []uint64{index, index + 1},
+	}
+
+	require.NoError(t, checkProofCoversTransactions(proof, []phase0.Hash32{{0x02}, {0x01}}))
+	require.NoError(t, checkProofCoversTransactions(proof, []phase0.Hash32{{0x01}}))
+	require.ErrorIs(t, checkProofCoversTransactions(proof, []phase0.Hash32{{0x03}}), errMissingConstraint)
+
+	mismatch := &InclusionProof{
+		TransactionHashes:  []phase0.Hash32{{0x01}},
+		GeneralizedIndexes: []uint64{index, index + 1},
+	}
+	require.ErrorIs(t, checkProofCoversTransactions(mismatch, []phase0.Hash32{{0x01}}), errMismatchProofSize)
+}
+
+func TestCancelConstraints(t *testing.T) {
+	cancelledTx := Transaction(_HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f"))
+	keptTx := Transaction(_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"))
+	cancelledTxHash, err := (&Constraint{Tx: cancelledTx}).TxHash()
+	require.NoError(t, err)
+	keptTxHash, err := (&Constraint{Tx: keptTx}).TxHash()
+	require.NoError(t, err)
+	slot := phase0.Slot(10)
+
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	var proposerPublicKey phase0.BLSPubKey
+	copy(proposerPublicKey[:], bls.PublicKeyToBytes(publicKey))
+
+	setup := func(t *testing.T, options ...BoostServiceOption) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 2, time.Second, options...)
+		for _, relay := range backend.relays {
+			// The relays only accept cancellations signed by the proposer
+			relay.SetProposerSigningDomain(phase0.Domain{}, proposerPublicKey)
+		}
+		payload := BatchedSignedConstraints{&SignedConstraints{
+			Message: ConstraintsMessage{
+				ValidatorIndex: 12345,
+				Slot:           uint64(slot),
+				Constraints:    []*Constraint{{cancelledTx, nil}, {keptTx, nil}},
+			},
+		}}
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		return backend
+	}
+
+	t.Run("Cancels the constraints on all relays", func(t *testing.T) {
+		backend := setup(t, WithConstraintSigningKey(secretKey))
+
+		err := backend.boost.CancelConstraints(context.Background(), slot, []phase0.Hash32{cancelledTxHash})
+		require.NoError(t, err)
+
+		// The relays only keep the other constraint
+		constraints, err := backend.boost.ConstraintsForSlot(context.Background(), slot)
+		require.NoError(t, err)
+		require.Len(t, constraints, 1)
+		require.Len(t, constraints[0].Message.Constraints, 1)
+		require.Equal(t, keptTx, constraints[0].Message.Constraints[0].Tx)
+
+		// The cancellation is signed with the configured key
+		for _, relay := range backend.relays {
+			relay.mu.Lock()
+			cancellations := relay.cancelledConstraints
+			relay.mu.Unlock()
+			require.Len(t, cancellations, 1)
+			cancellation := cancellations[0]
+			require.Equal(t, []phase0.Hash32{cancelledTxHash}, cancellation.Message.TransactionHashes)
+			ok, err := ssz.VerifySignature(&cancellation.Message, backend.boost.builderSigningDomain, bls.PublicKeyToBytes(publicKey), cancellation.Signature[:])
+			require.NoError(t, err)
+			require.True(t, ok)
+		}
+
+		// The local cache only keeps the other constraint too
+		cached, ok := backend.boost.constraints.Get(uint64(slot))
+		require.True(t, ok)
+		require.Len(t, cached, 1)
+		require.Contains(t, cached, common.Hash(keptTxHash))
+	})
+
+	t.Run("Fails if signed by another key", func(t *testing.T) {
+		otherSecretKey, _, err := bls.GenerateNewKeypair()
+		require.NoError(t, err)
+		backend := setup(t, WithConstraintSigningKey(otherSecretKey))
+
+		err = backend.boost.CancelConstraints(context.Background(), slot, []phase0.Hash32{cancelledTxHash})
+		require.ErrorIs(t, err, errNoSuccessfulRelayResponse)
+		for _, relay := range backend.relays {
+			relay.mu.Lock()
+			require.Empty(t, relay.cancelledConstraints)
+			require.Len(t, relay.capturedConstraints[0].Message.Constraints, 2)
+			relay.mu.Unlock()
+		}
+	})
+
+	t.Run("Fails without signing key", func(t *testing.T) {
+		backend := setup(t)
+
+		err := backend.boost.CancelConstraints(context.Background(), slot, []phase0.Hash32{cancelledTxHash})
+		require.ErrorIs(t, err, errNoConstraintSigningKey)
+		require.Equal(t, 0, backend.relays[0].GetRequestCount(pathDeleteConstraint))
+	})
+
+	t.Run("Fails if no relay accepts the cancellation", func(t *testing.T) {
+		backend := setup(t, WithConstraintSigningKey(secretKey))
+		backend.relays[0].Server.Close()
+		backend.relays[1].Server.Close()
+
+		err := backend.boost.CancelConstraints(context.Background(), slot, []phase0.Hash32{cancelledTxHash})
+		require.ErrorIs(t, err, errNoSuccessfulRelayResponse)
+	})
+}
+
+func TestEmitAuditLog(t *testing.T) {
+	slot := uint64(8978583)
+	txHash := _HexToHash("0xba40436abdc8adc037e2c92ea1099a5849053510c3911037ff663085ce44bc49")
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	blockHash := "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	backend := newTestBackend(t, 1, time.Second)
+	relay := backend.relays[0]
+
+	// Submit constraints for the slot
+	constraints := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+	rr := backend.request(t, http.MethodPost, pathSubmitConstraint, constraints)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Get a bid with proofs of the constraints
+	relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithConstraintsResponse(
+		12345, blockHash, parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella,
+		[]struct {
+			tx   Transaction
+			hash phase0.Hash32
+		}{{rawTx, txHash}},
+	)
+	rr = backend.request(t, http.MethodGet, getHeaderWithProofsPath(slot, parentHash, pubkey), nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Unblind the payload
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-capella.json")
+	require.NoError(t, err)
+	defer jsonFile.Close()
+	signedBlindedBeaconBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBeaconBlock))
+	relay.GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
+		Version: spec.DataVersionCapella,
+		Capella: blindedBlockToExecutionPayloadCapella(signedBlindedBeaconBlock),
+	}
+	rr = backend.request(t, http.MethodPost, "/eth/v1/builder/blinded_blocks", signedBlindedBeaconBlock)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	var buf bytes.Buffer
+	require.NoError(t, backend.boost.EmitAuditLog(&buf))
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(&buf)
+	for scanner.Scan() {
+		entry := AuditEntry{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		require.Equal(t, relay.RelayEntry.String(), entry.RelayURL)
+		require.False(t, entry.Timestamp.IsZero())
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+	require.Len(t, entries, 3)
+
+	require.Equal(t, AuditEventConstraintSubmitted, entries[0].EventType)
+	require.Equal(t, slot, entries[0].Slot)
+
+	require.Equal(t, AuditEventBid, entries[1].EventType)
+	require.Equal(t, slot, entries[1].Slot)
+	require.Equal(t, blockHash, entries[1].BlockHash)
+	require.Equal(t, "12345", entries[1].BidValue)
+
+	require.Equal(t, AuditEventPayloadUnblinded, entries[2].EventType)
+	require.Equal(t, uint64(signedBlindedBeaconBlock.Message.Slot), entries[2].Slot)
+	require.Equal(t, signedBlindedBeaconBlock.Message.Body.ExecutionPayloadHeader.BlockHash.String(), entries[2].BlockHash)
+
+	// The emitted entries are removed from the log
+	buf.Reset()
+	require.NoError(t, backend.boost.EmitAuditLog(&buf))
+	require.Empty(t, buf.String())
+}
+
+func TestGetBestBidForSlotConstraintWeightedSelection(t *testing.T) {
+	slot := uint64(8978583)
+	txHash := _HexToHash("0xba40436abdc8adc037e2c92ea1099a5849053510c3911037ff663085ce44bc49")
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	// The bid without proofs has the lowest block hash, so it wins the hash tiebreaker
+	noProofsBlockHash := "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	proofsBlockHash := "0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+
+	testCases := []struct {
+		name              string
+		options           []BoostServiceOption
+		expectedBlockHash string
+	}{
+		{
+			name:              "Hash tiebreaker by default",
+			expectedBlockHash: noProofsBlockHash,
+		},
+		{
+			name:              "Bid with the most proofs preferred",
+			options:           []BoostServiceOption{WithConstraintWeightedSelection()},
+			expectedBlockHash: proofsBlockHash,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 2, time.Second, tt.options...)
+
+			payload := BatchedSignedConstraints{&SignedConstraints{
+				Message: ConstraintsMessage{
+					ValidatorIndex: 12345,
+					Slot:           slot,
+					Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+				},
+			}}
+			rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+			require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+			// Both relays bid the same value, only the second one proves the constraint
+			backend.relays[0].GetHeaderWithProofsResponse = backend.relays[0].MakeGetHeaderWithProofsResponseWithTxsRoot(
+				20000, noProofsBlockHash, parentHash.String(), backend.relays[0].RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			)
+			backend.relays[1].GetHeaderWithProofsResponse = backend.relays[1].MakeGetHeaderWithConstraintsResponse(
+				20000, proofsBlockHash, parentHash.String(), backend.relays[1].RelayEntry.PublicKey.String(), spec.DataVersionCapella,
+				[]struct {
+					tx   Transaction
+					hash phase0.Hash32
+				}{{rawTx, txHash}},
+			)
+			require.Equal(t, 0, backend.relays[0].GetHeaderWithProofsResponse.ProofCount())
+			require.Equal(t, 1, backend.relays[1].GetHeaderWithProofsResponse.ProofCount())
+
+			bid, err := backend.boost.GetBestBidForSlot(context.Background(), phase0.Slot(slot), parentHash, pubkey)
+			require.NoError(t, err)
+			blockHash, err := bid.BlockHash()
+			require.NoError(t, err)
+			require.Equal(t, tt.expectedBlockHash, blockHash.String())
+		})
+	}
+}
+
+func TestMockRelayE2EWithDenebForkVersion(t *testing.T) {
+	slot := uint64(8978583)
+	txHash := _HexToHash("0xba40436abdc8adc037e2c92ea1099a5849053510c3911037ff663085ce44bc49")
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	blockHash := "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	backend := newTestBackend(t, 1, time.Second)
+	relay := backend.relays[0]
+
+	// Register the validator
+	registrationsPath := "/eth/v1/builder/validators"
+	registrations := []builderApiV1.SignedValidatorRegistration{{
+		Message: &builderApiV1.ValidatorRegistration{
+			FeeRecipient: _HexToAddress("0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941"),
+			Timestamp:    time.Unix(1234356, 0),
+			Pubkey:       pubkey,
+		},
+		Signature: _HexToSignature(
+			"0x81510b571e22f89d1697545aac01c9ad0c1e7a3e778b3078bef524efae14990e58a6e960a152abd49de2e18d7fd3081c15d5c25867ccfad3d47beef6b39ac24b6b9fbf2cfa91c88f67aff750438a6841ec9e4a06a94ae41410c4f97b75ab284c"),
+	}}
+	rr := backend.request(t, http.MethodPost, registrationsPath, registrations)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, 1, relay.GetRequestCount(registrationsPath))
+
+	// Submit the constraints
+	constraints := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+	rr = backend.request(t, http.MethodPost, pathSubmitConstraint, constraints)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.NoError(t, relay.WaitForConstraintSubmission(phase0.Slot(slot), 0))
+
+	// Get the Deneb bid with the proof of the constraints
+	relay.GetHeaderResponse = relay.MakeGetHeaderResponse(
+		20000, blockHash, parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionDeneb,
+	)
+	relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithConstraintsResponse(
+		20000, blockHash, parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionDeneb,
+		[]struct {
+			tx   Transaction
+			hash phase0.Hash32
+		}{{rawTx, txHash}},
+	)
+	rr = backend.request(t, http.MethodGet, getHeaderWithProofsPath(slot, parentHash, pubkey), nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	bid := new(builderSpec.VersionedSignedBuilderBid)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	require.Equal(t, spec.DataVersionDeneb, bid.Version)
+	require.NotNil(t, bid.Deneb)
+	require.Equal(t, blockHash, bid.Deneb.Message.Header.BlockHash.String())
+	require.Equal(t, uint256.NewInt(20000), bid.Deneb.Message.Value)
+	require.NotNil(t, bid.Deneb.Message.BlobKZGCommitments)
+	require.Equal(t, relay.GetHeaderResponse.Deneb.Message.BlobKZGCommitments, bid.Deneb.Message.BlobKZGCommitments)
+
+	// Unblind the payload
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-deneb.json")
+	require.NoError(t, err)
+	defer jsonFile.Close()
+	signedBlindedBlock := new(eth2ApiV1Deneb.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBlock))
+	relay.GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
+		Version: spec.DataVersionDeneb,
+		Deneb:   blindedBlockContentsToPayloadDeneb(signedBlindedBlock),
+	}
+
+	getPayloadPath := "/eth/v1/builder/blinded_blocks"
+	rr = backend.request(t, http.MethodPost, getPayloadPath, signedBlindedBlock)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	require.Equal(t, 1, relay.GetRequestCount(getPayloadPath))
+
+	payload := new(builderApi.VersionedSubmitBlindedBlockResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), payload))
+	require.Equal(t, spec.DataVersionDeneb, payload.Version)
+	require.NotNil(t, payload.Deneb)
+	require.Equal(t, signedBlindedBlock.Message.Body.ExecutionPayloadHeader.BlockHash, payload.Deneb.ExecutionPayload.BlockHash)
+	require.Len(t, payload.Deneb.BlobsBundle.Commitments, len(signedBlindedBlock.Message.Body.BlobKZGCommitments))
+	require.Equal(t, signedBlindedBlock.Message.Body.BlobKZGCommitments, payload.Deneb.BlobsBundle.Commitments)
+}
+
+func TestWithExtraRequestHeaders(t *testing.T) {
+	slot := uint64(8978583)
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	registrations := []builderApiV1.SignedValidatorRegistration{{
+		Message: &builderApiV1.ValidatorRegistration{
+			FeeRecipient: _HexToAddress("0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941"),
+			Timestamp:    time.Unix(1234356, 0),
+			Pubkey:       pubkey,
+		},
+		Signature: _HexToSignature(
+			"0x81510b571e22f89d1697545aac01c9ad0c1e7a3e778b3078bef524efae14990e58a6e960a152abd49de2e18d7fd3081c15d5c25867ccfad3d47beef6b39ac24b6b9fbf2cfa91c88f67aff750438a6841ec9e4a06a94ae41410c4f97b75ab284c"),
+	}}
+	constraints := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+
+	testCases := []struct {
+		name                 string
+		options              []BoostServiceOption
+		expectedRegisterCode int
+		expectedSubmitCode   int
+		expectedHeaderCode   int
+	}{
+		{
+			name:                 "Header missing",
+			expectedRegisterCode: http.StatusBadGateway,
+			expectedSubmitCode:   http.StatusBadGateway,
+			expectedHeaderCode:   http.StatusNoContent,
+		},
+		{
+			name:                 "Header sent",
+			options:              []BoostServiceOption{WithExtraRequestHeaders(http.Header{"X-Api-Key": []string{"secret"}})},
+			expectedRegisterCode: http.StatusOK,
+			expectedSubmitCode:   http.StatusOK,
+			expectedHeaderCode:   http.StatusOK,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 1, time.Second, tt.options...)
+			relay := backend.relays[0]
+			relay.RequiredHeader = "X-API-Key"
+			relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				20000, parentHash.String(), parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+			)
+
+			rr := backend.request(t, http.MethodPost, "/eth/v1/builder/validators", registrations)
+			require.Equal(t, tt.expectedRegisterCode, rr.Code, rr.Body.String())
+
+			rr = backend.request(t, http.MethodPost, pathSubmitConstraint, constraints)
+			require.Equal(t, tt.expectedSubmitCode, rr.Code, rr.Body.String())
+
+			// The bid is requested for another slot, so that its missing proofs are accepted
+			rr = backend.request(t, http.MethodGet, getHeaderWithProofsPath(slot+1, parentHash, pubkey), nil)
+			require.Equal(t, tt.expectedHeaderCode, rr.Code, rr.Body.String())
+		})
+	}
+}
+
+func TestGetAuditableProof(t *testing.T) {
+	slot := uint64(8978583)
+	txHash := _HexToHash("0xba40436abdc8adc037e2c92ea1099a5849053510c3911037ff663085ce44bc49")
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	blockHash := _HexToHash("0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		},
+	}}
+
+	t.Run("Normal function", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+		attestation, err := backend.boost.GetAuditableProof(context.Background(), phase0.Slot(slot), blockHash)
+		require.NoError(t, err)
+		require.Equal(t, slot, attestation.Message.Slot)
+		require.Equal(t, blockHash, attestation.Message.BlockHash)
+		require.Equal(t, []phase0.Hash32{txHash}, attestation.Message.TransactionHashes)
+
+		relayPublicKey := backend.relays[0].RelayEntry.PublicKey
+		ok, err := ssz.VerifySignature(&attestation.Message, backend.boost.builderSigningDomain, relayPublicKey[:], attestation.Signature[:])
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+
+	t.Run("Attestation signed with another key", func(t *testing.T) {
+		backend := newTestBackend(t, 1, time.Second)
+		secretKey, _, err := bls.GenerateNewKeypair()
+		require.NoError(t, err)
+		backend.relays[0].secretKey = secretKey
+
+		attestation, err := backend.boost.GetAuditableProof(context.Background(), phase0.Slot(slot), blockHash)
+		require.ErrorIs(t, err, errNoSuccessfulRelayResponse)
+		require.Nil(t, attestation)
+	})
+
+	t.Run("Only valid attestations returned", func(t *testing.T) {
+		backend := newTestBackend(t, 2, time.Second)
+		secretKey, _, err := bls.GenerateNewKeypair()
+		require.NoError(t, err)
+		backend.relays[0].secretKey = secretKey
+
+		attestation, err := backend.boost.GetAuditableProof(context.Background(), phase0.Slot(slot), blockHash)
+		require.NoError(t, err)
+		relayPublicKey := backend.relays[1].RelayEntry.PublicKey
+		ok, err := ssz.VerifySignature(&attestation.Message, backend.boost.builderSigningDomain, relayPublicKey[:], attestation.Signature[:])
+		require.NoError(t, err)
+		require.True(t, ok)
+	})
+}
+
+func TestVerifyPayloadAttestation(t *testing.T) {
+	backend := newTestBackend(t, 1, time.Second)
+	relay := backend.relays[0]
+	blockHash := _HexToHash("0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+
+	sign := func(t *testing.T, message PayloadAttestation) *SignedPayloadAttestation {
+		t.Helper()
+		signature, err := ssz.SignMessage(&message, ssz.DomainBuilder, relay.secretKey)
+		require.NoError(t, err)
+		return &SignedPayloadAttestation{Message: message, Signature: signature}
+	}
+
+	attestation := sign(t, PayloadAttestation{Slot: 1, BlockHash: blockHash})
+	require.NoError(t, backend.boost.verifyPayloadAttestation(attestation, relay.RelayEntry, 1, blockHash))
+
+	err := backend.boost.verifyPayloadAttestation(attestation, relay.RelayEntry, 2, blockHash)
+	require.ErrorIs(t, err, errAttestationMismatch)
+
+	err = backend.boost.verifyPayloadAttestation(attestation, relay.RelayEntry, 1, phase0.Hash32{0x01})
+	require.ErrorIs(t, err, errAttestationMismatch)
+
+	tampered := *attestation
+	tampered.Message.TransactionHashes = []phase0.Hash32{{0x01}}
+	err = backend.boost.verifyPayloadAttestation(&tampered, relay.RelayEntry, 1, blockHash)
+	require.ErrorIs(t, err, errInvalidAttestation)
+}
+
+// preferredRelaySelector selects the bid of the relay, whatever its value, or no bid if the relay did not bid
+type preferredRelaySelector struct {
+	relay RelayEntry
+}
+
+func (s preferredRelaySelector) SelectBestBid(bids []RelayBid) *RelayBid {
+	for i := range bids {
+		if bids[i].Relay.String() == s.relay.String() {
+			return &bids[i]
+		}
+	}
+	return nil
+}
+
+func TestWithRelaySelector(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+	blockHashes := []string{
+		"0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+		"0xb28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+		"0xc28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7",
+	}
+	relayValues := []uint64{20001, 20003, 20002}
+
+	testCases := []struct {
+		name string
+		// selector returns the selector to use, given the relays, or nil for the default selection
+		selector      func(relays []*mockRelay) RelaySelector
+		expectedValue uint64
+	}{
+		{
+			name:          "Default selection",
+			selector:      func(_ []*mockRelay) RelaySelector { return nil },
+			expectedValue: 20003,
+		},
+		{
+			name:          "MaxValueSelector",
+			selector:      func(_ []*mockRelay) RelaySelector { return MaxValueSelector{} },
+			expectedValue: 20003,
+		},
+		{
+			name: "Custom selector preferring a relay",
+			selector: func(relays []*mockRelay) RelaySelector {
+				return preferredRelaySelector{relay: relays[2].RelayEntry}
+			},
+			expectedValue: 20002,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			backend := newTestBackend(t, 3, time.Second)
+			if selector := tt.selector(backend.relays); selector != nil {
+				WithRelaySelector(selector)(backend.boost)
+			}
+			for i, relay := range backend.relays {
+				relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+					relayValues[i], blockHashes[i], parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+				)
+			}
+
+			bid, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+			require.NoError(t, err)
+			value, err := bid.Value()
+			require.NoError(t, err)
+			require.Equal(t, uint256.NewInt(tt.expectedValue), value)
+		})
+	}
+
+	t.Run("Selector returning no bid", func(t *testing.T) {
+		backend := newTestBackend(t, 2, time.Second)
+		unknownRelay, err := NewRelayEntry("http://0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249@other-relay.com")
+		require.NoError(t, err)
+		WithRelaySelector(preferredRelaySelector{relay: unknownRelay})(backend.boost)
+
+		bid, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Nil(t, bid)
+	})
+}
+
+// stubLocalBlockBuilder returns the same payload or error for every slot, and records the slots it was called for
+type stubLocalBlockBuilder struct {
+	payload *builderApi.VersionedSubmitBlindedBlockResponse
+	err     error
+	slots   []phase0.Slot
+}
+
+func (b *stubLocalBlockBuilder) BuildBlock(_ context.Context, slot phase0.Slot) (*builderApi.VersionedSubmitBlindedBlockResponse, error) {
+	b.slots = append(b.slots, slot)
+	return b.payload, b.err
+}
+
+func TestWithLocalBlockBuilder(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	// newFailingBackend returns a backend whose relays all fail to deliver a bid
+	newFailingBackend := func(t *testing.T, builder LocalBlockBuilder) *testBackend {
+		t.Helper()
+		backend := newTestBackend(t, 2, time.Second, WithLocalBlockBuilder(builder))
+		for _, relay := range backend.relays {
+			relay.overrideHandleGetHeaderWithProofs(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusInternalServerError)
+			})
+		}
+		return backend
+	}
+
+	t.Run("All relays failing", func(t *testing.T) {
+		builder := &stubLocalBlockBuilder{
+			payload: newMockRelay(t).MakeGetPayloadResponse(parentHash.String(), "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7", "0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941", 12345, spec.DataVersionCapella),
+		}
+		backend := newFailingBackend(t, builder)
+
+		result, err := backend.boost.GetBestBidOrLocalBlock(context.Background(), 7, parentHash, pubkey)
+		require.NoError(t, err)
+		require.Nil(t, result.Bid)
+		require.Equal(t, builder.payload, result.LocalBlock)
+		require.Equal(t, []phase0.Slot{7}, builder.slots)
+
+		// GetBestBidForSlot doesn't fall back to the local block builder
+		_, err = backend.boost.GetBestBidForSlot(context.Background(), 7, parentHash, pubkey)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.Equal(t, []phase0.Slot{7}, builder.slots)
+	})
+
+	t.Run("Local block builder failing", func(t *testing.T) {
+		builder := &stubLocalBlockBuilder{err: errors.New("execution client unavailable")}
+		backend := newFailingBackend(t, builder)
+
+		result, err := backend.boost.GetBestBidOrLocalBlock(context.Background(), 7, parentHash, pubkey)
+		require.Nil(t, result)
+		require.ErrorIs(t, err, errNoBidReceived)
+		require.ErrorIs(t, err, builder.err)
+	})
+
+	t.Run("Not called when a relay delivers a bid", func(t *testing.T) {
+		builder := &stubLocalBlockBuilder{}
+		backend := newFailingBackend(t, builder)
+		backend.relays[1].overrideHandleGetHeaderWithProofs(nil)
+		relay := backend.relays[1]
+		relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+			20000, "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7", parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+		)
+
+		result, err := backend.boost.GetBestBidOrLocalBlock(context.Background(), 7, parentHash, pubkey)
+		require.NoError(t, err)
+		require.NotNil(t, result.Bid)
+		require.Nil(t, result.LocalBlock)
+		require.Empty(t, builder.slots)
+	})
+}
+
+func TestWithRequestAndResponseInterceptors(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	type interceptorKey struct{}
+	type interceptedCall struct {
+		relay      string
+		method     string
+		statusCode int
+		elapsed    time.Duration
+		ctxValue   any
+	}
+
+	var mu sync.Mutex
+	requests := map[string]string{}
+	responses := map[string]interceptedCall{}
+	options := []BoostServiceOption{
+		WithRequestInterceptor(func(ctx context.Context, relay RelayEntry, method string) context.Context {
+			mu.Lock()
+			defer mu.Unlock()
+			requests[relay.String()] = method
+			return context.WithValue(ctx, interceptorKey{}, relay.String())
+		}),
+		WithResponseInterceptor(func(ctx context.Context, relay RelayEntry, method string, statusCode int, elapsed time.Duration) {
+			mu.Lock()
+			defer mu.Unlock()
+			responses[relay.String()] = interceptedCall{
+				relay:      relay.String(),
+				method:     method,
+				statusCode: statusCode,
+				elapsed:    elapsed,
+				ctxValue:   ctx.Value(interceptorKey{}),
+			}
+		}),
+	}
+
+	// The first relay bids slowly, the second one fails, and the third one is down
+	backend := newTestBackend(t, 3, time.Second, options...)
+	backend.relays[0].ResponseDelay = 20 * time.Millisecond
+	backend.relays[1].overrideHandleGetHeaderWithProofs(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	backend.relays[2].Server.Close()
+	relay := backend.relays[0]
+	relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+		20000, "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7", parentHash.String(), relay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, phase0.Root{0x01},
+	)
+
+	_, err := backend.boost.GetBestBidForSlot(context.Background(), 1, parentHash, pubkey)
+	require.NoError(t, err)
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, requests, 3)
+	require.Len(t, responses, 3)
+	expectedStatusCodes := []int{http.StatusOK, http.StatusInternalServerError, 0}
+	for i, relay := range backend.relays {
+		key := relay.RelayEntry.String()
+		require.Equal(t, http.MethodGet, requests[key])
+
+		response := responses[key]
+		require.Equal(t, key, response.relay)
+		require.Equal(t, http.MethodGet, response.method)
+		require.Equal(t, expectedStatusCodes[i], response.statusCode)
+		// The response interceptor gets the context returned by the request interceptor
+		require.Equal(t, key, response.ctxValue)
+	}
+	require.GreaterOrEqual(t, responses[backend.relays[0].RelayEntry.String()].elapsed, 20*time.Millisecond)
+}
+
+func TestBoostServiceFullFlowWithConstraints(t *testing.T) {
+	// The payload delivered for the slot of this blinded block is the one of the best bid
+	jsonFile, err := os.Open("../testdata/signed-blinded-beacon-block-capella.json")
+	require.NoError(t, err)
+	defer jsonFile.Close()
+	signedBlindedBeaconBlock := new(eth2ApiV1Capella.SignedBlindedBeaconBlock)
+	require.NoError(t, DecodeJSON(jsonFile, &signedBlindedBeaconBlock))
+	slot := signedBlindedBeaconBlock.Message.Slot
+	parentHash := signedBlindedBeaconBlock.Message.Body.ExecutionPayloadHeader.ParentHash
+	bestBlockHash := signedBlindedBeaconBlock.Message.Body.ExecutionPayloadHeader.BlockHash
+	otherBlockHash := "0xa28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7"
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	rawTxs := []Transaction{
+		_HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f"),
+		_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"),
+	}
+	constrainedTxs := make([]struct {
+		tx   Transaction
+		hash phase0.Hash32
+	}, len(rawTxs))
+	constraints := make([]*Constraint, len(rawTxs))
+	for i, rawTx := range rawTxs {
+		constraints[i] = &Constraint{Tx: rawTx}
+		hash, err := constraints[i].TxHash()
+		require.NoError(t, err)
+		constrainedTxs[i].tx = rawTx
+		constrainedTxs[i].hash = hash
+	}
+
+	backend := newTestBackend(t, 2, time.Second)
+	bestRelay, otherRelay := backend.relays[0], backend.relays[1]
+
+	var missingTxs []Transaction
+	payloadReceived := false
+	backend.boost.OnPayloadReceived(func(_ phase0.Slot, missing []Transaction) {
+		payloadReceived = true
+		missingTxs = missing
+	})
+
+	// Register the validator
+	registrationsPath := "/eth/v1/builder/validators"
+	registrations := []builderApiV1.SignedValidatorRegistration{{
+		Message: &builderApiV1.ValidatorRegistration{
+			FeeRecipient: _HexToAddress("0xdb65fEd33dc262Fe09D9a2Ba8F80b329BA25f941"),
+			Timestamp:    time.Unix(1234356, 0),
+			Pubkey:       pubkey,
+		},
+		Signature: _HexToSignature(
+			"0x81510b571e22f89d1697545aac01c9ad0c1e7a3e778b3078bef524efae14990e58a6e960a152abd49de2e18d7fd3081c15d5c25867ccfad3d47beef6b39ac24b6b9fbf2cfa91c88f67aff750438a6841ec9e4a06a94ae41410c4f97b75ab284c"),
+	}}
+	rr := backend.request(t, http.MethodPost, registrationsPath, registrations)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// Submit the constraints, which are forwarded to every relay
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           uint64(slot),
+			Constraints:    constraints,
+		},
+	}}
+	rr = backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	for _, relay := range backend.relays {
+		require.Equal(t, 1, relay.GetRequestCount(registrationsPath))
+		require.NoError(t, relay.WaitForConstraintSubmission(slot, time.Second))
+	}
+
+	// Both relays bid with the proofs of the constraints, the first one pays more
+	bestRelay.GetHeaderWithProofsResponse = bestRelay.MakeGetHeaderWithConstraintsResponse(
+		20000, bestBlockHash.String(), parentHash.String(), bestRelay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, constrainedTxs,
+	)
+	otherRelay.GetHeaderWithProofsResponse = otherRelay.MakeGetHeaderWithConstraintsResponse(
+		15000, otherBlockHash, parentHash.String(), otherRelay.RelayEntry.PublicKey.String(), spec.DataVersionCapella, constrainedTxs,
+	)
+	require.Equal(t, len(rawTxs), bestRelay.GetHeaderWithProofsResponse.ProofCount())
+	require.Equal(t, len(rawTxs), otherRelay.GetHeaderWithProofsResponse.ProofCount())
+
+	path := getHeaderWithProofsPath(uint64(slot), parentHash, pubkey)
+	rr = backend.request(t, http.MethodGet, path, nil)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+	for _, relay := range backend.relays {
+		require.Equal(t, 1, relay.GetRequestCount(path))
+	}
+
+	bid := new(builderSpec.VersionedSignedBuilderBid)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), bid))
+	require.Equal(t, spec.DataVersionCapella, bid.Version)
+	require.Equal(t, bestBlockHash, bid.Capella.Message.Header.BlockHash)
+	require.Equal(t, uint256.NewInt(20000), bid.Capella.Message.Value)
+
+	// Only the payload of the best relay matches the signed blinded block
+	bestPayload := blindedBlockToExecutionPayloadCapella(signedBlindedBeaconBlock)
+	otherPayload := blindedBlockToExecutionPayloadCapella(signedBlindedBeaconBlock)
+	otherPayload.BlockHash = _HexToHash(otherBlockHash)
+	for _, rawTx := range rawTxs {
+		bestPayload.Transactions = append(bestPayload.Transactions, bellatrix.Transaction(rawTx))
+		otherPayload.Transactions = append(otherPayload.Transactions, bellatrix.Transaction(rawTx))
+	}
+	bestRelay.GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
+		Version: spec.DataVersionCapella,
+		Capella: bestPayload,
+	}
+	otherRelay.GetPayloadResponse = &builderApi.VersionedSubmitBlindedBlockResponse{
+		Version: spec.DataVersionCapella,
+		Capella: otherPayload,
+	}
+
+	rr = backend.request(t, http.MethodPost, pathGetPayload, signedBlindedBeaconBlock)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	resp := new(builderApi.VersionedSubmitBlindedBlockResponse)
+	require.NoError(t, json.Unmarshal(rr.Body.Bytes(), resp))
+	require.Equal(t, spec.DataVersionCapella, resp.Version)
+	require.Equal(t, bestBlockHash, resp.Capella.BlockHash)
+	require.Equal(t, bestPayload.Transactions, resp.Capella.Transactions)
+
+	// The payload includes all the constrained transactions
+	for _, rawTx := range rawTxs {
+		require.Contains(t, resp.Capella.Transactions, bellatrix.Transaction(rawTx))
+	}
+	require.True(t, payloadReceived)
+	require.Empty(t, missingTxs)
 }
@@ -0,0 +1,143 @@
+package server
+
+import (
+	"sync"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	lru "github.com/hashicorp/golang-lru/v2"
+)
+
+// ConstraintStateStore persists the constraints submitted for each slot, so that they are not lost if the
+// BoostService restarts between the constraint submission and getPayload, see WithStateStore.
+// Implementations must be safe for concurrent use.
+type ConstraintStateStore interface {
+	// SaveConstraints adds the constraints to the ones stored for the slot
+	SaveConstraints(slot uint64, constraints BatchedSignedConstraints) error
+	// LoadConstraints returns the constraints stored for the slot, which are empty if there are none
+	LoadConstraints(slot uint64) (BatchedSignedConstraints, error)
+	// DeleteConstraints removes the constraints stored for the slot
+	DeleteConstraints(slot uint64) error
+}
+
+// InMemoryConstraintStateStore is the default ConstraintStateStore, keeping the constraints of the latest slots
+// in memory. It does not survive a restart of the process.
+type InMemoryConstraintStateStore struct {
+	mu          sync.Mutex
+	constraints *lru.Cache[uint64, BatchedSignedConstraints]
+}
+
+// NewInMemoryConstraintStateStore creates a store keeping the constraints of at most cap slots, evicting
+// the least recently used ones first
+func NewInMemoryConstraintStateStore(cap int) *InMemoryConstraintStateStore {
+	constraints, _ := lru.New[uint64, BatchedSignedConstraints](cap)
+	return &InMemoryConstraintStateStore{constraints: constraints}
+}
+
+func (s *InMemoryConstraintStateStore) SaveConstraints(slot uint64, constraints BatchedSignedConstraints) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, _ := s.constraints.Get(slot)
+	// Copy, so that the slice returned by LoadConstraints is never modified
+	updated := make(BatchedSignedConstraints, 0, len(stored)+len(constraints))
+	updated = append(updated, stored...)
+	s.constraints.Add(slot, append(updated, constraints...))
+	return nil
+}
+
+func (s *InMemoryConstraintStateStore) LoadConstraints(slot uint64) (BatchedSignedConstraints, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored, ok := s.constraints.Get(slot)
+	if !ok {
+		return BatchedSignedConstraints{}, nil
+	}
+	return stored, nil
+}
+
+func (s *InMemoryConstraintStateStore) DeleteConstraints(slot uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.constraints.Remove(slot)
+	return nil
+}
+
+// saveConstraintState stores the constraints accepted for submission, logging the errors of the state store
+func (m *BoostService) saveConstraintState(constraints BatchedSignedConstraints) {
+	bySlot := make(map[uint64]BatchedSignedConstraints)
+	for _, signedConstraints := range constraints {
+		slot := signedConstraints.Message.Slot
+		bySlot[slot] = append(bySlot[slot], signedConstraints)
+	}
+	for slot, slotConstraints := range bySlot {
+		if err := m.stateStore.SaveConstraints(slot, slotConstraints); err != nil {
+			m.log.WithError(err).WithField("slot", slot).Error("[BOLT]: error saving constraints to the state store")
+		}
+	}
+}
+
+// restoreConstraintState adds the constraints of the slot from the state store to the constraint cache,
+// for instance after a restart. It returns whether any constraint was restored.
+func (m *BoostService) restoreConstraintState(slot uint64) bool {
+	stored, err := m.stateStore.LoadConstraints(slot)
+	if err != nil {
+		m.log.WithError(err).WithField("slot", slot).Error("[BOLT]: error loading constraints from the state store")
+		return false
+	}
+	for _, signedConstraints := range stored {
+		if err := m.constraints.AddInclusionConstraints(slot, signedConstraints.Message.Constraints); err != nil {
+			m.log.WithError(err).WithField("slot", slot).Error("[BOLT]: error restoring constraints from the state store")
+			return false
+		}
+	}
+	return len(stored) > 0
+}
+
+// removeConstraintState removes the constraints of the given transactions from the ones stored for the slot
+func (m *BoostService) removeConstraintState(slot uint64, txHashes []phase0.Hash32) {
+	log := m.log.WithField("slot", slot)
+
+	stored, err := m.stateStore.LoadConstraints(slot)
+	if err != nil {
+		log.WithError(err).Error("[BOLT]: error loading constraints from the state store")
+		return
+	}
+	if len(stored) == 0 {
+		return
+	}
+
+	removed := make(map[phase0.Hash32]bool, len(txHashes))
+	for _, txHash := range txHashes {
+		removed[txHash] = true
+	}
+
+	remaining := make(BatchedSignedConstraints, 0, len(stored))
+	for _, signedConstraints := range stored {
+		kept := make([]*Constraint, 0, len(signedConstraints.Message.Constraints))
+		for _, constraint := range signedConstraints.Message.Constraints {
+			if txHash, err := constraint.TxHash(); err == nil && removed[txHash] {
+				continue
+			}
+			kept = append(kept, constraint)
+		}
+		if len(kept) == 0 {
+			continue
+		}
+		message := signedConstraints.Message
+		message.Constraints = kept
+		remaining = append(remaining, &SignedConstraints{Message: message, Signature: signedConstraints.Signature})
+	}
+
+	if err := m.stateStore.DeleteConstraints(slot); err != nil {
+		log.WithError(err).Error("[BOLT]: error deleting constraints from the state store")
+		return
+	}
+	if len(remaining) == 0 {
+		return
+	}
+	if err := m.stateStore.SaveConstraints(slot, remaining); err != nil {
+		log.WithError(err).Error("[BOLT]: error saving constraints to the state store")
+	}
+}
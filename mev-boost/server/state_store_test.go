@@ -0,0 +1,133 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/attestantio/go-eth2-client/spec/phase0"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/flashbots/go-boost-utils/bls"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInMemoryConstraintStateStore(t *testing.T) {
+	rawTx := _HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f")
+	signedConstraints := func(slot uint64, validatorIndex uint64) *SignedConstraints {
+		return &SignedConstraints{Message: ConstraintsMessage{
+			ValidatorIndex: validatorIndex,
+			Slot:           slot,
+			Constraints:    []*Constraint{{Transaction(rawTx), nil}},
+		}}
+	}
+
+	t.Run("Save and load", func(t *testing.T) {
+		store := NewInMemoryConstraintStateStore(64)
+		first := BatchedSignedConstraints{signedConstraints(10, 1)}
+		second := BatchedSignedConstraints{signedConstraints(10, 2)}
+		other := BatchedSignedConstraints{signedConstraints(11, 3)}
+		require.NoError(t, store.SaveConstraints(10, first))
+		require.NoError(t, store.SaveConstraints(10, second))
+		require.NoError(t, store.SaveConstraints(11, other))
+
+		// The constraints saved for a slot add up
+		loaded, err := store.LoadConstraints(10)
+		require.NoError(t, err)
+		require.Equal(t, BatchedSignedConstraints{first[0], second[0]}, loaded)
+
+		loaded, err = store.LoadConstraints(11)
+		require.NoError(t, err)
+		require.Equal(t, other, loaded)
+	})
+
+	t.Run("Load a slot without constraints", func(t *testing.T) {
+		store := NewInMemoryConstraintStateStore(64)
+		loaded, err := store.LoadConstraints(10)
+		require.NoError(t, err)
+		require.Empty(t, loaded)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		store := NewInMemoryConstraintStateStore(64)
+		require.NoError(t, store.SaveConstraints(10, BatchedSignedConstraints{signedConstraints(10, 1)}))
+		require.NoError(t, store.SaveConstraints(11, BatchedSignedConstraints{signedConstraints(11, 1)}))
+		require.NoError(t, store.DeleteConstraints(10))
+
+		loaded, err := store.LoadConstraints(10)
+		require.NoError(t, err)
+		require.Empty(t, loaded)
+		loaded, err = store.LoadConstraints(11)
+		require.NoError(t, err)
+		require.Len(t, loaded, 1)
+
+		// Deleting again is a no-op
+		require.NoError(t, store.DeleteConstraints(10))
+	})
+
+	t.Run("Evicts the least recently used slots", func(t *testing.T) {
+		store := NewInMemoryConstraintStateStore(2)
+		for slot := uint64(1); slot <= 3; slot++ {
+			require.NoError(t, store.SaveConstraints(slot, BatchedSignedConstraints{signedConstraints(slot, 1)}))
+		}
+
+		loaded, err := store.LoadConstraints(1)
+		require.NoError(t, err)
+		require.Empty(t, loaded)
+		loaded, err = store.LoadConstraints(3)
+		require.NoError(t, err)
+		require.Len(t, loaded, 1)
+	})
+}
+
+func TestWithStateStore(t *testing.T) {
+	cancelledTx := Transaction(_HexToBytes("0x02f871018304a5758085025ff11caf82565f94388c818ca8b9251b393131c08a736a67ccb1929787a41bb7ee22b41380c001a0c8630f734aba7acb4275a8f3b0ce831cf0c7c487fd49ee7bcca26ac622a28939a04c3745096fa0130a188fa249289fd9e60f9d6360854820dba22ae779ea6f573f"))
+	keptTx := Transaction(_HexToBytes("0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765"))
+	cancelledTxHash, err := (&Constraint{Tx: cancelledTx}).TxHash()
+	require.NoError(t, err)
+	keptTxHash, err := (&Constraint{Tx: keptTx}).TxHash()
+	require.NoError(t, err)
+	slot := uint64(10)
+
+	secretKey, publicKey, err := bls.GenerateNewKeypair()
+	require.NoError(t, err)
+	var proposerPublicKey phase0.BLSPubKey
+	copy(proposerPublicKey[:], bls.PublicKeyToBytes(publicKey))
+
+	store := NewInMemoryConstraintStateStore(64)
+	backend := newTestBackend(t, 1, time.Second, WithStateStore(store), WithConstraintSigningKey(secretKey))
+	backend.relays[0].SetProposerSigningDomain(phase0.Domain{}, proposerPublicKey)
+
+	payload := BatchedSignedConstraints{&SignedConstraints{
+		Message: ConstraintsMessage{
+			ValidatorIndex: 12345,
+			Slot:           slot,
+			Constraints:    []*Constraint{{cancelledTx, nil}, {keptTx, nil}},
+		},
+	}}
+	rr := backend.request(t, http.MethodPost, pathSubmitConstraint, payload)
+	require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+
+	// The submitted constraints are saved
+	stored, err := store.LoadConstraints(slot)
+	require.NoError(t, err)
+	require.Equal(t, payload, stored)
+
+	// Cancelled constraints are removed from the store too
+	err = backend.boost.CancelConstraints(context.Background(), phase0.Slot(slot), []phase0.Hash32{cancelledTxHash})
+	require.NoError(t, err)
+	stored, err = store.LoadConstraints(slot)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	require.Equal(t, []*Constraint{{keptTx, nil}}, stored[0].Message.Constraints)
+
+	// After a restart, the constraints are restored from the store when needed
+	restarted := newTestBackend(t, 1, time.Second, WithStateStore(store))
+	_, exists := restarted.boost.constraints.Get(slot)
+	require.False(t, exists)
+	require.True(t, restarted.boost.restoreConstraintState(slot))
+	restored, exists := restarted.boost.constraints.Get(slot)
+	require.True(t, exists)
+	require.Len(t, restored, 1)
+	require.Contains(t, restored, common.Hash(keptTxHash))
+}
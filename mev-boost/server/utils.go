@@ -3,18 +3,24 @@ package server
 import (
 	"bytes"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"math"
 	"math/big"
+	"mime"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	builderApi "github.com/attestantio/go-builder-client/api"
+	builderApiCapella "github.com/attestantio/go-builder-client/api/capella"
+	builderApiDeneb "github.com/attestantio/go-builder-client/api/deneb"
 	builderSpec "github.com/attestantio/go-builder-client/spec"
 	"github.com/attestantio/go-eth2-client/spec"
 	"github.com/attestantio/go-eth2-client/spec/phase0"
@@ -29,16 +35,51 @@ import (
 )
 
 const (
-	HeaderKeySlotUID = "X-MEVBoost-SlotID"
-	HeaderKeyVersion = "X-MEVBoost-Version"
+	HeaderKeySlotUID          = "X-MEVBoost-SlotID"
+	HeaderKeyVersion          = "X-MEVBoost-Version"
+	HeaderKeyBoltVersion      = "X-Bolt-Version"
+	HeaderEthConsensusVersion = "Eth-Consensus-Version"
+	HeaderWaitForBid          = "X-Wait-For-Bid"
+
+	MediaTypeJSON        = "application/json"
+	MediaTypeOctetStream = "application/octet-stream"
 )
 
 var (
-	errHTTPErrorResponse  = errors.New("HTTP error response")
-	errInvalidForkVersion = errors.New("invalid fork version")
-	errMaxRetriesExceeded = errors.New("max retries exceeded")
+	errHTTPErrorResponse   = errors.New("HTTP error response")
+	errInvalidForkVersion  = errors.New("invalid fork version")
+	errMaxRetriesExceeded  = errors.New("max retries exceeded")
+	errInvalidBlobsBundle  = errors.New("invalid blobs bundle")
+	errUnsupportedVersion  = errors.New("unsupported consensus version")
+	errTooManyTransactions = errors.New("too many transactions")
+	errInvalidGetHeaderURL = errors.New("invalid getHeader path")
+	errUnsupportedMedia    = errors.New("unsupported media type")
 )
 
+// maxWaitForBid caps the delay suggested by a relay with the X-Wait-For-Bid header, since the bid is still needed
+// within the getHeader timeout
+var maxWaitForBid = time.Second
+
+// MaxMultiProofTransactions is the maximum number of transactions of a payload for which CalculateMerkleMultiProofs
+// computes inclusion proofs. Proving against larger payloads is slow enough to be abused for DoS.
+var MaxMultiProofTransactions uint64 = 16_384
+
+// MultiError is a list of errors, reported together
+type MultiError []error
+
+func (e MultiError) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the errors of the list, for errors.Is and errors.As
+func (e MultiError) Unwrap() []error {
+	return e
+}
+
 // UserAgent is a custom string type to avoid confusing url + userAgent parameters in SendHTTPRequest
 type UserAgent string
 
@@ -106,6 +147,124 @@ func SendHTTPRequest(ctx context.Context, client http.Client, method, url string
 	return resp.StatusCode, nil
 }
 
+// SendGetHeaderRequest requests a bid from a relay. If sszPreferred is set, an SSZ-encoded response is requested,
+// which is smaller and faster to decode than JSON. JSON responses are decoded as well, for relays without SSZ support.
+// SSZ responses don't carry inclusion proofs, so the proofs of dst are left empty for them.
+//
+// If the relay answers with an X-Wait-For-Bid header, its bid is still being prepared: the request is sent again
+// once the suggested delay is over, and the second response is the one returned.
+func SendGetHeaderRequest(ctx context.Context, client http.Client, url string, userAgent UserAgent, headers map[string]string, sszPreferred bool, dst *BidWithInclusionProofs) (code int, err error) {
+	code, waitForBid, err := sendGetHeaderRequest(ctx, client, url, userAgent, headers, sszPreferred, dst)
+	if err != nil || waitForBid == 0 {
+		return code, err
+	}
+
+	timer := time.NewTimer(waitForBid)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return code, ctx.Err()
+	case <-timer.C:
+	}
+
+	*dst = BidWithInclusionProofs{}
+	code, _, err = sendGetHeaderRequest(ctx, client, url, userAgent, headers, sszPreferred, dst)
+	return code, err
+}
+
+// sendGetHeaderRequest sends a single getHeader request, and returns the delay suggested by the X-Wait-For-Bid
+// header of the response, if any
+func sendGetHeaderRequest(ctx context.Context, client http.Client, url string, userAgent UserAgent, headers map[string]string, sszPreferred bool, dst *BidWithInclusionProofs) (code int, waitForBid time.Duration, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("could not prepare request: %w", err)
+	}
+
+	// Set user agent header
+	req.Header.Set("User-Agent", strings.TrimSpace(fmt.Sprintf("mev-boost/%s %s", config.Version, userAgent)))
+	if sszPreferred {
+		req.Header.Set("Accept", fmt.Sprintf("%s;q=1.0,%s;q=0.9", MediaTypeOctetStream, MediaTypeJSON))
+	}
+
+	// Set other headers
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	// Execute request
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNoContent {
+		return resp.StatusCode, parseWaitForBid(resp.Header.Get(HeaderWaitForBid)), nil
+	}
+
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, 0, fmt.Errorf("could not read response body: %w", err)
+	}
+
+	if resp.StatusCode > 299 {
+		return resp.StatusCode, 0, fmt.Errorf("%w: %d / %s", errHTTPErrorResponse, resp.StatusCode, string(bodyBytes))
+	}
+
+	waitForBid = parseWaitForBid(resp.Header.Get(HeaderWaitForBid))
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err == nil && mediaType == MediaTypeOctetStream {
+		// An SSZ response only carries the bid, without inclusion proofs
+		dst.Bid = new(builderSpec.VersionedSignedBuilderBid)
+		if err := decodeSignedBuilderBidSSZ(resp.Header.Get(HeaderEthConsensusVersion), bodyBytes, dst.Bid); err != nil {
+			return resp.StatusCode, 0, fmt.Errorf("could not decode SSZ response: %w", err)
+		}
+		return resp.StatusCode, waitForBid, nil
+	}
+
+	if err := json.Unmarshal(bodyBytes, dst); err != nil {
+		return resp.StatusCode, 0, fmt.Errorf("could not unmarshal response %s: %w", string(bodyBytes), err)
+	}
+	return resp.StatusCode, waitForBid, nil
+}
+
+// parseWaitForBid parses the value of the X-Wait-For-Bid header, in milliseconds, capped to maxWaitForBid.
+// Missing, invalid and non-positive values mean no wait.
+func parseWaitForBid(value string) time.Duration {
+	ms, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || ms <= 0 {
+		return 0
+	}
+	wait := time.Duration(ms) * time.Millisecond
+	if wait > maxWaitForBid {
+		return maxWaitForBid
+	}
+	return wait
+}
+
+// decodeSignedBuilderBidSSZ decodes an SSZ-encoded signed builder bid of the given consensus version
+func decodeSignedBuilderBidSSZ(version string, data []byte, dst *builderSpec.VersionedSignedBuilderBid) error {
+	switch strings.ToLower(version) {
+	case spec.DataVersionCapella.String():
+		bid := new(builderApiCapella.SignedBuilderBid)
+		if err := bid.UnmarshalSSZ(data); err != nil {
+			return err
+		}
+		dst.Version = spec.DataVersionCapella
+		dst.Capella = bid
+	case spec.DataVersionDeneb.String():
+		bid := new(builderApiDeneb.SignedBuilderBid)
+		if err := bid.UnmarshalSSZ(data); err != nil {
+			return err
+		}
+		dst.Version = spec.DataVersionDeneb
+		dst.Deneb = bid
+	default:
+		return fmt.Errorf("%w: %q", errUnsupportedVersion, version)
+	}
+	return nil
+}
+
 // SendHTTPRequestWithRetries - prepare and send HTTP request, retrying the request if within the client timeout
 func SendHTTPRequestWithRetries(ctx context.Context, client http.Client, method, url string, userAgent UserAgent, headers map[string]string, payload, dst any, maxRetries int, log *log.Entry) (code int, err error) {
 	var requestCtx context.Context
@@ -157,6 +316,34 @@ func DecodeJSON(r io.Reader, dst any) error {
 	return decoder.Decode(dst)
 }
 
+// DecodeJSONRequest decodes the JSON body of the request into dst like DecodeJSON, after checking its content type.
+// A charset parameter is accepted if it is utf-8, so both "application/json" and "application/json; charset=utf-8"
+// are decoded, as well as requests without content type.
+func DecodeJSONRequest(req *http.Request, dst any) error {
+	if err := checkJSONContentType(req.Header.Get("Content-Type")); err != nil {
+		return err
+	}
+	return DecodeJSON(req.Body, dst)
+}
+
+// checkJSONContentType returns an error if the Content-Type header value is set and is not JSON
+func checkJSONContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errUnsupportedMedia, err)
+	}
+	if mediaType != MediaTypeJSON {
+		return fmt.Errorf("%w: %s", errUnsupportedMedia, mediaType)
+	}
+	if charset, ok := params["charset"]; ok && !strings.EqualFold(charset, "utf-8") {
+		return fmt.Errorf("%w: charset %s", errUnsupportedMedia, charset)
+	}
+	return nil
+}
+
 // GetURI returns the full request URI with scheme, host, path and args.
 func GetURI(url *url.URL, path string) string {
 	u2 := *url
@@ -165,12 +352,135 @@ func GetURI(url *url.URL, path string) string {
 	return u2.String()
 }
 
+// ParseGetHeaderPath decodes the slot, parent hash and proposer public key of a getHeader request path,
+// /eth/v1/builder/header/{slot}/{parent_hash}/{pubkey}
+func ParseGetHeaderPath(path string) (slot uint64, parentHash phase0.Hash32, pubkey phase0.BLSPubKey, err error) {
+	params, ok := strings.CutPrefix(path, "/eth/v1/builder/header/")
+	if !ok {
+		return 0, parentHash, pubkey, fmt.Errorf("%w: %s", errInvalidGetHeaderURL, path)
+	}
+	parts := strings.Split(params, "/")
+	if len(parts) != 3 {
+		return 0, parentHash, pubkey, fmt.Errorf("%w: %s", errInvalidGetHeaderURL, path)
+	}
+
+	slot, err = strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, parentHash, pubkey, fmt.Errorf("%w: %s", errInvalidSlot, parts[0])
+	}
+	parentHashBytes, err := hexutil.Decode(parts[1])
+	if err != nil || len(parentHashBytes) != len(parentHash) {
+		return 0, parentHash, pubkey, fmt.Errorf("%w: %s", errInvalidHash, parts[1])
+	}
+	pubkeyBytes, err := hexutil.Decode(parts[2])
+	if err != nil || len(pubkeyBytes) != len(pubkey) {
+		return 0, parentHash, pubkey, fmt.Errorf("%w: %s", errInvalidPubkey, parts[2])
+	}
+	return slot, phase0.Hash32(parentHashBytes), phase0.BLSPubKey(pubkeyBytes), nil
+}
+
+// relayLatencyEMAWeight is the weight of the latest sample in the relay latency moving average
+const relayLatencyEMAWeight = 0.2
+
+// relayLatencyTracker keeps an exponential moving average of the getHeader latency of each relay
+type relayLatencyTracker struct {
+	mu      sync.Mutex
+	latency map[string]time.Duration
+}
+
+func newRelayLatencyTracker() *relayLatencyTracker {
+	return &relayLatencyTracker{latency: make(map[string]time.Duration)}
+}
+
+// record adds a latency sample for the relay
+func (t *relayLatencyTracker) record(relay RelayEntry, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	key := relay.String()
+	previous, ok := t.latency[key]
+	if !ok {
+		t.latency[key] = latency
+		return
+	}
+	t.latency[key] = time.Duration(relayLatencyEMAWeight*float64(latency) + (1-relayLatencyEMAWeight)*float64(previous))
+}
+
+// get returns the average latency of the relay, and false if no sample was recorded yet
+func (t *relayLatencyTracker) get(relay RelayEntry) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	latency, ok := t.latency[relay.String()]
+	return latency, ok
+}
+
+// compare returns -1 if relay a is faster than relay b, 1 if it is slower, and 0 if they are equally fast
+// or the latency of either is unknown
+func (t *relayLatencyTracker) compare(a, b RelayEntry) int {
+	latencyA, okA := t.get(a)
+	latencyB, okB := t.get(b)
+	switch {
+	case !okA || !okB || latencyA == latencyB:
+		return 0
+	case latencyA < latencyB:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// BidStats are statistics of the bid values (in wei) received from a relay
+type BidStats struct {
+	Min   *uint256.Int
+	Max   *uint256.Int
+	Mean  *uint256.Int
+	Count *uint256.Int
+}
+
+// bidStatsAccumulator accumulates bid values to compute BidStats
+type bidStatsAccumulator struct {
+	min   *uint256.Int
+	max   *uint256.Int
+	sum   *uint256.Int
+	count uint64
+}
+
+func (a *bidStatsAccumulator) add(value *uint256.Int) {
+	if a.count == 0 {
+		a.min = value.Clone()
+		a.max = value.Clone()
+		a.sum = new(uint256.Int)
+	}
+	if value.Lt(a.min) {
+		a.min = value.Clone()
+	}
+	if value.Gt(a.max) {
+		a.max = value.Clone()
+	}
+	a.sum = new(uint256.Int).Add(a.sum, value)
+	a.count++
+}
+
+func (a *bidStatsAccumulator) stats() BidStats {
+	count := uint256.NewInt(a.count)
+	return BidStats{
+		Min:   a.min.Clone(),
+		Max:   a.max.Clone(),
+		Mean:  new(uint256.Int).Div(a.sum, count),
+		Count: count,
+	}
+}
+
 // bidResp are entries in the bids cache
 type bidResp struct {
 	t        time.Time
 	response builderSpec.VersionedSignedBuilderBid
 	bidInfo  bidInfo
 	relays   []RelayEntry
+	proofs   *InclusionProof // BOLT: inclusion proofs sent with the bid, if any
+
+	numBelowMinBidValue int     // bids skipped because of the WithMinBidValue option
+	relayErrors         []error // relays which failed or sent an invalid bid
 }
 
 // bidRespKey is used as key for the bids cache
@@ -193,6 +503,64 @@ func httpClientDisallowRedirects(_ *http.Request, _ []*http.Request) error {
 	return http.ErrUseLastResponse
 }
 
+// headerTransport is an http.RoundTripper setting the headers on every request before sending it with base,
+// or http.DefaultTransport if base is nil
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the request
+	req = req.Clone(req.Context())
+	for key, values := range t.headers {
+		req.Header.Del(key)
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return base.RoundTrip(req)
+}
+
+// interceptorTransport is an http.RoundTripper calling the request and response interceptors of the relay
+// around every request sent with base, or http.DefaultTransport if base is nil. Either interceptor may be nil.
+type interceptorTransport struct {
+	base       http.RoundTripper
+	relay      RelayEntry
+	onRequest  func(ctx context.Context, relay RelayEntry, method string) context.Context
+	onResponse func(ctx context.Context, relay RelayEntry, method string, statusCode int, elapsed time.Duration)
+	now        func() time.Time
+}
+
+func (t *interceptorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if t.onRequest != nil {
+		ctx = t.onRequest(ctx, t.relay, req.Method)
+		req = req.WithContext(ctx)
+	}
+
+	base := t.base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	start := t.now()
+	resp, err := base.RoundTrip(req)
+	if t.onResponse != nil {
+		// The status code is 0 if no response was received
+		statusCode := 0
+		if err == nil {
+			statusCode = resp.StatusCode
+		}
+		t.onResponse(ctx, t.relay, req.Method, statusCode, t.now().Sub(start))
+	}
+	return resp, err
+}
+
 func weiBigIntToEthBigFloat(wei *big.Int) (ethValue *big.Float) {
 	// wei / 10^18
 	fbalance := new(big.Float)
@@ -273,6 +641,14 @@ func getPayloadResponseIsEmpty(payload *builderApi.VersionedSubmitBlindedBlockRe
 	return false
 }
 
+// validateBlobsBundle checks that the blobs bundle holds exactly one KZG commitment and one KZG proof per blob
+func validateBlobsBundle(bundle *builderApiDeneb.BlobsBundle) error {
+	if len(bundle.Blobs) != len(bundle.Commitments) || len(bundle.Blobs) != len(bundle.Proofs) {
+		return fmt.Errorf("%w: %d blobs, %d commitments, %d proofs", errInvalidBlobsBundle, len(bundle.Blobs), len(bundle.Commitments), len(bundle.Proofs))
+	}
+	return nil
+}
+
 // EmitBoltDemoEvent sends a message to the web demo backend to log an event.
 // This is only used for demo purposes and should be removed in production.
 func EmitBoltDemoEvent(message string) {
@@ -306,17 +682,46 @@ func CalculateMerkleMultiProofs(rootNode *fastssz.Node, constraints []struct {
 	tx   Transaction
 	hash phase0.Hash32
 }) (inclusionProof *InclusionProof, err error) {
+	numTransactions, err := transactionsCount(rootNode)
+	if err != nil {
+		return nil, err
+	}
+	if numTransactions > MaxMultiProofTransactions {
+		return nil, fmt.Errorf("%w: %d, maximum is %d", errTooManyTransactions, numTransactions, MaxMultiProofTransactions)
+	}
+
 	// using our gen index formula: 2 * 2^21 + preconfIndex
 	baseGeneralizedIndex := int(math.Pow(float64(2), float64(21)))
-	generalizedIndexes := make([]int, len(constraints))
-	transactionHashes := make([]phase0.Hash32, len(constraints))
-	j := 0
 
-	for i, con := range constraints {
-		generalizedIndex := baseGeneralizedIndex + i
-		generalizedIndexes[i] = generalizedIndex
-		transactionHashes[j] = con.hash
-		j++
+	// Find the position of each constrained transaction in the block, by the hash tree root of the leaves.
+	// A transaction constrained several times is matched to as many occurrences in the block.
+	pending := make(map[[32]byte][]phase0.Hash32, len(constraints))
+	for _, con := range constraints {
+		txRoot, err := con.tx.HashTreeRoot()
+		if err != nil {
+			return nil, err
+		}
+		pending[txRoot] = append(pending[txRoot], con.hash)
+	}
+	generalizedIndexes := make([]int, 0, len(constraints))
+	transactionHashes := make([]phase0.Hash32, 0, len(constraints))
+	for i := 0; i < int(numTransactions) && len(generalizedIndexes) < len(constraints); i++ {
+		leaf, err := rootNode.Get(baseGeneralizedIndex + i)
+		if err != nil {
+			return nil, err
+		}
+		hashes := pending[[32]byte(leaf.Hash())]
+		if len(hashes) == 0 {
+			continue
+		}
+		generalizedIndexes = append(generalizedIndexes, baseGeneralizedIndex+i)
+		transactionHashes = append(transactionHashes, hashes[0])
+		pending[[32]byte(leaf.Hash())] = hashes[1:]
+	}
+	for _, hashes := range pending {
+		if len(hashes) > 0 {
+			return nil, fmt.Errorf("%w: transaction %s not in the block", errMissingConstraint, hashes[0])
+		}
 	}
 
 	log.Info(fmt.Sprintf("[BOLT]: Calculating merkle multiproof for %d preconfirmed transaction",
@@ -337,3 +742,154 @@ func CalculateMerkleMultiProofs(rootNode *fastssz.Node, constraints []struct {
 
 	return inclusionProof, nil
 }
+
+// CalculateMerkleMultiProofsParallel is CalculateMerkleMultiProofs with the work split across numWorkers goroutines:
+// each worker hashes a partition of the constraints, scans a partition of the transactions of the block, and hashes
+// a partition of the proof nodes. The resulting proof is the same as the serial one.
+//
+// The tree must have been hashed beforehand, as for CalculateMerkleMultiProofs.
+func CalculateMerkleMultiProofsParallel(rootNode *fastssz.Node, constraints []struct {
+	tx   Transaction
+	hash phase0.Hash32
+}, numWorkers int,
+) (*InclusionProof, error) {
+	if numWorkers <= 1 {
+		return CalculateMerkleMultiProofs(rootNode, constraints)
+	}
+
+	numTransactions, err := transactionsCount(rootNode)
+	if err != nil {
+		return nil, err
+	}
+	if numTransactions > MaxMultiProofTransactions {
+		return nil, fmt.Errorf("%w: %d, maximum is %d", errTooManyTransactions, numTransactions, MaxMultiProofTransactions)
+	}
+
+	baseGeneralizedIndex := int(math.Pow(float64(2), float64(21)))
+
+	txRoots := make([][32]byte, len(constraints))
+	err = runPartitioned(len(constraints), numWorkers, func(i int) (err error) {
+		txRoots[i], err = constraints[i].tx.HashTreeRoot()
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	pending := make(map[[32]byte][]phase0.Hash32, len(constraints))
+	for i, con := range constraints {
+		pending[txRoots[i]] = append(pending[txRoots[i]], con.hash)
+	}
+
+	// The subtrees of the transactions are disjoint, so the workers never hash the same nodes
+	leafRoots := make([][32]byte, numTransactions)
+	err = runPartitioned(int(numTransactions), numWorkers, func(i int) error {
+		leaf, err := rootNode.Get(baseGeneralizedIndex + i)
+		if err != nil {
+			return err
+		}
+		leafRoots[i] = [32]byte(leaf.Hash())
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Match the transactions in block order, to pick the same occurrences as the serial version
+	generalizedIndexes := make([]int, 0, len(constraints))
+	transactionHashes := make([]phase0.Hash32, 0, len(constraints))
+	for i, leafRoot := range leafRoots {
+		hashes := pending[leafRoot]
+		if len(hashes) == 0 {
+			continue
+		}
+		generalizedIndexes = append(generalizedIndexes, baseGeneralizedIndex+i)
+		transactionHashes = append(transactionHashes, hashes[0])
+		pending[leafRoot] = hashes[1:]
+	}
+	for _, hashes := range pending {
+		if len(hashes) > 0 {
+			return nil, fmt.Errorf("%w: transaction %s not in the block", errMissingConstraint, hashes[0])
+		}
+	}
+
+	log.Info(fmt.Sprintf("[BOLT]: Calculating merkle multiproof for %d preconfirmed transaction with %d workers",
+		len(constraints), numWorkers))
+
+	timeStart := time.Now()
+	requiredIndexes := requiredProofIndices(generalizedIndexes)
+	multiProof := &fastssz.Multiproof{
+		Indices: generalizedIndexes,
+		Leaves:  make([][]byte, len(generalizedIndexes)),
+		Hashes:  make([][]byte, len(requiredIndexes)),
+	}
+	err = runPartitioned(len(generalizedIndexes), numWorkers, func(i int) error {
+		leaf, err := rootNode.Get(generalizedIndexes[i])
+		if err != nil {
+			return err
+		}
+		multiProof.Leaves[i] = leaf.Hash()
+		return nil
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("[BOLT]: could not calculate merkle multiproof for %d preconf %s", len(constraints), err))
+		return nil, err
+	}
+	// None of the required nodes is in the subtree of another one, so they can be hashed concurrently too
+	err = runPartitioned(len(requiredIndexes), numWorkers, func(i int) error {
+		node, err := rootNode.Get(requiredIndexes[i])
+		if err != nil {
+			return err
+		}
+		multiProof.Hashes[i] = node.Hash()
+		return nil
+	})
+	if err != nil {
+		log.Error(fmt.Sprintf("[BOLT]: could not calculate merkle multiproof for %d preconf %s", len(constraints), err))
+		return nil, err
+	}
+
+	timeForProofs := time.Since(timeStart)
+	log.Info(fmt.Sprintf("[BOLT]: Calculated merkle multiproof for %d preconf in %s", len(constraints), timeForProofs))
+
+	inclusionProof := InclusionProofFromMultiProof(multiProof)
+	inclusionProof.TransactionHashes = transactionHashes
+
+	return inclusionProof, nil
+}
+
+// runPartitioned calls fn for every index in [0, n), split across numWorkers goroutines. Worker w handles the
+// indices w, w+numWorkers, ..., which spreads the expensive items evenly when they are grouped together.
+// The first error of a worker is returned, after all the workers are done.
+func runPartitioned(n, numWorkers int, fn func(i int) error) error {
+	errs := make([]error, numWorkers)
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers && w < n; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := w; i < n; i += numWorkers {
+				if err := fn(i); err != nil {
+					errs[w] = err
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// transactionsCount returns the length of the transactions list, read from the length mixed in at the root of its tree
+func transactionsCount(rootNode *fastssz.Node) (uint64, error) {
+	lengthNode, err := rootNode.Get(3)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(lengthNode.Hash()[:8]), nil
+}
@@ -10,6 +10,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	builderApi "github.com/attestantio/go-builder-client/api"
 	builderApiDeneb "github.com/attestantio/go-builder-client/api/deneb"
@@ -45,6 +46,39 @@ func TestDecodeJSON(t *testing.T) {
 	require.Equal(t, "json: unknown field \"c\"", err.Error())
 }
 
+func TestDecodeJSONRequest(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		expectedErr error
+	}{
+		{contentType: ""},
+		{contentType: "application/json"},
+		{contentType: "application/json; charset=utf-8"},
+		{contentType: "application/json; charset=UTF-8"},
+		{contentType: "application/json; charset=iso-8859-1", expectedErr: errUnsupportedMedia},
+		{contentType: "text/plain", expectedErr: errUnsupportedMedia},
+		{contentType: "application/json; charset", expectedErr: errUnsupportedMedia},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.contentType, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader([]byte(`{"a":1}`)))
+			req.Header.Set("Content-Type", tt.contentType)
+
+			var x struct {
+				A int `json:"a"`
+			}
+			err := DecodeJSONRequest(req, &x)
+			if tt.expectedErr != nil {
+				require.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, 1, x.A)
+		})
+	}
+}
+
 func TestSendHTTPRequestUserAgent(t *testing.T) {
 	done := make(chan bool, 1)
 
@@ -95,6 +129,144 @@ func TestSendHTTPRequestGzip(t *testing.T) {
 	require.Equal(t, "test-message", resp.Msg)
 }
 
+func TestSendGetHeaderRequestSSZ(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+
+	testCases := []struct {
+		name         string
+		version      spec.DataVersion
+		sszPreferred bool
+
+		expectedContentType string
+	}{
+		{
+			name:                "Capella SSZ",
+			version:             spec.DataVersionCapella,
+			sszPreferred:        true,
+			expectedContentType: MediaTypeOctetStream,
+		},
+		{
+			name:                "Capella JSON",
+			version:             spec.DataVersionCapella,
+			expectedContentType: MediaTypeJSON,
+		},
+		{
+			name:                "Deneb JSON",
+			version:             spec.DataVersionDeneb,
+			expectedContentType: MediaTypeJSON,
+		},
+	}
+
+	// Deneb SSZ isn't covered, because the SSZ encoding of Deneb bids panics in go-builder-client v0.4.2
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := newMockRelay(t)
+			relay.GetHeaderWithProofsResponse = relay.MakeGetHeaderWithProofsResponseWithTxsRoot(
+				12345, hash.String(), hash.String(), relay.RelayEntry.PublicKey.String(), tt.version, phase0.Root{0x01},
+			)
+			expected := relay.GetHeaderWithProofsResponse.Bid
+
+			// The relay answers with the expected encoding
+			req, err := http.NewRequest(http.MethodGet, getHeaderWithProofsPath(1, hash, relay.RelayEntry.PublicKey), nil)
+			require.NoError(t, err)
+			if tt.sszPreferred {
+				req.Header.Set("Accept", MediaTypeOctetStream)
+			}
+			rr := httptest.NewRecorder()
+			relay.getRouter().ServeHTTP(rr, req)
+			require.Equal(t, http.StatusOK, rr.Code)
+			require.Equal(t, tt.expectedContentType, rr.Header().Get("Content-Type"))
+
+			// The bid is decoded whatever the encoding
+			response := new(BidWithInclusionProofs)
+			url := relay.RelayEntry.GetURI(getHeaderWithProofsPath(1, hash, relay.RelayEntry.PublicKey))
+			code, err := SendGetHeaderRequest(context.Background(), *http.DefaultClient, url, "", nil, tt.sszPreferred, response)
+			require.NoError(t, err)
+			require.Equal(t, http.StatusOK, code)
+			require.Nil(t, response.Proofs)
+			bid := response.Bid
+			require.Equal(t, tt.version, bid.Version)
+			expectedRoot, err := expected.MessageHashTreeRoot()
+			require.NoError(t, err)
+			root, err := bid.MessageHashTreeRoot()
+			require.NoError(t, err)
+			require.Equal(t, expectedRoot, root)
+			expectedSignature, err := expected.Signature()
+			require.NoError(t, err)
+			signature, err := bid.Signature()
+			require.NoError(t, err)
+			require.Equal(t, expectedSignature, signature)
+		})
+	}
+
+	t.Run("Unsupported SSZ version", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", MediaTypeOctetStream)
+			w.Header().Set(HeaderEthConsensusVersion, spec.DataVersionBellatrix.String())
+			_, _ = w.Write([]byte{0x01})
+		}))
+		defer ts.Close()
+
+		_, err := SendGetHeaderRequest(context.Background(), *http.DefaultClient, ts.URL, "", nil, true, new(BidWithInclusionProofs))
+		require.ErrorIs(t, err, errUnsupportedVersion)
+	})
+}
+
+func TestParseWaitForBid(t *testing.T) {
+	testCases := []struct {
+		value    string
+		expected time.Duration
+	}{
+		{"", 0},
+		{"250", 250 * time.Millisecond},
+		{" 250 ", 250 * time.Millisecond},
+		{"0", 0},
+		{"-10", 0},
+		{"1.5", 0},
+		{"soon", 0},
+		{"60000", maxWaitForBid},
+	}
+
+	for _, tt := range testCases {
+		require.Equal(t, tt.expected, parseWaitForBid(tt.value), "value %q", tt.value)
+	}
+}
+
+func TestSendGetHeaderRequestWaitForBid(t *testing.T) {
+	hash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	relay := newMockRelay(t)
+	relay.WaitForBidMS = 50
+	path := getHeaderWithProofsPath(1, hash, relay.RelayEntry.PublicKey)
+	url := relay.RelayEntry.GetURI(path)
+
+	// The relay sets the header on its getHeader responses, with and without proofs
+	for _, p := range []string{getHeaderPath(1, hash, relay.RelayEntry.PublicKey), path} {
+		rr := httptest.NewRecorder()
+		relay.getRouter().ServeHTTP(rr, httptest.NewRequest(http.MethodGet, p, nil))
+		require.Equal(t, http.StatusOK, rr.Code, rr.Body.String())
+		require.Equal(t, "50", rr.Header().Get(HeaderWaitForBid))
+	}
+
+	t.Run("Request is sent again after the delay", func(t *testing.T) {
+		start := time.Now()
+		code, err := SendGetHeaderRequest(context.Background(), *http.DefaultClient, url, "", nil, false, new(BidWithInclusionProofs))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, code)
+		require.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+		// Counting the request served directly above
+		require.Equal(t, 3, relay.GetRequestCount(path))
+	})
+
+	t.Run("Context ends while waiting", func(t *testing.T) {
+		relay.WaitForBidMS = 1000
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		_, err := SendGetHeaderRequest(ctx, *http.DefaultClient, url, "", nil, false, new(BidWithInclusionProofs))
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+		require.Equal(t, 4, relay.GetRequestCount(path))
+	})
+}
+
 func TestWeiBigIntToEthBigFloat(t *testing.T) {
 	// test with valid input
 	i := big.NewInt(1)
@@ -106,6 +278,79 @@ func TestWeiBigIntToEthBigFloat(t *testing.T) {
 	require.Equal(t, "0.000000000000000000", f.Text('f', 18))
 }
 
+func TestParseGetHeaderPath(t *testing.T) {
+	parentHash := _HexToHash("0xe28385e7bd68df656cd0042b74b69c3104b5356ed1f20eb69f1f925df47a3ab7")
+	pubkey := _HexToPubkey(
+		"0x8a1d7b8dd64e0aafe7ea7b6c95065c9364cf99d38470c12ee807d55f7de1529ad29ce2c422e0b65e3d5a05c02caca249")
+
+	t.Run("Valid path", func(t *testing.T) {
+		slot, gotParentHash, gotPubkey, err := ParseGetHeaderPath(getHeaderPath(8978583, parentHash, pubkey))
+		require.NoError(t, err)
+		require.Equal(t, uint64(8978583), slot)
+		require.Equal(t, parentHash, gotParentHash)
+		require.Equal(t, pubkey, gotPubkey)
+	})
+
+	testCases := []struct {
+		name        string
+		path        string
+		expectedErr error
+	}{
+		{
+			name:        "Other endpoint",
+			path:        getHeaderWithProofsPath(1, parentHash, pubkey),
+			expectedErr: errInvalidGetHeaderURL,
+		},
+		{
+			name:        "Missing pubkey",
+			path:        fmt.Sprintf("/eth/v1/builder/header/1/%s", parentHash),
+			expectedErr: errInvalidGetHeaderURL,
+		},
+		{
+			name:        "Trailing slash",
+			path:        getHeaderPath(1, parentHash, pubkey) + "/",
+			expectedErr: errInvalidGetHeaderURL,
+		},
+		{
+			name:        "Negative slot",
+			path:        fmt.Sprintf("/eth/v1/builder/header/-1/%s/%s", parentHash, pubkey),
+			expectedErr: errInvalidSlot,
+		},
+		{
+			name:        "Slot overflowing uint64",
+			path:        fmt.Sprintf("/eth/v1/builder/header/18446744073709551616/%s/%s", parentHash, pubkey),
+			expectedErr: errInvalidSlot,
+		},
+		{
+			name:        "Parent hash without 0x prefix",
+			path:        fmt.Sprintf("/eth/v1/builder/header/1/%s/%s", parentHash.String()[2:], pubkey),
+			expectedErr: errInvalidHash,
+		},
+		{
+			name:        "Short parent hash",
+			path:        fmt.Sprintf("/eth/v1/builder/header/1/0x1234/%s", pubkey),
+			expectedErr: errInvalidHash,
+		},
+		{
+			name:        "Non-hex pubkey",
+			path:        fmt.Sprintf("/eth/v1/builder/header/1/%s/%szz", parentHash, pubkey.String()[:96]),
+			expectedErr: errInvalidPubkey,
+		},
+		{
+			name:        "Hash as pubkey",
+			path:        fmt.Sprintf("/eth/v1/builder/header/1/%s/%s", parentHash, parentHash),
+			expectedErr: errInvalidPubkey,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := ParseGetHeaderPath(tt.path)
+			require.ErrorIs(t, err, tt.expectedErr)
+		})
+	}
+}
+
 func TestGetPayloadResponseIsEmpty(t *testing.T) {
 	testCases := []struct {
 		name     string
@@ -215,6 +460,57 @@ func TestGetPayloadResponseIsEmpty(t *testing.T) {
 	}
 }
 
+func TestValidateBlobsBundle(t *testing.T) {
+	testCases := []struct {
+		name   string
+		bundle *builderApiDeneb.BlobsBundle
+
+		expectedErr error
+	}{
+		{
+			name:   "Empty bundle",
+			bundle: &builderApiDeneb.BlobsBundle{},
+		},
+		{
+			name: "Consistent bundle",
+			bundle: &builderApiDeneb.BlobsBundle{
+				Blobs:       make([]deneb.Blob, 2),
+				Commitments: make([]deneb.KZGCommitment, 2),
+				Proofs:      make([]deneb.KZGProof, 2),
+			},
+		},
+		{
+			name: "Missing commitment",
+			bundle: &builderApiDeneb.BlobsBundle{
+				Blobs:       make([]deneb.Blob, 2),
+				Commitments: make([]deneb.KZGCommitment, 1),
+				Proofs:      make([]deneb.KZGProof, 2),
+			},
+			expectedErr: errInvalidBlobsBundle,
+		},
+		{
+			name: "Missing proof",
+			bundle: &builderApiDeneb.BlobsBundle{
+				Blobs:       make([]deneb.Blob, 2),
+				Commitments: make([]deneb.KZGCommitment, 2),
+				Proofs:      make([]deneb.KZGProof, 1),
+			},
+			expectedErr: errInvalidBlobsBundle,
+		},
+	}
+
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateBlobsBundle(tt.bundle)
+			if tt.expectedErr == nil {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, tt.expectedErr)
+			}
+		})
+	}
+}
+
 func TestGenerateMerkleMultiProofs(t *testing.T) {
 	// https://etherscan.io/tx/0x138a5f8ba7950521d9dec66ee760b101e0c875039e695c9fcfb34f5ef02a881b
 	// 0x02f873011a8405f5e10085037fcc60e182520894f7eaaf75cb6ec4d0e2b53964ce6733f54f7d3ffc880b6139a7cbd2000080c080a095a7a3cbb7383fc3e7d217054f861b890a935adc1adf4f05e3a2f23688cf2416a00875cdc45f4395257e44d709d04990349b105c22c11034a60d7af749ffea2765